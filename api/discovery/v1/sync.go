@@ -7,6 +7,7 @@ type SyncRequest struct {
 	EndpointType       int   `json:"endpoint_type"`
 	APIVersion         int   `json:"api_version,omitempty"`
 	HeartbeatIntervalS int   `json:"heartbeat_interval_s,omitempty"`
+	DeliveryMode       int   `json:"delivery_mode,omitempty"`
 
 	Metadata map[string]string `json:"metadata,omitempty"`
 
@@ -16,9 +17,34 @@ type SyncRequest struct {
 	OS       string `json:"os"`
 	Arch     string `json:"arch"`
 	Platform string `json:"platform"`
+
+	// Pull mode only: every slot the agent runs, and the revision of the last desired state it received.
+	Applied         []AppliedTask `json:"applied,omitempty"`
+	DesiredRevision string        `json:"desired_revision,omitempty"`
+}
+
+// AppliedTask is one slot running on a pull-mode agent, with the control-plane version it applied
+// and the status of its latest task.
+type AppliedTask struct {
+	Slot    string `json:"slot"`
+	Version int    `json:"version"`
+	Status  string `json:"status,omitempty"`
 }
 
 // SyncResponse is returned to the agent after a successful sync.
+//
+// For a pull-mode agent it carries the revision of its desired state; Tasks and Remove are set
+// until the agent has that revision and reports it applied.
 type SyncResponse struct {
 	Success bool `json:"success"`
+
+	DesiredRevision string        `json:"desired_revision,omitempty"`
+	Tasks           []DesiredTask `json:"tasks,omitempty"`
+	Remove          []string      `json:"remove,omitempty"`
+}
+
+// DesiredTask is one task of the desired state, in the SubmitTask format.
+type DesiredTask struct {
+	Spec    map[string]any `json:"spec"`
+	Version int            `json:"version"`
 }
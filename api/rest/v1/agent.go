@@ -12,6 +12,7 @@ type Agent struct {
 	Endpoint     string `json:"endpoint"`
 	EndpointType string `json:"endpoint_type"`
 	APIVersion   string `json:"api_version"`
+	Delivery     string `json:"delivery"`
 	OS           string `json:"os"`
 	Arch         string `json:"arch"`
 	Platform     string `json:"platform"`
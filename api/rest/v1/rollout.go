@@ -3,18 +3,61 @@ package restv1
 // RolloutSpec embeds Spec with per-agent delivery state.
 type RolloutSpec struct {
 	Spec
-	Entries []RolloutEntry `json:"rollout,omitempty"`
+	Deployment *Deployment    `json:"deployment,omitempty"`
+	Entries    []RolloutEntry `json:"rollout,omitempty"`
+}
+
+// Deployment is the deploy of one spec version and its operator-controlled state.
+type Deployment struct {
+	SpecID    string `json:"spec_id"`
+	State     string `json:"state"`
+	Actor     string `json:"actor,omitempty"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+
+	Version int `json:"version"`
 }
 
 // RolloutEntry tracks the delivery state of a spec on a single agent.
 type RolloutEntry struct {
-	AgentID      string `json:"agent_id"`
-	Status       string `json:"status"`
-	LastPushedAt string `json:"last_pushed_at,omitempty"`
-	LastSyncedAt string `json:"last_synced_at,omitempty"`
-	Error        string `json:"error,omitempty"`
+	AgentID       string `json:"agent_id"`
+	Status        string `json:"status"`
+	LastPushedAt  string `json:"last_pushed_at,omitempty"`
+	LastSyncedAt  string `json:"last_synced_at,omitempty"`
+	NextAttemptAt string `json:"next_attempt_at,omitempty"`
+	Error         string `json:"error,omitempty"`
 
 	DesiredVersion int `json:"desired_version"`
 	ActualVersion  int `json:"actual_version"`
 	Attempts       int `json:"attempts,omitempty"`
+	Wave           int `json:"wave,omitempty"`
+}
+
+// DeployPlan is the outcome of a deploy dry run: what would happen to every rollout of the spec.
+//
+// Diffs lists the content changes from each version currently on a planned agent
+// (see DeployPlanEntry.CurrentVersion) to the version being deployed.
+type DeployPlan struct {
+	SpecID  string            `json:"spec_id"`
+	Entries []DeployPlanEntry `json:"rollout"`
+	Diffs   []DeployPlanDiff  `json:"diffs,omitempty"`
+
+	Version int `json:"version"`
+}
+
+// DeployPlanEntry is the planned action for one agent: create, update, unchanged or untargeted.
+type DeployPlanEntry struct {
+	AgentID string `json:"agent_id"`
+	Action  string `json:"action"`
+	Status  string `json:"status,omitempty"`
+
+	CurrentVersion int `json:"current_version"`
+	Wave           int `json:"wave,omitempty"`
+}
+
+// DeployPlanDiff is the content difference between a version running on agents and the deployed one.
+type DeployPlanDiff struct {
+	Changes []SpecChange `json:"changes"`
+
+	FromVersion int `json:"from_version"`
 }
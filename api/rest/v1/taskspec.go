@@ -7,6 +7,7 @@ type Spec struct {
 	RunnerLabels map[string]string `json:"runner_labels,omitempty"`
 	CreateSpec   map[string]any    `json:"create_spec,omitempty"`
 	Targets      []string          `json:"targets,omitempty"`
+	Strategy     *RolloutStrategy  `json:"strategy,omitempty"`
 
 	BackoffFactor float64 `json:"backoff_factor"`
 
@@ -40,6 +41,7 @@ type SpecCreateRequest struct {
 	TargetLabels map[string]string `json:"target_labels,omitempty"`
 	RunnerLabels map[string]string `json:"runner_labels,omitempty"`
 	Targets      []string          `json:"targets,omitempty"`
+	Strategy     *RolloutStrategy  `json:"strategy,omitempty"`
 
 	BackoffFactor float64 `json:"backoff_factor"`
 
@@ -55,3 +57,36 @@ type SpecCreateRequest struct {
 	Jitter      string `json:"jitter"`
 	Admission   string `json:"admission"`
 }
+
+// RolloutStrategy describes how a deploy is spread over the targets (absent: all at once).
+type RolloutStrategy struct {
+	PauseMs int64 `json:"pause_ms,omitempty"`
+
+	CanaryCount    int `json:"canary_count,omitempty"`
+	CanaryPercent  int `json:"canary_percent,omitempty"`
+	BatchSize      int `json:"batch_size,omitempty"`
+	MaxUnavailable int `json:"max_unavailable,omitempty"`
+}
+
+// SpecRevision is one recorded version of a spec.
+type SpecRevision struct {
+	Spec    Spec         `json:"spec"`
+	Changes []SpecChange `json:"changes,omitempty"`
+
+	Version int `json:"version"`
+
+	Author    string `json:"author,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// SpecChange is a content difference between a revision and the version before it.
+type SpecChange struct {
+	From  any    `json:"from,omitempty"`
+	To    any    `json:"to,omitempty"`
+	Field string `json:"field"`
+}
+
+// SpecRevisionListResponse is the revision history of a spec, newest first.
+type SpecRevisionListResponse struct {
+	Items []SpecRevision `json:"items"`
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog"
+
+	"github.com/soltiHQ/control-plane/internal/service/backup"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/codec"
+	"github.com/soltiHQ/control-plane/internal/storage/dirlock"
+)
+
+// runArchive implements the backup and restore subcommands:
+//
+//	lighthouse backup  -storage wal  -data-dir /var/lib/lighthouse     -file state.ndjson
+//	lighthouse restore -storage file -data-dir /var/lib/lighthouse-new -file state.ndjson
+//
+// Both open the data directory themselves and so run offline only: the directory is
+// locked while a server has it open, and they fail with dirlock.ErrLocked. A running
+// server is backed up with GET /api/v1/system/backup instead.
+//
+// Restore requires an empty store, so it targets a fresh data directory before the
+// server first starts on it (the server seeds built-in roles and users on start).
+// -file - (the default) streams through stdout / stdin.
+func runArchive(cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	var (
+		backend   = fs.String("storage", "", "storage backend: file or wal")
+		dataDir   = fs.String("data-dir", "", "data directory of the storage backend")
+		walRepair = fs.Bool("wal-repair", false, "cut a truncated or corrupt WAL tail instead of failing")
+		kekFile   = fs.String("kek-file", "", "key-encryption keys of the store (default: $"+envKEK+")")
+		file      = fs.String("file", "-", "archive path, - for stdout (backup) or stdin (restore)")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *backend != "file" && *backend != "wal" {
+		return fmt.Errorf("%s: -storage must be file or wal, got %q", cmd, *backend)
+	}
+
+	keys, err := loadKeyring(*kekFile)
+	if err != nil {
+		return err
+	}
+	recordCodec := codec.New(keys)
+
+	logger := zerolog.New(os.Stderr).With().Timestamp().Str("cmd", cmd).Logger()
+	store, err := openStorage(logger, *backend, *dataDir, *walRepair, recordCodec)
+	if errors.Is(err, dirlock.ErrLocked) {
+		return fmt.Errorf("%w (stop the server first, or back it up online with GET /api/v1/system/backup)", err)
+	}
+	if err != nil {
+		return err
+	}
+	if c, ok := store.(io.Closer); ok {
+		defer func() {
+			if err := c.Close(); err != nil {
+				logger.Error().Err(err).Msg("failed to close storage")
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var (
+		svc = backup.New(store, recordCodec)
+		m   *backup.Manifest
+	)
+	switch cmd {
+	case "backup":
+		m, err = writeArchive(*file, func(w io.Writer) (*backup.Manifest, error) { return svc.Export(ctx, w) })
+	case "restore":
+		m, err = readArchive(*file, func(r io.Reader) (*backup.Manifest, error) { return svc.Restore(ctx, r) })
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+	if errors.Is(err, storage.ErrAlreadyExists) {
+		return fmt.Errorf("%w (restore into an empty data directory)", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	ev := logger.Info().Uint64("revision", m.Revision).Time("created_at", m.CreatedAt)
+	for _, k := range storage.Kinds {
+		if n := m.Counts[k]; n > 0 {
+			ev = ev.Int(string(k), n)
+		}
+	}
+	ev.Msg(cmd + " completed")
+	return nil
+}
+
+// writeArchive runs export into path, replacing it only once the archive is complete.
+func writeArchive(path string, export func(io.Writer) (*backup.Manifest, error)) (*backup.Manifest, error) {
+	if path == "-" {
+		return export(os.Stdout)
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.Remove(tmp) }()
+
+	m, err := export(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// readArchive runs restore from path.
+func readArchive(path string, restore func(io.Reader) (*backup.Manifest, error)) (*backup.Manifest, error) {
+	if path == "-" {
+		return restore(os.Stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	return restore(f)
+}
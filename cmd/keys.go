@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog"
+
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/keyring"
+)
+
+// envKEK holds the key-encryption keys when no -kek-file is given.
+const envKEK = "LIGHTHOUSE_KEK"
+
+// loadKeyring returns the keyring from path, or from envKEK; nil disables encryption at rest.
+func loadKeyring(path string) (*keyring.Keyring, error) {
+	if path != "" {
+		return keyring.LoadFile(path)
+	}
+	if _, ok := os.LookupEnv(envKEK); ok {
+		return keyring.LoadEnv(envKEK)
+	}
+	return nil, nil
+}
+
+// rewrapper is implemented by backends that can re-seal their records (filestore, wal).
+type rewrapper interface {
+	Rewrap(ctx context.Context) error
+}
+
+// watchKeyring reloads keys on SIGHUP and re-wraps the store's records under the new active key.
+//
+// It returns when ctx is done.
+func watchKeyring(ctx context.Context, logger zerolog.Logger, keys *keyring.Keyring, store storage.Storage) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		if err := keys.Reload(); err != nil {
+			logger.Error().Err(err).Msg("keyring reload failed, keeping previous keys")
+			continue
+		}
+		logger.Info().Str("active_key", keys.ActiveID()).Msg("keyring reloaded")
+
+		rw, ok := store.(rewrapper)
+		if !ok {
+			continue
+		}
+		if err := rw.Rewrap(ctx); err != nil {
+			logger.Error().Err(err).Msg("rewrap failed")
+			continue
+		}
+		logger.Info().Str("active_key", keys.ActiveID()).Msg("records rewrapped")
+	}
+}
@@ -2,6 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,6 +14,7 @@ import (
 
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
 
 	genv1 "github.com/soltiHQ/control-plane/api/gen/v1"
 	"github.com/soltiHQ/control-plane/domain/kind"
@@ -19,17 +24,26 @@ import (
 	"github.com/soltiHQ/control-plane/internal/handler"
 	"github.com/soltiHQ/control-plane/internal/proxy"
 	"github.com/soltiHQ/control-plane/internal/server"
+	"github.com/soltiHQ/control-plane/internal/server/runner/drift"
 	"github.com/soltiHQ/control-plane/internal/server/runner/grpcserver"
 	"github.com/soltiHQ/control-plane/internal/server/runner/httpserver"
 	"github.com/soltiHQ/control-plane/internal/server/runner/lifecycle"
+	"github.com/soltiHQ/control-plane/internal/server/runner/reconcile"
 	syncrunner "github.com/soltiHQ/control-plane/internal/server/runner/sync"
+	"github.com/soltiHQ/control-plane/internal/server/runner/wave"
 	"github.com/soltiHQ/control-plane/internal/service/access"
 	"github.com/soltiHQ/control-plane/internal/service/agent"
+	"github.com/soltiHQ/control-plane/internal/service/backup"
 	"github.com/soltiHQ/control-plane/internal/service/credential"
+	"github.com/soltiHQ/control-plane/internal/service/delivery"
 	"github.com/soltiHQ/control-plane/internal/service/session"
 	"github.com/soltiHQ/control-plane/internal/service/spec"
 	"github.com/soltiHQ/control-plane/internal/service/user"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/codec"
+	"github.com/soltiHQ/control-plane/internal/storage/filestore"
 	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+	"github.com/soltiHQ/control-plane/internal/storage/wal"
 	"github.com/soltiHQ/control-plane/internal/transport/grpc/interceptor"
 	"github.com/soltiHQ/control-plane/internal/transport/http/middleware"
 	"github.com/soltiHQ/control-plane/internal/transport/http/responder"
@@ -37,13 +51,45 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "backup" || os.Args[1] == "restore") {
+		if err := runArchive(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var (
-		logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
-		store  = inmemory.New()
+		backend   = flag.String("storage", "memory", "storage backend: memory, file or wal")
+		dataDir   = flag.String("data-dir", "", "data directory of the file and wal backends")
+		walRepair = flag.Bool("wal-repair", false, "cut a truncated or corrupt WAL tail instead of refusing to start")
+		kekFile   = flag.String("kek-file", "", "key-encryption keys sealing persisted secrets (default: $"+envKEK+", unset disables encryption)")
+		bundles   = flag.Bool("sync-bundles", false, "push each agent its desired task set as one bundle (agents without the bundle API get one push per rollout)")
 	)
+	flag.Parse()
+
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+	keys, err := loadKeyring(*kekFile)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to load keyring")
+	}
+	recordCodec := codec.New(keys)
+
+	store, err := openStorage(logger, *backend, *dataDir, *walRepair, recordCodec)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to open storage")
+	}
+	if c, ok := store.(io.Closer); ok {
+		defer func() {
+			if err := c.Close(); err != nil {
+				logger.Error().Err(err).Msg("failed to close storage")
+			}
+		}()
+	}
 
 	// Bootstrap admin user
-	if err := bootstrap(context.Background(), store); err != nil {
+	if err = bootstrap(context.Background(), store); err != nil {
 		logger.Fatal().Err(err).Msg("failed to bootstrap")
 	}
 	///
@@ -67,6 +113,8 @@ func main() {
 		credentialSVC = credential.New(store, logger)
 		agentSVC      = agent.New(store)
 		specSVC       = spec.New(store)
+		deliverySVC   = delivery.New(store)
+		backupSVC     = backup.New(store, recordCodec)
 	)
 
 	proxyPool := proxy.NewPool()
@@ -77,18 +125,33 @@ func main() {
 		logger.Fatal().Err(err).Msg("failed to create lifecycle runner")
 	}
 
-	syncRunner, err := syncrunner.New(syncrunner.Config{}, logger, store, proxyPool)
+	syncRunner, err := syncrunner.New(syncrunner.Config{Bundles: *bundles}, logger, store, proxyPool)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to create sync runner")
 	}
 
+	driftRunner, err := drift.New(drift.Config{}, logger, store, proxyPool)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to create drift runner")
+	}
+
+	reconcileRunner, err := reconcile.New(reconcile.Config{}, logger, store)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to create reconcile runner")
+	}
+
+	waveRunner, err := wave.New(wave.Config{}, logger, store, proxyPool)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to create wave runner")
+	}
+
 	var (
 		jsonResp = responder.NewJSON()
 		htmlResp = responder.NewHTML()
 	)
 	var (
 		uiHandler     = handler.NewUI(logger, authSVC)
-		apiHandler    = handler.NewAPI(logger, userSVC, authSVC, sessionSVC, credentialSVC, agentSVC, specSVC, proxyPool)
+		apiHandler    = handler.NewAPI(logger, userSVC, authSVC, sessionSVC, credentialSVC, agentSVC, specSVC, backupSVC, proxyPool)
 		staticHandler = handler.NewStatic(logger)
 	)
 	authMW := middleware.Auth(authModel.Verifier, authModel.Session)
@@ -129,7 +192,7 @@ func main() {
 	// ---------------------------------------------------------------
 	// HTTP Discovery :8082
 	// ---------------------------------------------------------------
-	httpDiscovery := handler.NewHTTPDiscovery(logger, agentSVC)
+	httpDiscovery := handler.NewHTTPDiscovery(logger, agentSVC, deliverySVC)
 
 	discMux := http.NewServeMux()
 	discMux.HandleFunc("/api/v1/discovery/sync", httpDiscovery.Sync)
@@ -149,12 +212,25 @@ func main() {
 	// ---------------------------------------------------------------
 	// gRPC Discovery :50051
 	// ---------------------------------------------------------------
-	grpcDiscovery := handler.NewGRPCDiscovery(logger, agentSVC)
+	grpcDiscovery := handler.NewGRPCDiscovery(logger, agentSVC, deliverySVC, proxyPool.Streams())
 
 	grpcSrv := grpc.NewServer(
 		grpc.ChainUnaryInterceptor(
 			interceptor.UnaryRecovery(logger),
 		),
+		grpc.ChainStreamInterceptor(
+			interceptor.StreamRecovery(logger),
+		),
+		// Ping idle connections and drop those that do not answer, so the Connect stream
+		// of an agent that went away without closing it is reaped.
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    30 * time.Second,
+			Timeout: 10 * time.Second,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             10 * time.Second,
+			PermitWithoutStream: true,
+		}),
 	)
 	genv1.RegisterDiscoverServiceServer(grpcSrv, grpcDiscovery)
 
@@ -168,9 +244,9 @@ func main() {
 	}
 
 	// ---------------------------------------------------------------
-	// Server (5 runners)
+	// Server (8 runners)
 	// ---------------------------------------------------------------
-	srv, err := server.New(server.Config{}, logger, httpRunner, httpDiscoveryRunner, grpcRunner, lifecycleRunner, syncRunner)
+	srv, err := server.New(server.Config{}, logger, httpRunner, httpDiscoveryRunner, grpcRunner, lifecycleRunner, syncRunner, driftRunner, reconcileRunner, waveRunner)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to create server")
 	}
@@ -179,6 +255,11 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	if keys != nil {
+		logger.Info().Str("active_key", keys.ActiveID()).Msg("encryption at rest enabled")
+		go watchKeyring(ctx, logger, keys, store)
+	}
+
 	if err = srv.Run(ctx); err != nil {
 		logger.Error().Err(err).Msg("server exited")
 		os.Exit(1)
@@ -186,7 +267,62 @@ func main() {
 	logger.Info().Msg("server stopped")
 }
 
-func bootstrap(ctx context.Context, store *inmemory.Store) error {
+// openStorage opens the selected storage backend; c encodes the records of persistent backends.
+func openStorage(logger zerolog.Logger, backend, dataDir string, walRepair bool, c *codec.Codec) (storage.Storage, error) {
+	switch backend {
+	case "memory":
+		return inmemory.New(), nil
+	case "file":
+		return filestore.Open(dataDir, filestore.WithCodec(c))
+	case "wal":
+		s, err := wal.Open(dataDir, wal.Config{RepairTail: walRepair, Codec: c})
+		if err != nil {
+			return nil, err
+		}
+		rec := s.Recovery()
+		if rec.TailErr != nil {
+			logger.Warn().Err(rec.TailErr).Int64("truncated_bytes", rec.TruncatedBytes).Msg("wal tail repaired")
+		}
+		logger.Info().
+			Uint64("snapshot_seq", rec.SnapshotSeq).
+			Int("replayed", rec.Replayed).
+			Uint64("last_seq", rec.LastSeq).
+			Msg("wal recovered")
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// upgradeAdmin grants the admin role the permissions of the seed versions it has not seen yet.
+// Roles seeded before versions were recorded count as seeded with the first version.
+func upgradeAdmin(ctx context.Context, store storage.Storage, admin *model.Role) error {
+	if admin.Seed() >= len(kind.AdminSeeds) {
+		return nil
+	}
+	for _, perms := range kind.AdminSeeds[max(admin.Seed(), 1):] {
+		for _, p := range perms {
+			if err := admin.PermissionAdd(p); err != nil {
+				return err
+			}
+		}
+	}
+	admin.SetSeed(len(kind.AdminSeeds))
+	return store.UpsertRole(ctx, admin)
+}
+
+func bootstrap(ctx context.Context, store storage.Storage) error {
+	// A persisted store is seeded once; later restarts must not reset edited roles or passwords.
+	// The admin role only gains the permissions of seed versions newer than the one it was seeded
+	// with, so a permission removed from it stays removed.
+	admin, err := store.GetRole(ctx, "role-admin")
+	if err == nil {
+		return upgradeAdmin(ctx, store, admin)
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
 	// ---------------------------------------------------
 	// ROLES
 	// ---------------------------------------------------
@@ -196,11 +332,14 @@ func bootstrap(ctx context.Context, store *inmemory.Store) error {
 	if err != nil {
 		return err
 	}
-	for _, p := range kind.All {
-		if err := adminRole.PermissionAdd(p); err != nil {
-			return err
+	for _, seed := range kind.AdminSeeds {
+		for _, p := range seed {
+			if err := adminRole.PermissionAdd(p); err != nil {
+				return err
+			}
 		}
 	}
+	adminRole.SetSeed(len(kind.AdminSeeds))
 	if err := store.UpsertRole(ctx, adminRole); err != nil {
 		return err
 	}
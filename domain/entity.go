@@ -8,6 +8,7 @@ import "time"
 //   - Stable, unique ID for a lifetime of the entity.
 //   - Clone() returns a deep copy (no shared references).
 //   - UpdatedAt() changes on every state mutation.
+//   - Clone() preserves the resource version.
 type Entity[T any] interface {
 	// ID returns the unique identifier for this entity.
 	// Must be non-empty for stored entities.
@@ -16,4 +17,10 @@ type Entity[T any] interface {
 	Clone() T
 	// UpdatedAt returns the last modification timestamp.
 	UpdatedAt() time.Time
+	// ResourceVersion returns the storage revision of the last write.
+	// Zero means the entity has not been stored yet.
+	ResourceVersion() uint64
+	// SetResourceVersion sets the storage revision.
+	// Storage calls it on every write; callers use it to make an upsert conditional.
+	SetResourceVersion(v uint64)
 }
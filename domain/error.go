@@ -15,4 +15,8 @@ var (
 	ErrEmptyName = errors.New("name cannot be empty")
 	// ErrEmptyID indicates that entity ID is empty.
 	ErrEmptyID = errors.New("id cannot be empty")
+	// ErrInvalidStrategy indicates that a rollout strategy has out-of-range values.
+	ErrInvalidStrategy = errors.New("invalid rollout strategy")
+	// ErrInvalidFields indicates that an entity has invalid fields; see FieldErrors.
+	ErrInvalidFields = errors.New("invalid fields")
 )
@@ -0,0 +1,31 @@
+package kind
+
+import "errors"
+
+// ErrUnknownDeliveryMode indicates an unrecognised delivery mode value.
+var ErrUnknownDeliveryMode = errors.New("unknown delivery mode")
+
+// DeliveryMode describes how specs reach an agent.
+type DeliveryMode string
+
+const (
+	// DeliveryPush — the control plane dials the agent endpoint (sync, drift and wave runners).
+	DeliveryPush DeliveryMode = "push"
+	// DeliveryPull — the agent cannot be dialed; it receives its desired state in discovery
+	// sync responses and reports what it applied on the next sync.
+	DeliveryPull DeliveryMode = "pull"
+)
+
+// DeliveryModeFromInt maps the proto/JSON integer enum to DeliveryMode.
+//
+//	0 → push, 1 → pull.
+func DeliveryModeFromInt(v int) (DeliveryMode, error) {
+	switch v {
+	case 0:
+		return DeliveryPush, nil
+	case 1:
+		return DeliveryPull, nil
+	default:
+		return "", ErrUnknownDeliveryMode
+	}
+}
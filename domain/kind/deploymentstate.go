@@ -0,0 +1,24 @@
+package kind
+
+// DeploymentState describes the operator-controlled state of a spec deployment.
+type DeploymentState uint8
+
+const (
+	DeploymentActive  DeploymentState = iota // rollouts are pushed and waves released
+	DeploymentPaused                         // pushes and wave releases are suspended until resumed
+	DeploymentAborted                        // stopped for good; only a new deploy supersedes it
+)
+
+// String returns the human-readable deployment state label.
+func (s DeploymentState) String() string {
+	switch s {
+	case DeploymentActive:
+		return "active"
+	case DeploymentPaused:
+		return "paused"
+	case DeploymentAborted:
+		return "aborted"
+	default:
+		return "unknown"
+	}
+}
@@ -16,6 +16,8 @@ const (
 	SpecsAdd    Permission = "taskspecs:add"
 	SpecsEdit   Permission = "taskspecs:edit"
 	SpecsDeploy Permission = "taskspecs:deploy"
+
+	SystemBackup Permission = "system:backup"
 )
 
 // All contains all declared permissions.
@@ -30,4 +32,13 @@ var All = []Permission{
 	SpecsAdd,
 	SpecsEdit,
 	SpecsDeploy,
+	SystemBackup,
+}
+
+// AdminSeeds lists the permissions granted to the built-in admin role, grouped by the seed
+// version that introduced them: a store seeded at version n has been granted AdminSeeds[:n].
+// A new permission goes into a new version, so stores seeded earlier gain it once, on upgrade.
+var AdminSeeds = [][]Permission{
+	{AgentsGet, AgentsEdit, UsersGet, UsersAdd, UsersEdit, UsersDelete, SpecsGet, SpecsAdd, SpecsEdit, SpecsDeploy},
+	{SystemBackup},
 }
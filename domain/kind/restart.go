@@ -8,3 +8,13 @@ const (
 	RestartOnFailure RestartType = "onFailure"
 	RestartAlways    RestartType = "always"
 )
+
+// Valid reports whether r is a known restart type.
+func (r RestartType) Valid() bool {
+	switch r {
+	case RestartNever, RestartOnFailure, RestartAlways:
+		return true
+	default:
+		return false
+	}
+}
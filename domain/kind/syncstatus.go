@@ -4,11 +4,17 @@ package kind
 type SyncStatus uint8
 
 const (
-	SyncStatusPending SyncStatus = iota // created/updated, not yet pushed
-	SyncStatusSynced                    // desiredVersion == actualVersion
-	SyncStatusDrift                     // export shows mismatch
-	SyncStatusFailed                    // push error
-	SyncStatusUnknown                   // agent unreachable
+	SyncStatusPending   SyncStatus = iota // created/updated, not yet pushed
+	SyncStatusSynced                      // desiredVersion == actualVersion
+	SyncStatusDrift                       // export shows mismatch
+	SyncStatusFailed                      // push error
+	SyncStatusUnknown                     // agent unreachable
+	SyncStatusOrphaned                    // agent no longer targeted by the spec
+	SyncStatusWaiting                     // held back until its wave of a progressive deploy is released
+	SyncStatusHalted                      // progressive deploy halted before reaching this agent
+	SyncStatusRemoving                    // undeployed, the task is being removed from the agent
+	SyncStatusRemoved                     // undeployed, the agent no longer runs the task
+	SyncStatusExhausted                   // every retry failed; left alone until retried or redeployed
 )
 
 // String returns the human-readable sync status label.
@@ -24,6 +30,18 @@ func (s SyncStatus) String() string {
 		return "failed"
 	case SyncStatusUnknown:
 		return "unknown"
+	case SyncStatusOrphaned:
+		return "orphaned"
+	case SyncStatusWaiting:
+		return "waiting"
+	case SyncStatusHalted:
+		return "halted"
+	case SyncStatusRemoving:
+		return "removing"
+	case SyncStatusRemoved:
+		return "removed"
+	case SyncStatusExhausted:
+		return "exhausted"
 	default:
 		return "unknown"
 	}
@@ -8,3 +8,13 @@ const (
 	TaskKindWasm       TaskKindType = "wasm"
 	TaskKindContainer  TaskKindType = "container"
 )
+
+// Valid reports whether t is a known task kind.
+func (t TaskKindType) Valid() bool {
+	switch t {
+	case TaskKindSubprocess, TaskKindWasm, TaskKindContainer:
+		return true
+	default:
+		return false
+	}
+}
@@ -28,6 +28,7 @@ type Agent struct {
 	endpoint     string
 	endpointType kind.EndpointType
 	apiVersion   kind.APIVersion
+	delivery     kind.DeliveryMode
 	os           string
 	arch         string
 	platform     string
@@ -37,6 +38,8 @@ type Agent struct {
 	status            kind.AgentStatus
 	lastSeenAt        time.Time
 	heartbeatInterval time.Duration
+
+	resourceVersion uint64 // assigned by storage on every write
 }
 
 // NewAgent creates a new agent domain entity.
@@ -53,6 +56,7 @@ func NewAgent(id, name, endpoint string) (*Agent, error) {
 		id:       id,
 		name:     name,
 		endpoint: endpoint,
+		delivery: kind.DeliveryPush,
 
 		metadata: make(map[string]string),
 		labels:   make(map[string]string),
@@ -70,6 +74,7 @@ type AgentParams struct {
 
 	EndpointType int
 	APIVersion   int
+	DeliveryMode int
 
 	OS       string
 	Arch     string
@@ -93,6 +98,10 @@ func NewAgentFrom(p AgentParams) (*Agent, error) {
 	if err != nil {
 		return nil, err
 	}
+	delivery, err := kind.DeliveryModeFromInt(p.DeliveryMode)
+	if err != nil {
+		return nil, err
+	}
 
 	now := time.Now()
 	md := make(map[string]string, len(p.Metadata))
@@ -112,6 +121,7 @@ func NewAgentFrom(p AgentParams) (*Agent, error) {
 		endpoint:     p.Endpoint,
 		endpointType: epType,
 		apiVersion:   kind.APIVersionFromInt(p.APIVersion),
+		delivery:     delivery,
 		os:           p.OS,
 		arch:         p.Arch,
 		platform:     p.Platform,
@@ -139,6 +149,9 @@ func (a *Agent) EndpointType() kind.EndpointType { return a.endpointType }
 // APIVersion returns the agent's API version.
 func (a *Agent) APIVersion() kind.APIVersion { return a.apiVersion }
 
+// Delivery returns how specs reach the agent.
+func (a *Agent) Delivery() kind.DeliveryMode { return a.delivery }
+
 // UptimeSeconds returns the agent-reported uptime in seconds.
 func (a *Agent) UptimeSeconds() int64 { return a.uptimeSeconds }
 
@@ -178,6 +191,12 @@ func (a *Agent) SetCreatedAt(t time.Time) { a.createdAt = t }
 // UpdatedAt returns the last modification timestamp.
 func (a *Agent) UpdatedAt() time.Time { return a.updatedAt }
 
+// ResourceVersion returns the storage revision of the last write (0 if never stored).
+func (a *Agent) ResourceVersion() uint64 { return a.resourceVersion }
+
+// SetResourceVersion sets the storage revision; a non-zero value makes the next upsert conditional.
+func (a *Agent) SetResourceVersion(rv uint64) { a.resourceVersion = rv }
+
 // Metadata returns the metadata value for the given key.
 func (a *Agent) Metadata(key string) (string, bool) {
 	v, ok := a.metadata[key]
@@ -245,6 +264,7 @@ func (a *Agent) Clone() *Agent {
 		endpoint:     a.endpoint,
 		endpointType: a.endpointType,
 		apiVersion:   a.apiVersion,
+		delivery:     a.delivery,
 		os:           a.os,
 		arch:         a.arch,
 		platform:     a.platform,
@@ -254,5 +274,7 @@ func (a *Agent) Clone() *Agent {
 		status:            a.status,
 		lastSeenAt:        a.lastSeenAt,
 		heartbeatInterval: a.heartbeatInterval,
+
+		resourceVersion: a.resourceVersion,
 	}
 }
@@ -20,6 +20,8 @@ type Credential struct {
 
 	secrets map[string]string
 	auth    kind.Auth
+
+	resourceVersion uint64 // assigned by storage on every write
 }
 
 // NewCredential creates a new credential domain model.
@@ -57,6 +59,12 @@ func (c *Credential) CreatedAt() time.Time { return c.createdAt }
 // UpdatedAt returns the timestamp of the last modification to the credential.
 func (c *Credential) UpdatedAt() time.Time { return c.updatedAt }
 
+// ResourceVersion returns the storage revision of the last write (0 if never stored).
+func (c *Credential) ResourceVersion() uint64 { return c.resourceVersion }
+
+// SetResourceVersion sets the storage revision; a non-zero value makes the next upsert conditional.
+func (c *Credential) SetResourceVersion(rv uint64) { c.resourceVersion = rv }
+
 // Secret returns a secret value by key.
 func (c *Credential) Secret(key string) (string, bool) {
 	v, ok := c.secrets[key]
@@ -117,5 +125,7 @@ func (c *Credential) Clone() *Credential {
 		userID:    c.userID,
 		auth:      c.auth,
 		secrets:   secrets,
+
+		resourceVersion: c.resourceVersion,
 	}
 }
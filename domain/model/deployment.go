@@ -0,0 +1,132 @@
+package model
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain"
+	"github.com/soltiHQ/control-plane/domain/kind"
+)
+
+var _ domain.Entity[*Deployment] = (*Deployment)(nil)
+
+// Deployment tracks the deploy of one Spec version.
+//
+// It is created (or reset) by every deploy of the version and carries the operator
+// controls: while paused or aborted the sync runner does not push the version's
+// rollouts and the wave runner does not release waves.
+type Deployment struct {
+	createdAt time.Time
+	updatedAt time.Time
+
+	id     string
+	specID string
+	actor  string // subject of the last deploy or state change
+
+	version int
+	state   kind.DeploymentState
+
+	resourceVersion uint64 // assigned by storage on every write
+}
+
+// DeploymentID returns the deterministic identifier of the deploy of a spec version.
+func DeploymentID(specID string, version int) string {
+	return "dep-" + specID + "-" + strconv.Itoa(version)
+}
+
+// NewDeployment creates an active deployment of a spec version.
+func NewDeployment(specID string, version int, actor string) (*Deployment, error) {
+	if specID == "" {
+		return nil, domain.ErrEmptyID
+	}
+	now := time.Now()
+	return &Deployment{
+		createdAt: now,
+		updatedAt: now,
+
+		id:     DeploymentID(specID, version),
+		specID: specID,
+		actor:  actor,
+
+		version: version,
+		state:   kind.DeploymentActive,
+	}, nil
+}
+
+// ID returns the deployment's unique identifier.
+func (d *Deployment) ID() string { return d.id }
+
+// SpecID returns the ID of the deployed spec.
+func (d *Deployment) SpecID() string { return d.specID }
+
+// Version returns the deployed spec version.
+func (d *Deployment) Version() int { return d.version }
+
+// State returns the current deployment state.
+func (d *Deployment) State() kind.DeploymentState { return d.state }
+
+// Actor returns the subject of the last deploy or state change (empty for system changes).
+func (d *Deployment) Actor() string { return d.actor }
+
+// CreatedAt returns the creation timestamp.
+func (d *Deployment) CreatedAt() time.Time { return d.createdAt }
+
+// UpdatedAt returns the last modification timestamp.
+func (d *Deployment) UpdatedAt() time.Time { return d.updatedAt }
+
+// ResourceVersion returns the storage revision of the last write (0 if never stored).
+func (d *Deployment) ResourceVersion() uint64 { return d.resourceVersion }
+
+// SetResourceVersion sets the storage revision; a non-zero value makes the next upsert conditional.
+func (d *Deployment) SetResourceVersion(rv uint64) { d.resourceVersion = rv }
+
+// Active reports whether rollouts of the deployment may be pushed.
+func (d *Deployment) Active() bool { return d.state == kind.DeploymentActive }
+
+// Restart makes the deployment active again for a new deploy of the same version.
+func (d *Deployment) Restart(actor string) { d.set(kind.DeploymentActive, actor) }
+
+// Pause suspends an active deployment.
+//
+// Returns false (and changes nothing) unless the deployment is active.
+func (d *Deployment) Pause(actor string) bool {
+	if d.state != kind.DeploymentActive {
+		return false
+	}
+	d.set(kind.DeploymentPaused, actor)
+	return true
+}
+
+// Resume reactivates a paused deployment.
+//
+// Returns false (and changes nothing) unless the deployment is paused.
+func (d *Deployment) Resume(actor string) bool {
+	if d.state != kind.DeploymentPaused {
+		return false
+	}
+	d.set(kind.DeploymentActive, actor)
+	return true
+}
+
+// Abort stops an active or paused deployment for good.
+//
+// Returns false (and changes nothing) if the deployment is already aborted.
+func (d *Deployment) Abort(actor string) bool {
+	if d.state == kind.DeploymentAborted {
+		return false
+	}
+	d.set(kind.DeploymentAborted, actor)
+	return true
+}
+
+func (d *Deployment) set(state kind.DeploymentState, actor string) {
+	d.state = state
+	d.actor = actor
+	d.updatedAt = time.Now()
+}
+
+// Clone creates a deep copy of the Deployment.
+func (d *Deployment) Clone() *Deployment {
+	out := *d
+	return &out
+}
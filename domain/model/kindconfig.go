@@ -0,0 +1,258 @@
+package model
+
+import (
+	"github.com/soltiHQ/control-plane/domain"
+	"github.com/soltiHQ/control-plane/domain/kind"
+)
+
+// KindConfig is the typed configuration of a task kind, sent to agents as the "kind" object
+// of the CreateSpec; ParseKindConfig builds one from the generic map stored on a Spec.
+type KindConfig interface {
+	// Kind returns the task kind the configuration belongs to.
+	Kind() kind.TaskKindType
+	// Map returns the configuration in the agent CreateSpec format.
+	Map() map[string]any
+}
+
+// SubprocessConfig runs a command on the agent host.
+type SubprocessConfig struct {
+	Command       string
+	Args          []string
+	Env           map[string]string
+	Cwd           string
+	FailOnNonZero *bool // nil leaves the agent default
+}
+
+// Kind returns kind.TaskKindSubprocess.
+func (c SubprocessConfig) Kind() kind.TaskKindType { return kind.TaskKindSubprocess }
+
+// Map returns {command, args, env, cwd, failOnNonZero}, omitting unset fields.
+func (c SubprocessConfig) Map() map[string]any {
+	out := map[string]any{"command": c.Command}
+	putStrings(out, "args", c.Args)
+	putEnv(out, "env", c.Env)
+	if c.Cwd != "" {
+		out["cwd"] = c.Cwd
+	}
+	if c.FailOnNonZero != nil {
+		out["failOnNonZero"] = *c.FailOnNonZero
+	}
+	return out
+}
+
+// WasmConfig runs a WebAssembly module in the agent's runtime.
+type WasmConfig struct {
+	Module string
+	Args   []string
+	Env    map[string]string
+}
+
+// Kind returns kind.TaskKindWasm.
+func (c WasmConfig) Kind() kind.TaskKindType { return kind.TaskKindWasm }
+
+// Map returns {module, args, env}, omitting unset fields.
+func (c WasmConfig) Map() map[string]any {
+	out := map[string]any{"module": c.Module}
+	putStrings(out, "args", c.Args)
+	putEnv(out, "env", c.Env)
+	return out
+}
+
+// ContainerConfig runs a container image on the agent host.
+type ContainerConfig struct {
+	Image   string
+	Command string // empty keeps the image entrypoint
+	Args    []string
+	Env     map[string]string
+}
+
+// Kind returns kind.TaskKindContainer.
+func (c ContainerConfig) Kind() kind.TaskKindType { return kind.TaskKindContainer }
+
+// Map returns {image, command, args, env}, omitting unset fields.
+func (c ContainerConfig) Map() map[string]any {
+	out := map[string]any{"image": c.Image}
+	if c.Command != "" {
+		out["command"] = c.Command
+	}
+	putStrings(out, "args", c.Args)
+	putEnv(out, "env", c.Env)
+	return out
+}
+
+// ParseKindConfig decodes and validates the configuration of a task kind.
+//
+// Every problem is reported: missing required fields, wrong value types and unknown fields
+// are returned as domain.FieldErrors keyed "kind_config.<field>"; an unknown kind as "kind_type".
+func ParseKindConfig(t kind.TaskKindType, cfg map[string]any) (KindConfig, error) {
+	var (
+		errs = make(domain.FieldErrors)
+		r    = configReader{cfg: cfg, errs: errs, seen: make(map[string]struct{})}
+		out  KindConfig
+	)
+	switch t {
+	case kind.TaskKindSubprocess:
+		out = SubprocessConfig{
+			Command:       r.str("command", true),
+			Args:          r.strings("args"),
+			Env:           r.env("env"),
+			Cwd:           r.str("cwd", false),
+			FailOnNonZero: r.boolPtr("failOnNonZero"),
+		}
+	case kind.TaskKindWasm:
+		out = WasmConfig{
+			Module: r.str("module", true),
+			Args:   r.strings("args"),
+			Env:    r.env("env"),
+		}
+	case kind.TaskKindContainer:
+		out = ContainerConfig{
+			Image:   r.str("image", true),
+			Command: r.str("command", false),
+			Args:    r.strings("args"),
+			Env:     r.env("env"),
+		}
+	default:
+		errs.Add("kind_type", "must be one of subprocess, wasm, container")
+		return nil, errs
+	}
+	r.rejectUnknown()
+
+	if err := errs.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// configReader reads typed fields from a generic kind config, collecting problems.
+//
+// Values are accepted as decoded from JSON ([]any, map[string]any) or as built in Go
+// ([]string, map[string]string).
+type configReader struct {
+	cfg  map[string]any
+	errs domain.FieldErrors
+	seen map[string]struct{}
+}
+
+func (r *configReader) get(key string) (any, bool) {
+	r.seen[key] = struct{}{}
+	v, ok := r.cfg[key]
+	return v, ok && v != nil
+}
+
+func (r *configReader) fail(key, problem string) {
+	r.errs.Add("kind_config."+key, problem)
+}
+
+func (r *configReader) str(key string, required bool) string {
+	v, ok := r.get(key)
+	if !ok {
+		if required {
+			r.fail(key, "is required")
+		}
+		return ""
+	}
+	s, isStr := v.(string)
+	switch {
+	case !isStr:
+		r.fail(key, "must be a string")
+	case required && s == "":
+		r.fail(key, "is required")
+	}
+	return s
+}
+
+func (r *configReader) strings(key string) []string {
+	v, ok := r.get(key)
+	if !ok {
+		return nil
+	}
+	switch vs := v.(type) {
+	case []string:
+		return append([]string(nil), vs...)
+	case []any:
+		out := make([]string, 0, len(vs))
+		for _, item := range vs {
+			s, isStr := item.(string)
+			if !isStr {
+				r.fail(key, "must be a list of strings")
+				return nil
+			}
+			out = append(out, s)
+		}
+		return out
+	default:
+		r.fail(key, "must be a list of strings")
+		return nil
+	}
+}
+
+func (r *configReader) env(key string) map[string]string {
+	v, ok := r.get(key)
+	if !ok {
+		return nil
+	}
+	out := make(map[string]string)
+	switch vs := v.(type) {
+	case map[string]string:
+		for k, s := range vs {
+			out[k] = s
+		}
+	case map[string]any:
+		for k, item := range vs {
+			s, isStr := item.(string)
+			if !isStr {
+				r.fail(key, "must map names to strings")
+				return nil
+			}
+			out[k] = s
+		}
+	default:
+		r.fail(key, "must map names to strings")
+		return nil
+	}
+	if _, empty := out[""]; empty {
+		r.fail(key, "must not contain an empty name")
+		return nil
+	}
+	return out
+}
+
+func (r *configReader) boolPtr(key string) *bool {
+	v, ok := r.get(key)
+	if !ok {
+		return nil
+	}
+	b, isBool := v.(bool)
+	if !isBool {
+		r.fail(key, "must be a boolean")
+		return nil
+	}
+	return &b
+}
+
+// rejectUnknown reports every field that no reader asked for.
+func (r *configReader) rejectUnknown() {
+	for key := range r.cfg {
+		if _, ok := r.seen[key]; !ok {
+			r.fail(key, "is not a known field")
+		}
+	}
+}
+
+func putStrings(m map[string]any, key string, vs []string) {
+	if len(vs) > 0 {
+		m[key] = append([]string(nil), vs...)
+	}
+}
+
+func putEnv(m map[string]any, key string, env map[string]string) {
+	if len(env) == 0 {
+		return
+	}
+	out := make(map[string]string, len(env))
+	for k, v := range env {
+		out[k] = v
+	}
+	m[key] = out
+}
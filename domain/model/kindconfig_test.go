@@ -0,0 +1,164 @@
+package model
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/soltiHQ/control-plane/domain"
+	"github.com/soltiHQ/control-plane/domain/kind"
+)
+
+func TestParseKindConfig(t *testing.T) {
+	t.Parallel()
+
+	yes := true
+	cases := []struct {
+		name string
+		kind kind.TaskKindType
+		cfg  map[string]any
+		want KindConfig
+	}{
+		{
+			name: "subprocess as decoded from JSON",
+			kind: kind.TaskKindSubprocess,
+			cfg: map[string]any{
+				"command":       "sleep",
+				"args":          []any{"30"},
+				"env":           map[string]any{"A": "1"},
+				"cwd":           "/tmp",
+				"failOnNonZero": true,
+			},
+			want: SubprocessConfig{Command: "sleep", Args: []string{"30"}, Env: map[string]string{"A": "1"}, Cwd: "/tmp", FailOnNonZero: &yes},
+		},
+		{
+			name: "subprocess as built in Go",
+			kind: kind.TaskKindSubprocess,
+			cfg:  map[string]any{"command": "sleep", "args": []string{"30"}, "env": map[string]string{"A": "1"}},
+			want: SubprocessConfig{Command: "sleep", Args: []string{"30"}, Env: map[string]string{"A": "1"}},
+		},
+		{
+			name: "null optional fields",
+			kind: kind.TaskKindSubprocess,
+			cfg:  map[string]any{"command": "sleep", "args": nil, "cwd": nil},
+			want: SubprocessConfig{Command: "sleep"},
+		},
+		{
+			name: "wasm",
+			kind: kind.TaskKindWasm,
+			cfg:  map[string]any{"module": "app.wasm", "args": []any{"-v"}},
+			want: WasmConfig{Module: "app.wasm", Args: []string{"-v"}},
+		},
+		{
+			name: "container keeping the entrypoint",
+			kind: kind.TaskKindContainer,
+			cfg:  map[string]any{"image": "nginx:1"},
+			want: ContainerConfig{Image: "nginx:1"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseKindConfig(tc.kind, tc.cfg)
+			if err != nil {
+				t.Fatalf("ParseKindConfig: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("ParseKindConfig = %#v, want %#v", got, tc.want)
+			}
+			if got.Kind() != tc.kind {
+				t.Fatalf("Kind() = %s, want %s", got.Kind(), tc.kind)
+			}
+		})
+	}
+}
+
+func TestParseKindConfig_Invalid(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		kind kind.TaskKindType
+		cfg  map[string]any
+		want domain.FieldErrors
+	}{
+		{
+			name: "unknown kind",
+			kind: "vm",
+			cfg:  map[string]any{"command": "sleep"},
+			want: domain.FieldErrors{"kind_type": "must be one of subprocess, wasm, container"},
+		},
+		{
+			name: "missing required field",
+			kind: kind.TaskKindSubprocess,
+			cfg:  map[string]any{},
+			want: domain.FieldErrors{"kind_config.command": "is required"},
+		},
+		{
+			name: "empty required field",
+			kind: kind.TaskKindWasm,
+			cfg:  map[string]any{"module": ""},
+			want: domain.FieldErrors{"kind_config.module": "is required"},
+		},
+		{
+			name: "wrong types",
+			kind: kind.TaskKindSubprocess,
+			cfg: map[string]any{
+				"command":       42,
+				"args":          "30",
+				"env":           []any{"A=1"},
+				"cwd":           false,
+				"failOnNonZero": "yes",
+			},
+			want: domain.FieldErrors{
+				"kind_config.command":       "must be a string",
+				"kind_config.args":          "must be a list of strings",
+				"kind_config.env":           "must map names to strings",
+				"kind_config.cwd":           "must be a string",
+				"kind_config.failOnNonZero": "must be a boolean",
+			},
+		},
+		{
+			name: "wrong element types",
+			kind: kind.TaskKindContainer,
+			cfg:  map[string]any{"image": "nginx", "args": []any{"a", 1}, "env": map[string]any{"A": 1}},
+			want: domain.FieldErrors{
+				"kind_config.args": "must be a list of strings",
+				"kind_config.env":  "must map names to strings",
+			},
+		},
+		{
+			name: "empty env name",
+			kind: kind.TaskKindWasm,
+			cfg:  map[string]any{"module": "app.wasm", "env": map[string]any{"": "x"}},
+			want: domain.FieldErrors{"kind_config.env": "must not contain an empty name"},
+		},
+		{
+			name: "unknown fields",
+			kind: kind.TaskKindWasm,
+			cfg:  map[string]any{"module": "app.wasm", "command": "sleep", "image": "nginx"},
+			want: domain.FieldErrors{
+				"kind_config.command": "is not a known field",
+				"kind_config.image":   "is not a known field",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := ParseKindConfig(tc.kind, tc.cfg)
+			if !errors.Is(err, domain.ErrInvalidFields) {
+				t.Fatalf("expected ErrInvalidFields, got %v", err)
+			}
+			var fields domain.FieldErrors
+			if !errors.As(err, &fields) {
+				t.Fatalf("expected FieldErrors, got %T", err)
+			}
+			if !reflect.DeepEqual(fields, tc.want) {
+				t.Fatalf("fields = %v, want %v", fields, tc.want)
+			}
+		})
+	}
+}
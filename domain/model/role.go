@@ -24,6 +24,9 @@ type Role struct {
 	name string
 
 	permissions []kind.Permission
+	seed        int // kind.AdminSeeds version applied by bootstrap, 0 for roles it does not manage
+
+	resourceVersion uint64 // assigned by storage on every write
 }
 
 // NewRole creates a new role entity.
@@ -57,6 +60,18 @@ func (r *Role) CreatedAt() time.Time { return r.createdAt }
 // UpdatedAt returns the timestamp of the last modification.
 func (r *Role) UpdatedAt() time.Time { return r.updatedAt }
 
+// ResourceVersion returns the storage revision of the last write (0 if never stored).
+func (r *Role) ResourceVersion() uint64 { return r.resourceVersion }
+
+// SetResourceVersion sets the storage revision; a non-zero value makes the next upsert conditional.
+func (r *Role) SetResourceVersion(rv uint64) { r.resourceVersion = rv }
+
+// Seed returns the version of the built-in permission set last granted to the role (see kind.AdminSeeds).
+func (r *Role) Seed() int { return r.seed }
+
+// SetSeed records the version of the built-in permission set granted to the role.
+func (r *Role) SetSeed(v int) { r.seed = v }
+
 // PermissionsAll returns a copy of all permissions assigned to the role.
 func (r *Role) PermissionsAll() []kind.Permission {
 	out := make([]kind.Permission, len(r.permissions))
@@ -127,5 +142,8 @@ func (r *Role) Clone() *Role {
 		id:          r.id,
 		name:        r.name,
 		permissions: out,
+		seed:        r.seed,
+
+		resourceVersion: r.resourceVersion,
 	}
 }
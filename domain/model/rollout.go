@@ -17,19 +17,27 @@ type Rollout struct {
 	createdAt time.Time
 	updatedAt time.Time
 
-	lastPushedAt time.Time
-	lastSyncedAt time.Time
+	lastPushedAt  time.Time
+	lastSyncedAt  time.Time
+	healthyAt     time.Time // when the agent first reported the task running or succeeded
+	nextAttemptAt time.Time // earliest retry of a failed push or removal, zero when due
+
+	retryDelay time.Duration // wait before nextAttemptAt, the base of the next decorrelated delay
 
 	id      string
 	specID  string
 	agentID string
+	slot    string // slot to remove from the agent, set while undeploying
 	errMsg  string
 
 	desiredVersion int
 	actualVersion  int
 	attempts       int
+	wave           int // position in a progressive rollout, 0 for the first wave
 
 	status kind.SyncStatus
+
+	resourceVersion uint64 // assigned by storage on every write
 }
 
 // RolloutID returns the deterministic identifier for a Spec-Agent pair.
@@ -80,24 +88,96 @@ func (ss *Rollout) LastPushedAt() time.Time { return ss.lastPushedAt }
 // LastSyncedAt returns when the agent last confirmed sync.
 func (ss *Rollout) LastSyncedAt() time.Time { return ss.lastSyncedAt }
 
+// NextAttemptAt returns the earliest time the sync runner retries a failed push or removal
+// (zero if it may retry right away).
+func (ss *Rollout) NextAttemptAt() time.Time { return ss.nextAttemptAt }
+
+// RetryDelay returns the wait scheduled before NextAttemptAt (zero if no retry is scheduled).
+func (ss *Rollout) RetryDelay() time.Duration { return ss.retryDelay }
+
+// Slot returns the agent slot being removed (empty unless the rollout is removing or removed).
+func (ss *Rollout) Slot() string { return ss.slot }
+
 // Error returns the last error message (if any).
 func (ss *Rollout) Error() string { return ss.errMsg }
 
 // Attempts returns the retry counter.
 func (ss *Rollout) Attempts() int { return ss.attempts }
 
+// Wave returns the wave of the rollout in a progressive deploy (0 for the first one).
+func (ss *Rollout) Wave() int { return ss.wave }
+
+// HealthyAt returns when the agent was first seen running the desired version (zero if not yet).
+func (ss *Rollout) HealthyAt() time.Time { return ss.healthyAt }
+
 // CreatedAt returns the creation timestamp.
 func (ss *Rollout) CreatedAt() time.Time { return ss.createdAt }
 
 // UpdatedAt returns the last modification timestamp.
 func (ss *Rollout) UpdatedAt() time.Time { return ss.updatedAt }
 
+// RunsOnAgent reports whether the agent is expected to keep running the rollout's task as it is:
+// a version was delivered and the rollout is not being removed.
+func (ss *Rollout) RunsOnAgent() bool {
+	switch ss.status {
+	case kind.SyncStatusRemoving, kind.SyncStatusRemoved:
+		return false
+	}
+	return ss.actualVersion > 0 && ss.slot == ""
+}
+
+// ResourceVersion returns the storage revision of the last write (0 if never stored).
+func (ss *Rollout) ResourceVersion() uint64 { return ss.resourceVersion }
+
+// SetResourceVersion sets the storage revision; a non-zero value makes the next upsert conditional.
+func (ss *Rollout) SetResourceVersion(rv uint64) { ss.resourceVersion = rv }
+
 // MarkPending sets the state to pending with a new desired version.
 func (ss *Rollout) MarkPending(desiredVersion int) {
 	ss.desiredVersion = desiredVersion
 	ss.status = kind.SyncStatusPending
+	ss.slot = ""
 	ss.attempts = 0
 	ss.errMsg = ""
+	ss.healthyAt = time.Time{}
+	ss.nextAttemptAt = time.Time{}
+	ss.retryDelay = 0
+	ss.updatedAt = time.Now()
+}
+
+// MarkWaiting sets a new desired version that is held back until the rollout's wave is released.
+func (ss *Rollout) MarkWaiting(desiredVersion int) {
+	ss.MarkPending(desiredVersion)
+	ss.status = kind.SyncStatusWaiting
+}
+
+// MarkTargeted points the rollout at a deployed version in a wave, as a deploy does for its
+// targets: pending in wave 0, waiting in later waves until the wave runner releases them.
+func (ss *Rollout) MarkTargeted(desiredVersion, wave int) {
+	if wave == 0 {
+		ss.MarkPending(desiredVersion)
+	} else {
+		ss.MarkWaiting(desiredVersion)
+	}
+	ss.SetWave(wave)
+}
+
+// SetWave assigns the rollout to a wave of a progressive deploy.
+func (ss *Rollout) SetWave(wave int) {
+	ss.wave = wave
+	ss.updatedAt = time.Now()
+}
+
+// MarkHealthy records that the agent reported the task running or succeeded.
+func (ss *Rollout) MarkHealthy() {
+	ss.healthyAt = time.Now()
+	ss.updatedAt = ss.healthyAt
+}
+
+// MarkHalted stops a waiting rollout because the progressive deploy was halted.
+func (ss *Rollout) MarkHalted(reason string) {
+	ss.status = kind.SyncStatusHalted
+	ss.errMsg = reason
 	ss.updatedAt = time.Now()
 }
 
@@ -107,6 +187,8 @@ func (ss *Rollout) MarkSynced(actualVersion int) {
 	ss.status = kind.SyncStatusSynced
 	ss.lastSyncedAt = time.Now()
 	ss.errMsg = ""
+	ss.nextAttemptAt = time.Time{}
+	ss.retryDelay = 0
 	ss.updatedAt = time.Now()
 }
 
@@ -131,6 +213,84 @@ func (ss *Rollout) MarkUnknown() {
 	ss.updatedAt = time.Now()
 }
 
+// MarkOrphaned records that the agent is no longer targeted by the spec.
+//
+// The sync runner skips orphaned rollouts; MarkPending revives one if the agent is targeted again.
+func (ss *Rollout) MarkOrphaned() {
+	ss.status = kind.SyncStatusOrphaned
+	ss.updatedAt = time.Now()
+}
+
+// MarkRemoving starts removing the task in slot from the agent.
+//
+// The slot is kept on the rollout so the removal can finish after the spec is deleted.
+func (ss *Rollout) MarkRemoving(slot string) {
+	ss.slot = slot
+	ss.status = kind.SyncStatusRemoving
+	ss.attempts = 0
+	ss.errMsg = ""
+	ss.nextAttemptAt = time.Time{}
+	ss.retryDelay = 0
+	ss.updatedAt = time.Now()
+}
+
+// MarkRemoveFailed records a failed removal; the rollout stays removing.
+func (ss *Rollout) MarkRemoveFailed(errMsg string) {
+	ss.errMsg = errMsg
+	ss.attempts++
+	ss.lastPushedAt = time.Now()
+	ss.updatedAt = ss.lastPushedAt
+}
+
+// MarkRemoved records that the agent no longer runs the task.
+func (ss *Rollout) MarkRemoved() {
+	ss.actualVersion = 0
+	ss.status = kind.SyncStatusRemoved
+	ss.errMsg = ""
+	ss.nextAttemptAt = time.Time{}
+	ss.retryDelay = 0
+	ss.lastSyncedAt = time.Now()
+	ss.updatedAt = ss.lastSyncedAt
+}
+
+// MarkExhausted gives up on a rollout whose retries all failed; the last error is kept.
+//
+// The sync runner no longer touches it until Retry or a new deploy. A rollout exhausted
+// while removing keeps its slot, so Retry resumes the removal.
+func (ss *Rollout) MarkExhausted() {
+	ss.status = kind.SyncStatusExhausted
+	ss.nextAttemptAt = time.Time{}
+	ss.retryDelay = 0
+	ss.updatedAt = time.Now()
+}
+
+// Retry makes a failed, exhausted or retrying removing rollout due right away, with a fresh
+// attempt budget. It reports whether the rollout was in such a state.
+func (ss *Rollout) Retry() bool {
+	switch {
+	case ss.status == kind.SyncStatusExhausted && ss.slot != "":
+		ss.status = kind.SyncStatusRemoving
+	case ss.status == kind.SyncStatusExhausted, ss.status == kind.SyncStatusFailed:
+		ss.status = kind.SyncStatusPending
+	case ss.status == kind.SyncStatusRemoving && ss.attempts > 0:
+	default:
+		return false
+	}
+	ss.attempts = 0
+	ss.errMsg = ""
+	ss.nextAttemptAt = time.Time{}
+	ss.retryDelay = 0
+	ss.updatedAt = time.Now()
+	return true
+}
+
+// ScheduleRetry schedules the next retry of a failed push or removal after delay.
+func (ss *Rollout) ScheduleRetry(delay time.Duration) {
+	ss.retryDelay = delay
+	ss.updatedAt = time.Now()
+	ss.nextAttemptAt = ss.updatedAt.Add(delay)
+}
+
 // SetLastPushedAt records a push attempt timestamp.
 func (ss *Rollout) SetLastPushedAt(t time.Time) {
 	ss.lastPushedAt = t
@@ -140,20 +300,28 @@ func (ss *Rollout) SetLastPushedAt(t time.Time) {
 // Clone creates a deep copy of the Rollout.
 func (ss *Rollout) Clone() *Rollout {
 	return &Rollout{
-		createdAt:    ss.createdAt,
-		updatedAt:    ss.updatedAt,
-		lastPushedAt: ss.lastPushedAt,
-		lastSyncedAt: ss.lastSyncedAt,
+		createdAt:     ss.createdAt,
+		updatedAt:     ss.updatedAt,
+		lastPushedAt:  ss.lastPushedAt,
+		lastSyncedAt:  ss.lastSyncedAt,
+		healthyAt:     ss.healthyAt,
+		nextAttemptAt: ss.nextAttemptAt,
+
+		retryDelay: ss.retryDelay,
 
 		id:      ss.id,
 		specID:  ss.specID,
 		agentID: ss.agentID,
+		slot:    ss.slot,
 		errMsg:  ss.errMsg,
 
 		desiredVersion: ss.desiredVersion,
 		actualVersion:  ss.actualVersion,
 		attempts:       ss.attempts,
+		wave:           ss.wave,
 
 		status: ss.status,
+
+		resourceVersion: ss.resourceVersion,
 	}
 }
@@ -0,0 +1,158 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+)
+
+func TestRollout_Retry(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		change func(*Rollout)
+		want   kind.SyncStatus
+		ok     bool
+	}{
+		{
+			name:   "failed",
+			change: func(ss *Rollout) { ss.MarkFailed("boom"); ss.ScheduleRetry(time.Minute) },
+			want:   kind.SyncStatusPending,
+			ok:     true,
+		},
+		{
+			name:   "exhausted push",
+			change: func(ss *Rollout) { ss.MarkFailed("boom"); ss.MarkExhausted() },
+			want:   kind.SyncStatusPending,
+			ok:     true,
+		},
+		{
+			name: "exhausted removal",
+			change: func(ss *Rollout) {
+				ss.MarkRemoving("web")
+				ss.MarkRemoveFailed("boom")
+				ss.MarkExhausted()
+			},
+			want: kind.SyncStatusRemoving,
+			ok:   true,
+		},
+		{
+			name: "retrying removal",
+			change: func(ss *Rollout) {
+				ss.MarkRemoving("web")
+				ss.MarkRemoveFailed("boom")
+				ss.ScheduleRetry(time.Minute)
+			},
+			want: kind.SyncStatusRemoving,
+			ok:   true,
+		},
+		{
+			name:   "removal not yet tried",
+			change: func(ss *Rollout) { ss.MarkRemoving("web") },
+			want:   kind.SyncStatusRemoving,
+		},
+		{
+			name:   "pending",
+			change: func(*Rollout) {},
+			want:   kind.SyncStatusPending,
+		},
+		{
+			name:   "synced",
+			change: func(ss *Rollout) { ss.MarkSynced(1) },
+			want:   kind.SyncStatusSynced,
+		},
+		{
+			name:   "halted",
+			change: func(ss *Rollout) { ss.MarkHalted("canary failed") },
+			want:   kind.SyncStatusHalted,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ss, err := NewRollout("s1", "a1", 1)
+			if err != nil {
+				t.Fatalf("NewRollout: %v", err)
+			}
+			tc.change(ss)
+			before := ss.Snapshot()
+
+			if ok := ss.Retry(); ok != tc.ok {
+				t.Fatalf("Retry() = %v, want %v", ok, tc.ok)
+			}
+			if ss.Status() != tc.want {
+				t.Fatalf("status %s, want %s", ss.Status(), tc.want)
+			}
+			if !tc.ok {
+				if ss.Snapshot() != before {
+					t.Fatalf("a rollout that cannot be retried must not change")
+				}
+				return
+			}
+			if ss.Attempts() != 0 || ss.Error() != "" || !ss.NextAttemptAt().IsZero() || ss.RetryDelay() != 0 {
+				t.Fatalf("expected a fresh, due attempt budget, got attempts=%d error=%q next=%v delay=%v",
+					ss.Attempts(), ss.Error(), ss.NextAttemptAt(), ss.RetryDelay())
+			}
+			if ss.Slot() != before.Slot {
+				t.Fatalf("slot %q, want %q kept", ss.Slot(), before.Slot)
+			}
+		})
+	}
+}
+
+func TestRollout_MarkExhausted(t *testing.T) {
+	t.Parallel()
+
+	ss, err := NewRollout("s1", "a1", 1)
+	if err != nil {
+		t.Fatalf("NewRollout: %v", err)
+	}
+	ss.MarkRemoving("web")
+	ss.MarkRemoveFailed("connection refused")
+	ss.ScheduleRetry(time.Minute)
+
+	ss.MarkExhausted()
+	if ss.Status() != kind.SyncStatusExhausted {
+		t.Fatalf("status %s, want exhausted", ss.Status())
+	}
+	if ss.Error() != "connection refused" || ss.Attempts() != 1 || ss.Slot() != "web" {
+		t.Fatalf("expected the last error, attempts and slot kept, got error=%q attempts=%d slot=%q",
+			ss.Error(), ss.Attempts(), ss.Slot())
+	}
+	if !ss.NextAttemptAt().IsZero() || ss.RetryDelay() != 0 {
+		t.Fatalf("expected no retry scheduled, got next=%v delay=%v", ss.NextAttemptAt(), ss.RetryDelay())
+	}
+}
+
+func TestRollout_RunsOnAgent(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		change func(*Rollout)
+		want   bool
+	}{
+		{"never delivered", func(*Rollout) {}, false},
+		{"synced", func(ss *Rollout) { ss.MarkSynced(1) }, true},
+		{"new version pending", func(ss *Rollout) { ss.MarkSynced(1); ss.MarkPending(2) }, true},
+		{"removing", func(ss *Rollout) { ss.MarkSynced(1); ss.MarkRemoving("web") }, false},
+		{"removed", func(ss *Rollout) { ss.MarkSynced(1); ss.MarkRemoving("web"); ss.MarkRemoved() }, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ss, err := NewRollout("s1", "a1", 1)
+			if err != nil {
+				t.Fatalf("NewRollout: %v", err)
+			}
+			tc.change(ss)
+			if got := ss.RunsOnAgent(); got != tc.want {
+				t.Fatalf("RunsOnAgent() = %v in status %s, want %v", got, ss.Status(), tc.want)
+			}
+		})
+	}
+}
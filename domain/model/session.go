@@ -28,6 +28,8 @@ type Session struct {
 
 	refreshHash []byte
 	auth        kind.Auth
+
+	resourceVersion uint64 // assigned by storage on every write
 }
 
 // NewSession creates a new session entity.
@@ -93,6 +95,12 @@ func (s *Session) CreatedAt() time.Time { return s.createdAt }
 // UpdatedAt returns the timestamp of the last modification.
 func (s *Session) UpdatedAt() time.Time { return s.updatedAt }
 
+// ResourceVersion returns the storage revision of the last write (0 if never stored).
+func (s *Session) ResourceVersion() uint64 { return s.resourceVersion }
+
+// SetResourceVersion sets the storage revision; a non-zero value makes the next upsert conditional.
+func (s *Session) SetResourceVersion(rv uint64) { s.resourceVersion = rv }
+
 // Expired reports whether the session is expired at the given time.
 func (s *Session) Expired(at time.Time) bool {
 	return !s.expiresAt.IsZero() && !at.Before(s.expiresAt)
@@ -148,5 +156,7 @@ func (s *Session) Clone() *Session {
 		credentialID: s.credentialID,
 		auth:         s.auth,
 		refreshHash:  append([]byte(nil), s.refreshHash...),
+
+		resourceVersion: s.resourceVersion,
 	}
 }
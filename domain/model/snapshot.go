@@ -0,0 +1,686 @@
+package model
+
+import (
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain"
+	"github.com/soltiHQ/control-plane/domain/kind"
+)
+
+// Snapshots are flat, serializable copies of entity state.
+//
+// Entities keep their fields unexported, so persistent storage backends cannot
+// rebuild them through the regular constructors without losing timestamps and
+// counters. Each entity therefore exposes a Snapshot method and a matching
+// <Entity>FromSnapshot constructor that restores the exact state.
+//
+// Snapshots are a storage concern: handlers and services must keep using the
+// regular constructors and setters.
+
+// AgentSnapshot is the serializable state of an Agent.
+type AgentSnapshot struct {
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	LastSeenAt time.Time `json:"last_seen_at,omitzero"`
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+
+	ID           string            `json:"id"`
+	Name         string            `json:"name,omitempty"`
+	Endpoint     string            `json:"endpoint,omitempty"`
+	EndpointType kind.EndpointType `json:"endpoint_type,omitempty"`
+	APIVersion   kind.APIVersion   `json:"api_version,omitempty"`
+	Delivery     kind.DeliveryMode `json:"delivery,omitempty"`
+	OS           string            `json:"os,omitempty"`
+	Arch         string            `json:"arch,omitempty"`
+	Platform     string            `json:"platform,omitempty"`
+
+	UptimeSeconds     int64         `json:"uptime_seconds,omitempty"`
+	HeartbeatInterval time.Duration `json:"heartbeat_interval,omitempty"`
+
+	Status kind.AgentStatus `json:"status"`
+
+	ResourceVersion uint64 `json:"resource_version,omitempty"`
+}
+
+// Snapshot returns the serializable state of the agent.
+func (a *Agent) Snapshot() AgentSnapshot {
+	return AgentSnapshot{
+		CreatedAt:  a.createdAt,
+		UpdatedAt:  a.updatedAt,
+		LastSeenAt: a.lastSeenAt,
+
+		Metadata: a.MetadataAll(),
+		Labels:   a.LabelsAll(),
+
+		ID:           a.id,
+		Name:         a.name,
+		Endpoint:     a.endpoint,
+		EndpointType: a.endpointType,
+		APIVersion:   a.apiVersion,
+		Delivery:     a.delivery,
+		OS:           a.os,
+		Arch:         a.arch,
+		Platform:     a.platform,
+
+		UptimeSeconds:     a.uptimeSeconds,
+		HeartbeatInterval: a.heartbeatInterval,
+
+		Status: a.status,
+
+		ResourceVersion: a.resourceVersion,
+	}
+}
+
+// AgentFromSnapshot restores an Agent from its serialized state.
+func AgentFromSnapshot(s AgentSnapshot) (*Agent, error) {
+	if s.ID == "" {
+		return nil, domain.ErrEmptyID
+	}
+	if s.Delivery == "" {
+		// Written before agents declared a delivery mode: every agent was dialed.
+		s.Delivery = kind.DeliveryPush
+	}
+	return &Agent{
+		createdAt:  s.CreatedAt,
+		updatedAt:  s.UpdatedAt,
+		lastSeenAt: s.LastSeenAt,
+
+		metadata: copyStrings(s.Metadata),
+		labels:   copyStrings(s.Labels),
+
+		id:           s.ID,
+		name:         s.Name,
+		endpoint:     s.Endpoint,
+		endpointType: s.EndpointType,
+		apiVersion:   s.APIVersion,
+		delivery:     s.Delivery,
+		os:           s.OS,
+		arch:         s.Arch,
+		platform:     s.Platform,
+
+		uptimeSeconds:     s.UptimeSeconds,
+		heartbeatInterval: s.HeartbeatInterval,
+
+		status: s.Status,
+
+		resourceVersion: s.ResourceVersion,
+	}, nil
+}
+
+// UserSnapshot is the serializable state of a User.
+type UserSnapshot struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ID      string `json:"id"`
+	Subject string `json:"subject"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+
+	RoleIDs     []string          `json:"role_ids,omitempty"`
+	Permissions []kind.Permission `json:"permissions,omitempty"`
+
+	Disabled bool `json:"disabled,omitempty"`
+
+	ResourceVersion uint64 `json:"resource_version,omitempty"`
+}
+
+// Snapshot returns the serializable state of the user.
+func (u *User) Snapshot() UserSnapshot {
+	return UserSnapshot{
+		CreatedAt:   u.createdAt,
+		UpdatedAt:   u.updatedAt,
+		ID:          u.id,
+		Subject:     u.subject,
+		Email:       u.email,
+		Name:        u.name,
+		RoleIDs:     u.RoleIDsAll(),
+		Permissions: u.PermissionsAll(),
+		Disabled:    u.disabled,
+
+		ResourceVersion: u.resourceVersion,
+	}
+}
+
+// UserFromSnapshot restores a User from its serialized state.
+func UserFromSnapshot(s UserSnapshot) (*User, error) {
+	if s.ID == "" {
+		return nil, domain.ErrEmptyID
+	}
+	if s.Subject == "" {
+		return nil, domain.ErrInvalidSubject
+	}
+
+	roleIDs := make([]string, len(s.RoleIDs))
+	copy(roleIDs, s.RoleIDs)
+	perms := make([]kind.Permission, len(s.Permissions))
+	copy(perms, s.Permissions)
+
+	return &User{
+		createdAt:   s.CreatedAt,
+		updatedAt:   s.UpdatedAt,
+		id:          s.ID,
+		subject:     s.Subject,
+		email:       s.Email,
+		name:        s.Name,
+		roleIDs:     roleIDs,
+		permissions: perms,
+		disabled:    s.Disabled,
+
+		resourceVersion: s.ResourceVersion,
+	}, nil
+}
+
+// RoleSnapshot is the serializable state of a Role.
+type RoleSnapshot struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ID   string `json:"id"`
+	Name string `json:"name"`
+
+	Permissions []kind.Permission `json:"permissions,omitempty"`
+	Seed        int               `json:"seed,omitempty"`
+
+	ResourceVersion uint64 `json:"resource_version,omitempty"`
+}
+
+// Snapshot returns the serializable state of the role.
+func (r *Role) Snapshot() RoleSnapshot {
+	return RoleSnapshot{
+		CreatedAt:   r.createdAt,
+		UpdatedAt:   r.updatedAt,
+		ID:          r.id,
+		Name:        r.name,
+		Permissions: r.PermissionsAll(),
+		Seed:        r.seed,
+
+		ResourceVersion: r.resourceVersion,
+	}
+}
+
+// RoleFromSnapshot restores a Role from its serialized state.
+func RoleFromSnapshot(s RoleSnapshot) (*Role, error) {
+	if s.ID == "" {
+		return nil, domain.ErrEmptyID
+	}
+	if s.Name == "" {
+		return nil, domain.ErrEmptyName
+	}
+
+	perms := make([]kind.Permission, len(s.Permissions))
+	copy(perms, s.Permissions)
+
+	return &Role{
+		createdAt:   s.CreatedAt,
+		updatedAt:   s.UpdatedAt,
+		id:          s.ID,
+		name:        s.Name,
+		permissions: perms,
+		seed:        s.Seed,
+
+		resourceVersion: s.ResourceVersion,
+	}, nil
+}
+
+// CredentialSnapshot is the serializable state of a Credential.
+type CredentialSnapshot struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+
+	Secrets map[string]string `json:"secrets,omitempty"`
+	Auth    kind.Auth         `json:"auth"`
+
+	ResourceVersion uint64 `json:"resource_version,omitempty"`
+}
+
+// Snapshot returns the serializable state of the credential.
+func (c *Credential) Snapshot() CredentialSnapshot {
+	return CredentialSnapshot{
+		CreatedAt: c.createdAt,
+		UpdatedAt: c.updatedAt,
+		ID:        c.id,
+		UserID:    c.userID,
+		Secrets:   c.SecretsAll(),
+		Auth:      c.auth,
+
+		ResourceVersion: c.resourceVersion,
+	}
+}
+
+// CredentialFromSnapshot restores a Credential from its serialized state.
+func CredentialFromSnapshot(s CredentialSnapshot) (*Credential, error) {
+	if s.ID == "" {
+		return nil, domain.ErrEmptyID
+	}
+	if s.UserID == "" {
+		return nil, domain.ErrEmptyUserID
+	}
+	return &Credential{
+		createdAt: s.CreatedAt,
+		updatedAt: s.UpdatedAt,
+		id:        s.ID,
+		userID:    s.UserID,
+		auth:      s.Auth,
+		secrets:   copyStrings(s.Secrets),
+
+		resourceVersion: s.ResourceVersion,
+	}, nil
+}
+
+// VerifierSnapshot is the serializable state of a Verifier.
+type VerifierSnapshot struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ID           string `json:"id"`
+	CredentialID string `json:"credential_id"`
+
+	Auth kind.Auth `json:"auth"`
+
+	Data map[string]string `json:"data,omitempty"`
+
+	ResourceVersion uint64 `json:"resource_version,omitempty"`
+}
+
+// Snapshot returns the serializable state of the verifier.
+func (v *Verifier) Snapshot() VerifierSnapshot {
+	return VerifierSnapshot{
+		CreatedAt:    v.createdAt,
+		UpdatedAt:    v.updatedAt,
+		ID:           v.id,
+		CredentialID: v.credentialID,
+		Auth:         v.auth,
+		Data:         v.DataAll(),
+
+		ResourceVersion: v.resourceVersion,
+	}
+}
+
+// VerifierFromSnapshot restores a Verifier from its serialized state.
+func VerifierFromSnapshot(s VerifierSnapshot) (*Verifier, error) {
+	if s.ID == "" {
+		return nil, domain.ErrEmptyID
+	}
+	if s.CredentialID == "" || s.Auth == "" {
+		return nil, domain.ErrFieldEmpty
+	}
+	return &Verifier{
+		createdAt:    s.CreatedAt,
+		updatedAt:    s.UpdatedAt,
+		id:           s.ID,
+		credentialID: s.CredentialID,
+		auth:         s.Auth,
+		data:         copyStrings(s.Data),
+
+		resourceVersion: s.ResourceVersion,
+	}, nil
+}
+
+// SessionSnapshot is the serializable state of a Session.
+type SessionSnapshot struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at,omitzero"`
+
+	ID           string `json:"id"`
+	UserID       string `json:"user_id"`
+	CredentialID string `json:"credential_id"`
+
+	RefreshHash []byte    `json:"refresh_hash"`
+	Auth        kind.Auth `json:"auth"`
+
+	ResourceVersion uint64 `json:"resource_version,omitempty"`
+}
+
+// Snapshot returns the serializable state of the session.
+func (s *Session) Snapshot() SessionSnapshot {
+	return SessionSnapshot{
+		CreatedAt:    s.createdAt,
+		UpdatedAt:    s.updatedAt,
+		ExpiresAt:    s.expiresAt,
+		RevokedAt:    s.revokedAt,
+		ID:           s.id,
+		UserID:       s.userID,
+		CredentialID: s.credentialID,
+		RefreshHash:  s.RefreshHash(),
+		Auth:         s.auth,
+
+		ResourceVersion: s.resourceVersion,
+	}
+}
+
+// SessionFromSnapshot restores a Session from its serialized state.
+func SessionFromSnapshot(s SessionSnapshot) (*Session, error) {
+	if s.ID == "" {
+		return nil, domain.ErrEmptyID
+	}
+	if s.UserID == "" {
+		return nil, domain.ErrEmptyUserID
+	}
+	if s.CredentialID == "" || len(s.RefreshHash) == 0 || s.ExpiresAt.IsZero() {
+		return nil, domain.ErrFieldEmpty
+	}
+	return &Session{
+		createdAt:    s.CreatedAt,
+		updatedAt:    s.UpdatedAt,
+		expiresAt:    s.ExpiresAt,
+		revokedAt:    s.RevokedAt,
+		id:           s.ID,
+		userID:       s.UserID,
+		credentialID: s.CredentialID,
+		auth:         s.Auth,
+		refreshHash:  append([]byte(nil), s.RefreshHash...),
+
+		resourceVersion: s.ResourceVersion,
+	}, nil
+}
+
+// SpecSnapshot is the serializable state of a Spec.
+type SpecSnapshot struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name,omitempty"`
+	Version      int               `json:"version"`
+	Targets      []string          `json:"targets,omitempty"`
+	TargetLabels map[string]string `json:"target_labels,omitempty"`
+	Deployed     int               `json:"deployed_version,omitempty"`
+	Strategy     RolloutStrategy   `json:"strategy,omitzero"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+
+	Slot         string                 `json:"slot"`
+	KindType     kind.TaskKindType      `json:"kind_type"`
+	KindConfig   map[string]any         `json:"kind_config,omitempty"`
+	TimeoutMs    int64                  `json:"timeout_ms"`
+	RestartType  kind.RestartType       `json:"restart_type"`
+	IntervalMs   int64                  `json:"interval_ms,omitempty"`
+	Backoff      BackoffConfig          `json:"backoff"`
+	Admission    kind.AdmissionStrategy `json:"admission"`
+	RunnerLabels map[string]string      `json:"runner_labels,omitempty"`
+
+	ResourceVersion uint64 `json:"resource_version,omitempty"`
+}
+
+// Snapshot returns the serializable state of the spec.
+func (ts *Spec) Snapshot() SpecSnapshot {
+	return SpecSnapshot{
+		ID:           ts.id,
+		Name:         ts.name,
+		Version:      ts.version,
+		Targets:      ts.Targets(),
+		TargetLabels: ts.TargetLabels(),
+		Deployed:     ts.deployed,
+		Strategy:     ts.strategy,
+		CreatedAt:    ts.createdAt,
+		UpdatedAt:    ts.updatedAt,
+
+		Slot:         ts.slot,
+		KindType:     ts.kindType,
+		KindConfig:   ts.KindConfig(),
+		TimeoutMs:    ts.timeoutMs,
+		RestartType:  ts.restartType,
+		IntervalMs:   ts.intervalMs,
+		Backoff:      ts.backoff,
+		Admission:    ts.admission,
+		RunnerLabels: ts.RunnerLabels(),
+
+		ResourceVersion: ts.resourceVersion,
+	}
+}
+
+// SpecFromSnapshot restores a Spec from its serialized state.
+func SpecFromSnapshot(s SpecSnapshot) (*Spec, error) {
+	if s.ID == "" {
+		return nil, domain.ErrEmptyID
+	}
+	if s.Slot == "" {
+		return nil, domain.ErrFieldEmpty
+	}
+
+	targets := make([]string, len(s.Targets))
+	copy(targets, s.Targets)
+	kindConfig := make(map[string]any, len(s.KindConfig))
+	for k, v := range s.KindConfig {
+		kindConfig[k] = v
+	}
+
+	return &Spec{
+		id:           s.ID,
+		name:         s.Name,
+		version:      s.Version,
+		targets:      targets,
+		targetLabels: copyStrings(s.TargetLabels),
+		deployed:     s.Deployed,
+		strategy:     s.Strategy,
+		createdAt:    s.CreatedAt,
+		updatedAt:    s.UpdatedAt,
+
+		slot:         s.Slot,
+		kindType:     s.KindType,
+		kindConfig:   kindConfig,
+		timeoutMs:    s.TimeoutMs,
+		restartType:  s.RestartType,
+		intervalMs:   s.IntervalMs,
+		backoff:      s.Backoff,
+		admission:    s.Admission,
+		runnerLabels: copyStrings(s.RunnerLabels),
+
+		resourceVersion: s.ResourceVersion,
+	}, nil
+}
+
+// RolloutSnapshot is the serializable state of a Rollout.
+type RolloutSnapshot struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	LastPushedAt  time.Time `json:"last_pushed_at,omitzero"`
+	LastSyncedAt  time.Time `json:"last_synced_at,omitzero"`
+	HealthyAt     time.Time `json:"healthy_at,omitzero"`
+	NextAttemptAt time.Time `json:"next_attempt_at,omitzero"`
+
+	RetryDelayMs int64 `json:"retry_delay_ms,omitempty"`
+
+	ID      string `json:"id"`
+	SpecID  string `json:"spec_id"`
+	AgentID string `json:"agent_id"`
+	Slot    string `json:"slot,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	DesiredVersion int `json:"desired_version"`
+	ActualVersion  int `json:"actual_version"`
+	Attempts       int `json:"attempts,omitempty"`
+	Wave           int `json:"wave,omitempty"`
+
+	Status kind.SyncStatus `json:"status"`
+
+	ResourceVersion uint64 `json:"resource_version,omitempty"`
+}
+
+// Snapshot returns the serializable state of the rollout.
+func (ss *Rollout) Snapshot() RolloutSnapshot {
+	return RolloutSnapshot{
+		CreatedAt:     ss.createdAt,
+		UpdatedAt:     ss.updatedAt,
+		LastPushedAt:  ss.lastPushedAt,
+		LastSyncedAt:  ss.lastSyncedAt,
+		HealthyAt:     ss.healthyAt,
+		NextAttemptAt: ss.nextAttemptAt,
+
+		RetryDelayMs: ss.retryDelay.Milliseconds(),
+
+		ID:      ss.id,
+		SpecID:  ss.specID,
+		AgentID: ss.agentID,
+		Slot:    ss.slot,
+		Error:   ss.errMsg,
+
+		DesiredVersion: ss.desiredVersion,
+		ActualVersion:  ss.actualVersion,
+		Attempts:       ss.attempts,
+		Wave:           ss.wave,
+
+		Status: ss.status,
+
+		ResourceVersion: ss.resourceVersion,
+	}
+}
+
+// RolloutFromSnapshot restores a Rollout from its serialized state.
+func RolloutFromSnapshot(s RolloutSnapshot) (*Rollout, error) {
+	if s.ID == "" || s.SpecID == "" || s.AgentID == "" {
+		return nil, domain.ErrEmptyID
+	}
+	return &Rollout{
+		createdAt:     s.CreatedAt,
+		updatedAt:     s.UpdatedAt,
+		lastPushedAt:  s.LastPushedAt,
+		lastSyncedAt:  s.LastSyncedAt,
+		healthyAt:     s.HealthyAt,
+		nextAttemptAt: s.NextAttemptAt,
+
+		retryDelay: time.Duration(s.RetryDelayMs) * time.Millisecond,
+
+		id:      s.ID,
+		specID:  s.SpecID,
+		agentID: s.AgentID,
+		slot:    s.Slot,
+		errMsg:  s.Error,
+
+		desiredVersion: s.DesiredVersion,
+		actualVersion:  s.ActualVersion,
+		attempts:       s.Attempts,
+		wave:           s.Wave,
+
+		status: s.Status,
+
+		resourceVersion: s.ResourceVersion,
+	}, nil
+}
+
+// SpecRevisionSnapshot is the serializable state of a SpecRevision.
+type SpecRevisionSnapshot struct {
+	CreatedAt time.Time `json:"created_at"`
+
+	ID     string `json:"id"`
+	SpecID string `json:"spec_id"`
+	Author string `json:"author,omitempty"`
+
+	Version int          `json:"version"`
+	Spec    SpecSnapshot `json:"spec"`
+
+	ResourceVersion uint64 `json:"resource_version,omitempty"`
+}
+
+// Snapshot returns the serializable state of the revision.
+func (r *SpecRevision) Snapshot() SpecRevisionSnapshot {
+	return SpecRevisionSnapshot{
+		CreatedAt: r.createdAt,
+
+		ID:     r.id,
+		SpecID: r.specID,
+		Author: r.author,
+
+		Version: r.version,
+		Spec:    cloneSpecSnapshot(r.spec),
+
+		ResourceVersion: r.resourceVersion,
+	}
+}
+
+// SpecRevisionFromSnapshot restores a SpecRevision from its serialized state.
+func SpecRevisionFromSnapshot(s SpecRevisionSnapshot) (*SpecRevision, error) {
+	if s.ID == "" || s.SpecID == "" {
+		return nil, domain.ErrEmptyID
+	}
+	return &SpecRevision{
+		createdAt: s.CreatedAt,
+
+		id:     s.ID,
+		specID: s.SpecID,
+		author: s.Author,
+
+		version: s.Version,
+		spec:    cloneSpecSnapshot(s.Spec),
+
+		resourceVersion: s.ResourceVersion,
+	}, nil
+}
+
+func cloneSpecSnapshot(s SpecSnapshot) SpecSnapshot {
+	out := s
+	out.Targets = append([]string(nil), s.Targets...)
+	out.TargetLabels = copyStrings(s.TargetLabels)
+	out.RunnerLabels = copyStrings(s.RunnerLabels)
+	out.KindConfig = make(map[string]any, len(s.KindConfig))
+	for k, v := range s.KindConfig {
+		out.KindConfig[k] = v
+	}
+	return out
+}
+
+func copyStrings(in map[string]string) map[string]string {
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+// DeploymentSnapshot is the serializable state of a Deployment.
+type DeploymentSnapshot struct {
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ID     string `json:"id"`
+	SpecID string `json:"spec_id"`
+	Actor  string `json:"actor,omitempty"`
+
+	Version int                  `json:"version"`
+	State   kind.DeploymentState `json:"state"`
+
+	ResourceVersion uint64 `json:"resource_version,omitempty"`
+}
+
+// Snapshot returns the serializable state of the deployment.
+func (d *Deployment) Snapshot() DeploymentSnapshot {
+	return DeploymentSnapshot{
+		CreatedAt: d.createdAt,
+		UpdatedAt: d.updatedAt,
+
+		ID:     d.id,
+		SpecID: d.specID,
+		Actor:  d.actor,
+
+		Version: d.version,
+		State:   d.state,
+
+		ResourceVersion: d.resourceVersion,
+	}
+}
+
+// DeploymentFromSnapshot restores a Deployment from its serialized state.
+func DeploymentFromSnapshot(s DeploymentSnapshot) (*Deployment, error) {
+	if s.ID == "" || s.SpecID == "" {
+		return nil, domain.ErrEmptyID
+	}
+	return &Deployment{
+		createdAt: s.CreatedAt,
+		updatedAt: s.UpdatedAt,
+
+		id:     s.ID,
+		specID: s.SpecID,
+		actor:  s.Actor,
+
+		version: s.Version,
+		state:   s.State,
+
+		resourceVersion: s.ResourceVersion,
+	}, nil
+}
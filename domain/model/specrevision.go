@@ -0,0 +1,152 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain"
+)
+
+var _ domain.Entity[*SpecRevision] = (*SpecRevision)(nil)
+
+// SpecRevision is an immutable record of one version of a Spec.
+//
+// Every create, update and rollback of a spec stores a revision with the full content
+// of the new version, so any earlier definition can be inspected, diffed and restored.
+type SpecRevision struct {
+	createdAt time.Time
+
+	id     string
+	specID string
+	author string
+
+	version int
+	spec    SpecSnapshot
+
+	resourceVersion uint64 // assigned by storage on every write
+}
+
+// SpecRevisionID returns the deterministic identifier of a spec version.
+func SpecRevisionID(specID string, version int) string {
+	return "rev-" + specID + "-" + strconv.Itoa(version)
+}
+
+// NewSpecRevision records the current content of ts; author is the subject that made the change.
+func NewSpecRevision(ts *Spec, author string) (*SpecRevision, error) {
+	if ts == nil || ts.ID() == "" {
+		return nil, domain.ErrEmptyID
+	}
+	content := ts.Snapshot()
+	content.ResourceVersion = 0
+	content.Deployed = 0
+
+	return &SpecRevision{
+		createdAt: time.Now(),
+
+		id:     SpecRevisionID(ts.ID(), ts.Version()),
+		specID: ts.ID(),
+		author: author,
+
+		version: ts.Version(),
+		spec:    content,
+	}, nil
+}
+
+// ID returns the revision's unique identifier.
+func (r *SpecRevision) ID() string { return r.id }
+
+// SpecID returns the ID of the spec this revision belongs to.
+func (r *SpecRevision) SpecID() string { return r.specID }
+
+// Version returns the spec version recorded by this revision.
+func (r *SpecRevision) Version() int { return r.version }
+
+// Author returns the subject that created this version (empty for system changes).
+func (r *SpecRevision) Author() string { return r.author }
+
+// CreatedAt returns when the version was recorded.
+func (r *SpecRevision) CreatedAt() time.Time { return r.createdAt }
+
+// UpdatedAt returns the creation timestamp; revisions never change.
+func (r *SpecRevision) UpdatedAt() time.Time { return r.createdAt }
+
+// ResourceVersion returns the storage revision of the last write (0 if never stored).
+func (r *SpecRevision) ResourceVersion() uint64 { return r.resourceVersion }
+
+// SetResourceVersion sets the storage revision.
+func (r *SpecRevision) SetResourceVersion(rv uint64) { r.resourceVersion = rv }
+
+// Spec returns the spec as it was at this version.
+func (r *SpecRevision) Spec() (*Spec, error) {
+	return SpecFromSnapshot(r.spec)
+}
+
+// Clone creates a deep copy of the SpecRevision.
+func (r *SpecRevision) Clone() *SpecRevision {
+	out := *r
+	out.spec = cloneSpecSnapshot(r.spec)
+	return &out
+}
+
+// SpecChange is a difference in one field between two spec versions.
+//
+// Field is the snapshot JSON name; a nil From or To means the field was unset.
+type SpecChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from,omitempty"`
+	To    any    `json:"to,omitempty"`
+}
+
+// specMetaFields are snapshot fields that change with every version and are not content.
+var specMetaFields = map[string]struct{}{
+	"id":               {},
+	"version":          {},
+	"deployed_version": {},
+	"created_at":       {},
+	"updated_at":       {},
+	"resource_version": {},
+}
+
+// DiffSpecs returns the content changes from one spec version to another, sorted by field.
+func DiffSpecs(from, to *Spec) []SpecChange {
+	a, b := contentFields(from), contentFields(to)
+
+	fields := make(map[string]struct{}, len(a)+len(b))
+	for k := range a {
+		fields[k] = struct{}{}
+	}
+	for k := range b {
+		fields[k] = struct{}{}
+	}
+
+	var out []SpecChange
+	for k := range fields {
+		if !reflect.DeepEqual(a[k], b[k]) {
+			out = append(out, SpecChange{Field: k, From: a[k], To: b[k]})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Field < out[j].Field })
+	return out
+}
+
+// contentFields returns the snapshot of ts as generic JSON values, without metadata fields.
+func contentFields(ts *Spec) map[string]any {
+	out := make(map[string]any)
+	if ts == nil {
+		return out
+	}
+	data, err := json.Marshal(ts.Snapshot())
+	if err != nil {
+		return out
+	}
+	if err = json.Unmarshal(data, &out); err != nil {
+		return out
+	}
+	for k := range specMetaFields {
+		delete(out, k)
+	}
+	return out
+}
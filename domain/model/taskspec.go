@@ -1,6 +1,10 @@
 package model
 
 import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"sort"
 	"time"
 
 	"github.com/soltiHQ/control-plane/domain"
@@ -11,10 +15,82 @@ var _ domain.Entity[*Spec] = (*Spec)(nil)
 
 // BackoffConfig holds backoff parameters for task restart delays.
 type BackoffConfig struct {
-	Jitter  kind.JitterStrategy
-	FirstMs int64
-	MaxMs   int64
-	Factor  float64
+	Jitter  kind.JitterStrategy `json:"jitter"`
+	FirstMs int64               `json:"first_ms"`
+	MaxMs   int64               `json:"max_ms"`
+	Factor  float64             `json:"factor"`
+}
+
+// Delay returns the wait before retry number attempt (1 for the first retry): FirstMs grown
+// by Factor per attempt, capped at MaxMs, with the Jitter strategy applied.
+//
+// Decorrelated jitter does not use attempt: it picks between FirstMs and three times prev,
+// the delay actually waited before the previous retry (FirstMs for the first one), capped at MaxMs.
+func (b BackoffConfig) Delay(attempt int, prev time.Duration) time.Duration {
+	limit := float64(max(b.MaxMs, b.FirstMs))
+	ms := min(float64(b.FirstMs)*math.Pow(max(b.Factor, 1), float64(max(attempt-1, 0))), limit)
+	switch b.Jitter {
+	case kind.JitterFull:
+		ms = rand.Float64() * ms
+	case kind.JitterEqual:
+		ms = ms/2 + rand.Float64()*ms/2
+	case kind.JitterDecorrelated:
+		lo := float64(b.FirstMs)
+		hi := min(3*max(float64(prev)/float64(time.Millisecond), lo), limit)
+		ms = lo + rand.Float64()*max(hi-lo, 0)
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// RolloutStrategy controls how a deploy is spread over the target agents.
+//
+// Targets are split into waves: an optional canary wave (CanaryCount agents, or CanaryPercent
+// of the targets rounded up), then waves of BatchSize agents (all remaining ones if 0).
+// A wave is released only when every earlier wave is healthy and PauseMs has passed since;
+// more than MaxUnavailable unhealthy agents (task failed, or push retries exhausted) halt the rollout.
+// The zero value deploys to every target at once.
+type RolloutStrategy struct {
+	CanaryCount    int   `json:"canary_count,omitempty"`
+	CanaryPercent  int   `json:"canary_percent,omitempty"`
+	BatchSize      int   `json:"batch_size,omitempty"`
+	PauseMs        int64 `json:"pause_ms,omitempty"`
+	MaxUnavailable int   `json:"max_unavailable,omitempty"`
+}
+
+// Progressive reports whether the strategy splits a deploy into more than one wave.
+func (s RolloutStrategy) Progressive() bool {
+	return s.CanaryCount > 0 || s.CanaryPercent > 0 || s.BatchSize > 0
+}
+
+// Validate returns domain.ErrInvalidStrategy for negative values or a percentage above 100.
+func (s RolloutStrategy) Validate() error {
+	if s.CanaryCount < 0 || s.CanaryPercent < 0 || s.CanaryPercent > 100 ||
+		s.BatchSize < 0 || s.PauseMs < 0 || s.MaxUnavailable < 0 {
+		return domain.ErrInvalidStrategy
+	}
+	return nil
+}
+
+// WaveOf returns the wave of the i-th of n ordered targets; wave 0 is released at deploy time.
+func (s RolloutStrategy) WaveOf(i, n int) int {
+	canary := s.CanaryCount
+	if canary == 0 && s.CanaryPercent > 0 {
+		canary = (n*s.CanaryPercent + 99) / 100
+	}
+	canary = min(canary, n)
+
+	switch {
+	case canary > 0 && i < canary:
+		return 0
+	case canary > 0 && s.BatchSize > 0:
+		return 1 + (i-canary)/s.BatchSize
+	case canary > 0:
+		return 1
+	case s.BatchSize > 0:
+		return i / s.BatchSize
+	default:
+		return 0
+	}
 }
 
 // Spec represents a desired task specification managed by the control-plane.
@@ -31,6 +107,8 @@ type Spec struct {
 	version      int
 	targets      []string          // concrete agent IDs
 	targetLabels map[string]string // label selector for dynamic targeting
+	deployed     int               // version of the last deploy, 0 if never deployed
+	strategy     RolloutStrategy   // how deploys are spread over the targets
 	createdAt    time.Time
 	updatedAt    time.Time
 
@@ -44,6 +122,8 @@ type Spec struct {
 	backoff      BackoffConfig
 	admission    kind.AdmissionStrategy
 	runnerLabels map[string]string
+
+	resourceVersion uint64 // assigned by storage on every write
 }
 
 // NewSpec creates a new Spec domain entity with sensible defaults.
@@ -97,6 +177,18 @@ func (ts *Spec) IntervalMs() int64                  { return ts.intervalMs }
 func (ts *Spec) Backoff() BackoffConfig             { return ts.backoff }
 func (ts *Spec) Admission() kind.AdmissionStrategy  { return ts.admission }
 
+// ResourceVersion returns the storage revision of the last write (0 if never stored).
+func (ts *Spec) ResourceVersion() uint64 { return ts.resourceVersion }
+
+// SetResourceVersion sets the storage revision; a non-zero value makes the next upsert conditional.
+func (ts *Spec) SetResourceVersion(rv uint64) { ts.resourceVersion = rv }
+
+// DeployedVersion returns the version of the last deploy (0 if the spec was never deployed).
+func (ts *Spec) DeployedVersion() int { return ts.deployed }
+
+// Strategy returns the rollout strategy of the spec.
+func (ts *Spec) Strategy() RolloutStrategy { return ts.strategy }
+
 // KindConfig returns a defensive copy of the kind configuration.
 func (ts *Spec) KindConfig() map[string]any {
 	out := make(map[string]any, len(ts.kindConfig))
@@ -106,6 +198,11 @@ func (ts *Spec) KindConfig() map[string]any {
 	return out
 }
 
+// TypedKindConfig parses the kind configuration; see ParseKindConfig.
+func (ts *Spec) TypedKindConfig() (KindConfig, error) {
+	return ParseKindConfig(ts.kindType, ts.kindConfig)
+}
+
 // Targets returns a copy of the target agent IDs.
 func (ts *Spec) Targets() []string {
 	out := make([]string, len(ts.targets))
@@ -122,6 +219,28 @@ func (ts *Spec) TargetLabels() map[string]string {
 	return out
 }
 
+// ResolveTargets returns the explicit targets followed by the IDs of matched, the agents
+// matching TargetLabels, sorted so waves are stable across deploys, without duplicates.
+func (ts *Spec) ResolveTargets(matched []*Agent) []string {
+	var (
+		out  = ts.Targets()
+		seen = make(map[string]struct{}, len(out)+len(matched))
+		ids  []string
+	)
+	for _, id := range out {
+		seen[id] = struct{}{}
+	}
+	for _, a := range matched {
+		if _, dup := seen[a.ID()]; dup {
+			continue
+		}
+		seen[a.ID()] = struct{}{}
+		ids = append(ids, a.ID())
+	}
+	sort.Strings(ids)
+	return append(out, ids...)
+}
+
 // RunnerLabels returns a defensive copy of the runner labels.
 func (ts *Spec) RunnerLabels() map[string]string {
 	out := make(map[string]string, len(ts.runnerLabels))
@@ -182,6 +301,11 @@ func (ts *Spec) SetAdmission(a kind.AdmissionStrategy) {
 	ts.updatedAt = time.Now()
 }
 
+func (ts *Spec) SetStrategy(s RolloutStrategy) {
+	ts.strategy = s
+	ts.updatedAt = time.Now()
+}
+
 func (ts *Spec) SetTargets(targets []string) {
 	cp := make([]string, len(targets))
 	copy(cp, targets)
@@ -207,12 +331,95 @@ func (ts *Spec) SetRunnerLabels(labels map[string]string) {
 	ts.updatedAt = time.Now()
 }
 
+// SetContent replaces the definition (name, targets and every agent-facing field) with the one of src.
+//
+// Identity, version, timestamps and the deployed version are kept; used to roll back to a revision.
+func (ts *Spec) SetContent(src *Spec) {
+	c := src.Clone()
+	ts.name = c.name
+	ts.targets = c.targets
+	ts.targetLabels = c.targetLabels
+	ts.strategy = c.strategy
+	ts.slot = c.slot
+	ts.kindType = c.kindType
+	ts.kindConfig = c.kindConfig
+	ts.timeoutMs = c.timeoutMs
+	ts.restartType = c.restartType
+	ts.intervalMs = c.intervalMs
+	ts.backoff = c.backoff
+	ts.admission = c.admission
+	ts.runnerLabels = c.runnerLabels
+	ts.updatedAt = time.Now()
+}
+
 // IncrementVersion bumps the version number and updates the timestamp.
 func (ts *Spec) IncrementVersion() {
 	ts.version++
 	ts.updatedAt = time.Now()
 }
 
+// MarkDeployed records that the current version has been deployed.
+func (ts *Spec) MarkDeployed() {
+	ts.deployed = ts.version
+	ts.updatedAt = time.Now()
+}
+
+// MarkUndeployed records that no version is deployed anymore.
+func (ts *Spec) MarkUndeployed() {
+	ts.deployed = 0
+	ts.updatedAt = time.Now()
+}
+
+// Validate checks the agent-facing fields of the spec: the kind and its typed configuration,
+// the restart, jitter and admission enums, the timeout and the backoff bounds.
+//
+// Returns domain.FieldErrors keyed by the spec request field names (e.g. "kind_config.command",
+// "backoff_max_ms") listing every problem found.
+func (ts *Spec) Validate() error {
+	errs := make(domain.FieldErrors)
+	if ts.slot == "" {
+		errs.Add("slot", "is required")
+	}
+
+	if _, err := ts.TypedKindConfig(); err != nil {
+		var fields domain.FieldErrors
+		if !errors.As(err, &fields) {
+			return err
+		}
+		for f, problem := range fields {
+			errs.Add(f, problem)
+		}
+	}
+
+	if ts.timeoutMs <= 0 {
+		errs.Add("timeout_ms", "must be positive")
+	}
+	if !ts.restartType.Valid() {
+		errs.Add("restart_type", "must be one of never, onFailure, always")
+	}
+	if ts.intervalMs < 0 {
+		errs.Add("interval_ms", "must not be negative")
+	}
+	if !ts.admission.Valid() {
+		errs.Add("admission", "must be one of dropIfRunning, replace, queue")
+	}
+
+	b := ts.backoff
+	if !b.Jitter.Valid() {
+		errs.Add("jitter", "must be one of none, full, equal, decorrelated")
+	}
+	if b.FirstMs <= 0 {
+		errs.Add("backoff_first_ms", "must be positive")
+	}
+	if b.MaxMs < b.FirstMs {
+		errs.Add("backoff_max_ms", "must not be below backoff_first_ms")
+	}
+	if !(b.Factor >= 1) || math.IsInf(b.Factor, 0) {
+		errs.Add("backoff_factor", "must be a finite number of at least 1")
+	}
+	return errs.Err()
+}
+
 // ToCreateSpec builds a map[string]any in the agent's CreateSpec JSON format.
 //
 // Example output:
@@ -221,10 +428,14 @@ func (ts *Spec) IncrementVersion() {
 //	 "restart":{"type":"never"},"backoff":{"jitter":"none","firstMs":1000,"maxMs":5000,"factor":2.0},
 //	 "admission":"dropIfRunning"}
 func (ts *Spec) ToCreateSpec() map[string]any {
-	// kind
+	// kind: normalized through the typed config when it parses, passed through as stored otherwise
 	kindCfg := make(map[string]any, len(ts.kindConfig))
-	for k, v := range ts.kindConfig {
-		kindCfg[k] = v
+	if typed, err := ts.TypedKindConfig(); err == nil {
+		kindCfg = typed.Map()
+	} else {
+		for k, v := range ts.kindConfig {
+			kindCfg[k] = v
+		}
 	}
 
 	// restart
@@ -279,6 +490,8 @@ func (ts *Spec) Clone() *Spec {
 		version:      ts.version,
 		targets:      targets,
 		targetLabels: targetLabels,
+		deployed:     ts.deployed,
+		strategy:     ts.strategy,
 		createdAt:    ts.createdAt,
 		updatedAt:    ts.updatedAt,
 
@@ -291,5 +504,7 @@ func (ts *Spec) Clone() *Spec {
 		backoff:      ts.backoff,
 		admission:    ts.admission,
 		runnerLabels: runnerLabels,
+
+		resourceVersion: ts.resourceVersion,
 	}
 }
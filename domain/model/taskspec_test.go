@@ -0,0 +1,163 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain"
+	"github.com/soltiHQ/control-plane/domain/kind"
+)
+
+func TestSpec_Validate(t *testing.T) {
+	t.Parallel()
+
+	backoff := func(jitter kind.JitterStrategy, first, max int64, factor float64) func(*Spec) {
+		return func(ts *Spec) {
+			ts.SetBackoff(BackoffConfig{Jitter: jitter, FirstMs: first, MaxMs: max, Factor: factor})
+		}
+	}
+	cases := []struct {
+		name   string
+		change func(*Spec)
+		fields []string // nil: valid
+	}{
+		{"defaults", func(*Spec) {}, nil},
+		{"max equal to first", backoff(kind.JitterFull, 1000, 1000, 1), nil},
+		{"empty slot", func(ts *Spec) { ts.SetSlot("") }, []string{"slot"}},
+		{"unknown kind", func(ts *Spec) { ts.SetKindType("vm") }, []string{"kind_type"}},
+		{"kind config", func(ts *Spec) { ts.SetKindConfig(map[string]any{"args": 1}) }, []string{"kind_config.args", "kind_config.command"}},
+		{"zero timeout", func(ts *Spec) { ts.SetTimeoutMs(0) }, []string{"timeout_ms"}},
+		{"negative interval", func(ts *Spec) { ts.SetIntervalMs(-1) }, []string{"interval_ms"}},
+		{"restart enum", func(ts *Spec) { ts.SetRestartType("sometimes") }, []string{"restart_type"}},
+		{"admission enum", func(ts *Spec) { ts.SetAdmission("skip") }, []string{"admission"}},
+		{"jitter enum", backoff("random", 1000, 5000, 2), []string{"jitter"}},
+		{"zero first", backoff(kind.JitterNone, 0, 5000, 2), []string{"backoff_first_ms"}},
+		{"max below first", backoff(kind.JitterNone, 5000, 1000, 2), []string{"backoff_max_ms"}},
+		{"factor below 1", backoff(kind.JitterNone, 1000, 5000, 0.5), []string{"backoff_factor"}},
+		{"NaN factor", backoff(kind.JitterNone, 1000, 5000, math.NaN()), []string{"backoff_factor"}},
+		{"infinite factor", backoff(kind.JitterNone, 1000, 5000, math.Inf(1)), []string{"backoff_factor"}},
+		{
+			name: "every problem at once",
+			change: func(ts *Spec) {
+				ts.SetTimeoutMs(-5)
+				ts.SetAdmission("")
+				backoff("", -1, -2, math.Inf(-1))(ts)
+			},
+			fields: []string{"admission", "backoff_factor", "backoff_first_ms", "backoff_max_ms", "jitter", "timeout_ms"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ts, err := NewSpec("s1", "s1", "slot")
+			if err != nil {
+				t.Fatalf("NewSpec: %v", err)
+			}
+			ts.SetKindConfig(map[string]any{"command": "sleep"})
+			tc.change(ts)
+
+			err = ts.Validate()
+			if tc.fields == nil {
+				if err != nil {
+					t.Fatalf("expected a valid spec, got %v", err)
+				}
+				return
+			}
+			var fields domain.FieldErrors
+			if !errors.As(err, &fields) || !errors.Is(err, domain.ErrInvalidFields) {
+				t.Fatalf("expected FieldErrors, got %v", err)
+			}
+			got := make([]string, 0, len(fields))
+			for f := range fields {
+				got = append(got, f)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tc.fields) {
+				t.Fatalf("invalid fields %v, want %v", got, tc.fields)
+			}
+		})
+	}
+}
+
+func TestBackoffConfig_Delay(t *testing.T) {
+	t.Parallel()
+
+	const ms = time.Millisecond
+	cases := []struct {
+		name    string
+		jitter  kind.JitterStrategy
+		attempt int
+		prev    time.Duration
+		lo, hi  time.Duration
+	}{
+		{"none first", kind.JitterNone, 1, 0, 100 * ms, 100 * ms},
+		{"none grows", kind.JitterNone, 3, 0, 400 * ms, 400 * ms},
+		{"none capped", kind.JitterNone, 10, 0, 1000 * ms, 1000 * ms},
+		{"full", kind.JitterFull, 3, 0, 0, 400 * ms},
+		{"full capped", kind.JitterFull, 10, 0, 0, 1000 * ms},
+		{"equal", kind.JitterEqual, 3, 0, 200 * ms, 400 * ms},
+		{"decorrelated first", kind.JitterDecorrelated, 1, 0, 100 * ms, 300 * ms},
+		{"decorrelated from previous", kind.JitterDecorrelated, 2, 150 * ms, 100 * ms, 450 * ms},
+		{"decorrelated ignores attempt", kind.JitterDecorrelated, 9, 120 * ms, 100 * ms, 360 * ms},
+		{"decorrelated capped", kind.JitterDecorrelated, 2, 900 * ms, 100 * ms, 1000 * ms},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := BackoffConfig{Jitter: tc.jitter, FirstMs: 100, MaxMs: 1000, Factor: 2}
+			for range 200 {
+				if d := b.Delay(tc.attempt, tc.prev); d < tc.lo || d > tc.hi {
+					t.Fatalf("Delay(%d, %v) = %v, want within [%v, %v]", tc.attempt, tc.prev, d, tc.lo, tc.hi)
+				}
+			}
+		})
+	}
+}
+
+func TestSpec_ResolveTargets(t *testing.T) {
+	t.Parallel()
+
+	agents := func(ids ...string) []*Agent {
+		out := make([]*Agent, 0, len(ids))
+		for _, id := range ids {
+			a, err := NewAgent(id, id, "http://"+id)
+			if err != nil {
+				t.Fatalf("NewAgent: %v", err)
+			}
+			out = append(out, a)
+		}
+		return out
+	}
+	cases := []struct {
+		name     string
+		explicit []string
+		matched  []*Agent
+		want     []string
+	}{
+		{"none", nil, nil, []string{}},
+		{"explicit keep their order", []string{"b", "a"}, nil, []string{"b", "a"}},
+		{"matched are sorted", nil, agents("c", "a", "b"), []string{"a", "b", "c"}},
+		{"explicit first", []string{"z"}, agents("b", "a"), []string{"z", "a", "b"}},
+		{"duplicates dropped", []string{"b"}, agents("b", "a", "a"), []string{"b", "a"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ts, err := NewSpec("s1", "s1", "slot")
+			if err != nil {
+				t.Fatalf("NewSpec: %v", err)
+			}
+			ts.SetTargets(tc.explicit)
+			if got := ts.ResolveTargets(tc.matched); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("ResolveTargets = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
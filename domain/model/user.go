@@ -35,6 +35,8 @@ type User struct {
 	permissions []kind.Permission
 
 	disabled bool
+
+	resourceVersion uint64 // assigned by storage on every write
 }
 
 // NewUser creates a new user domain entity.
@@ -79,6 +81,12 @@ func (u *User) CreatedAt() time.Time { return u.createdAt }
 // UpdatedAt returns the timestamp of the last modification.
 func (u *User) UpdatedAt() time.Time { return u.updatedAt }
 
+// ResourceVersion returns the storage revision of the last write (0 if never stored).
+func (u *User) ResourceVersion() uint64 { return u.resourceVersion }
+
+// SetResourceVersion sets the storage revision; a non-zero value makes the next upsert conditional.
+func (u *User) SetResourceVersion(rv uint64) { u.resourceVersion = rv }
+
 // EmailAdd updates the user's email.
 func (u *User) EmailAdd(email string) {
 	if u.email == email {
@@ -264,5 +272,7 @@ func (u *User) Clone() *User {
 		roleIDs:     roleIDs,
 		permissions: perms,
 		disabled:    u.disabled,
+
+		resourceVersion: u.resourceVersion,
 	}
 }
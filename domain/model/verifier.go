@@ -30,6 +30,8 @@ type Verifier struct {
 
 	// Contains auth-kind specific verifier payload (e.g., password hash/params).
 	data map[string]string
+
+	resourceVersion uint64 // assigned by storage on every write
 }
 
 // NewVerifier creates a new verifier entity.
@@ -70,6 +72,12 @@ func (v *Verifier) CreatedAt() time.Time { return v.createdAt }
 // UpdatedAt returns the timestamp of the last modification.
 func (v *Verifier) UpdatedAt() time.Time { return v.updatedAt }
 
+// ResourceVersion returns the storage revision of the last write (0 if never stored).
+func (v *Verifier) ResourceVersion() uint64 { return v.resourceVersion }
+
+// SetResourceVersion sets the storage revision; a non-zero value makes the next upsert conditional.
+func (v *Verifier) SetResourceVersion(rv uint64) { v.resourceVersion = rv }
+
 // DataGet returns a verifier data value by key.
 func (v *Verifier) DataGet(key string) (string, bool) {
 	val, ok := v.data[key]
@@ -118,5 +126,7 @@ func (v *Verifier) Clone() *Verifier {
 		credentialID: v.credentialID,
 		auth:         v.auth,
 		data:         out,
+
+		resourceVersion: v.resourceVersion,
 	}
 }
@@ -0,0 +1,308 @@
+// Package selector implements label selectors:
+//   - Parsing of the Kubernetes-style selector syntax into a backend-agnostic AST
+//   - Evaluation of a parsed selector against a label set.
+//
+// Grammar (requirements are separated by commas and ANDed together):
+//
+//	env=prod        env==prod       label "env" is "prod"
+//	tier!=db                        label "tier" is absent or not "db"
+//	env in (prod,stage)             label "env" is one of the values
+//	env notin (dev)                 label "env" is absent or none of the values
+//	region                          label "region" is present
+//	!canary                         label "canary" is absent
+//
+// The empty selector has no requirements and matches every label set.
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalid indicates that a selector expression cannot be parsed.
+var ErrInvalid = errors.New("invalid label selector")
+
+// Operator is the comparison applied by a Requirement.
+type Operator uint8
+
+const (
+	OpEquals       Operator = iota // key=value, key==value
+	OpNotEquals                    // key!=value
+	OpIn                           // key in (v1,v2)
+	OpNotIn                        // key notin (v1,v2)
+	OpExists                       // key
+	OpDoesNotExist                 // !key
+)
+
+// String returns the operator as written in a selector.
+func (o Operator) String() string {
+	switch o {
+	case OpEquals:
+		return "="
+	case OpNotEquals:
+		return "!="
+	case OpIn:
+		return "in"
+	case OpNotIn:
+		return "notin"
+	case OpExists:
+		return "exists"
+	case OpDoesNotExist:
+		return "!"
+	default:
+		return "unknown"
+	}
+}
+
+// Requirement is a single condition on one label key.
+//
+// Values holds one value for OpEquals / OpNotEquals, one or more (sorted, unique)
+// for OpIn / OpNotIn, and none for OpExists / OpDoesNotExist.
+type Requirement struct {
+	Key    string
+	Op     Operator
+	Values []string
+}
+
+// Matches reports whether labels satisfy the requirement.
+func (r Requirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+	switch r.Op {
+	case OpEquals, OpIn:
+		return ok && r.has(v)
+	case OpNotEquals, OpNotIn:
+		return !ok || !r.has(v)
+	case OpExists:
+		return ok
+	case OpDoesNotExist:
+		return !ok
+	default:
+		return false
+	}
+}
+
+func (r Requirement) has(v string) bool {
+	for _, want := range r.Values {
+		if want == v {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the requirement in selector syntax.
+func (r Requirement) String() string {
+	switch r.Op {
+	case OpEquals, OpNotEquals:
+		return r.Key + r.Op.String() + strings.Join(r.Values, "")
+	case OpIn, OpNotIn:
+		return r.Key + " " + r.Op.String() + " (" + strings.Join(r.Values, ",") + ")"
+	case OpDoesNotExist:
+		return "!" + r.Key
+	default:
+		return r.Key
+	}
+}
+
+// Selector is a conjunction of requirements.
+type Selector []Requirement
+
+// Empty reports whether the selector has no requirements (matches everything).
+func (s Selector) Empty() bool { return len(s) == 0 }
+
+// Matches reports whether labels satisfy every requirement.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the selector in selector syntax; Parse(s.String()) yields an equal selector.
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// Parse parses a selector expression.
+//
+// Returns an error wrapping ErrInvalid if the expression is malformed.
+func Parse(expr string) (Selector, error) {
+	p := &parser{in: expr}
+	var out Selector
+
+	p.skipSpace()
+	if p.eof() {
+		return out, nil
+	}
+	for {
+		r, err := p.requirement()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+
+		p.skipSpace()
+		if p.eof() {
+			return out, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expected ','")
+		}
+	}
+}
+
+// FromLabels returns the selector requiring every key of labels to have its value.
+//
+// An empty map yields the empty selector, which matches everything.
+func FromLabels(labels map[string]string) Selector {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make(Selector, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, Requirement{Key: k, Op: OpEquals, Values: []string{labels[k]}})
+	}
+	return out
+}
+
+// parser is a recursive-descent parser over a selector expression.
+type parser struct {
+	in  string
+	pos int
+}
+
+func (p *parser) requirement() (Requirement, error) {
+	p.skipSpace()
+	if p.consume("!") {
+		key, err := p.key()
+		if err != nil {
+			return Requirement{}, err
+		}
+		return Requirement{Key: key, Op: OpDoesNotExist}, nil
+	}
+
+	key, err := p.key()
+	if err != nil {
+		return Requirement{}, err
+	}
+
+	p.skipSpace()
+	switch {
+	case p.eof() || p.peek() == ',':
+		return Requirement{Key: key, Op: OpExists}, nil
+	case p.consume("=="), p.consume("="):
+		return p.single(key, OpEquals)
+	case p.consume("!="):
+		return p.single(key, OpNotEquals)
+	case p.consumeWord("notin"):
+		return p.set(key, OpNotIn)
+	case p.consumeWord("in"):
+		return p.set(key, OpIn)
+	default:
+		return Requirement{}, p.errorf("expected operator after %q", key)
+	}
+}
+
+func (p *parser) single(key string, op Operator) (Requirement, error) {
+	p.skipSpace()
+	return Requirement{Key: key, Op: op, Values: []string{p.word()}}, nil
+}
+
+func (p *parser) set(key string, op Operator) (Requirement, error) {
+	p.skipSpace()
+	if !p.consume("(") {
+		return Requirement{}, p.errorf("expected '(' after %s", op)
+	}
+
+	seen := make(map[string]struct{})
+	for {
+		p.skipSpace()
+		v := p.word()
+		if v == "" {
+			return Requirement{}, p.errorf("expected value in value set")
+		}
+		seen[v] = struct{}{}
+		p.skipSpace()
+		if p.consume(")") {
+			break
+		}
+		if !p.consume(",") {
+			return Requirement{}, p.errorf("expected ',' or ')' in value set")
+		}
+	}
+
+	values := make([]string, 0, len(seen))
+	for v := range seen {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return Requirement{Key: key, Op: op, Values: values}, nil
+}
+
+func (p *parser) key() (string, error) {
+	p.skipSpace()
+	k := p.word()
+	if k == "" {
+		return "", p.errorf("expected label key")
+	}
+	return k, nil
+}
+
+// word consumes a run of label characters; it may be empty.
+func (p *parser) word() string {
+	start := p.pos
+	for !p.eof() && isLabelChar(p.peek()) {
+		p.pos++
+	}
+	return p.in[start:p.pos]
+}
+
+// consumeWord consumes w when it is followed by a non-label character, so "in" does not match "inner".
+func (p *parser) consumeWord(w string) bool {
+	if !strings.HasPrefix(p.in[p.pos:], w) {
+		return false
+	}
+	end := p.pos + len(w)
+	if end < len(p.in) && isLabelChar(p.in[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *parser) consume(tok string) bool {
+	if strings.HasPrefix(p.in[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) peek() byte { return p.in[p.pos] }
+func (p *parser) eof() bool  { return p.pos >= len(p.in) }
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: at offset %d: %s", ErrInvalid, p.pos, fmt.Sprintf(format, args...))
+}
+
+func isLabelChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '_' || c == '.' || c == '/'
+}
@@ -0,0 +1,155 @@
+package selector
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		expr string
+		want Selector
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"env=prod", Selector{{Key: "env", Op: OpEquals, Values: []string{"prod"}}}},
+		{"env==prod", Selector{{Key: "env", Op: OpEquals, Values: []string{"prod"}}}},
+		{"tier!=db", Selector{{Key: "tier", Op: OpNotEquals, Values: []string{"db"}}}},
+		{"env in (stage,prod,stage)", Selector{{Key: "env", Op: OpIn, Values: []string{"prod", "stage"}}}},
+		{"env notin (dev)", Selector{{Key: "env", Op: OpNotIn, Values: []string{"dev"}}}},
+		{"region", Selector{{Key: "region", Op: OpExists}}},
+		{"!canary", Selector{{Key: "canary", Op: OpDoesNotExist}}},
+		{"inner", Selector{{Key: "inner", Op: OpExists}}},
+		{"zone=eu-west/1.a_b", Selector{{Key: "zone", Op: OpEquals, Values: []string{"eu-west/1.a_b"}}}},
+		{"env=", Selector{{Key: "env", Op: OpEquals, Values: []string{""}}}},
+		{
+			"  env = prod ,\ttier in ( a , b ) , ! canary , region ",
+			Selector{
+				{Key: "env", Op: OpEquals, Values: []string{"prod"}},
+				{Key: "tier", Op: OpIn, Values: []string{"a", "b"}},
+				{Key: "canary", Op: OpDoesNotExist},
+				{Key: "region", Op: OpExists},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := Parse(tc.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tc.expr, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Parse(%q) = %#v, want %#v", tc.expr, got, tc.want)
+			}
+
+			again, err := Parse(got.String())
+			if err != nil || !reflect.DeepEqual(again, got) {
+				t.Fatalf("round trip of %q through %q = %#v, %v", tc.expr, got.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		expr   string
+		offset string
+	}{
+		{",", "at offset 0: expected label key"},
+		{"!", "at offset 1: expected label key"},
+		{"env=prod,", "at offset 9: expected label key"},
+		{"env>prod", "at offset 3: expected operator"},
+		{"env=prod;", "at offset 8: expected ','"},
+		{"env=prod tier=db", "at offset 9: expected ','"},
+		{"env in prod", "at offset 7: expected '(' after in"},
+		{"env notin dev", "at offset 10: expected '(' after notin"},
+		{"env in ()", "at offset 8: expected value in value set"},
+		{"env in (a b)", "at offset 10: expected ',' or ')'"},
+		{"env in (a,", "at offset 10: expected value in value set"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse(tc.expr)
+			if !errors.Is(err, ErrInvalid) {
+				t.Fatalf("Parse(%q): expected ErrInvalid, got %v", tc.expr, err)
+			}
+			if !strings.Contains(err.Error(), tc.offset) {
+				t.Fatalf("Parse(%q): error %q does not contain %q", tc.expr, err, tc.offset)
+			}
+		})
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	t.Parallel()
+
+	labels := map[string]string{"env": "prod", "tier": "edge", "region": "eu"}
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env=dev", false},
+		{"missing=x", false},
+		{"env!=dev", true},
+		{"env!=prod", false},
+		{"missing!=x", true},
+		{"env in (dev,prod)", true},
+		{"env in (dev,stage)", false},
+		{"missing in (x)", false},
+		{"env notin (dev)", true},
+		{"env notin (prod)", false},
+		{"missing notin (x)", true},
+		{"region", true},
+		{"missing", false},
+		{"!missing", true},
+		{"!region", false},
+		{"env=prod,tier=edge", true},
+		{"env=prod,tier=core", false},
+	}
+	for _, tc := range cases {
+		sel, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.expr, err)
+		}
+		if got := sel.Matches(labels); got != tc.want {
+			t.Fatalf("%q.Matches(%v) = %v, want %v", tc.expr, labels, got, tc.want)
+		}
+	}
+}
+
+func TestFromLabels(t *testing.T) {
+	t.Parallel()
+
+	if sel := FromLabels(nil); !sel.Empty() || !sel.Matches(map[string]string{"any": "x"}) {
+		t.Fatalf("empty labels must yield the empty selector, got %q", sel)
+	}
+
+	labels := map[string]string{"tier": "edge", "env": "prod"}
+	sel := FromLabels(labels)
+	if got, want := sel.String(), "env=prod,tier=edge"; got != want {
+		t.Fatalf("FromLabels(%v) = %q, want %q (keys sorted)", labels, got, want)
+	}
+	if !sel.Matches(map[string]string{"env": "prod", "tier": "edge", "extra": "y"}) {
+		t.Fatalf("expected a superset of the labels to match")
+	}
+	if sel.Matches(map[string]string{"env": "prod"}) {
+		t.Fatalf("expected a subset of the labels not to match")
+	}
+
+	parsed, err := Parse(sel.String())
+	if err != nil || !reflect.DeepEqual(parsed, sel) {
+		t.Fatalf("Parse(%q) = %#v, %v; want %#v", sel.String(), parsed, err, sel)
+	}
+}
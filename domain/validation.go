@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+)
+
+// FieldErrors maps invalid field names to what is wrong with them.
+//
+// A non-empty FieldErrors is an error matching ErrInvalidFields with errors.Is;
+// callers extract the fields with errors.As.
+type FieldErrors map[string]string
+
+// Add records a problem with field; the first problem recorded for a field is kept.
+func (e FieldErrors) Add(field, problem string) {
+	if _, ok := e[field]; !ok {
+		e[field] = problem
+	}
+}
+
+// Err returns e as an error, or nil if no field is invalid.
+func (e FieldErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error lists the invalid fields sorted by name.
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for f := range e {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	var b strings.Builder
+	b.WriteString(ErrInvalidFields.Error())
+	for i, f := range fields {
+		if i == 0 {
+			b.WriteString(": ")
+		} else {
+			b.WriteString("; ")
+		}
+		b.WriteString(f + " " + e[f])
+	}
+	return b.String()
+}
+
+// Is reports whether target is ErrInvalidFields.
+func (e FieldErrors) Is(target error) bool { return target == ErrInvalidFields }
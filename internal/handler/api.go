@@ -1,9 +1,11 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,11 +17,14 @@ import (
 	"github.com/soltiHQ/control-plane/internal/uikit/trigger"
 
 	restv1 "github.com/soltiHQ/control-plane/api/rest/v1"
+	"github.com/soltiHQ/control-plane/domain"
 	"github.com/soltiHQ/control-plane/domain/kind"
 	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/domain/selector"
 	"github.com/soltiHQ/control-plane/internal/proxy"
 	"github.com/soltiHQ/control-plane/internal/service/access"
 	"github.com/soltiHQ/control-plane/internal/service/agent"
+	"github.com/soltiHQ/control-plane/internal/service/backup"
 	"github.com/soltiHQ/control-plane/internal/service/credential"
 	"github.com/soltiHQ/control-plane/internal/service/session"
 	"github.com/soltiHQ/control-plane/internal/service/spec"
@@ -58,6 +63,7 @@ const (
 type API struct {
 	credentialSVC *credential.Service
 	sessionSVC    *session.Service
+	backupSVC     *backup.Service
 	accessSVC     *access.Service
 	agentSVC      *agent.Service
 	specSVC       *spec.Service
@@ -76,6 +82,7 @@ func NewAPI(
 	credentialSVC *credential.Service,
 	agentSVC *agent.Service,
 	specSVC *spec.Service,
+	backupSVC *backup.Service,
 	proxyPool *proxy.Pool,
 ) *API {
 	if accessSVC == nil {
@@ -96,6 +103,9 @@ func NewAPI(
 	if specSVC == nil {
 		panic("handler.API: specSVC is nil")
 	}
+	if backupSVC == nil {
+		panic("handler.API: backupSVC is nil")
+	}
 	if proxyPool == nil {
 		panic("handler.API: proxyPool is nil")
 	}
@@ -106,6 +116,7 @@ func NewAPI(
 		sessionSVC:    sessionSVC,
 		accessSVC:     accessSVC,
 		agentSVC:      agentSVC,
+		backupSVC:     backupSVC,
 		specSVC:       specSVC,
 		userSVC:       userSVC,
 		proxyPool:     proxyPool,
@@ -124,6 +135,7 @@ func (a *API) Routes(mux *http.ServeMux, auth route.BaseMW, _ route.PermMW, comm
 	route.HandleFunc(mux, routepath.ApiSpec, a.SpecsRouter, append(common, auth)...)
 	route.HandleFunc(mux, routepath.ApiPermissions, a.Permissions, append(common, auth)...)
 	route.HandleFunc(mux, routepath.ApiRoles, a.Roles, append(common, auth)...)
+	route.HandleFunc(mux, routepath.ApiSystemBackup, a.Backup, append(common, auth)...)
 }
 
 // Users handles /api/v1/users.
@@ -439,6 +451,26 @@ func (a *API) Roles(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Backup handles /api/v1/system/backup.
+//
+// Supported:
+//   - GET /api/v1/system/backup
+func (a *API) Backup(w http.ResponseWriter, r *http.Request) {
+	mode := httpctx.ModeFromRequest(r)
+	switch r.Method {
+	case http.MethodGet:
+		middleware.RequirePermission(kind.SystemBackup)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				a.backupExport(w, r, mode)
+			}),
+		).ServeHTTP(w, r)
+		return
+	default:
+		response.NotAllowed(w, r, mode)
+		return
+	}
+}
+
 func (a *API) permissionsList(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode) {
 	perms := a.accessSVC.GetPermissions()
 
@@ -484,8 +516,13 @@ func (a *API) agentList(w http.ResponseWriter, r *http.Request, mode httpctx.Ren
 			limit = n
 		}
 	}
-	if q != "" {
-		filter = inmemory.NewAgentFilter().Query(q)
+	sel, err := selector.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		response.BadRequest(w, r, mode)
+		return
+	}
+	if q != "" || !sel.Empty() {
+		filter = inmemory.NewAgentFilter().Query(q).BySelector(sel)
 	}
 
 	res, err := a.agentSVC.List(r.Context(), agent.ListQuery{
@@ -595,7 +632,7 @@ func (a *API) agentTasksList(w http.ResponseWriter, r *http.Request, mode httpct
 		}
 	}
 
-	p, err := a.proxyPool.Get(ag.Endpoint(), ag.EndpointType(), ag.APIVersion())
+	p, err := a.proxyPool.ForAgent(ag.ID(), ag.Endpoint(), ag.EndpointType(), ag.APIVersion())
 	if err != nil {
 		a.logger.Error().Err(err).
 			Str("agent_id", agentID).
@@ -773,6 +810,11 @@ func (a *API) userUpsert(w http.ResponseWriter, r *http.Request, mode httpctx.Re
 	}
 
 	if err := a.userSVC.Upsert(r.Context(), u); err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			a.logger.Info().Str("user_id", u.ID()).Msg("user upsert conflict")
+			response.Conflict(w, r, mode)
+			return
+		}
 		a.logger.Error().Err(err).Str("user_id", u.ID()).Msg("user upsert failed")
 		response.Unavailable(w, r, mode)
 		return
@@ -820,6 +862,11 @@ func (a *API) userSetStatus(w http.ResponseWriter, r *http.Request, mode httpctx
 	}
 
 	if err = a.userSVC.Upsert(r.Context(), u); err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			a.logger.Info().Str("user_id", userID).Msg("user status conflict")
+			response.Conflict(w, r, mode)
+			return
+		}
 		a.logger.Error().Err(err).Str("user_id", userID).Msg("user status update failed")
 		response.Unavailable(w, r, mode)
 		return
@@ -913,8 +960,8 @@ func (a *API) Specs(w http.ResponseWriter, r *http.Request) {
 // SpecsRouter handles /api/v1/specs/{id} and subroutes.
 //
 // Supported:
-//   - GET    /api/v1/specs/{id}
-//   - PUT    /api/v1/specs/{id}
+//   - GET    /api/v1/specs/{id}        (sets ETag to the resource version)
+//   - PUT    /api/v1/specs/{id}        (honours If-Match; 409 on version mismatch)
 //   - DELETE /api/v1/specs/{id}
 //   - POST   /api/v1/specs/{id}/deploy
 //   - GET    /api/v1/specs/{id}/sync
@@ -951,11 +998,23 @@ func (a *API) SpecsRouter(w http.ResponseWriter, r *http.Request) {
 			).ServeHTTP(w, r)
 			return
 		case http.MethodDelete:
-			middleware.RequirePermission(kind.SpecsEdit)(
-				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-					a.specDelete(w, r, mode, tsID)
-				}),
-			).ServeHTTP(w, r)
+			var undeploy bool
+			if raw := r.URL.Query().Get("undeploy"); raw != "" {
+				v, err := strconv.ParseBool(raw)
+				if err != nil {
+					response.BadRequest(w, r, mode)
+					return
+				}
+				undeploy = v
+			}
+			h := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				a.specDelete(w, r, mode, tsID, undeploy)
+			}))
+			if undeploy {
+				// Removing the task from agents is a deploy operation.
+				h = middleware.RequirePermission(kind.SpecsDeploy)(h)
+			}
+			middleware.RequirePermission(kind.SpecsEdit)(h).ServeHTTP(w, r)
 			return
 		default:
 			response.NotAllowed(w, r, mode)
@@ -964,20 +1023,63 @@ func (a *API) SpecsRouter(w http.ResponseWriter, r *http.Request) {
 	}
 
 	action, extra, _ := strings.Cut(tail, "/")
-	if extra != "" {
+	if extra != "" && action != "deploy" {
 		response.NotFound(w, r, mode)
 		return
 	}
 
 	switch action {
 	case "deploy":
+		if extra != "" && extra != "pause" && extra != "resume" && extra != "abort" {
+			response.NotFound(w, r, mode)
+			return
+		}
+		if r.Method != http.MethodPost {
+			response.NotAllowed(w, r, mode)
+			return
+		}
+		var dryRun bool
+		if raw := r.URL.Query().Get("dryRun"); raw != "" && extra == "" {
+			v, err := strconv.ParseBool(raw)
+			if err != nil {
+				response.BadRequest(w, r, mode)
+				return
+			}
+			dryRun = v
+		}
+		middleware.RequirePermission(kind.SpecsDeploy)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if dryRun {
+					a.specDeployPlan(w, r, mode, tsID)
+					return
+				}
+				if extra == "" {
+					a.specDeploy(w, r, mode, tsID)
+					return
+				}
+				a.specDeployControl(w, r, mode, tsID, extra)
+			}),
+		).ServeHTTP(w, r)
+		return
+	case "undeploy":
 		if r.Method != http.MethodPost {
 			response.NotAllowed(w, r, mode)
 			return
 		}
 		middleware.RequirePermission(kind.SpecsDeploy)(
 			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				a.specDeploy(w, r, mode, tsID)
+				a.specUndeploy(w, r, mode, tsID)
+			}),
+		).ServeHTTP(w, r)
+		return
+	case "retry":
+		if r.Method != http.MethodPost {
+			response.NotAllowed(w, r, mode)
+			return
+		}
+		middleware.RequirePermission(kind.SpecsDeploy)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				a.specRetry(w, r, mode, tsID)
 			}),
 		).ServeHTTP(w, r)
 		return
@@ -992,6 +1094,31 @@ func (a *API) SpecsRouter(w http.ResponseWriter, r *http.Request) {
 			}),
 		).ServeHTTP(w, r)
 		return
+	case "revisions":
+		if r.Method != http.MethodGet {
+			response.NotAllowed(w, r, mode)
+			return
+		}
+		middleware.RequirePermission(kind.SpecsGet)(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				a.specRevisions(w, r, mode, tsID)
+			}),
+		).ServeHTTP(w, r)
+		return
+	case "rollback":
+		if r.Method != http.MethodPost {
+			response.NotAllowed(w, r, mode)
+			return
+		}
+		// A rollback both edits the spec and deploys the restored version.
+		middleware.RequirePermission(kind.SpecsEdit)(
+			middleware.RequirePermission(kind.SpecsDeploy)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					a.specRollback(w, r, mode, tsID)
+				}),
+			),
+		).ServeHTTP(w, r)
+		return
 	default:
 		response.NotFound(w, r, mode)
 		return
@@ -1011,8 +1138,13 @@ func (a *API) specList(w http.ResponseWriter, r *http.Request, mode httpctx.Rend
 			limit = n
 		}
 	}
-	if q != "" {
-		filter = inmemory.NewSpecFilter().Query(q)
+	sel, err := selector.Parse(r.URL.Query().Get("selector"))
+	if err != nil {
+		response.BadRequest(w, r, mode)
+		return
+	}
+	if q != "" || !sel.Empty() {
+		filter = inmemory.NewSpecFilter().Query(q).BySelector(sel)
 	}
 
 	res, err := a.specSVC.List(r.Context(), spec.ListQuery{
@@ -1061,8 +1193,14 @@ func (a *API) specDetails(w http.ResponseWriter, r *http.Request, mode httpctx.R
 		return
 	}
 
+	deployment, err := a.specSVC.Deployment(r.Context(), id)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		a.logger.Warn().Err(err).Str("spec", id).Msg("spec deployment get failed")
+	}
+
 	identity, _ := transportctx.Identity(r.Context())
-	dto := apimapv1.RolloutSpec(ts, states)
+	dto := apimapv1.RolloutSpec(ts, deployment, states)
+	w.Header().Set("ETag", etag(ts.ResourceVersion()))
 	response.OK(w, r, mode, &responder.View{
 		Data:      dto,
 		Component: contentSpec.Detail(dto, policy.BuildSpecDetail(identity)),
@@ -1092,6 +1230,11 @@ func (a *API) specUpsert(w http.ResponseWriter, r *http.Request, mode httpctx.Re
 		}
 		ts = x
 	case modeUpdate:
+		want, err := ifMatch(r)
+		if err != nil {
+			response.BadRequest(w, r, mode)
+			return
+		}
 		x, err := a.specSVC.Get(r.Context(), id)
 		if err != nil {
 			if errors.Is(err, storage.ErrNotFound) {
@@ -1102,6 +1245,11 @@ func (a *API) specUpsert(w http.ResponseWriter, r *http.Request, mode httpctx.Re
 			response.Unavailable(w, r, mode)
 			return
 		}
+		if want != 0 && want != x.ResourceVersion() {
+			a.logger.Info().Str("spec", id).Msg("spec update precondition failed")
+			response.Conflict(w, r, mode)
+			return
+		}
 		if in.Name != "" {
 			x.SetName(in.Name)
 		}
@@ -1132,14 +1280,8 @@ func (a *API) specUpsert(w http.ResponseWriter, r *http.Request, mode httpctx.Re
 	if in.IntervalMs > 0 {
 		ts.SetIntervalMs(in.IntervalMs)
 	}
-	if action == modeCreate {
-		ts.SetBackoff(model.BackoffConfig{
-			Jitter:  kind.JitterStrategy(in.Jitter),
-			FirstMs: in.BackoffFirstMs,
-			MaxMs:   in.BackoffMaxMs,
-			Factor:  in.BackoffFactor,
-		})
-	} else if in.Jitter != "" || in.BackoffFirstMs > 0 || in.BackoffMaxMs > 0 || in.BackoffFactor > 0 {
+	// Backoff fields left out keep the current (on create: default) values.
+	if in.Jitter != "" || in.BackoffFirstMs > 0 || in.BackoffMaxMs > 0 || in.BackoffFactor > 0 {
 		b := ts.Backoff()
 		if in.Jitter != "" {
 			b.Jitter = kind.JitterStrategy(in.Jitter)
@@ -1159,6 +1301,22 @@ func (a *API) specUpsert(w http.ResponseWriter, r *http.Request, mode httpctx.Re
 		ts.SetAdmission(kind.AdmissionStrategy(in.Admission))
 	}
 
+	// Rollout strategy (an empty object resets to all-at-once)
+	if in.Strategy != nil {
+		strategy := model.RolloutStrategy{
+			CanaryCount:    in.Strategy.CanaryCount,
+			CanaryPercent:  in.Strategy.CanaryPercent,
+			BatchSize:      in.Strategy.BatchSize,
+			PauseMs:        in.Strategy.PauseMs,
+			MaxUnavailable: in.Strategy.MaxUnavailable,
+		}
+		if err := strategy.Validate(); err != nil {
+			response.Invalid(w, r, mode, map[string]string{"strategy": err.Error()})
+			return
+		}
+		ts.SetStrategy(strategy)
+	}
+
 	// Targets
 	if action == modeCreate {
 		if len(in.Targets) > 0 {
@@ -1182,46 +1340,70 @@ func (a *API) specUpsert(w http.ResponseWriter, r *http.Request, mode httpctx.Re
 		}
 	}
 
+	// Agents reject malformed specs only at push time; catch them before anything is stored.
+	if err := ts.Validate(); err != nil {
+		var fields domain.FieldErrors
+		if !errors.As(err, &fields) {
+			response.BadRequest(w, r, mode)
+			return
+		}
+		a.logger.Info().Str("spec", ts.ID()).Err(err).Msg("spec rejected")
+		response.Invalid(w, r, mode, fields)
+		return
+	}
+
 	if action == modeCreate {
-		if err := a.specSVC.Create(r.Context(), ts); err != nil {
+		if err := a.specSVC.Create(r.Context(), ts, author(r)); err != nil {
 			a.logger.Error().Err(err).Msg("spec create failed")
 			response.Unavailable(w, r, mode)
 			return
 		}
 		a.logger.Info().Str("spec", ts.ID()).Str("name", ts.Name()).Msg("spec created")
+		w.Header().Set("ETag", etag(ts.ResourceVersion()))
 		trigger.Redirect(w, routepath.PageSpecs)
 		response.NoContent(w, r)
 		return
 	}
 
-	if err := a.specSVC.Upsert(r.Context(), ts); err != nil {
+	if err := a.specSVC.Upsert(r.Context(), ts, author(r)); err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			a.logger.Info().Str("spec", id).Msg("spec update conflict")
+			response.Conflict(w, r, mode)
+			return
+		}
 		a.logger.Error().Err(err).Str("spec", id).Msg("spec update failed")
 		response.Unavailable(w, r, mode)
 		return
 	}
 	a.logger.Info().Str("spec", id).Msg("spec updated")
+	w.Header().Set("ETag", etag(ts.ResourceVersion()))
 	trigger.Set(w, trigger.SpecUpdate)
 	response.NoContent(w, r)
 }
 
-func (a *API) specDelete(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode, id string) {
-	err := a.specSVC.Delete(r.Context(), id)
+func (a *API) specDelete(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode, id string, undeploy bool) {
+	err := a.specSVC.Delete(r.Context(), id, undeploy)
 	if err != nil && !errors.Is(err, storage.ErrNotFound) {
 		a.logger.Error().Err(err).Str("spec", id).Msg("spec delete failed")
 		response.Unavailable(w, r, mode)
 		return
 	}
-	a.logger.Info().Str("spec", id).Msg("spec deleted")
+	a.logger.Info().Str("spec", id).Bool("undeploy", undeploy).Msg("spec deleted")
 	trigger.Redirect(w, routepath.PageSpecs)
 	response.NoContent(w, r)
 }
 
 func (a *API) specDeploy(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode, id string) {
-	if err := a.specSVC.Deploy(r.Context(), id); err != nil {
+	if err := a.specSVC.Deploy(r.Context(), id, author(r)); err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
 			response.NotFound(w, r, mode)
 			return
 		}
+		if errors.Is(err, storage.ErrConflict) {
+			a.logger.Info().Str("spec", id).Msg("spec deploy conflict")
+			response.Conflict(w, r, mode)
+			return
+		}
 		a.logger.Error().Err(err).Str("spec", id).Msg("spec deploy failed")
 		response.Unavailable(w, r, mode)
 		return
@@ -1249,6 +1431,110 @@ func (a *API) specDeploy(w http.ResponseWriter, r *http.Request, mode httpctx.Re
 	response.NoContent(w, r)
 }
 
+func (a *API) specDeployPlan(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode, id string) {
+	plan, err := a.specSVC.PlanDeploy(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			response.NotFound(w, r, mode)
+			return
+		}
+		a.logger.Error().Err(err).Str("spec", id).Msg("spec deploy plan failed")
+		response.Unavailable(w, r, mode)
+		return
+	}
+
+	dto := restv1.DeployPlan{
+		SpecID:  plan.Spec.ID(),
+		Version: plan.Spec.Version(),
+		Entries: make([]restv1.DeployPlanEntry, 0, len(plan.Rollouts)),
+	}
+	for _, p := range plan.Rollouts {
+		dto.Entries = append(dto.Entries, apimapv1.DeployPlanEntry(p.AgentID, string(p.Action), p.Current, p.Wave))
+	}
+	for v, changes := range plan.Diffs {
+		dto.Diffs = append(dto.Diffs, restv1.DeployPlanDiff{FromVersion: v, Changes: apimapv1.SpecChanges(changes)})
+	}
+	sort.Slice(dto.Diffs, func(i, j int) bool { return dto.Diffs[i].FromVersion > dto.Diffs[j].FromVersion })
+
+	response.OK(w, r, mode, &responder.View{
+		Data:      dto,
+		Component: contentSpec.DeployPlan(dto),
+	})
+}
+
+func (a *API) specRetry(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode, id string) {
+	agentID := r.URL.Query().Get("agent")
+	n, err := a.specSVC.Retry(r.Context(), id, agentID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			response.NotFound(w, r, mode)
+			return
+		}
+		a.logger.Error().Err(err).Str("spec", id).Str("agent", agentID).Msg("spec retry failed")
+		response.Unavailable(w, r, mode)
+		return
+	}
+	a.logger.Info().Str("spec", id).Str("agent", agentID).Int("rollouts", n).Msg("spec rollouts retried")
+
+	trigger.Set(w, trigger.SpecUpdate)
+	response.NoContent(w, r)
+}
+
+func (a *API) specUndeploy(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode, id string) {
+	if err := a.specSVC.Undeploy(r.Context(), id, author(r)); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			response.NotFound(w, r, mode)
+			return
+		}
+		a.logger.Error().Err(err).Str("spec", id).Msg("spec undeploy failed")
+		response.Unavailable(w, r, mode)
+		return
+	}
+	a.logger.Info().Str("spec", id).Msg("spec undeployed")
+
+	trigger.Set(w, trigger.SpecUpdate)
+	response.NoContent(w, r)
+}
+
+func (a *API) specDeployControl(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode, id, op string) {
+	var (
+		d   *model.Deployment
+		err error
+	)
+	switch op {
+	case "pause":
+		d, err = a.specSVC.PauseDeploy(r.Context(), id, author(r))
+	case "resume":
+		d, err = a.specSVC.ResumeDeploy(r.Context(), id, author(r))
+	case "abort":
+		d, err = a.specSVC.AbortDeploy(r.Context(), id, author(r))
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			response.NotFound(w, r, mode)
+			return
+		}
+		if errors.Is(err, storage.ErrConflict) {
+			a.logger.Info().Str("spec", id).Str("op", op).Msg("spec deploy control rejected")
+			response.Conflict(w, r, mode)
+			return
+		}
+		a.logger.Error().Err(err).Str("spec", id).Str("op", op).Msg("spec deploy control failed")
+		response.Unavailable(w, r, mode)
+		return
+	}
+	a.logger.Info().
+		Str("spec", id).
+		Int("version", d.Version()).
+		Str("state", d.State().String()).
+		Msg("spec deploy " + op)
+
+	trigger.Set(w, trigger.SpecUpdate)
+	response.OK(w, r, mode, &responder.View{
+		Data: apimapv1.Deployment(d),
+	})
+}
+
 func (a *API) specRollouts(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode, id string) {
 	states, err := a.specSVC.RolloutsBySpec(r.Context(), id, inmemory.NewRolloutFilter().BySpecID(id))
 	if err != nil {
@@ -1281,3 +1567,80 @@ func (a *API) specRollouts(w http.ResponseWriter, r *http.Request, mode httpctx.
 		Component: contentSpec.Rollouts(items),
 	})
 }
+
+func (a *API) specRevisions(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode, id string) {
+	revisions, err := a.specSVC.Revisions(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			response.NotFound(w, r, mode)
+			return
+		}
+		a.logger.Error().Err(err).Str("spec", id).Msg("spec revisions failed")
+		response.Unavailable(w, r, mode)
+		return
+	}
+
+	items := make([]restv1.SpecRevision, 0, len(revisions))
+	for _, rev := range revisions {
+		items = append(items, apimapv1.SpecRevision(rev.Revision, rev.Changes))
+	}
+	response.OK(w, r, mode, &responder.View{
+		Data: restv1.SpecRevisionListResponse{Items: items},
+	})
+}
+
+func (a *API) specRollback(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode, id string) {
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil || to < 1 {
+		response.BadRequest(w, r, mode)
+		return
+	}
+
+	ts, err := a.specSVC.Rollback(r.Context(), id, to, author(r))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			response.NotFound(w, r, mode)
+			return
+		}
+		if errors.Is(err, storage.ErrConflict) {
+			a.logger.Info().Str("spec", id).Msg("spec rollback conflict")
+			response.Conflict(w, r, mode)
+			return
+		}
+		a.logger.Error().Err(err).Str("spec", id).Int("to", to).Msg("spec rollback failed")
+		response.Unavailable(w, r, mode)
+		return
+	}
+	a.logger.Info().Str("spec", id).Int("to", to).Int("version", ts.Version()).Msg("spec rolled back")
+
+	w.Header().Set("ETag", etag(ts.ResourceVersion()))
+	trigger.Set(w, trigger.SpecUpdate)
+	response.OK(w, r, mode, &responder.View{
+		Data: apimapv1.Spec(ts),
+	})
+}
+
+// author returns the subject of the authenticated caller, recorded on spec revisions.
+func author(r *http.Request) string {
+	if id, ok := transportctx.Identity(r.Context()); ok && id != nil {
+		return id.Subject
+	}
+	return ""
+}
+
+func (a *API) backupExport(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode) {
+	// Buffer the archive so that a failed export still answers with an error status.
+	var buf bytes.Buffer
+	m, err := a.backupSVC.Export(r.Context(), &buf)
+	if err != nil {
+		a.logger.Error().Err(err).Msg("backup export failed")
+		response.Unavailable(w, r, mode)
+		return
+	}
+	a.logger.Info().Uint64("revision", m.Revision).Int("bytes", buf.Len()).Msg("backup exported")
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="lighthouse-backup-`+m.CreatedAt.Format("20060102T150405Z")+`.ndjson"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
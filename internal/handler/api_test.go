@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/auth/wire"
+	"github.com/soltiHQ/control-plane/internal/proxy"
+	"github.com/soltiHQ/control-plane/internal/service/access"
+	"github.com/soltiHQ/control-plane/internal/service/agent"
+	"github.com/soltiHQ/control-plane/internal/service/backup"
+	"github.com/soltiHQ/control-plane/internal/service/credential"
+	"github.com/soltiHQ/control-plane/internal/service/session"
+	"github.com/soltiHQ/control-plane/internal/service/spec"
+	"github.com/soltiHQ/control-plane/internal/service/user"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/codec"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+	"github.com/soltiHQ/control-plane/internal/transport/httpctx"
+)
+
+func newTestAPI(t *testing.T) (*API, storage.Storage) {
+	t.Helper()
+	var (
+		st     = inmemory.New()
+		logger = zerolog.Nop()
+		auth   = wire.NewAuth(st, "test-secret", time.Minute, time.Hour, time.Minute, 2)
+	)
+	return NewAPI(
+		logger,
+		user.New(st, logger),
+		access.New(auth, st, logger),
+		session.New(st),
+		credential.New(st, logger),
+		agent.New(st),
+		spec.New(st),
+		backup.New(st, codec.New(nil)),
+		proxy.NewPool(),
+	), st
+}
+
+// errorResponse is the JSON body of an error response.
+type errorResponse struct {
+	Code   int               `json:"code"`
+	Fields map[string]string `json:"fields"`
+}
+
+// call runs h with a JSON request and decodes the JSON response into out (if not nil).
+func call(t *testing.T, h func(http.ResponseWriter, *http.Request, httpctx.RenderMode), method, body string, out any) int {
+	t.Helper()
+	r := httptest.NewRequest(method, "/api/v1/specs", bytes.NewBufferString(body))
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	h(w, r, httpctx.ModeFromRequest(r))
+	if out != nil && w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("decode %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code
+}
+
+func TestSpecCreate_InvalidFields(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{
+			name:   "missing command",
+			body:   `{"name":"web","slot":"web"}`,
+			fields: []string{"kind_config.command"},
+		},
+		{
+			name:   "wrong types and unknown fields",
+			body:   `{"name":"web","slot":"web","kind_config":{"command":1,"args":"x","bogus":true}}`,
+			fields: []string{"kind_config.args", "kind_config.bogus", "kind_config.command"},
+		},
+		{
+			name:   "unknown kind",
+			body:   `{"name":"web","slot":"web","kind_type":"vm","kind_config":{"command":"sleep"}}`,
+			fields: []string{"kind_type"},
+		},
+		{
+			name:   "enums",
+			body:   `{"name":"web","slot":"web","kind_config":{"command":"sleep"},"restart_type":"sometimes","jitter":"random","admission":"skip"}`,
+			fields: []string{"admission", "jitter", "restart_type"},
+		},
+		{
+			name:   "backoff bounds",
+			body:   `{"name":"web","slot":"web","kind_config":{"command":"sleep"},"backoff_first_ms":5000,"backoff_max_ms":1000,"backoff_factor":0.5}`,
+			fields: []string{"backoff_factor", "backoff_max_ms"},
+		},
+		{
+			name:   "strategy",
+			body:   `{"name":"web","slot":"web","kind_config":{"command":"sleep"},"strategy":{"canary_percent":150}}`,
+			fields: []string{"strategy"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			a, st := newTestAPI(t)
+			var res errorResponse
+			code := call(t, func(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode) {
+				a.specUpsert(w, r, mode, "", modeCreate)
+			}, http.MethodPost, tc.body, &res)
+
+			if code != http.StatusBadRequest || res.Code != http.StatusBadRequest {
+				t.Fatalf("expected 400, got %d (body code %d)", code, res.Code)
+			}
+			got := make([]string, 0, len(res.Fields))
+			for f := range res.Fields {
+				got = append(got, f)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tc.fields) {
+				t.Fatalf("field errors %v, want %v", res.Fields, tc.fields)
+			}
+
+			specs, err := st.ListSpecs(t.Context(), nil, storage.ListOptions{Limit: 1})
+			if err != nil {
+				t.Fatalf("ListSpecs: %v", err)
+			}
+			if len(specs.Items) != 0 {
+				t.Fatalf("a rejected spec must not be stored")
+			}
+		})
+	}
+}
+
+func TestSpecCreate_Valid(t *testing.T) {
+	t.Parallel()
+
+	a, st := newTestAPI(t)
+	code := call(t, func(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode) {
+		a.specUpsert(w, r, mode, "", modeCreate)
+	}, http.MethodPost, `{"name":"web","slot":"web","kind_config":{"command":"sleep","args":["30"]}}`, nil)
+	if code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	specs, err := st.ListSpecs(t.Context(), nil, storage.ListOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListSpecs: %v", err)
+	}
+	if len(specs.Items) != 1 || specs.Items[0].Slot() != "web" {
+		t.Fatalf("expected the spec stored, got %d specs", len(specs.Items))
+	}
+}
+
+func TestSpecRetry(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		spec    string
+		agent   string
+		code    int
+		retried []string // agents whose rollout is pending again
+	}{
+		{name: "every rollout of the spec", spec: "s1", code: http.StatusNoContent, retried: []string{"a1", "a2"}},
+		{name: "one agent", spec: "s1", agent: "a1", code: http.StatusNoContent, retried: []string{"a1"}},
+		{name: "unknown spec", spec: "nope", code: http.StatusNotFound},
+		{name: "agent without rollout", spec: "s1", agent: "a9", code: http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			a, st := newTestAPI(t)
+			ctx := t.Context()
+			for _, id := range []string{"a1", "a2"} {
+				ag, err := model.NewAgent(id, id, "http://"+id)
+				if err != nil {
+					t.Fatalf("NewAgent: %v", err)
+				}
+				if err = st.UpsertAgent(ctx, ag); err != nil {
+					t.Fatalf("UpsertAgent: %v", err)
+				}
+			}
+			ts, err := model.NewSpec("s1", "s1", "web")
+			if err != nil {
+				t.Fatalf("NewSpec: %v", err)
+			}
+			ts.SetKindConfig(map[string]any{"command": "sleep"})
+			ts.SetTargets([]string{"a1", "a2"})
+			svc := spec.New(st)
+			if err = svc.Create(ctx, ts, "tester"); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if err = svc.Deploy(ctx, "s1", "tester"); err != nil {
+				t.Fatalf("Deploy: %v", err)
+			}
+			for _, id := range []string{"a1", "a2"} {
+				ss, err := st.GetRollout(ctx, model.RolloutID("s1", id))
+				if err != nil {
+					t.Fatalf("GetRollout: %v", err)
+				}
+				ss.MarkFailed("connection refused")
+				ss.MarkExhausted()
+				if err = st.UpsertRollout(ctx, ss); err != nil {
+					t.Fatalf("UpsertRollout: %v", err)
+				}
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/specs/"+tc.spec+"/retry?agent="+tc.agent, nil)
+			r.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			a.specRetry(w, r, httpctx.ModeFromRequest(r), tc.spec)
+			if w.Code != tc.code {
+				t.Fatalf("expected %d, got %d", tc.code, w.Code)
+			}
+
+			for _, id := range []string{"a1", "a2"} {
+				ss, err := st.GetRollout(ctx, model.RolloutID("s1", id))
+				if err != nil {
+					t.Fatalf("GetRollout: %v", err)
+				}
+				want := kind.SyncStatusExhausted
+				if slices.Contains(tc.retried, id) {
+					want = kind.SyncStatusPending
+				}
+				if ss.Status() != want {
+					t.Fatalf("%s: expected %s, got %s", id, want, ss.Status())
+				}
+			}
+		})
+	}
+}
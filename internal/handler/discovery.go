@@ -3,36 +3,49 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/rs/zerolog"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/soltiHQ/control-plane/internal/transport/grpc/status"
 
 	discoveryv1 "github.com/soltiHQ/control-plane/api/discovery/v1"
 	genv1 "github.com/soltiHQ/control-plane/api/gen/v1"
+	"github.com/soltiHQ/control-plane/domain/kind"
 	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/proxy"
 	"github.com/soltiHQ/control-plane/internal/service/agent"
+	"github.com/soltiHQ/control-plane/internal/service/delivery"
 	"github.com/soltiHQ/control-plane/internal/transport/http/responder"
 	"github.com/soltiHQ/control-plane/internal/transport/http/response"
 	"github.com/soltiHQ/control-plane/internal/transport/httpctx"
 )
 
 // HTTPDiscovery handles agent discovery over HTTP.
+//
+// Pull-mode agents also receive their desired state in the sync response.
 type HTTPDiscovery struct {
-	logger   zerolog.Logger
-	agentSVC *agent.Service
+	logger      zerolog.Logger
+	agentSVC    *agent.Service
+	deliverySVC *delivery.Service
 }
 
 // NewHTTPDiscovery creates a new HTTP discovery handler.
-func NewHTTPDiscovery(logger zerolog.Logger, agentSVC *agent.Service) *HTTPDiscovery {
+func NewHTTPDiscovery(logger zerolog.Logger, agentSVC *agent.Service, deliverySVC *delivery.Service) *HTTPDiscovery {
 	if agentSVC == nil {
 		panic("handler.HTTPDiscovery: agentSVC is nil")
 	}
+	if deliverySVC == nil {
+		panic("handler.HTTPDiscovery: deliverySVC is nil")
+	}
 	return &HTTPDiscovery{
-		logger:   logger.With().Str("handler", "discovery-http").Logger(),
-		agentSVC: agentSVC,
+		logger:      logger.With().Str("handler", "discovery-http").Logger(),
+		agentSVC:    agentSVC,
+		deliverySVC: deliverySVC,
 	}
 }
 
@@ -63,6 +76,7 @@ func (h *HTTPDiscovery) Sync(w http.ResponseWriter, r *http.Request) {
 		Platform:           in.Platform,
 		UptimeSeconds:      in.UptimeSeconds,
 		HeartbeatIntervalS: in.HeartbeatIntervalS,
+		DeliveryMode:       in.DeliveryMode,
 		Metadata:           in.Metadata,
 	})
 	if err != nil {
@@ -70,6 +84,7 @@ func (h *HTTPDiscovery) Sync(w http.ResponseWriter, r *http.Request) {
 			Str("agent_id", in.ID).
 			Int("endpoint_type", in.EndpointType).
 			Int("api_version", in.APIVersion).
+			Int("delivery_mode", in.DeliveryMode).
 			Msg("invalid sync request")
 		response.BadRequest(w, r, mode)
 		return
@@ -79,26 +94,56 @@ func (h *HTTPDiscovery) Sync(w http.ResponseWriter, r *http.Request) {
 		response.Unavailable(w, r, mode)
 		return
 	}
-	response.OK(w, r, mode, &responder.View{
-		Data: discoveryv1.SyncResponse{Success: true},
-	})
+
+	out := discoveryv1.SyncResponse{Success: true}
+	if a.Delivery() == kind.DeliveryPull {
+		report := delivery.Report{AgentID: in.ID, Revision: in.DesiredRevision}
+		for _, t := range in.Applied {
+			report.Applied = append(report.Applied, delivery.AppliedTask{Slot: t.Slot, Version: t.Version, Status: t.Status})
+		}
+		desired, err := h.deliverySVC.Sync(r.Context(), report)
+		if err != nil {
+			h.logger.Error().Err(err).Str("agent_id", in.ID).Msg("pull delivery failed")
+			response.Unavailable(w, r, mode)
+			return
+		}
+		out.DesiredRevision = desired.Bundle.Revision
+		out.Remove = desired.Bundle.Remove
+		for _, t := range desired.Bundle.Tasks {
+			out.Tasks = append(out.Tasks, discoveryv1.DesiredTask{Spec: t.Spec, Version: t.Version})
+		}
+	}
+	response.OK(w, r, mode, &responder.View{Data: out})
 }
 
 // GRPCDiscovery implements genv1.DiscoverServiceServer.
+//
+// Pull-mode agents also receive their desired state in the sync response.
+// Agents on a Connect stream are registered in streams for the proxy pool to reach them.
 type GRPCDiscovery struct {
 	genv1.UnimplementedDiscoverServiceServer
-	logger   zerolog.Logger
-	agentSVC *agent.Service
+	logger      zerolog.Logger
+	agentSVC    *agent.Service
+	deliverySVC *delivery.Service
+	streams     *proxy.Streams
 }
 
 // NewGRPCDiscovery creates a new gRPC discovery handler.
-func NewGRPCDiscovery(logger zerolog.Logger, agentSVC *agent.Service) *GRPCDiscovery {
+func NewGRPCDiscovery(logger zerolog.Logger, agentSVC *agent.Service, deliverySVC *delivery.Service, streams *proxy.Streams) *GRPCDiscovery {
 	if agentSVC == nil {
 		panic("handler.GRPCDiscovery: agentSVC is nil")
 	}
+	if deliverySVC == nil {
+		panic("handler.GRPCDiscovery: deliverySVC is nil")
+	}
+	if streams == nil {
+		panic("handler.GRPCDiscovery: streams is nil")
+	}
 	return &GRPCDiscovery{
-		logger:   logger.With().Str("handler", "discovery-grpc").Logger(),
-		agentSVC: agentSVC,
+		logger:      logger.With().Str("handler", "discovery-grpc").Logger(),
+		agentSVC:    agentSVC,
+		deliverySVC: deliverySVC,
+		streams:     streams,
 	}
 }
 
@@ -115,6 +160,7 @@ func (g *GRPCDiscovery) Sync(ctx context.Context, req *genv1.SyncRequest) (*genv
 		Platform:           req.GetPlatform(),
 		UptimeSeconds:      req.GetUptimeSeconds(),
 		HeartbeatIntervalS: int(req.GetHeartbeatIntervalS()),
+		DeliveryMode:       int(req.GetDeliveryMode()),
 		Metadata:           req.GetMetadata(),
 	})
 	if err != nil {
@@ -126,5 +172,125 @@ func (g *GRPCDiscovery) Sync(ctx context.Context, req *genv1.SyncRequest) (*genv
 		g.logger.Error().Err(err).Str("agent_id", req.GetId()).Msg("upsert failed")
 		return nil, status.FromError(ctx, err).Err()
 	}
-	return &genv1.SyncResponse{Success: true}, nil
+
+	out := &genv1.SyncResponse{Success: true}
+	if a.Delivery() != kind.DeliveryPull {
+		return out, nil
+	}
+
+	report := delivery.Report{AgentID: req.GetId(), Revision: req.GetDesiredRevision()}
+	for _, t := range req.GetApplied() {
+		report.Applied = append(report.Applied, delivery.AppliedTask{Slot: t.GetSlot(), Version: int(t.GetVersion()), Status: t.GetStatus()})
+	}
+	desired, err := g.deliverySVC.Sync(ctx, report)
+	if err != nil {
+		g.logger.Error().Err(err).Str("agent_id", req.GetId()).Msg("pull delivery failed")
+		return nil, status.FromError(ctx, err).Err()
+	}
+	out.DesiredRevision = desired.Bundle.Revision
+	out.Remove = desired.Bundle.Remove
+	for _, t := range desired.Bundle.Tasks {
+		spec, err := structpb.NewStruct(t.Spec)
+		if err != nil {
+			g.logger.Error().Err(err).Str("agent_id", req.GetId()).Msg("pull delivery: encode spec failed")
+			return nil, status.Errorf(ctx, codes.Internal, "encode spec: %v", err)
+		}
+		out.Tasks = append(out.Tasks, &genv1.DesiredTask{Spec: spec, Version: uint32(t.Version)})
+	}
+	return out, nil
+}
+
+// Connect implements genv1.DiscoverServiceServer.
+//
+// The first message must be a heartbeat; it is handled like Sync and registers the stream
+// under the agent ID until the agent disconnects. Later heartbeats must carry the same ID.
+// A new stream for the agent replaces the one it had open, which is ended with Aborted, so an
+// agent reconnecting from a new address is not locked out by its half-open old stream.
+// Command results complete the proxy calls made over the stream; task events feed rollout health.
+func (g *GRPCDiscovery) Connect(stream genv1.DiscoverService_ConnectServer) error {
+	ctx := stream.Context()
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	hb := first.GetHeartbeat()
+	if hb == nil {
+		return status.Errorf(ctx, codes.InvalidArgument, "first message must be a heartbeat")
+	}
+	synced, err := g.Sync(ctx, hb)
+	if err != nil {
+		return err
+	}
+
+	agentID := hb.GetId()
+	conn := g.streams.Open(agentID, stream.Send)
+	defer g.streams.Close(conn)
+
+	logger := g.logger.With().Str("agent_id", agentID).Logger()
+	logger.Info().Msg("agent stream connected")
+	defer logger.Info().Msg("agent stream disconnected")
+
+	if err = conn.Send(&genv1.ControlMessage{Msg: &genv1.ControlMessage_Synced{Synced: synced}}); err != nil {
+		return err
+	}
+
+	// Recv blocks until the agent sends or the stream ends, so it runs apart from the loop
+	// below, which also has to return once the stream is replaced.
+	var (
+		msgs = make(chan *genv1.AgentMessage)
+		errc = make(chan error, 1)
+	)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		var msg *genv1.AgentMessage
+		select {
+		case <-conn.Done():
+			logger.Info().Msg("agent stream replaced")
+			return status.Errorf(ctx, codes.Aborted, "agent %q opened a newer stream", agentID)
+		case err = <-errc:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case msg = <-msgs:
+		}
+
+		switch m := msg.GetMsg().(type) {
+		case *genv1.AgentMessage_Heartbeat:
+			if m.Heartbeat.GetId() != agentID {
+				return status.Errorf(ctx, codes.InvalidArgument, "heartbeat for agent %q on the stream of %q", m.Heartbeat.GetId(), agentID)
+			}
+			if synced, err = g.Sync(ctx, m.Heartbeat); err != nil {
+				return err
+			}
+			if err = conn.Send(&genv1.ControlMessage{Msg: &genv1.ControlMessage_Synced{Synced: synced}}); err != nil {
+				return err
+			}
+		case *genv1.AgentMessage_Result:
+			conn.Resolve(m.Result)
+		case *genv1.AgentMessage_Event:
+			ev := m.Event
+			if err = g.deliverySVC.TaskEvent(ctx, agentID, ev.GetSlot(), ev.GetStatus()); err != nil {
+				logger.Warn().Err(err).
+					Str("task_id", ev.GetTaskId()).
+					Str("slot", ev.GetSlot()).
+					Msg("task event failed")
+			}
+		}
+	}
 }
@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	genv1 "github.com/soltiHQ/control-plane/api/gen/v1"
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/internal/proxy"
+	"github.com/soltiHQ/control-plane/internal/service/agent"
+	"github.com/soltiHQ/control-plane/internal/service/delivery"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+// fakeConnect is a Connect stream from an agent: the test writes the agent's messages
+// to in (closing it ends the stream) and reads the control plane's from out.
+type fakeConnect struct {
+	grpc.ServerStream
+	ctx context.Context
+	in  chan *genv1.AgentMessage
+	out chan *genv1.ControlMessage
+}
+
+func newFakeConnect(t *testing.T) *fakeConnect {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &fakeConnect{
+		ctx: ctx,
+		in:  make(chan *genv1.AgentMessage, 8),
+		out: make(chan *genv1.ControlMessage, 8),
+	}
+}
+
+func (s *fakeConnect) Context() context.Context { return s.ctx }
+
+func (s *fakeConnect) Send(msg *genv1.ControlMessage) error {
+	s.out <- msg
+	return nil
+}
+
+func (s *fakeConnect) Recv() (*genv1.AgentMessage, error) {
+	select {
+	case msg, ok := <-s.in:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+// receive returns the next control message, failing the test if none comes.
+func (s *fakeConnect) receive(t *testing.T) *genv1.ControlMessage {
+	t.Helper()
+	select {
+	case msg := <-s.out:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no control message received")
+		return nil
+	}
+}
+
+func heartbeat(agentID, name string) *genv1.AgentMessage {
+	return &genv1.AgentMessage{Msg: &genv1.AgentMessage_Heartbeat{Heartbeat: &genv1.SyncRequest{
+		Id:         agentID,
+		Name:       name,
+		Endpoint:   "grpc://" + agentID,
+		ApiVersion: genv1.APIVersion_API_VERSION_V1,
+	}}}
+}
+
+func newTestDiscovery() (*GRPCDiscovery, *proxy.Pool, storage.Storage) {
+	st := inmemory.New()
+	pool := proxy.NewPool()
+	return NewGRPCDiscovery(zerolog.Nop(), agent.New(st), delivery.New(st), pool.Streams()), pool, st
+}
+
+// connect runs Connect on s in the background; the returned channel yields its error.
+func connect(g *GRPCDiscovery, s *fakeConnect) <-chan error {
+	errc := make(chan error, 1)
+	go func() { errc <- g.Connect(s) }()
+	return errc
+}
+
+func wait(t *testing.T, errc <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-errc:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Connect did not return")
+		return nil
+	}
+}
+
+func TestConnect_FirstMessageMustBeHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		first *genv1.AgentMessage
+	}{
+		{"result", &genv1.AgentMessage{Msg: &genv1.AgentMessage_Result{Result: &genv1.CommandResult{Id: "1"}}}},
+		{"task event", &genv1.AgentMessage{Msg: &genv1.AgentMessage_Event{Event: &genv1.TaskEvent{Slot: "web"}}}},
+		{"heartbeat without id", heartbeat("", "a1")},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			g, pool, _ := newTestDiscovery()
+			s := newFakeConnect(t)
+			s.in <- tc.first
+
+			if err := wait(t, connect(g, s)); grpcstatus.Code(err) != codes.InvalidArgument {
+				t.Fatalf("expected InvalidArgument, got %v", err)
+			}
+			if _, ok := pool.Streams().Get("a1"); ok {
+				t.Fatalf("a refused stream must not be registered")
+			}
+		})
+	}
+}
+
+func TestConnect_HeartbeatForAnotherAgent(t *testing.T) {
+	t.Parallel()
+
+	g, pool, _ := newTestDiscovery()
+	s := newFakeConnect(t)
+	errc := connect(g, s)
+
+	s.in <- heartbeat("a1", "a1")
+	if s.receive(t).GetSynced() == nil {
+		t.Fatalf("expected the heartbeat answered")
+	}
+	if _, ok := pool.Streams().Get("a1"); !ok {
+		t.Fatalf("expected the stream registered")
+	}
+
+	s.in <- heartbeat("a2", "a2")
+	if err := wait(t, errc); grpcstatus.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	if _, ok := pool.Streams().Get("a1"); ok {
+		t.Fatalf("expected the stream unregistered once closed")
+	}
+}
+
+func TestConnect_ResultResolvesCommand(t *testing.T) {
+	t.Parallel()
+
+	g, pool, _ := newTestDiscovery()
+	s := newFakeConnect(t)
+	errc := connect(g, s)
+	s.in <- heartbeat("a1", "a1")
+	s.receive(t)
+
+	ap, err := pool.ForAgent("a1", "", kind.EndpointGRPC, kind.APIVersionV1)
+	if err != nil {
+		t.Fatalf("ForAgent: %v", err)
+	}
+	type listed struct {
+		total int
+		err   error
+	}
+	res := make(chan listed, 1)
+	go func() {
+		out, err := ap.ListTasks(context.Background(), proxy.TaskFilter{})
+		if err != nil {
+			res <- listed{err: err}
+			return
+		}
+		res <- listed{total: out.Total}
+	}()
+
+	cmd := s.receive(t).GetCommand()
+	if cmd == nil || cmd.GetMethod() != genv1.SoltiApi_ListTasks_FullMethodName {
+		t.Fatalf("expected a ListTasks command, got %v", cmd)
+	}
+	body, err := proto.Marshal(&genv1.ListTasksResponse{Total: 3})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	s.in <- &genv1.AgentMessage{Msg: &genv1.AgentMessage_Result{Result: &genv1.CommandResult{Id: cmd.GetId(), Response: body}}}
+
+	select {
+	case got := <-res:
+		if got.err != nil || got.total != 3 {
+			t.Fatalf("expected the call completed with the result, got total=%d err=%v", got.total, got.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the result did not complete the call")
+	}
+
+	close(s.in)
+	if err = wait(t, errc); err != nil {
+		t.Fatalf("expected a clean disconnect, got %v", err)
+	}
+}
+
+func TestConnect_NewStreamReplacesOld(t *testing.T) {
+	t.Parallel()
+
+	g, pool, st := newTestDiscovery()
+	old := newFakeConnect(t)
+	oldc := connect(g, old)
+	old.in <- heartbeat("a1", "a1")
+	old.receive(t)
+	conn, _ := pool.Streams().Get("a1")
+
+	// The old stream is half-open: its agent reconnects from elsewhere without closing it.
+	again := newFakeConnect(t)
+	againc := connect(g, again)
+	again.in <- heartbeat("a1", "a1-moved")
+	if again.receive(t).GetSynced() == nil {
+		t.Fatalf("expected the new stream's heartbeat answered")
+	}
+	if err := wait(t, oldc); grpcstatus.Code(err) != codes.Aborted {
+		t.Fatalf("expected the old stream ended with Aborted, got %v", err)
+	}
+	if c, ok := pool.Streams().Get("a1"); !ok || c == conn {
+		t.Fatalf("expected the new stream registered in place of the old one")
+	}
+	a, err := st.GetAgent(context.Background(), "a1")
+	if err != nil {
+		t.Fatalf("GetAgent: %v", err)
+	}
+	if a.Name() != "a1-moved" {
+		t.Fatalf("expected the new stream's heartbeat handled, got name %q", a.Name())
+	}
+
+	close(again.in)
+	if err = wait(t, againc); err != nil {
+		t.Fatalf("expected a clean disconnect, got %v", err)
+	}
+	if _, ok := pool.Streams().Get("a1"); ok {
+		t.Fatalf("expected the stream unregistered once closed")
+	}
+}
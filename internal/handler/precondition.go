@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errBadPrecondition = errors.New("handler: malformed If-Match header")
+
+// etag formats a resource version as a strong entity tag.
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// ifMatch returns the resource version required by the request's If-Match header.
+//
+// It returns 0 when the header is absent or "*": the write is then conditional only on
+// the version the handler read. Weak tags are accepted since versions are exact anyway.
+func ifMatch(r *http.Request) (uint64, error) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return 0, nil
+	}
+	v = strings.TrimPrefix(v, "W/")
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return 0, errBadPrecondition
+	}
+	version, err := strconv.ParseUint(v[1:len(v)-1], 10, 64)
+	if err != nil || version == 0 {
+		return 0, errBadPrecondition
+	}
+	return version, nil
+}
@@ -27,4 +27,14 @@ var (
 	ErrSubmitTask = errors.New("proxy: submit task")
 	// ErrExportSpecs indicates an export call failed.
 	ErrExportSpecs = errors.New("proxy: export task specs")
+	// ErrCancelTask indicates a task cancellation call failed.
+	ErrCancelTask = errors.New("proxy: cancel task")
+	// ErrGetTask indicates a gRPC GetTask call failed.
+	ErrGetTask = errors.New("proxy: grpc get task")
+	// ErrNotFound indicates the agent does not know the requested task or slot.
+	ErrNotFound = errors.New("proxy: not found on agent")
+	// ErrApplyBundle indicates a bundle was not applied, or acknowledged with another revision.
+	ErrApplyBundle = errors.New("proxy: apply bundle")
+	// ErrNotSupported indicates the agent does not implement the called API.
+	ErrNotSupported = errors.New("proxy: not supported by agent")
 )
@@ -14,7 +14,7 @@ type httpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-// doGet performs a GET request and JSON-decodes the response body.
+// doGet performs a GET request and JSON-decodes the response body [404 wraps ErrNotFound].
 func doGet[T any](ctx context.Context, client httpClient, url string) (*T, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -28,7 +28,11 @@ func doGet[T any](ctx context.Context, client httpClient, url string) (*T, error
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %d: %w", ErrUnexpectedStatus, resp.StatusCode, ErrNotFound)
+	default:
 		return nil, fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
 	}
 
@@ -68,3 +72,65 @@ func doPost(ctx context.Context, client httpClient, url string, body any) error
 		return fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
 	}
 }
+
+// doDelete performs a DELETE request [statuses: 200, 202, 204; 404 counts as already gone].
+func doDelete(ctx context.Context, client httpClient, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCreateRequest, err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRequest, err)
+	}
+	defer resp.Body.Close()
+
+	// Drain body to allow connection reuse.
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+}
+
+// doPostResult performs a POST request with a JSON body and JSON-decodes the response body
+// [status: 200; 404, 405 and 501 mean the agent lacks the endpoint and wrap ErrNotSupported].
+func doPostResult[T any](ctx context.Context, client httpClient, url string, body any) (*T, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCreateRequest, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCreateRequest, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRequest, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("%w: %d: %w", ErrUnexpectedStatus, resp.StatusCode, ErrNotSupported)
+	default:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+
+	var dst T
+	if err = json.NewDecoder(resp.Body).Decode(&dst); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecode, err)
+	}
+	return &dst, nil
+}
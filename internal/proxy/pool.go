@@ -19,13 +19,17 @@ import (
 //
 // For HTTP it holds a single *http.Client whose Transport pools TCP connections.
 // For gRPC it caches one *grpc.ClientConn per endpoint address.
+// Agents connected over DiscoverService.Connect are reached through their stream (see Streams).
 type Pool struct {
 	mu sync.RWMutex
 
 	httpCli   *http.Client
 	grpcConns map[string]*grpc.ClientConn
+	streams   *Streams
 }
 
+var _ Dialer = (*Pool)(nil)
+
 // NewPool creates a Pool with a configured HTTP transport.
 func NewPool() *Pool {
 	return &Pool{
@@ -42,7 +46,20 @@ func NewPool() *Pool {
 			},
 		},
 		grpcConns: make(map[string]*grpc.ClientConn),
+		streams:   NewStreams(),
+	}
+}
+
+// Streams returns the registry of agent streams the pool routes through.
+func (p *Pool) Streams() *Streams { return p.streams }
+
+// ForAgent returns an AgentProxy over the agent's stream while one is open (API v1),
+// and Get(endpoint, epType, apiVersion) otherwise.
+func (p *Pool) ForAgent(agentID, endpoint string, epType kind.EndpointType, apiVersion kind.APIVersion) (AgentProxy, error) {
+	if c, ok := p.streams.Get(agentID); ok {
+		return &grpcProxyV1{conn: c}, nil
 	}
+	return p.Get(endpoint, epType, apiVersion)
 }
 
 // Get returns an AgentProxy for the given endpoint, selecting the implementation
@@ -7,8 +7,14 @@ package proxy
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
 
 	proxyv1 "github.com/soltiHQ/control-plane/api/proxy/v1"
+	"github.com/soltiHQ/control-plane/domain/kind"
 )
 
 // TaskFilter holds optional filters and pagination for listing tasks.
@@ -21,8 +27,52 @@ type TaskFilter struct {
 
 // TaskSubmission describes a task to push to an agent.
 // The Spec field is the agent CreateSpec JSON (slot, kind, timeoutMs, restart, backoff, admission, labels).
+// Version is the control-plane spec version; the agent stores it and reports it back via export.
 type TaskSubmission struct {
-	Spec map[string]any `json:"spec"`
+	Spec    map[string]any `json:"spec"`
+	Version int            `json:"version"`
+}
+
+// TaskBundle is the desired task set of one agent, applied as a unit by ApplyBundle.
+//
+// The agent submits every task (a slot already at the task's version keeps running) and cancels
+// the Remove slots; slots the bundle does not mention are left alone. Revision identifies the
+// content and is echoed back by the agent on success.
+type TaskBundle struct {
+	Revision string           `json:"revision"`
+	Tasks    []TaskSubmission `json:"tasks"`
+	Remove   []string         `json:"remove,omitempty"`
+}
+
+// NewTaskBundle builds a bundle with tasks sorted by slot and its revision computed from
+// the slots, versions and removed slots.
+func NewTaskBundle(tasks []TaskSubmission, remove []string) TaskBundle {
+	slot := func(t TaskSubmission) string { s, _ := t.Spec["slot"].(string); return s }
+	tasks = append([]TaskSubmission(nil), tasks...)
+	sort.SliceStable(tasks, func(i, j int) bool { return slot(tasks[i]) < slot(tasks[j]) })
+	remove = append([]string(nil), remove...)
+	sort.Strings(remove)
+
+	h := sha256.New()
+	for _, t := range tasks {
+		h.Write([]byte("+" + slot(t) + "@" + strconv.Itoa(t.Version) + "\n"))
+	}
+	for _, s := range remove {
+		h.Write([]byte("-" + s + "\n"))
+	}
+	return TaskBundle{
+		Revision: hex.EncodeToString(h.Sum(nil)[:8]),
+		Tasks:    tasks,
+		Remove:   remove,
+	}
+}
+
+// checkBundleAck verifies that the agent acknowledged the revision it was sent.
+func checkBundleAck(sent, acked string) error {
+	if acked != sent {
+		return fmt.Errorf("%w: sent revision %q, agent acknowledged %q", ErrApplyBundle, sent, acked)
+	}
+	return nil
 }
 
 // SpecExport describes a task spec as reported by an agent via export.
@@ -32,8 +82,26 @@ type SpecExport struct {
 	Kind    map[string]any `json:"kind,omitempty"`
 }
 
+// SpecExportList is the agent's export response.
+type SpecExportList struct {
+	Specs []SpecExport `json:"specs"`
+}
+
 // AgentProxy is the interface for outbound communication with an agent.
 type AgentProxy interface {
 	ListTasks(ctx context.Context, filter TaskFilter) (*proxyv1.TaskListResponse, error)
+	// GetTask returns a single task; ErrNotFound if the agent does not know the ID.
+	GetTask(ctx context.Context, id string) (*proxyv1.Task, error)
 	SubmitTask(ctx context.Context, sub TaskSubmission) error
+	ExportSpecs(ctx context.Context) ([]SpecExport, error)
+	// CancelTask stops the task in slot and removes its spec from the agent.
+	// A slot the agent does not know is not an error.
+	CancelTask(ctx context.Context, slot string) error
+	// ApplyBundle applies the bundle all or nothing; ErrNotSupported if the agent has no bundle API.
+	ApplyBundle(ctx context.Context, b TaskBundle) error
+}
+
+// Dialer returns the proxy of an agent; *Pool is the implementation.
+type Dialer interface {
+	ForAgent(agentID, endpoint string, epType kind.EndpointType, apiVersion kind.APIVersion) (AgentProxy, error)
 }
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	genv1 "github.com/soltiHQ/control-plane/api/gen/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Streams is the registry of agents connected over DiscoverService.Connect, by agent ID.
+//
+// Pool.ForAgent returns a proxy over the agent's stream while one is open, so callers reach
+// agents that cannot be dialed without knowing how they are connected.
+type Streams struct {
+	mu    sync.RWMutex
+	conns map[string]*StreamConn
+}
+
+// NewStreams creates an empty registry.
+func NewStreams() *Streams {
+	return &Streams{conns: make(map[string]*StreamConn)}
+}
+
+// Open registers the stream of an agent; send writes one message to it. A stream the agent
+// had open before is closed: its pending commands fail with codes.Unavailable.
+func (s *Streams) Open(agentID string, send func(*genv1.ControlMessage) error) *StreamConn {
+	c := &StreamConn{
+		agentID: agentID,
+		send:    send,
+		pending: make(map[string]chan *genv1.CommandResult),
+		done:    make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	prev := s.conns[agentID]
+	s.conns[agentID] = c
+	s.mu.Unlock()
+
+	if prev != nil {
+		prev.close()
+	}
+	return c
+}
+
+// Close unregisters c, unless the agent has opened another stream since, and fails its pending commands.
+func (s *Streams) Close(c *StreamConn) {
+	s.mu.Lock()
+	if s.conns[c.agentID] == c {
+		delete(s.conns, c.agentID)
+	}
+	s.mu.Unlock()
+
+	c.close()
+}
+
+// Get returns the open stream of an agent.
+func (s *Streams) Get(agentID string) (*StreamConn, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.conns[agentID]
+	return c, ok
+}
+
+// StreamConn is the open stream of one agent.
+//
+// It implements grpc.ClientConnInterface: every unary call becomes a Command on the stream and
+// completes with the CommandResult of the same ID, so the gRPC v1 proxy runs over it unchanged.
+type StreamConn struct {
+	agentID string
+
+	sendMu sync.Mutex
+	send   func(*genv1.ControlMessage) error
+
+	seq     atomic.Uint64
+	mu      sync.Mutex
+	pending map[string]chan *genv1.CommandResult
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+var _ grpc.ClientConnInterface = (*StreamConn)(nil)
+
+// AgentID returns the ID of the connected agent.
+func (c *StreamConn) AgentID() string { return c.agentID }
+
+// Done is closed once the stream is closed or replaced by a newer one.
+func (c *StreamConn) Done() <-chan struct{} { return c.done }
+
+// Send writes a message to the stream; sends are serialized.
+func (c *StreamConn) Send(msg *genv1.ControlMessage) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.send(msg)
+}
+
+// Resolve completes the pending command the result answers; results of unknown or
+// abandoned commands are dropped.
+func (c *StreamConn) Resolve(res *genv1.CommandResult) {
+	c.mu.Lock()
+	ch, ok := c.pending[res.GetId()]
+	delete(c.pending, res.GetId())
+	c.mu.Unlock()
+
+	if ok {
+		ch <- res
+	}
+}
+
+// Invoke sends method as a Command and waits for its result, ctx, or the end of the stream.
+// Errors are gRPC status errors, as over a dialed connection.
+func (c *StreamConn) Invoke(ctx context.Context, method string, args, reply any, _ ...grpc.CallOption) error {
+	req, err := proto.Marshal(args.(proto.Message))
+	if err != nil {
+		return status.Errorf(codes.Internal, "encode request: %v", err)
+	}
+
+	var (
+		id = strconv.FormatUint(c.seq.Add(1), 10)
+		ch = make(chan *genv1.CommandResult, 1)
+	)
+	c.mu.Lock()
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	select {
+	case <-c.done:
+		return status.Error(codes.Unavailable, "agent stream closed")
+	default:
+	}
+	err = c.Send(&genv1.ControlMessage{Msg: &genv1.ControlMessage_Command{
+		Command: &genv1.Command{Id: id, Method: method, Request: req},
+	}})
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "send command: %v", err)
+	}
+
+	select {
+	case res := <-ch:
+		if code := codes.Code(res.GetCode()); code != codes.OK {
+			return status.Error(code, res.GetMessage())
+		}
+		if err = proto.Unmarshal(res.GetResponse(), reply.(proto.Message)); err != nil {
+			return status.Errorf(codes.Internal, "decode response: %v", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-c.done:
+		return status.Error(codes.Unavailable, "agent stream closed")
+	}
+}
+
+// NewStream is not supported: commands are unary calls.
+func (c *StreamConn) NewStream(context.Context, *grpc.StreamDesc, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Error(codes.Unimplemented, "streaming calls are not supported over the agent stream")
+}
+
+func (c *StreamConn) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
@@ -8,11 +8,15 @@ import (
 	genv1 "github.com/soltiHQ/control-plane/api/gen/v1"
 	proxyv1 "github.com/soltiHQ/control-plane/api/proxy/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
-// grpcProxyV1 implements AgentProxy over gRPC (solti.v1.SoltiApi).
+// grpcProxyV1 implements AgentProxy over gRPC (solti.api.v1.SoltiApi), on a dialed
+// connection or an agent stream (StreamConn).
 type grpcProxyV1 struct {
-	conn *grpc.ClientConn
+	conn grpc.ClientConnInterface
 }
 
 func (p *grpcProxyV1) ListTasks(ctx context.Context, f TaskFilter) (*proxyv1.TaskListResponse, error) {
@@ -38,15 +42,7 @@ func (p *grpcProxyV1) ListTasks(ctx context.Context, f TaskFilter) (*proxyv1.Tas
 
 	tasks := make([]proxyv1.Task, len(resp.GetTasks()))
 	for i, t := range resp.GetTasks() {
-		tasks[i] = proxyv1.Task{
-			ID:        t.GetId(),
-			Slot:      t.GetSlot(),
-			Status:    v1TaskStatusString(t.GetStatus()),
-			Attempt:   int(t.GetAttempt()),
-			CreatedAt: t.GetCreatedAt(),
-			UpdatedAt: t.GetUpdatedAt(),
-			Error:     t.GetError(),
-		}
+		tasks[i] = v1Task(t)
 	}
 
 	return &proxyv1.TaskListResponse{
@@ -55,9 +51,112 @@ func (p *grpcProxyV1) ListTasks(ctx context.Context, f TaskFilter) (*proxyv1.Tas
 	}, nil
 }
 
-// SubmitTask is not yet supported over gRPC — the proto does not define the RPC.
-func (p *grpcProxyV1) SubmitTask(_ context.Context, _ TaskSubmission) error {
-	return fmt.Errorf("%w: not available over gRPC (no proto RPC defined)", ErrSubmitTask)
+func (p *grpcProxyV1) GetTask(ctx context.Context, id string) (*proxyv1.Task, error) {
+	client := genv1.NewSoltiApiClient(p.conn)
+
+	resp, err := client.GetTask(ctx, &genv1.GetTaskRequest{Id: id})
+	if err != nil {
+		return nil, v1CallError(ErrGetTask, err)
+	}
+
+	t := v1Task(resp.GetTask())
+	return &t, nil
+}
+
+func (p *grpcProxyV1) SubmitTask(ctx context.Context, sub TaskSubmission) error {
+	client := genv1.NewSoltiApiClient(p.conn)
+
+	spec, err := structpb.NewStruct(sub.Spec)
+	if err != nil {
+		return fmt.Errorf("%w: encode spec: %v", ErrSubmitTask, err)
+	}
+
+	_, err = client.SubmitTask(ctx, &genv1.SubmitTaskRequest{
+		Spec:    spec,
+		Version: clampUint32(sub.Version),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSubmitTask, err)
+	}
+	return nil
+}
+
+// CancelTask treats NOT_FOUND as success, like a 404 over HTTP: the slot is already gone.
+func (p *grpcProxyV1) CancelTask(ctx context.Context, slot string) error {
+	client := genv1.NewSoltiApiClient(p.conn)
+
+	_, err := client.CancelTask(ctx, &genv1.CancelTaskRequest{Slot: slot})
+	if err != nil && status.Code(err) != codes.NotFound {
+		return fmt.Errorf("%w: %v", ErrCancelTask, err)
+	}
+	return nil
+}
+
+func (p *grpcProxyV1) ExportSpecs(ctx context.Context) ([]SpecExport, error) {
+	client := genv1.NewSoltiApiClient(p.conn)
+
+	resp, err := client.ExportSpecs(ctx, &genv1.ExportSpecsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExportSpecs, err)
+	}
+
+	specs := make([]SpecExport, len(resp.GetSpecs()))
+	for i, s := range resp.GetSpecs() {
+		specs[i] = SpecExport{
+			Version: int(s.GetVersion()),
+			Slot:    s.GetSlot(),
+			Kind:    s.GetKind().AsMap(),
+		}
+	}
+	return specs, nil
+}
+
+// ApplyBundle maps UNIMPLEMENTED (an agent without the RPC) to ErrNotSupported.
+func (p *grpcProxyV1) ApplyBundle(ctx context.Context, b TaskBundle) error {
+	client := genv1.NewSoltiApiClient(p.conn)
+
+	req := &genv1.ApplyBundleRequest{
+		Revision: b.Revision,
+		Tasks:    make([]*genv1.SubmitTaskRequest, 0, len(b.Tasks)),
+		Remove:   b.Remove,
+	}
+	for _, t := range b.Tasks {
+		spec, err := structpb.NewStruct(t.Spec)
+		if err != nil {
+			return fmt.Errorf("%w: encode spec: %v", ErrApplyBundle, err)
+		}
+		req.Tasks = append(req.Tasks, &genv1.SubmitTaskRequest{Spec: spec, Version: clampUint32(t.Version)})
+	}
+
+	resp, err := client.ApplyBundle(ctx, req)
+	if err != nil {
+		if status.Code(err) == codes.Unimplemented {
+			return fmt.Errorf("%w: %w", ErrApplyBundle, ErrNotSupported)
+		}
+		return fmt.Errorf("%w: %v", ErrApplyBundle, err)
+	}
+	return checkBundleAck(b.Revision, resp.GetRevision())
+}
+
+// v1Task converts a v1 proto TaskInfo to the proxy DTO.
+func v1Task(t *genv1.TaskInfo) proxyv1.Task {
+	return proxyv1.Task{
+		ID:        t.GetId(),
+		Slot:      t.GetSlot(),
+		Status:    v1TaskStatusString(t.GetStatus()),
+		Attempt:   int(t.GetAttempt()),
+		CreatedAt: t.GetCreatedAt(),
+		UpdatedAt: t.GetUpdatedAt(),
+		Error:     t.GetError(),
+	}
+}
+
+// v1CallError wraps a failed call in sentinel, adding ErrNotFound for a NOT_FOUND status.
+func v1CallError(sentinel, err error) error {
+	if status.Code(err) == codes.NotFound {
+		return fmt.Errorf("%w: %w", sentinel, ErrNotFound)
+	}
+	return fmt.Errorf("%w: %v", sentinel, err)
 }
 
 // v1TaskStatusString converts a v1 proto TaskStatus enum to a lowercase string.
@@ -10,7 +10,9 @@ import (
 )
 
 const (
-	v1PathTasks = "/api/v1/tasks"
+	v1PathTasks       = "/api/v1/tasks"
+	v1PathSpecsExport = "/api/v1/specs/export"
+	v1PathBundle      = "/api/v1/bundle"
 )
 
 // httpProxyV1 implements AgentProxy over HTTP for API v1.
@@ -43,11 +45,59 @@ func (p *httpProxyV1) ListTasks(ctx context.Context, f TaskFilter) (*proxyv1.Tas
 	return doGet[proxyv1.TaskListResponse](ctx, p.client, u.String())
 }
 
+func (p *httpProxyV1) GetTask(ctx context.Context, id string) (*proxyv1.Task, error) {
+	u, err := url.Parse(p.endpoint + v1PathTasks + "/" + url.PathEscape(id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadEndpointURL, err)
+	}
+
+	return doGet[proxyv1.Task](ctx, p.client, u.String())
+}
+
 func (p *httpProxyV1) SubmitTask(ctx context.Context, sub TaskSubmission) error {
 	u, err := url.Parse(p.endpoint + v1PathTasks)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrBadEndpointURL, err)
 	}
 
-	return doPost(ctx, p.client, u.String(), map[string]any{"spec": sub.Spec})
+	return doPost(ctx, p.client, u.String(), map[string]any{"spec": sub.Spec, "version": sub.Version})
+}
+
+func (p *httpProxyV1) CancelTask(ctx context.Context, slot string) error {
+	u, err := url.Parse(p.endpoint + v1PathTasks)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadEndpointURL, err)
+	}
+
+	q := u.Query()
+	q.Set("slot", slot)
+	u.RawQuery = q.Encode()
+
+	return doDelete(ctx, p.client, u.String())
+}
+
+func (p *httpProxyV1) ExportSpecs(ctx context.Context) ([]SpecExport, error) {
+	u, err := url.Parse(p.endpoint + v1PathSpecsExport)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadEndpointURL, err)
+	}
+
+	res, err := doGet[SpecExportList](ctx, p.client, u.String())
+	if err != nil {
+		return nil, err
+	}
+	return res.Specs, nil
+}
+
+func (p *httpProxyV1) ApplyBundle(ctx context.Context, b TaskBundle) error {
+	u, err := url.Parse(p.endpoint + v1PathBundle)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadEndpointURL, err)
+	}
+
+	ack, err := doPostResult[TaskBundle](ctx, p.client, u.String(), b)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrApplyBundle, err)
+	}
+	return checkBundleAck(b.Revision, ack.Revision)
 }
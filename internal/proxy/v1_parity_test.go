@@ -0,0 +1,550 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	genv1 "github.com/soltiHQ/control-plane/api/gen/v1"
+	proxyv1 "github.com/soltiHQ/control-plane/api/proxy/v1"
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// fakeAgent is an in-memory agent exposed over every v1 transport.
+type fakeAgent struct {
+	genv1.UnimplementedSoltiApiServer
+
+	mu    sync.Mutex
+	seq   int
+	tasks []proxyv1.Task
+	specs map[string]SpecExport
+}
+
+func newFakeAgent() *fakeAgent {
+	return &fakeAgent{specs: make(map[string]SpecExport)}
+}
+
+func (a *fakeAgent) submit(spec map[string]any, version int) (string, error) {
+	slot, _ := spec["slot"].(string)
+	if slot == "" {
+		return "", errors.New("spec without slot")
+	}
+	kindCfg, _ := spec["kind"].(map[string]any)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.seq++
+	t := proxyv1.Task{
+		ID:        fmt.Sprintf("task-%d", a.seq),
+		Slot:      slot,
+		Status:    "running",
+		Attempt:   1,
+		CreatedAt: 1700000000 + int64(a.seq),
+		UpdatedAt: 1700000000 + int64(a.seq),
+	}
+	a.tasks = append(a.tasks, t)
+	a.specs[slot] = SpecExport{Slot: slot, Version: version, Kind: kindCfg}
+	return t.ID, nil
+}
+
+func (a *fakeAgent) cancel(slot string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.specs[slot]; !ok {
+		return false
+	}
+	delete(a.specs, slot)
+	for i := range a.tasks {
+		if a.tasks[i].Slot == slot && a.tasks[i].Status == "running" {
+			a.tasks[i].Status = "canceled"
+		}
+	}
+	return true
+}
+
+// apply submits the bundle's tasks whose slot is not at their version yet and cancels its removed
+// slots; a task without a slot rejects the whole bundle.
+func (a *fakeAgent) apply(b TaskBundle) error {
+	for _, t := range b.Tasks {
+		if slot, _ := t.Spec["slot"].(string); slot == "" {
+			return errors.New("bundle task without slot")
+		}
+	}
+	for _, t := range b.Tasks {
+		a.mu.Lock()
+		cur, ok := a.specs[t.Spec["slot"].(string)]
+		a.mu.Unlock()
+		if ok && cur.Version == t.Version {
+			continue
+		}
+		if _, err := a.submit(t.Spec, t.Version); err != nil {
+			return err
+		}
+	}
+	for _, slot := range b.Remove {
+		a.cancel(slot)
+	}
+	return nil
+}
+
+func (a *fakeAgent) get(id string) (proxyv1.Task, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, t := range a.tasks {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return proxyv1.Task{}, false
+}
+
+func (a *fakeAgent) list(slot, state string) []proxyv1.Task {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var out []proxyv1.Task
+	for _, t := range a.tasks {
+		if (slot == "" || t.Slot == slot) && (state == "" || t.Status == state) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func (a *fakeAgent) export() []SpecExport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]SpecExport, 0, len(a.specs))
+	for _, s := range a.specs {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Slot < out[j].Slot })
+	return out
+}
+
+// ServeHTTP implements the agent's HTTP API v1.
+func (a *fakeAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJSON := func(v any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	switch {
+	case r.URL.Path == v1PathSpecsExport && r.Method == http.MethodGet:
+		writeJSON(SpecExportList{Specs: a.export()})
+	case r.URL.Path == v1PathTasks && r.Method == http.MethodGet:
+		tasks := a.list(r.URL.Query().Get("slot"), r.URL.Query().Get("status"))
+		writeJSON(proxyv1.TaskListResponse{Tasks: tasks, Total: len(tasks)})
+	case r.URL.Path == v1PathTasks && r.Method == http.MethodPost:
+		var body TaskSubmission
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, err := a.submit(body.Spec, body.Version); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case r.URL.Path == v1PathTasks && r.Method == http.MethodDelete:
+		if !a.cancel(r.URL.Query().Get("slot")) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == v1PathBundle && r.Method == http.MethodPost:
+		var body TaskBundle
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := a.apply(body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJSON(TaskBundle{Revision: body.Revision})
+	case strings.HasPrefix(r.URL.Path, v1PathTasks+"/") && r.Method == http.MethodGet:
+		t, ok := a.get(strings.TrimPrefix(r.URL.Path, v1PathTasks+"/"))
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(t)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *fakeAgent) ListTasks(_ context.Context, req *genv1.ListTasksRequest) (*genv1.ListTasksResponse, error) {
+	var state string
+	if req.Status != nil {
+		state = v1TaskStatusString(req.GetStatus())
+	}
+	tasks := a.list(req.GetSlot(), state)
+
+	out := make([]*genv1.TaskInfo, len(tasks))
+	for i, t := range tasks {
+		out[i] = fakeTaskInfo(t)
+	}
+	return &genv1.ListTasksResponse{Tasks: out, Total: uint32(len(out))}, nil
+}
+
+func (a *fakeAgent) GetTask(_ context.Context, req *genv1.GetTaskRequest) (*genv1.GetTaskResponse, error) {
+	t, ok := a.get(req.GetId())
+	if !ok {
+		return nil, status.Error(codes.NotFound, "task not found")
+	}
+	return &genv1.GetTaskResponse{Task: fakeTaskInfo(t)}, nil
+}
+
+func (a *fakeAgent) SubmitTask(_ context.Context, req *genv1.SubmitTaskRequest) (*genv1.SubmitTaskResponse, error) {
+	id, err := a.submit(req.GetSpec().AsMap(), int(req.GetVersion()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &genv1.SubmitTaskResponse{TaskId: id}, nil
+}
+
+func (a *fakeAgent) CancelTask(_ context.Context, req *genv1.CancelTaskRequest) (*genv1.CancelTaskResponse, error) {
+	if !a.cancel(req.GetSlot()) {
+		return nil, status.Error(codes.NotFound, "slot not found")
+	}
+	return &genv1.CancelTaskResponse{}, nil
+}
+
+func (a *fakeAgent) ExportSpecs(_ context.Context, _ *genv1.ExportSpecsRequest) (*genv1.ExportSpecsResponse, error) {
+	specs := a.export()
+
+	out := make([]*genv1.SpecInfo, len(specs))
+	for i, s := range specs {
+		kindCfg, err := structpb.NewStruct(s.Kind)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		out[i] = &genv1.SpecInfo{Slot: s.Slot, Version: uint32(s.Version), Kind: kindCfg}
+	}
+	return &genv1.ExportSpecsResponse{Specs: out}, nil
+}
+
+func (a *fakeAgent) ApplyBundle(_ context.Context, req *genv1.ApplyBundleRequest) (*genv1.ApplyBundleResponse, error) {
+	b := TaskBundle{Revision: req.GetRevision(), Remove: req.GetRemove()}
+	for _, t := range req.GetTasks() {
+		b.Tasks = append(b.Tasks, TaskSubmission{Spec: t.GetSpec().AsMap(), Version: int(t.GetVersion())})
+	}
+	if err := a.apply(b); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &genv1.ApplyBundleResponse{Revision: req.GetRevision()}, nil
+}
+
+func fakeTaskInfo(t proxyv1.Task) *genv1.TaskInfo {
+	s, _ := parseV1TaskStatus(t.Status)
+	info := &genv1.TaskInfo{
+		Id:        t.ID,
+		Slot:      t.Slot,
+		Status:    s,
+		Attempt:   uint32(t.Attempt),
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+	}
+	if t.Error != "" {
+		info.Error = &t.Error
+	}
+	return info
+}
+
+// openStream registers an agent stream whose commands are answered by srv, the way an agent
+// dispatches them to its SoltiApi implementation.
+func openStream(streams *Streams, agentID string, srv genv1.SoltiApiServer) *StreamConn {
+	var conn *StreamConn
+	conn = streams.Open(agentID, func(msg *genv1.ControlMessage) error {
+		cmd := msg.GetCommand()
+		go func() { conn.Resolve(dispatch(srv, cmd)) }()
+		return nil
+	})
+	return conn
+}
+
+func dispatch(srv genv1.SoltiApiServer, cmd *genv1.Command) *genv1.CommandResult {
+	res := &genv1.CommandResult{Id: cmd.GetId()}
+	for _, m := range genv1.SoltiApi_ServiceDesc.Methods {
+		if "/"+genv1.SoltiApi_ServiceDesc.ServiceName+"/"+m.MethodName != cmd.GetMethod() {
+			continue
+		}
+		dec := func(v any) error { return proto.Unmarshal(cmd.GetRequest(), v.(proto.Message)) }
+		out, err := m.Handler(srv, context.Background(), dec, nil)
+		if err != nil {
+			st := status.Convert(err)
+			res.Code, res.Message = uint32(st.Code()), st.Message()
+			return res
+		}
+		res.Response, _ = proto.Marshal(out.(proto.Message))
+		return res
+	}
+	res.Code = uint32(codes.Unimplemented)
+	return res
+}
+
+// transcript records what one transport observed while running the parity scenario.
+type transcript struct {
+	WebTasks    *proxyv1.TaskListResponse
+	WebTask     *proxyv1.Task
+	Exported    []SpecExport
+	Canceled    *proxyv1.TaskListResponse
+	AfterSpecs  []SpecExport
+	BundleTasks *proxyv1.TaskListResponse
+	BundleSpecs []SpecExport
+}
+
+func runScenario(t *testing.T, ap AgentProxy) transcript {
+	t.Helper()
+	ctx := context.Background()
+
+	web := map[string]any{
+		"slot":      "web",
+		"kind":      map[string]any{"subprocess": map[string]any{"command": "sleep", "args": []any{"30"}}},
+		"timeoutMs": 60000,
+	}
+	if err := ap.SubmitTask(ctx, TaskSubmission{Spec: web, Version: 3}); err != nil {
+		t.Fatalf("submit web: %v", err)
+	}
+	cron := map[string]any{"slot": "cron", "kind": map[string]any{"subprocess": map[string]any{"command": "true"}}}
+	if err := ap.SubmitTask(ctx, TaskSubmission{Spec: cron, Version: 1}); err != nil {
+		t.Fatalf("submit cron: %v", err)
+	}
+
+	var (
+		tr  transcript
+		err error
+	)
+	if tr.WebTasks, err = ap.ListTasks(ctx, TaskFilter{Slot: "web"}); err != nil {
+		t.Fatalf("list web: %v", err)
+	}
+	if len(tr.WebTasks.Tasks) != 1 {
+		t.Fatalf("expected 1 web task, got %d", len(tr.WebTasks.Tasks))
+	}
+	if tr.WebTask, err = ap.GetTask(ctx, tr.WebTasks.Tasks[0].ID); err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if _, err = ap.GetTask(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unknown task, got %v", err)
+	}
+	if tr.Exported, err = ap.ExportSpecs(ctx); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	if err = ap.CancelTask(ctx, "web"); err != nil {
+		t.Fatalf("cancel web: %v", err)
+	}
+	if err = ap.CancelTask(ctx, "web"); err != nil {
+		t.Fatalf("cancel of a removed slot must succeed, got %v", err)
+	}
+	if tr.Canceled, err = ap.ListTasks(ctx, TaskFilter{Status: "canceled"}); err != nil {
+		t.Fatalf("list canceled: %v", err)
+	}
+	if tr.AfterSpecs, err = ap.ExportSpecs(ctx); err != nil {
+		t.Fatalf("export after cancel: %v", err)
+	}
+
+	// cron is kept as it is, web comes back at version 4 and a second bundle removes cron.
+	b := NewTaskBundle([]TaskSubmission{{Spec: web, Version: 4}, {Spec: cron, Version: 1}}, nil)
+	if err = ap.ApplyBundle(ctx, b); err != nil {
+		t.Fatalf("apply bundle: %v", err)
+	}
+	if err = ap.ApplyBundle(ctx, NewTaskBundle([]TaskSubmission{{Spec: web, Version: 4}}, []string{"cron"})); err != nil {
+		t.Fatalf("apply removal bundle: %v", err)
+	}
+	if err = ap.ApplyBundle(ctx, NewTaskBundle([]TaskSubmission{{Spec: map[string]any{}, Version: 1}}, nil)); !errors.Is(err, ErrApplyBundle) {
+		t.Fatalf("expected ErrApplyBundle for a rejected bundle, got %v", err)
+	}
+	if tr.BundleTasks, err = ap.ListTasks(ctx, TaskFilter{Status: "running"}); err != nil {
+		t.Fatalf("list after bundle: %v", err)
+	}
+	if tr.BundleSpecs, err = ap.ExportSpecs(ctx); err != nil {
+		t.Fatalf("export after bundle: %v", err)
+	}
+	return tr
+}
+
+func TestV1Proxy_Parity(t *testing.T) {
+	pool := NewPool()
+	t.Cleanup(func() { _ = pool.Close() })
+
+	httpSrv := httptest.NewServer(newFakeAgent())
+	t.Cleanup(httpSrv.Close)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	grpcSrv := grpc.NewServer()
+	genv1.RegisterSoltiApiServer(grpcSrv, newFakeAgent())
+	go func() { _ = grpcSrv.Serve(lis) }()
+	t.Cleanup(grpcSrv.Stop)
+
+	httpProxy, err := pool.Get(httpSrv.URL, kind.EndpointHTTP, kind.APIVersionV1)
+	if err != nil {
+		t.Fatalf("http proxy: %v", err)
+	}
+	grpcProxy, err := pool.Get(lis.Addr().String(), kind.EndpointGRPC, kind.APIVersionV1)
+	if err != nil {
+		t.Fatalf("grpc proxy: %v", err)
+	}
+	openStream(pool.Streams(), "agent-s", newFakeAgent())
+	streamProxy, err := pool.ForAgent("agent-s", "", kind.EndpointGRPC, kind.APIVersionV1)
+	if err != nil {
+		t.Fatalf("stream proxy: %v", err)
+	}
+
+	overHTTP := runScenario(t, httpProxy)
+	overGRPC := runScenario(t, grpcProxy)
+	overStream := runScenario(t, streamProxy)
+
+	if !reflect.DeepEqual(overHTTP, overGRPC) {
+		t.Fatalf("transports disagree:\nhttp: %+v\ngrpc: %+v", overHTTP, overGRPC)
+	}
+	if !reflect.DeepEqual(overHTTP, overStream) {
+		t.Fatalf("transports disagree:\nhttp: %+v\nstream: %+v", overHTTP, overStream)
+	}
+
+	if got := overHTTP.WebTask.Slot; got != "web" {
+		t.Fatalf("expected task of slot web, got %q", got)
+	}
+	if len(overHTTP.Exported) != 2 || overHTTP.Exported[1].Version != 3 {
+		t.Fatalf("expected web exported at version 3, got %+v", overHTTP.Exported)
+	}
+	if len(overHTTP.Canceled.Tasks) != 1 || overHTTP.Canceled.Tasks[0].Slot != "web" {
+		t.Fatalf("expected the web task canceled, got %+v", overHTTP.Canceled.Tasks)
+	}
+	if len(overHTTP.AfterSpecs) != 1 || overHTTP.AfterSpecs[0].Slot != "cron" {
+		t.Fatalf("expected only cron left, got %+v", overHTTP.AfterSpecs)
+	}
+	if len(overHTTP.BundleSpecs) != 1 || overHTTP.BundleSpecs[0].Slot != "web" || overHTTP.BundleSpecs[0].Version != 4 {
+		t.Fatalf("expected only web at version 4 after the bundles, got %+v", overHTTP.BundleSpecs)
+	}
+	if len(overHTTP.BundleTasks.Tasks) != 1 || overHTTP.BundleTasks.Tasks[0].Slot != "web" {
+		t.Fatalf("expected one running web task after the bundles, got %+v", overHTTP.BundleTasks.Tasks)
+	}
+}
+
+func TestV1Proxy_BundleNotSupported(t *testing.T) {
+	pool := NewPool()
+	t.Cleanup(func() { _ = pool.Close() })
+
+	httpSrv := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(httpSrv.Close)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	grpcSrv := grpc.NewServer()
+	genv1.RegisterSoltiApiServer(grpcSrv, genv1.UnimplementedSoltiApiServer{})
+	go func() { _ = grpcSrv.Serve(lis) }()
+	t.Cleanup(grpcSrv.Stop)
+
+	for _, target := range []struct {
+		endpoint string
+		typ      kind.EndpointType
+	}{
+		{httpSrv.URL, kind.EndpointHTTP},
+		{lis.Addr().String(), kind.EndpointGRPC},
+	} {
+		ap, err := pool.Get(target.endpoint, target.typ, kind.APIVersionV1)
+		if err != nil {
+			t.Fatalf("%s proxy: %v", target.typ, err)
+		}
+		err = ap.ApplyBundle(context.Background(), NewTaskBundle(nil, []string{"web"}))
+		if !errors.Is(err, ErrApplyBundle) || !errors.Is(err, ErrNotSupported) {
+			t.Fatalf("%s: expected ErrApplyBundle and ErrNotSupported, got %v", target.typ, err)
+		}
+	}
+
+	openStream(pool.Streams(), "agent-s", genv1.UnimplementedSoltiApiServer{})
+	ap, err := pool.ForAgent("agent-s", "", kind.EndpointGRPC, kind.APIVersionV1)
+	if err != nil {
+		t.Fatalf("stream proxy: %v", err)
+	}
+	err = ap.ApplyBundle(context.Background(), NewTaskBundle(nil, []string{"web"}))
+	if !errors.Is(err, ErrApplyBundle) || !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("stream: expected ErrApplyBundle and ErrNotSupported, got %v", err)
+	}
+}
+
+func TestStreams_ReplaceAndClose(t *testing.T) {
+	pool := NewPool()
+	t.Cleanup(func() { _ = pool.Close() })
+
+	// An agent that never answers: the call waits until the stream is replaced.
+	sent := make(chan struct{}, 1)
+	first := pool.Streams().Open("agent-s", func(*genv1.ControlMessage) error {
+		sent <- struct{}{}
+		return nil
+	})
+	ap, err := pool.ForAgent("agent-s", "", kind.EndpointGRPC, kind.APIVersionV1)
+	if err != nil {
+		t.Fatalf("stream proxy: %v", err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := ap.ListTasks(context.Background(), TaskFilter{})
+		errc <- err
+	}()
+	<-sent
+
+	second := openStream(pool.Streams(), "agent-s", newFakeAgent())
+	if err = <-errc; !errors.Is(err, ErrListTasks) || !strings.Contains(err.Error(), "stream closed") {
+		t.Fatalf("expected the pending call to fail with the replaced stream, got %v", err)
+	}
+
+	pool.Streams().Close(first)
+	if c, ok := pool.Streams().Get("agent-s"); !ok || c != second {
+		t.Fatalf("expected closing the replaced stream to keep the new one")
+	}
+	pool.Streams().Close(second)
+	ap, err = pool.ForAgent("agent-s", "http://agent-s", kind.EndpointHTTP, kind.APIVersionV1)
+	if err != nil {
+		t.Fatalf("http proxy: %v", err)
+	}
+	if _, ok := ap.(*httpProxyV1); !ok {
+		t.Fatalf("expected the dialed proxy once the stream is closed, got %T", ap)
+	}
+}
+
+func TestNewTaskBundle_Revision(t *testing.T) {
+	a := TaskSubmission{Spec: map[string]any{"slot": "a"}, Version: 1}
+	b := TaskSubmission{Spec: map[string]any{"slot": "b"}, Version: 2}
+
+	first := NewTaskBundle([]TaskSubmission{a, b}, []string{"x", "y"})
+	if again := NewTaskBundle([]TaskSubmission{b, a}, []string{"y", "x"}); again.Revision != first.Revision {
+		t.Fatalf("expected the revision to ignore order: %q != %q", again.Revision, first.Revision)
+	}
+	if first.Tasks[0].Spec["slot"] != "a" || first.Remove[0] != "x" {
+		t.Fatalf("expected tasks and removals sorted, got %+v", first)
+	}
+	b.Version = 3
+	if bumped := NewTaskBundle([]TaskSubmission{a, b}, []string{"x", "y"}); bumped.Revision == first.Revision {
+		t.Fatalf("expected a new revision for a new task version")
+	}
+}
+
+func TestV1Proxy_SubmitUnencodableSpec(t *testing.T) {
+	p := &grpcProxyV1{}
+	err := p.SubmitTask(context.Background(), TaskSubmission{Spec: map[string]any{"slot": make(chan int)}})
+	if !errors.Is(err, ErrSubmitTask) {
+		t.Fatalf("expected ErrSubmitTask, got %v", err)
+	}
+}
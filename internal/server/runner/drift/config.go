@@ -0,0 +1,37 @@
+package drift
+
+import "time"
+
+const (
+	defaultTickInterval  = 60 * time.Second
+	defaultExportTimeout = 15 * time.Second
+
+	defaultName    = "drift"
+	defaultWorkers = 16
+)
+
+// Config configures the drift runner.
+//
+// Up to Workers agents are checked at once, each export bounded by ExportTimeout.
+type Config struct {
+	TickInterval  time.Duration
+	ExportTimeout time.Duration
+	Name          string
+	Workers       int
+}
+
+func (c Config) withDefaults() Config {
+	if c.Name == "" {
+		c.Name = defaultName
+	}
+	if c.TickInterval <= 0 {
+		c.TickInterval = defaultTickInterval
+	}
+	if c.ExportTimeout <= 0 {
+		c.ExportTimeout = defaultExportTimeout
+	}
+	if c.Workers <= 0 {
+		c.Workers = defaultWorkers
+	}
+	return c
+}
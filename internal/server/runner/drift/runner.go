@@ -0,0 +1,236 @@
+// Package drift implements a server.Runner that detects drift between rollouts and agents
+// by reading back the specs agents actually run:
+//   - Lists synced and unknown rollouts on every tick, grouped by agent
+//   - Calls ExportSpecs once per agent via the proxy pool, up to Config.Workers agents at once
+//   - Marks a rollout drift when the agent reports another version (or no spec) for its slot,
+//     unknown when the agent cannot be reached, and synced again when an unknown rollout matches.
+//
+// Drifted rollouts are healed by the sync runner, which pushes them like pending ones.
+package drift
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/proxy"
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+// Runner is a server.Runner that periodically compares rollouts with agent exports.
+type Runner struct {
+	logger  zerolog.Logger
+	cfg     Config
+	store   storage.Storage
+	pool    proxy.Dialer
+	stop    chan struct{}
+	started atomic.Bool
+}
+
+// New creates a drift runner.
+func New(cfg Config, logger zerolog.Logger, store storage.Storage, pool *proxy.Pool) (*Runner, error) {
+	if store == nil {
+		return nil, errors.New("drift: store is nil")
+	}
+	if pool == nil {
+		return nil, errors.New("drift: proxy pool is nil")
+	}
+
+	cfg = cfg.withDefaults()
+	return &Runner{
+		logger: logger.With().Str("runner", cfg.Name).Logger(),
+		cfg:    cfg,
+		store:  store,
+		pool:   pool,
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+// Name returns the runner name.
+func (r *Runner) Name() string { return r.cfg.Name }
+
+// Start runs the drift detection loop until Stop is called.
+func (r *Runner) Start(_ context.Context) error {
+	if !r.started.CompareAndSwap(false, true) {
+		return errors.New("drift: already started")
+	}
+
+	ticker := time.NewTicker(r.cfg.TickInterval)
+	defer ticker.Stop()
+
+	r.logger.Info().
+		Dur("tick", r.cfg.TickInterval).
+		Msg("drift runner started")
+
+	for {
+		select {
+		case <-ticker.C:
+			r.tick()
+		case <-r.stop:
+			r.logger.Info().Msg("drift runner stopped")
+			return nil
+		}
+	}
+}
+
+// Stop signals the runner to exit. Safe to call multiple times.
+func (r *Runner) Stop(_ context.Context) error {
+	if !r.started.Load() {
+		return nil
+	}
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	return nil
+}
+
+func (r *Runner) tick() {
+	ctx := context.Background()
+
+	var (
+		byAgent = make(map[string][]*model.Rollout)
+		agents  []string
+	)
+	opts := storage.ListOptions{Limit: storage.MaxListLimit}
+	for {
+		res, err := r.store.ListRollouts(ctx, nil, opts)
+		if err != nil {
+			r.logger.Error().Err(err).Msg("tick: list rollouts failed")
+			return
+		}
+		for _, ss := range res.Items {
+			switch ss.Status() {
+			case kind.SyncStatusSynced, kind.SyncStatusUnknown:
+				if _, ok := byAgent[ss.AgentID()]; !ok {
+					agents = append(agents, ss.AgentID())
+				}
+				byAgent[ss.AgentID()] = append(byAgent[ss.AgentID()], ss)
+			}
+		}
+		if res.NextCursor == "" {
+			break
+		}
+		opts.Cursor = res.NextCursor
+	}
+
+	if len(agents) == 0 {
+		return
+	}
+
+	// An unreachable agent holds its worker for up to ExportTimeout; the others carry on.
+	var (
+		workers = min(r.cfg.Workers, len(agents))
+		work    = make(chan string)
+		done    = make(chan struct{})
+	)
+	for range workers {
+		go func() {
+			for agentID := range work {
+				exportCtx, cancel := context.WithTimeout(ctx, r.cfg.ExportTimeout)
+				r.check(exportCtx, agentID, byAgent[agentID])
+				cancel()
+			}
+			done <- struct{}{}
+		}()
+	}
+	for _, agentID := range agents {
+		work <- agentID
+	}
+	close(work)
+	for range workers {
+		<-done
+	}
+}
+
+// check compares the rollouts of one agent with the agent's export.
+func (r *Runner) check(ctx context.Context, agentID string, rollouts []*model.Rollout) {
+	reported, err := r.export(ctx, agentID)
+	if errors.Is(err, errPullDelivery) {
+		// The agent reports its versions on discovery sync instead (see service/delivery).
+		return
+	}
+	if err != nil {
+		r.logger.Warn().Err(err).
+			Str("agent_id", agentID).
+			Msg("check: export failed")
+		for _, ss := range rollouts {
+			if ss.Status() != kind.SyncStatusUnknown {
+				ss.MarkUnknown()
+				r.save(ctx, ss, "markUnknown")
+			}
+		}
+		return
+	}
+
+	for _, ss := range rollouts {
+		ts, err := r.store.GetSpec(ctx, ss.SpecID())
+		if err != nil {
+			// Deleted specs take their rollouts with them; nothing to compare.
+			continue
+		}
+
+		version, ok := reported[ts.Slot()]
+		switch {
+		case !ok || version != ss.DesiredVersion():
+			ss.MarkDrift()
+			r.save(ctx, ss, "markDrift")
+			r.logger.Info().
+				Str("spec_id", ss.SpecID()).
+				Str("agent_id", agentID).
+				Int("desired", ss.DesiredVersion()).
+				Int("reported", version).
+				Bool("present", ok).
+				Msg("drift detected")
+		case ss.Status() == kind.SyncStatusUnknown:
+			ss.MarkSynced(version)
+			r.save(ctx, ss, "markSynced")
+		}
+	}
+}
+
+// errPullDelivery is returned by export for agents the control plane does not dial.
+var errPullDelivery = errors.New("drift: agent uses pull delivery")
+
+// export returns the spec versions reported by the agent, by slot.
+func (r *Runner) export(ctx context.Context, agentID string) (map[string]int, error) {
+	ag, err := r.store.GetAgent(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	if ag.Delivery() == kind.DeliveryPull {
+		return nil, errPullDelivery
+	}
+	ap, err := r.pool.ForAgent(ag.ID(), ag.Endpoint(), ag.EndpointType(), ag.APIVersion())
+	if err != nil {
+		return nil, err
+	}
+	specs, err := ap.ExportSpecs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]int, len(specs))
+	for _, s := range specs {
+		out[s.Slot] = s.Version
+	}
+	return out, nil
+}
+
+// save writes the rollout conditionally on the version read at tick time: if it changed
+// meanwhile (a new Deploy, a push), the observation is stale and is dropped.
+func (r *Runner) save(ctx context.Context, ss *model.Rollout, op string) {
+	err := r.store.UpsertRollout(ctx, ss)
+	switch {
+	case err == nil:
+	case errors.Is(err, storage.ErrConflict):
+		r.logger.Info().Str("rid", ss.ID()).Msg(op + ": rollout changed during check, skipped")
+	default:
+		r.logger.Error().Err(err).Str("rid", ss.ID()).Msg(op + ": upsert failed")
+	}
+}
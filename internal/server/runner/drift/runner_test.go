@@ -0,0 +1,210 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	proxyv1 "github.com/soltiHQ/control-plane/api/proxy/v1"
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/proxy"
+	specsvc "github.com/soltiHQ/control-plane/internal/service/spec"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+func requireNoErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// fakeDialer is a proxy.Dialer whose agents export the versions set in exports.
+type fakeDialer struct {
+	mu      sync.Mutex
+	exports map[string]map[string]int // agent → slot → version; a missing agent is unreachable
+	dialed  map[string]int
+
+	// export, when set, runs inside every ExportSpecs call.
+	export func()
+}
+
+func newFakeDialer() *fakeDialer {
+	return &fakeDialer{exports: make(map[string]map[string]int), dialed: make(map[string]int)}
+}
+
+func (d *fakeDialer) ForAgent(agentID, _ string, _ kind.EndpointType, _ kind.APIVersion) (proxy.AgentProxy, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dialed[agentID]++
+	return &fakeAgent{d: d, id: agentID}, nil
+}
+
+type fakeAgent struct {
+	d  *fakeDialer
+	id string
+}
+
+func (a *fakeAgent) ExportSpecs(context.Context) ([]proxy.SpecExport, error) {
+	if a.d.export != nil {
+		a.d.export()
+	}
+	a.d.mu.Lock()
+	defer a.d.mu.Unlock()
+	slots, ok := a.d.exports[a.id]
+	if !ok {
+		return nil, errors.New("connection refused")
+	}
+	var out []proxy.SpecExport
+	for slot, v := range slots {
+		out = append(out, proxy.SpecExport{Slot: slot, Version: v})
+	}
+	return out, nil
+}
+
+func (a *fakeAgent) ListTasks(context.Context, proxy.TaskFilter) (*proxyv1.TaskListResponse, error) {
+	return &proxyv1.TaskListResponse{}, nil
+}
+
+func (a *fakeAgent) GetTask(context.Context, string) (*proxyv1.Task, error) {
+	return nil, proxy.ErrNotFound
+}
+func (a *fakeAgent) SubmitTask(context.Context, proxy.TaskSubmission) error { return nil }
+func (a *fakeAgent) ApplyBundle(context.Context, proxy.TaskBundle) error    { return nil }
+func (a *fakeAgent) CancelTask(context.Context, string) error               { return nil }
+
+func newTestRunner(t *testing.T, cfg Config, st storage.Storage, d *fakeDialer) *Runner {
+	t.Helper()
+	r, err := New(cfg, zerolog.Nop(), st, proxy.NewPool())
+	requireNoErr(t, err)
+	r.pool = d
+	return r
+}
+
+// mustRollout registers the agent (delivery 0 is push) and deploys spec id, slot id, to it
+// with its rollout in the given status.
+func mustRollout(t *testing.T, ctx context.Context, st storage.Storage, id, agentID string, delivery int, status kind.SyncStatus) {
+	t.Helper()
+	if _, err := st.GetAgent(ctx, agentID); errors.Is(err, storage.ErrNotFound) {
+		a, err := model.NewAgentFrom(model.AgentParams{ID: agentID, Name: agentID, Endpoint: "http://" + agentID, DeliveryMode: delivery})
+		requireNoErr(t, err)
+		requireNoErr(t, st.UpsertAgent(ctx, a))
+	}
+
+	ts, err := model.NewSpec(id, id, id)
+	requireNoErr(t, err)
+	ts.SetKindConfig(map[string]any{"command": "sleep"})
+	ts.SetTargets([]string{agentID})
+	svc := specsvc.New(st)
+	requireNoErr(t, svc.Create(ctx, ts, "tester"))
+	requireNoErr(t, svc.Deploy(ctx, id, "tester"))
+
+	ss, err := st.GetRollout(ctx, model.RolloutID(id, agentID))
+	requireNoErr(t, err)
+	ss.MarkSynced(1)
+	if status == kind.SyncStatusUnknown {
+		ss.MarkUnknown()
+	}
+	requireNoErr(t, st.UpsertRollout(ctx, ss))
+}
+
+func status(t *testing.T, ctx context.Context, st storage.Storage, specID, agentID string) kind.SyncStatus {
+	t.Helper()
+	ss, err := st.GetRollout(ctx, model.RolloutID(specID, agentID))
+	requireNoErr(t, err)
+	return ss.Status()
+}
+
+func TestTick_Transitions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustRollout(t, ctx, st, "same", "a1", 0, kind.SyncStatusSynced)
+	mustRollout(t, ctx, st, "other", "a1", 0, kind.SyncStatusSynced)
+	mustRollout(t, ctx, st, "missing", "a1", 0, kind.SyncStatusSynced)
+	mustRollout(t, ctx, st, "back", "a1", 0, kind.SyncStatusUnknown)
+	mustRollout(t, ctx, st, "gone", "a2", 0, kind.SyncStatusSynced)
+
+	d := newFakeDialer()
+	d.exports["a1"] = map[string]int{"same": 1, "other": 2, "back": 1}
+	newTestRunner(t, Config{}, st, d).tick()
+
+	cases := []struct {
+		spec, agent string
+		want        kind.SyncStatus
+	}{
+		{"same", "a1", kind.SyncStatusSynced},
+		{"other", "a1", kind.SyncStatusDrift},
+		{"missing", "a1", kind.SyncStatusDrift},
+		{"back", "a1", kind.SyncStatusSynced},
+		{"gone", "a2", kind.SyncStatusUnknown},
+	}
+	for _, tc := range cases {
+		if got := status(t, ctx, st, tc.spec, tc.agent); got != tc.want {
+			t.Fatalf("%s on %s: expected %s, got %s", tc.spec, tc.agent, tc.want, got)
+		}
+	}
+}
+
+func TestTick_SkipsPullDelivery(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustRollout(t, ctx, st, "s1", "a1", 1, kind.SyncStatusSynced)
+
+	d := newFakeDialer()
+	newTestRunner(t, Config{}, st, d).tick()
+
+	if n := d.dialed["a1"]; n != 0 {
+		t.Fatalf("a pull agent must not be dialed, got %d dials", n)
+	}
+	if got := status(t, ctx, st, "s1", "a1"); got != kind.SyncStatusSynced {
+		t.Fatalf("expected the rollout left synced, got %s", got)
+	}
+}
+
+func TestTick_BoundsConcurrentExports(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	d := newFakeDialer()
+	for i := range 6 {
+		id := fmt.Sprintf("a%d", i)
+		mustRollout(t, ctx, st, "s"+id, id, 0, kind.SyncStatusSynced)
+		d.exports[id] = map[string]int{"s" + id: 1}
+	}
+
+	var running, peak atomic.Int32
+	d.export = func() {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+	}
+	newTestRunner(t, Config{Workers: 2}, st, d).tick()
+
+	if p := peak.Load(); p != 2 {
+		t.Fatalf("expected exactly 2 concurrent exports, got a peak of %d", p)
+	}
+	for i := range 6 {
+		id := fmt.Sprintf("a%d", i)
+		if got := status(t, ctx, st, "s"+id, id); got != kind.SyncStatusSynced {
+			t.Fatalf("%s: expected synced, got %s", id, got)
+		}
+	}
+}
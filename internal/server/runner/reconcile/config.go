@@ -0,0 +1,25 @@
+package reconcile
+
+import "time"
+
+const (
+	defaultTickInterval = 30 * time.Second
+	defaultName         = "reconcile"
+)
+
+// Config configures the reconcile runner.
+type Config struct {
+	// TickInterval is the period of the full reconciliation that backs up the watches.
+	TickInterval time.Duration
+	Name         string
+}
+
+func (c Config) withDefaults() Config {
+	if c.Name == "" {
+		c.Name = defaultName
+	}
+	if c.TickInterval <= 0 {
+		c.TickInterval = defaultTickInterval
+	}
+	return c
+}
@@ -0,0 +1,522 @@
+// Package reconcile implements a server.Runner that keeps the rollouts of label-targeted
+// specs in line with the agent fleet:
+//   - Creates rollouts for agents that start matching a deployed spec's target labels
+//     (new registrations, relabeling)
+//   - Marks rollouts orphaned when their agent stops matching or is deleted
+//   - Revives orphaned and removed rollouts when their agent matches again.
+//
+// Created and revived rollouts are placed like a deploy places its targets: pending, or
+// waiting in a wave of a progressive deploy (never the already released wave 0), and
+// halted when the deployment was aborted. Only specs that were deployed and have target
+// labels are reconciled; explicit targets are never orphaned.
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/domain/selector"
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+// Runner is a server.Runner that reconciles label-targeted rollouts.
+//
+// It watches agents and specs. An agent that appears, disappears or changes labels is
+// reconciled against the deployed specs, a changed spec against the fleet; events that
+// arrive together are coalesced into one pass. A periodic full pass covers missed events.
+// Agent heartbeats (updates without label changes) do not trigger a pass.
+type Runner struct {
+	logger  zerolog.Logger
+	cfg     Config
+	store   storage.Storage
+	stop    chan struct{}
+	started atomic.Bool
+
+	// labels is the label fingerprint of every known agent, owned by the Start goroutine.
+	labels map[string]string
+}
+
+// New creates a reconcile runner.
+func New(cfg Config, logger zerolog.Logger, store storage.Storage) (*Runner, error) {
+	if store == nil {
+		return nil, errors.New("reconcile: store is nil")
+	}
+
+	cfg = cfg.withDefaults()
+	return &Runner{
+		logger: logger.With().Str("runner", cfg.Name).Logger(),
+		cfg:    cfg,
+		store:  store,
+		stop:   make(chan struct{}),
+		labels: make(map[string]string),
+	}, nil
+}
+
+// Name returns the runner name.
+func (r *Runner) Name() string { return r.cfg.Name }
+
+// Start runs the reconciliation loop until Stop is called.
+func (r *Runner) Start(_ context.Context) error {
+	if !r.started.CompareAndSwap(false, true) {
+		return errors.New("reconcile: already started")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ticker := time.NewTicker(r.cfg.TickInterval)
+	defer ticker.Stop()
+
+	r.logger.Info().
+		Dur("tick", r.cfg.TickInterval).
+		Msg("reconcile runner started")
+
+	agents := r.watch(ctx, storage.KindAgent)
+	specs := r.watch(ctx, storage.KindSpec)
+	r.reconcileAll()
+	for {
+		c := newChanges()
+		select {
+		case <-ticker.C:
+			r.reconcileAll()
+			continue
+		case ev, ok := <-agents:
+			c.agent(r, ev, ok)
+		case ev, ok := <-specs:
+			c.spec(ev, ok)
+		case <-r.stop:
+			r.logger.Info().Msg("reconcile runner stopped")
+			return nil
+		}
+
+		// Coalesce the events already queued (e.g. a fleet registering at once) into this pass.
+	drain:
+		for !c.full {
+			select {
+			case ev, ok := <-agents:
+				c.agent(r, ev, ok)
+			case ev, ok := <-specs:
+				c.spec(ev, ok)
+			default:
+				break drain
+			}
+		}
+
+		if c.full {
+			// Dropped as a slow consumer: re-subscribe and catch up with a full pass.
+			agents = r.watch(ctx, storage.KindAgent)
+			specs = r.watch(ctx, storage.KindSpec)
+			r.reconcileAll()
+			continue
+		}
+		r.apply(c)
+	}
+}
+
+// Stop signals the runner to exit. Safe to call multiple times.
+func (r *Runner) Stop(_ context.Context) error {
+	if !r.started.Load() {
+		return nil
+	}
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	return nil
+}
+
+// watch subscribes to changes of kind k; on failure the runner falls back to ticking only.
+func (r *Runner) watch(ctx context.Context, k storage.Kind) <-chan storage.Event {
+	events, err := r.store.Watch(ctx, k, nil, 0)
+	if err != nil {
+		r.logger.Warn().Err(err).Str("kind", string(k)).Msg("watch failed, polling only")
+		return nil
+	}
+	return events
+}
+
+// changes is the set of agents and specs to reconcile in one pass.
+type changes struct {
+	agents map[string]*model.Agent // nil value: the agent was deleted
+	specs  map[string]struct{}
+	full   bool
+}
+
+func newChanges() *changes {
+	return &changes{agents: make(map[string]*model.Agent), specs: make(map[string]struct{})}
+}
+
+// agent records an agent event that changes the agent set or an agent's labels.
+func (c *changes) agent(r *Runner, ev storage.Event, ok bool) {
+	if !ok {
+		c.full = true
+		return
+	}
+	if !r.agentChanged(ev) {
+		return
+	}
+	a, _ := ev.Object.(*model.Agent)
+	if ev.Type == storage.EventDeleted {
+		a = nil
+	}
+	c.agents[ev.ID] = a
+}
+
+// spec records a spec event; deleted specs take their rollouts with them.
+func (c *changes) spec(ev storage.Event, ok bool) {
+	if !ok {
+		c.full = true
+		return
+	}
+	if ev.Type != storage.EventDeleted {
+		c.specs[ev.ID] = struct{}{}
+	}
+}
+
+// agentChanged reports whether ev changes the agent set or an agent's labels.
+func (r *Runner) agentChanged(ev storage.Event) bool {
+	if ev.Type == storage.EventDeleted {
+		_, known := r.labels[ev.ID]
+		return known
+	}
+	a, ok := ev.Object.(*model.Agent)
+	if !ok {
+		return false
+	}
+	prev, known := r.labels[ev.ID]
+	return !known || prev != fingerprint(a)
+}
+
+func fingerprint(a *model.Agent) string {
+	return selector.FromLabels(a.LabelsAll()).String()
+}
+
+// apply reconciles the changed specs against the fleet, then the changed agents against the
+// deployed specs, each in its own transaction.
+func (r *Runner) apply(c *changes) {
+	ctx := context.Background()
+
+	var n counts
+	for specID := range c.specs {
+		err := r.store.InTx(ctx, func(tx storage.Tx) error {
+			ts, err := tx.GetSpec(ctx, specID)
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return newPass(ctx, tx, &n).spec(ts)
+		})
+		if err != nil {
+			r.logger.Error().Err(err).Str("spec_id", specID).Msg("reconcile spec failed")
+		}
+	}
+
+	if len(c.agents) > 0 {
+		specs, err := r.deployedSpecs(ctx)
+		if err != nil {
+			r.logger.Error().Err(err).Msg("reconcile: list specs failed")
+			return
+		}
+		for agentID, a := range c.agents {
+			var labels map[string]string
+			if a != nil {
+				labels = a.LabelsAll()
+			}
+			err = r.store.InTx(ctx, func(tx storage.Tx) error {
+				return newPass(ctx, tx, &n).agent(agentID, labels, specs)
+			})
+			if err != nil {
+				r.logger.Error().Err(err).Str("agent_id", agentID).Msg("reconcile agent failed")
+				continue
+			}
+			if a == nil {
+				delete(r.labels, agentID)
+			} else {
+				r.labels[agentID] = fingerprint(a)
+			}
+		}
+	}
+	r.report(n)
+}
+
+// reconcileAll runs a full pass: every deployed, label-targeted spec against the fleet.
+func (r *Runner) reconcileAll() {
+	ctx := context.Background()
+
+	labels := make(map[string]string)
+	err := each(func(opts storage.ListOptions) (*storage.AgentListResult, error) {
+		return r.store.ListAgents(ctx, nil, opts)
+	}, func(a *model.Agent) {
+		labels[a.ID()] = fingerprint(a)
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("reconcile: list agents failed")
+		return
+	}
+	r.labels = labels
+
+	specs, err := r.deployedSpecs(ctx)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("reconcile: list specs failed")
+		return
+	}
+	var n counts
+	for _, id := range specs {
+		err = r.store.InTx(ctx, func(tx storage.Tx) error {
+			ts, err := tx.GetSpec(ctx, id)
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return newPass(ctx, tx, &n).spec(ts)
+		})
+		if err != nil {
+			r.logger.Error().Err(err).Str("spec_id", id).Msg("reconcile spec failed")
+		}
+	}
+	r.report(n)
+}
+
+// deployedSpecs returns the IDs of the deployed specs with target labels.
+func (r *Runner) deployedSpecs(ctx context.Context) ([]string, error) {
+	var out []string
+	err := each(func(opts storage.ListOptions) (*storage.SpecListResult, error) {
+		return r.store.ListSpecs(ctx, nil, opts)
+	}, func(ts *model.Spec) {
+		if reconciled(ts) {
+			out = append(out, ts.ID())
+		}
+	})
+	return out, err
+}
+
+func (r *Runner) report(n counts) {
+	if n.created+n.orphaned+n.revived > 0 {
+		r.logger.Info().
+			Int("created", n.created).
+			Int("orphaned", n.orphaned).
+			Int("revived", n.revived).
+			Msg("rollouts reconciled")
+	}
+}
+
+// reconciled reports whether the rollouts of ts follow the fleet.
+func reconciled(ts *model.Spec) bool {
+	return ts.DeployedVersion() > 0 && len(ts.TargetLabels()) > 0
+}
+
+type counts struct {
+	created, orphaned, revived int
+}
+
+// pass reconciles (spec, agent) pairs inside one transaction.
+type pass struct {
+	ctx     context.Context
+	tx      storage.Tx
+	n       *counts
+	targets map[string][]string // per spec, as spec.Service.Deploy orders them
+}
+
+func newPass(ctx context.Context, tx storage.Tx, n *counts) *pass {
+	return &pass{ctx: ctx, tx: tx, n: n, targets: make(map[string][]string)}
+}
+
+// spec reconciles one spec against the agents matching its target labels.
+func (p *pass) spec(ts *model.Spec) error {
+	if !reconciled(ts) {
+		return nil
+	}
+	targets, err := p.targetsOf(ts)
+	if err != nil {
+		return err
+	}
+	on := make(map[string]struct{}, len(targets))
+	for _, id := range targets {
+		on[id] = struct{}{}
+	}
+
+	rollouts, err := p.tx.ListRolloutsBySpec(p.ctx, ts.ID())
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]struct{}, len(rollouts))
+	for _, ss := range rollouts {
+		existing[ss.AgentID()] = struct{}{}
+		_, targeted := on[ss.AgentID()]
+		if err = p.settle(ts, ss.AgentID(), ss, targeted); err != nil {
+			return err
+		}
+	}
+
+	explicit := make(map[string]struct{})
+	for _, id := range ts.Targets() {
+		explicit[id] = struct{}{}
+	}
+	for _, id := range targets {
+		_, done := existing[id]
+		_, isExplicit := explicit[id]
+		if done || isExplicit {
+			// Explicit targets without a rollout are Deploy's to create.
+			continue
+		}
+		if err = p.settle(ts, id, nil, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// agent reconciles one agent (labels nil if it was deleted) against the given specs.
+func (p *pass) agent(agentID string, labels map[string]string, specIDs []string) error {
+	list, err := p.tx.ListRolloutsByAgent(p.ctx, agentID)
+	if err != nil {
+		return err
+	}
+	rollouts := make(map[string]*model.Rollout, len(list))
+	for _, ss := range list {
+		rollouts[ss.SpecID()] = ss
+	}
+
+	for _, id := range specIDs {
+		ts, err := p.tx.GetSpec(p.ctx, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !reconciled(ts) {
+			continue
+		}
+
+		targeted := labels != nil && selector.FromLabels(ts.TargetLabels()).Matches(labels)
+		for _, t := range ts.Targets() {
+			targeted = targeted || t == agentID
+		}
+		ss, ok := rollouts[id]
+		if !ok && (!targeted || labels == nil) {
+			continue
+		}
+		if err = p.settle(ts, agentID, ss, targeted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settle brings the agent's rollout of ts (nil if it has none) in line with whether the
+// agent is targeted.
+func (p *pass) settle(ts *model.Spec, agentID string, ss *model.Rollout, targeted bool) error {
+	if ss == nil {
+		if !targeted {
+			return nil
+		}
+		ss, err := model.NewRollout(ts.ID(), agentID, ts.DeployedVersion())
+		if err != nil {
+			return err
+		}
+		if err = p.place(ts, ss); err != nil {
+			return err
+		}
+		p.n.created++
+		return p.tx.UpsertRollout(p.ctx, ss)
+	}
+
+	switch status := ss.Status(); {
+	case status == kind.SyncStatusRemoving:
+		// Left by an undeploy; Deploy decides again for its targets.
+		return nil
+	case targeted && (status == kind.SyncStatusOrphaned || status == kind.SyncStatusRemoved):
+		if err := p.place(ts, ss); err != nil {
+			return err
+		}
+		p.n.revived++
+	case !targeted && status != kind.SyncStatusOrphaned && status != kind.SyncStatusRemoved:
+		ss.MarkOrphaned()
+		p.n.orphaned++
+	default:
+		return nil
+	}
+	return p.tx.UpsertRollout(p.ctx, ss)
+}
+
+// place points ss at the deployed version of ts the way a deploy would: in its wave of a
+// progressive strategy (waiting, at least wave 1, so it goes through the health gates),
+// pending otherwise, and halted if the deployment was aborted. A paused deployment holds
+// the rollout like every other one of the deploy.
+func (p *pass) place(ts *model.Spec, ss *model.Rollout) error {
+	version := ts.DeployedVersion()
+
+	d, err := p.tx.GetDeployment(p.ctx, model.DeploymentID(ts.ID(), version))
+	switch {
+	case err == nil && d.State() == kind.DeploymentAborted:
+		ss.MarkPending(version)
+		ss.MarkHalted("deploy aborted")
+		return nil
+	case err != nil && !errors.Is(err, storage.ErrNotFound):
+		return err
+	}
+
+	strategy := ts.Strategy()
+	if !strategy.Progressive() {
+		ss.MarkTargeted(version, 0)
+		return nil
+	}
+	targets, err := p.targetsOf(ts)
+	if err != nil {
+		return err
+	}
+	i := len(targets)
+	for j, id := range targets {
+		if id == ss.AgentID() {
+			i = j
+			break
+		}
+	}
+	ss.MarkTargeted(version, max(strategy.WaveOf(i, len(targets)), 1))
+	return nil
+}
+
+// targetsOf returns the targets of ts in deploy order (see model.Spec.ResolveTargets),
+// cached for the pass.
+func (p *pass) targetsOf(ts *model.Spec) ([]string, error) {
+	if out, ok := p.targets[ts.ID()]; ok {
+		return out, nil
+	}
+	agents, err := p.tx.ListAgentsBySelector(p.ctx, selector.FromLabels(ts.TargetLabels()))
+	if err != nil {
+		return nil, err
+	}
+	out := ts.ResolveTargets(agents)
+	p.targets[ts.ID()] = out
+	return out, nil
+}
+
+// each calls fn for every item of a paginated listing.
+func each[T any](list func(storage.ListOptions) (*storage.ListResult[T], error), fn func(T)) error {
+	opts := storage.ListOptions{Limit: storage.MaxListLimit}
+	for {
+		res, err := list(opts)
+		if err != nil {
+			return err
+		}
+		for _, item := range res.Items {
+			fn(item)
+		}
+		if res.NextCursor == "" {
+			return nil
+		}
+		opts.Cursor = res.NextCursor
+	}
+}
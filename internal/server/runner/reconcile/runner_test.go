@@ -0,0 +1,215 @@
+package reconcile
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	specsvc "github.com/soltiHQ/control-plane/internal/service/spec"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+func requireNoErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// fixture is a store with a reconcile runner that has seen the initial fleet.
+type fixture struct {
+	ctx context.Context
+	st  storage.Storage
+	r   *Runner
+	svc *specsvc.Service
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	st := inmemory.New()
+	r, err := New(Config{}, zerolog.Nop(), st)
+	requireNoErr(t, err)
+	return &fixture{ctx: context.Background(), st: st, r: r, svc: specsvc.New(st)}
+}
+
+// agent creates or relabels an agent and reconciles the change as its event would.
+func (f *fixture) agent(t *testing.T, id string, labels map[string]string) {
+	t.Helper()
+	a, err := f.st.GetAgent(f.ctx, id)
+	typ := storage.EventUpdated
+	if err != nil {
+		a, err = model.NewAgent(id, id, "http://"+id)
+		requireNoErr(t, err)
+		typ = storage.EventCreated
+	}
+	for k := range a.LabelsAll() {
+		a.LabelDelete(k)
+	}
+	for k, v := range labels {
+		a.LabelAdd(k, v)
+	}
+	requireNoErr(t, f.st.UpsertAgent(f.ctx, a))
+	f.event(storage.Event{Kind: storage.KindAgent, Type: typ, ID: id, Object: a})
+}
+
+// deleteAgent deletes an agent and reconciles the change as its event would.
+func (f *fixture) deleteAgent(t *testing.T, id string) {
+	t.Helper()
+	a, err := f.st.GetAgent(f.ctx, id)
+	requireNoErr(t, err)
+	requireNoErr(t, f.st.DeleteAgent(f.ctx, id))
+	f.event(storage.Event{Kind: storage.KindAgent, Type: storage.EventDeleted, ID: id, Object: a})
+}
+
+func (f *fixture) event(ev storage.Event) {
+	c := newChanges()
+	c.agent(f.r, ev, true)
+	f.r.apply(c)
+}
+
+// deploy creates and deploys a spec targeting the given labels and explicit agents.
+func (f *fixture) deploy(t *testing.T, id string, strategy model.RolloutStrategy, labels map[string]string, targets ...string) {
+	t.Helper()
+	ts, err := model.NewSpec(id, id, "slot-"+id)
+	requireNoErr(t, err)
+	ts.SetKindConfig(map[string]any{"command": "sleep"})
+	ts.SetTargetLabels(labels)
+	ts.SetTargets(targets)
+	ts.SetStrategy(strategy)
+	requireNoErr(t, f.svc.Create(f.ctx, ts, "tester"))
+	requireNoErr(t, f.svc.Deploy(f.ctx, id, "tester"))
+	f.r.reconcileAll()
+}
+
+func (f *fixture) rollout(t *testing.T, specID, agentID string) *model.Rollout {
+	t.Helper()
+	ss, err := f.st.GetRollout(f.ctx, model.RolloutID(specID, agentID))
+	requireNoErr(t, err)
+	return ss
+}
+
+func (f *fixture) expect(t *testing.T, specID, agentID string, status kind.SyncStatus, wave int) {
+	t.Helper()
+	ss := f.rollout(t, specID, agentID)
+	if ss.Status() != status || ss.Wave() != wave || ss.DesiredVersion() != 1 {
+		t.Fatalf("%s/%s: expected %s in wave %d at v1, got %s in wave %d at v%d",
+			specID, agentID, status, wave, ss.Status(), ss.Wave(), ss.DesiredVersion())
+	}
+}
+
+var prod = map[string]string{"env": "prod"}
+
+func TestReconcile_CreatesRolloutForNewMatch(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	f.agent(t, "a1", prod)
+	f.deploy(t, "s1", model.RolloutStrategy{}, prod)
+
+	f.agent(t, "a2", prod)
+	f.agent(t, "a3", map[string]string{"env": "dev"})
+
+	f.expect(t, "s1", "a2", kind.SyncStatusPending, 0)
+	if _, err := f.st.GetRollout(f.ctx, model.RolloutID("s1", "a3")); err == nil {
+		t.Fatalf("expected no rollout for a non-matching agent")
+	}
+}
+
+func TestReconcile_ProgressiveNewcomerWaits(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	f.agent(t, "a1", prod)
+	f.agent(t, "a2", prod)
+	f.deploy(t, "s1", model.RolloutStrategy{BatchSize: 1}, prod)
+	f.expect(t, "s1", "a1", kind.SyncStatusPending, 0)
+	f.expect(t, "s1", "a2", kind.SyncStatusWaiting, 1)
+
+	f.agent(t, "a3", prod)
+	f.expect(t, "s1", "a3", kind.SyncStatusWaiting, 2)
+
+	// Sorted before the released canary, it must still not land in wave 0.
+	f.agent(t, "a0", prod)
+	f.expect(t, "s1", "a0", kind.SyncStatusWaiting, 1)
+}
+
+func TestReconcile_AbortedDeployHaltsNewcomer(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	f.agent(t, "a1", prod)
+	f.deploy(t, "s1", model.RolloutStrategy{}, prod)
+	_, err := f.svc.AbortDeploy(f.ctx, "s1", "tester")
+	requireNoErr(t, err)
+
+	f.agent(t, "a2", prod)
+	f.expect(t, "s1", "a2", kind.SyncStatusHalted, 0)
+}
+
+func TestReconcile_OrphansAndRevives(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	f.agent(t, "a1", prod)
+	f.agent(t, "a2", prod)
+	f.deploy(t, "s1", model.RolloutStrategy{}, prod)
+
+	f.agent(t, "a1", map[string]string{"env": "dev"})
+	f.expect(t, "s1", "a1", kind.SyncStatusOrphaned, 0)
+	f.expect(t, "s1", "a2", kind.SyncStatusPending, 0)
+
+	f.agent(t, "a1", prod)
+	f.expect(t, "s1", "a1", kind.SyncStatusPending, 0)
+
+	f.deleteAgent(t, "a2")
+	f.expect(t, "s1", "a2", kind.SyncStatusOrphaned, 0)
+}
+
+func TestReconcile_KeepsExplicitTargets(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	f.agent(t, "a1", prod)
+	f.deploy(t, "s1", model.RolloutStrategy{}, prod, "a1")
+
+	f.agent(t, "a1", nil)
+	f.expect(t, "s1", "a1", kind.SyncStatusPending, 0)
+	f.deleteAgent(t, "a1")
+	f.expect(t, "s1", "a1", kind.SyncStatusPending, 0)
+}
+
+func TestReconcile_IgnoresHeartbeats(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	f.agent(t, "a1", prod)
+	f.deploy(t, "s1", model.RolloutStrategy{}, prod)
+
+	a, err := f.st.GetAgent(f.ctx, "a1")
+	requireNoErr(t, err)
+	if f.r.agentChanged(storage.Event{Kind: storage.KindAgent, Type: storage.EventUpdated, ID: "a1", Object: a}) {
+		t.Fatalf("an update without label changes must not trigger a pass")
+	}
+}
+
+func TestReconcileAll_CatchesUpMissedEvents(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t)
+	f.deploy(t, "s1", model.RolloutStrategy{}, prod)
+
+	// Written without an event reaching the runner.
+	a, err := model.NewAgent("a1", "a1", "http://a1")
+	requireNoErr(t, err)
+	a.LabelAdd("env", "prod")
+	requireNoErr(t, f.st.UpsertAgent(f.ctx, a))
+
+	f.r.reconcileAll()
+	f.expect(t, "s1", "a1", kind.SyncStatusPending, 0)
+	if _, known := f.r.labels["a1"]; !known {
+		t.Fatalf("expected the full pass to record the agent's labels")
+	}
+}
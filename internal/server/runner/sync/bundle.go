@@ -0,0 +1,200 @@
+package sync
+
+import (
+	"context"
+	"errors"
+
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/proxy"
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+// serveBundle pushes the desired task set of one agent as a single bundle: the jobs' tasks at
+// their desired version, the removals, and the kept rollouts' tasks at the version the agent runs.
+// An agent without the bundle API is served job by job instead (see serve). It returns the
+// number of jobs left for the next tick.
+func (r *Runner) serveBundle(ctx context.Context, agentID string, q []job, kept []*model.Rollout) int {
+	if err := r.limit.wait(ctx); err != nil {
+		return len(q)
+	}
+
+	opCtx, cancel := context.WithTimeout(context.Background(), r.cfg.PushTimeout)
+	sent, err := r.bundle(opCtx, agentID, q, kept)
+	cancel()
+	if errors.Is(err, proxy.ErrNotSupported) {
+		r.logger.Info().
+			Str("agent_id", agentID).
+			Msg("bundle: agent has no bundle API, pushing rollouts one by one")
+		return r.serve(ctx, sent)
+	}
+	return 0
+}
+
+// bundle builds, applies and acknowledges the bundle of one agent and returns the jobs it sent.
+// Failures are recorded on the jobs, except ErrNotSupported, which is returned untouched for the
+// caller to fall back with the sent jobs.
+func (r *Runner) bundle(ctx context.Context, agentID string, q []job, kept []*model.Rollout) ([]job, error) {
+	ag, err := r.store.GetAgent(ctx, agentID)
+	if err != nil {
+		r.logger.Warn().Err(err).
+			Str("agent_id", agentID).
+			Msg("bundle: get agent failed")
+		for _, j := range q {
+			switch {
+			case !j.remove:
+				r.markFailed(ctx, j.ss, "agent not found: "+err.Error())
+			case errors.Is(err, storage.ErrNotFound):
+				// A deleted agent runs nothing anymore.
+				r.markRemoved(ctx, j.ss)
+			default:
+				r.markRemoveFailed(ctx, j.ss, "agent error: "+err.Error())
+			}
+		}
+		return nil, err
+	}
+	ap, err := r.pool.ForAgent(ag.ID(), ag.Endpoint(), ag.EndpointType(), ag.APIVersion())
+	if err != nil {
+		r.logger.Warn().Err(err).
+			Str("agent_id", agentID).
+			Str("endpoint", ag.Endpoint()).
+			Msg("bundle: get proxy failed")
+		r.failAll(ctx, q, "proxy error: "+err.Error())
+		return nil, err
+	}
+
+	var (
+		tasks  []proxy.TaskSubmission
+		remove []string
+		sent   []job
+	)
+	for _, j := range q {
+		if j.remove {
+			remove = append(remove, j.ss.Slot())
+			sent = append(sent, j)
+			continue
+		}
+		ts, err := r.store.GetSpec(ctx, j.ss.SpecID())
+		if err == nil {
+			ts, err = storage.SpecAt(ctx, r.store, ts, j.ss.DesiredVersion())
+		}
+		if err != nil {
+			r.logger.Warn().Err(err).
+				Str("rid", j.ss.ID()).
+				Str("spec_id", j.ss.SpecID()).
+				Msg("bundle: get spec failed")
+			r.markFailed(ctx, j.ss, "spec not found: "+err.Error())
+			continue
+		}
+		tasks = append(tasks, proxy.TaskSubmission{Spec: ts.ToCreateSpec(), Version: j.ss.DesiredVersion()})
+		sent = append(sent, j)
+	}
+	if len(sent) == 0 {
+		return nil, nil
+	}
+	for _, ss := range kept {
+		// A version whose content is gone is left out: the agent keeps what it runs in the slot.
+		ts, err := r.store.GetSpec(ctx, ss.SpecID())
+		if err == nil {
+			ts, err = storage.SpecAt(ctx, r.store, ts, ss.ActualVersion())
+		}
+		if err == nil {
+			tasks = append(tasks, proxy.TaskSubmission{Spec: ts.ToCreateSpec(), Version: ss.ActualVersion()})
+		}
+	}
+
+	b := proxy.NewTaskBundle(tasks, remove)
+	if err = ap.ApplyBundle(ctx, b); err != nil {
+		if errors.Is(err, proxy.ErrNotSupported) {
+			return sent, err
+		}
+		r.logger.Warn().Err(err).
+			Str("agent_id", agentID).
+			Str("revision", b.Revision).
+			Msg("bundle: apply failed")
+		r.failAll(ctx, sent, "bundle error: "+err.Error())
+		return sent, err
+	}
+
+	r.ackBundle(ctx, agentID, b.Revision, sent)
+	return sent, nil
+}
+
+// ackBundle records an applied bundle on its rollouts in one transaction: pushed ones synced,
+// removed ones removed (deleted when their spec is gone).
+//
+// Like markSynced, it only writes rollouts still at the resource version read at tick time;
+// the others changed during the push and are left for the next tick.
+func (r *Runner) ackBundle(ctx context.Context, agentID, revision string, sent []job) {
+	var synced, removed, stale int
+	err := r.store.InTx(ctx, func(tx storage.Tx) error {
+		synced, removed, stale = 0, 0, 0
+		for _, j := range sent {
+			cur, err := tx.GetRollout(ctx, j.ss.ID())
+			switch {
+			case errors.Is(err, storage.ErrNotFound):
+				stale++
+				continue
+			case err != nil:
+				return err
+			case cur.ResourceVersion() != j.ss.ResourceVersion():
+				stale++
+				continue
+			}
+
+			if !j.remove {
+				cur.MarkSynced(j.ss.DesiredVersion())
+				if err = tx.UpsertRollout(ctx, cur); err != nil {
+					return err
+				}
+				synced++
+				continue
+			}
+
+			_, err = tx.GetSpec(ctx, cur.SpecID())
+			switch {
+			case errors.Is(err, storage.ErrNotFound):
+				err = tx.DeleteRollout(ctx, cur.ID())
+			case err == nil:
+				cur.MarkRemoved()
+				err = tx.UpsertRollout(ctx, cur)
+			}
+			if err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		// The agent applied the bundle; the next tick sends the same revision again, which it ignores.
+		r.logger.Error().Err(err).
+			Str("agent_id", agentID).
+			Str("revision", revision).
+			Msg("bundle: acknowledge failed")
+		return
+	}
+
+	r.logger.Info().
+		Str("agent_id", agentID).
+		Str("revision", revision).
+		Int("synced", synced).
+		Int("removed", removed).
+		Int("stale", stale).
+		Msg("bundle applied on agent")
+}
+
+// failAll records the same failure on every job.
+func (r *Runner) failAll(ctx context.Context, q []job, errMsg string) {
+	for _, j := range q {
+		r.fail(ctx, j, errMsg)
+	}
+}
+
+// fail records a failed push or removal.
+func (r *Runner) fail(ctx context.Context, j job, errMsg string) {
+	if j.remove {
+		r.markRemoveFailed(ctx, j.ss, errMsg)
+		return
+	}
+	r.markFailed(ctx, j.ss, errMsg)
+}
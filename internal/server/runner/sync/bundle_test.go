@@ -0,0 +1,155 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/proxy"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+func TestAckBundle_SkipsStaleRollouts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustAgent(t, ctx, st, "a1")
+	mustDeploy(t, ctx, st, "fresh", "a1")
+	mustDeploy(t, ctx, st, "stale", "a1")
+	r := newTestRunner(t, Config{Bundles: true}, st, newFakeDialer())
+
+	var (
+		fresh = mustRollout(t, ctx, st, "fresh", "a1")
+		stale = mustRollout(t, ctx, st, "stale", "a1")
+	)
+	// Changed while the bundle was in flight (e.g. a new deploy).
+	changed := stale.Clone()
+	changed.MarkPending(2)
+	if err := st.UpsertRollout(ctx, changed); err != nil {
+		t.Fatalf("UpsertRollout: %v", err)
+	}
+
+	r.ackBundle(ctx, "a1", "rev", []job{{ss: fresh}, {ss: stale}})
+
+	if got := mustRollout(t, ctx, st, "fresh", "a1"); got.Status() != kind.SyncStatusSynced || got.ActualVersion() != 1 {
+		t.Fatalf("expected fresh rollout synced at v1, got %s v%d", got.Status(), got.ActualVersion())
+	}
+	got := mustRollout(t, ctx, st, "stale", "a1")
+	if got.Status() != kind.SyncStatusPending || got.DesiredVersion() != 2 || got.ActualVersion() != 0 {
+		t.Fatalf("stale rollout must be left as changed, got %s desired=%d actual=%d",
+			got.Status(), got.DesiredVersion(), got.ActualVersion())
+	}
+}
+
+func TestTick_BundleCarriesKeptTasks(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustAgent(t, ctx, st, "a1")
+	mustDeploy(t, ctx, st, "s1", "a1")
+	d := newFakeDialer()
+	r := newTestRunner(t, Config{Bundles: true}, st, d)
+
+	r.tick()
+	mustDeploy(t, ctx, st, "s2", "a1")
+	r.tick()
+
+	bundles := d.appliedBundles("a1")
+	if len(bundles) != 2 {
+		t.Fatalf("expected one bundle per tick, got %d", len(bundles))
+	}
+	if n := len(bundles[1].Tasks); n != 2 {
+		t.Fatalf("expected the new task and the kept one, got %d tasks", n)
+	}
+	for _, id := range []string{"s1", "s2"} {
+		if got := mustRollout(t, ctx, st, id, "a1").Status(); got != kind.SyncStatusSynced {
+			t.Fatalf("%s: expected synced, got %s", id, got)
+		}
+	}
+}
+
+func TestTick_BundleFallsBackWithoutBundleAPI(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustAgent(t, ctx, st, "a1")
+	mustDeploy(t, ctx, st, "s1", "a1")
+	mustDeploy(t, ctx, st, "s2", "a1")
+	d := newFakeDialer()
+	d.bundle = func(string) error { return proxy.ErrNotSupported }
+	r := newTestRunner(t, Config{Bundles: true}, st, d)
+
+	r.tick()
+
+	if n := len(d.submissions("a1")); n != 2 {
+		t.Fatalf("expected every rollout pushed one by one, got %d submissions", n)
+	}
+	for _, id := range []string{"s1", "s2"} {
+		ss := mustRollout(t, ctx, st, id, "a1")
+		if ss.Status() != kind.SyncStatusSynced || ss.Attempts() != 0 {
+			t.Fatalf("%s: expected synced without a failed attempt, got %s attempts=%d", id, ss.Status(), ss.Attempts())
+		}
+	}
+}
+
+func TestTick_BundleFailureFailsQueuedRollouts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustAgent(t, ctx, st, "a1")
+	mustDeploy(t, ctx, st, "s1", "a1")
+	d := newFakeDialer()
+	d.bundle = func(string) error { return errors.New("agent down") }
+	r := newTestRunner(t, Config{Bundles: true}, st, d)
+
+	r.tick()
+
+	ss := mustRollout(t, ctx, st, "s1", "a1")
+	if ss.Status() != kind.SyncStatusFailed || ss.Attempts() != 1 || ss.NextAttemptAt().IsZero() {
+		t.Fatalf("expected failed with a retry scheduled, got %s attempts=%d next=%v", ss.Status(), ss.Attempts(), ss.NextAttemptAt())
+	}
+	if n := len(d.submissions("a1")); n != 0 {
+		t.Fatalf("a failed bundle must not fall back, got %d submissions", n)
+	}
+}
+
+func TestTick_BundleRemovals(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustAgent(t, ctx, st, "a1")
+	undeployed := mustDeploy(t, ctx, st, "undeployed", "a1")
+	deleted := mustDeploy(t, ctx, st, "deleted", "a1")
+	d := newFakeDialer()
+	r := newTestRunner(t, Config{Bundles: true}, st, d)
+
+	r.tick()
+	if err := undeployed.Undeploy(ctx, "undeployed", "tester"); err != nil {
+		t.Fatalf("Undeploy: %v", err)
+	}
+	if err := deleted.Delete(ctx, "deleted", true); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	r.tick()
+
+	bundles := d.appliedBundles("a1")
+	last := bundles[len(bundles)-1]
+	if len(last.Tasks) != 0 || len(last.Remove) != 2 {
+		t.Fatalf("expected both slots removed and no tasks, got %+v", last)
+	}
+
+	if got := mustRollout(t, ctx, st, "undeployed", "a1").Status(); got != kind.SyncStatusRemoved {
+		t.Fatalf("expected the undeployed rollout removed, got %s", got)
+	}
+	if _, err := st.GetRollout(ctx, model.RolloutID("deleted", "a1")); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected the rollout of the deleted spec gone, got %v", err)
+	}
+}
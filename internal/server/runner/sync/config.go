@@ -1,6 +1,11 @@
 package sync
 
-import "time"
+import (
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+)
 
 const (
 	defaultTickInterval = 10 * time.Second
@@ -8,14 +13,42 @@ const (
 
 	defaultName       = "sync"
 	defaultMaxRetries = 5
+	defaultWorkers    = 16
+	defaultPushRate   = 50
 )
 
+// defaultRetryBackoff spaces the retries of a failed push: 10s, 20s, 40s… up to 10 minutes, fully jittered.
+var defaultRetryBackoff = model.BackoffConfig{
+	Jitter:  kind.JitterFull,
+	FirstMs: 10_000,
+	MaxMs:   600_000,
+	Factor:  2,
+}
+
 // Config configures the sync runner.
+//
+// Rollouts are pushed by up to Workers goroutines, the rollouts of one agent in order by a
+// single worker. Pushes (and removals) start at no more than PushRate per second overall, with
+// bursts of up to PushBurst. A tick stops starting new pushes after TickBudget; what is left
+// is picked up by the next tick.
+//
+// A failed push or removal is retried after RetryBackoff.Delay, given the attempts so far and
+// the delay waited before the previous retry; after MaxRetries failed attempts the rollout is
+// marked exhausted.
+//
+// With Bundles, each agent gets one proxy.TaskBundle per tick instead of one call per rollout;
+// agents without the bundle API are served rollout by rollout.
 type Config struct {
 	TickInterval time.Duration
+	TickBudget   time.Duration // defaults to TickInterval
 	PushTimeout  time.Duration
 	Name         string
 	MaxRetries   int
+	Workers      int
+	PushRate     float64 // pushes per second
+	PushBurst    int     // defaults to Workers
+	RetryBackoff model.BackoffConfig
+	Bundles      bool
 }
 
 func (c Config) withDefaults() Config {
@@ -25,11 +58,26 @@ func (c Config) withDefaults() Config {
 	if c.TickInterval <= 0 {
 		c.TickInterval = defaultTickInterval
 	}
+	if c.TickBudget <= 0 {
+		c.TickBudget = c.TickInterval
+	}
 	if c.PushTimeout <= 0 {
 		c.PushTimeout = defaultPushTimeout
 	}
 	if c.MaxRetries <= 0 {
 		c.MaxRetries = defaultMaxRetries
 	}
+	if c.Workers <= 0 {
+		c.Workers = defaultWorkers
+	}
+	if c.PushRate <= 0 {
+		c.PushRate = defaultPushRate
+	}
+	if c.PushBurst <= 0 {
+		c.PushBurst = c.Workers
+	}
+	if c.RetryBackoff.FirstMs <= 0 {
+		c.RetryBackoff = defaultRetryBackoff
+	}
 	return c
 }
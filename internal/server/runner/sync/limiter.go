@@ -0,0 +1,52 @@
+package sync
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// limiter spaces events at a steady rate, allowing bursts after idle periods.
+//
+// It tracks the time the next event is due; each wait reserves the earliest free slot
+// (no earlier than burst-1 intervals in the past) and sleeps until it.
+type limiter struct {
+	interval time.Duration
+	slack    time.Duration
+	next     atomic.Int64 // unix nanoseconds
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	interval := time.Duration(float64(time.Second) / rate)
+	return &limiter{
+		interval: interval,
+		slack:    interval * time.Duration(burst-1),
+	}
+}
+
+// wait blocks until the caller may proceed or ctx is done. A slot given up because ctx
+// ended is not returned, which only makes the rate more conservative.
+func (l *limiter) wait(ctx context.Context) error {
+	var slot int64
+	for {
+		now := time.Now().UnixNano()
+		next := l.next.Load()
+		slot = max(next, now-int64(l.slack))
+		if l.next.CompareAndSwap(next, slot+int64(l.interval)) {
+			break
+		}
+	}
+
+	delay := time.Until(time.Unix(0, slot))
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,8 +1,18 @@
 // Package sync implements a server.Runner that reconciles pending rollouts
 // by pushing specs to agents via the proxy pool:
-//   - Lists actionable rollouts (pending, drift, failed under max retries)
+//   - Lists actionable rollouts (pending, drift, failed once their retry is due) on every tick
+//     and as soon as a watched rollout becomes pending
+//   - Skips rollouts whose deployment is paused or aborted, and those of pull-mode agents
+//   - Pushes on a bounded worker pool: the rollouts of one agent in order, different agents
+//     concurrently, under a global push rate limit and a per-tick time budget
 //   - Resolves spec and agent, gets a proxy, calls SubmitTask
-//   - Marks rollout synced on success, failed (with attempt increment) on error.
+//   - Marks rollout synced on success, failed (with attempt increment and the next attempt
+//     scheduled with exponential backoff) on error, exhausted once MaxRetries attempts failed,
+//     unless the rollout changed during the push (resource version conflict)
+//   - Removes the task of removing rollouts (undeploy) via CancelTask and marks them removed,
+//     or deletes them when their spec is gone
+//   - With Config.Bundles, sends each agent its desired task set as one ApplyBundle call and
+//     marks every included rollout synced or removed on the agent's acknowledgment.
 package sync
 
 import (
@@ -13,6 +23,7 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
 	"github.com/soltiHQ/control-plane/internal/proxy"
 	"github.com/soltiHQ/control-plane/internal/storage"
 )
@@ -21,16 +32,29 @@ import (
 // records by pushing Specs to agents via the proxy pool.
 //
 // On each tick it:
-//  1. Lists all rollouts with status pending, drift, or failed (under max retries).
-//  2. For each, resolves the Spec and agent.
-//  3. Gets an AgentProxy from the pool and calls "SubmitTask".
-//  4. On success: marks the rollout as synced.
-//  5. On failure: marks the rollout as failed (increment attempts).
+//  1. Lists all rollouts with status pending, drift, or failed (with their next attempt due)
+//     whose deployment is active, and queues them per agent.
+//  2. Hands the queues to at most Config.Workers workers; each runs one agent's queue in order.
+//  3. For each rollout, resolves the Spec and agent.
+//  4. Gets an AgentProxy from the pool and calls "SubmitTask".
+//  5. On success: marks the rollout as synced.
+//  6. On failure: marks the rollout as failed (increment attempts, schedule the next attempt),
+//     or exhausted when it was the last one.
+//
+// Removing rollouts (with their next attempt due) are handled in the same tick with "CancelTask".
+// An unreachable agent only holds up the worker serving it; rollouts not started within
+// Config.TickBudget wait for the next tick. A tick returns when all its workers are done,
+// so ticks never overlap.
+//
+// With Config.Bundles, steps 3-6 run once per agent: its queue and the rollouts it already
+// runs form one proxy.TaskBundle, and the acknowledgment settles the whole queue in one
+// transaction. Agents without the bundle API fall back to the steps above.
 type Runner struct {
 	logger  zerolog.Logger
 	cfg     Config
 	store   storage.Storage
-	pool    *proxy.Pool
+	pool    proxy.Dialer
+	limit   *limiter
 	stop    chan struct{}
 	started atomic.Bool
 }
@@ -50,6 +74,7 @@ func New(cfg Config, logger zerolog.Logger, store storage.Storage, pool *proxy.P
 		cfg:    cfg,
 		store:  store,
 		pool:   pool,
+		limit:  newLimiter(cfg.PushRate, cfg.PushBurst),
 		stop:   make(chan struct{}),
 	}, nil
 }
@@ -58,23 +83,43 @@ func New(cfg Config, logger zerolog.Logger, store storage.Storage, pool *proxy.P
 func (r *Runner) Name() string { return r.cfg.Name }
 
 // Start runs the sync reconciliation loop until Stop is called.
+//
+// Besides the periodic tick, the runner watches rollouts and reconciles as soon as
+// one becomes pending, so a Deploy does not wait for the next tick.
 func (r *Runner) Start(_ context.Context) error {
 	if !r.started.CompareAndSwap(false, true) {
 		return errors.New("sync: already started")
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	ticker := time.NewTicker(r.cfg.TickInterval)
 	defer ticker.Stop()
 
 	r.logger.Info().
 		Dur("tick", r.cfg.TickInterval).
+		Dur("tick_budget", r.cfg.TickBudget).
 		Int("max_retries", r.cfg.MaxRetries).
+		Int("workers", r.cfg.Workers).
+		Float64("push_rate", r.cfg.PushRate).
 		Msg("sync runner started")
 
+	events := r.watch(ctx)
 	for {
 		select {
 		case <-ticker.C:
 			r.tick()
+		case ev, ok := <-events:
+			if !ok {
+				// Dropped as a slow consumer: re-subscribe and catch up with a full tick.
+				events = r.watch(ctx)
+				r.tick()
+				continue
+			}
+			if pendingEvent(ev) && drainEvents(events) {
+				r.tick()
+			}
 		case <-r.stop:
 			r.logger.Info().Msg("sync runner stopped")
 			return nil
@@ -95,8 +140,64 @@ func (r *Runner) Stop(_ context.Context) error {
 	return nil
 }
 
+// watch subscribes to rollout changes; on failure the runner falls back to ticking only.
+func (r *Runner) watch(ctx context.Context) <-chan storage.Event {
+	events, err := r.store.Watch(ctx, storage.KindRollout, nil, 0)
+	if err != nil {
+		r.logger.Warn().Err(err).Msg("watch rollouts failed, polling only")
+		return nil
+	}
+	return events
+}
+
+// pendingEvent reports whether ev made a rollout ready to be pushed or removed.
+//
+// A failed removal stays removing with a retry scheduled; its save waits for the tick that
+// finds it due instead of triggering one.
+func pendingEvent(ev storage.Event) bool {
+	if ev.Type == storage.EventDeleted {
+		return false
+	}
+	ss, ok := ev.Object.(*model.Rollout)
+	if !ok || time.Now().Before(ss.NextAttemptAt()) {
+		return false
+	}
+	return ss.Status() == kind.SyncStatusPending || ss.Status() == kind.SyncStatusRemoving
+}
+
+// drainEvents consumes the events already queued so that a burst (e.g. a Deploy to
+// many agents) results in a single tick. It returns false if the channel was closed.
+func drainEvents(events <-chan storage.Event) bool {
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return false
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// job is one rollout to push, or to remove from its agent.
+type job struct {
+	ss     *model.Rollout
+	remove bool
+}
+
+// tick lists the actionable rollouts, queues them per agent and runs the queues on the
+// worker pool. It returns once every worker is done, so ticks never overlap.
 func (r *Runner) tick() {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.TickBudget)
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
 	res, err := r.store.ListRollouts(ctx, nil, storage.ListOptions{
 		Limit: storage.MaxListLimit,
@@ -106,35 +207,173 @@ func (r *Runner) tick() {
 		return
 	}
 
+	var (
+		now    = time.Now()
+		active = make(map[string]bool)
+		pull   = make(map[string]bool)
+		queues = make(map[string][]job)
+		kept   = make(map[string][]*model.Rollout)
+		agents []string
+	)
 	for _, ss := range res.Items {
 		if ss == nil {
 			continue
 		}
 
-		switch ss.Status() {
-		case kind.SyncStatusPending, kind.SyncStatusDrift:
-		case kind.SyncStatusFailed:
-			if ss.Attempts() >= r.cfg.MaxRetries {
-				continue
+		if r.pullDelivery(ctx, pull, ss.AgentID()) {
+			// Delivered through discovery sync (see service/delivery).
+			continue
+		}
+		j, ok := r.actionable(ctx, now, active, ss)
+		if !ok {
+			if r.cfg.Bundles && ss.RunsOnAgent() {
+				kept[ss.AgentID()] = append(kept[ss.AgentID()], ss)
 			}
-		default:
 			continue
 		}
+		if _, ok = queues[ss.AgentID()]; !ok {
+			agents = append(agents, ss.AgentID())
+		}
+		queues[ss.AgentID()] = append(queues[ss.AgentID()], j)
+	}
+	if len(agents) == 0 {
+		return
+	}
+
+	var (
+		workers  = min(r.cfg.Workers, len(agents))
+		work     = make(chan string)
+		done     = make(chan struct{})
+		deferred atomic.Int64
+	)
+	for range workers {
+		go func() {
+			for agentID := range work {
+				if r.cfg.Bundles {
+					deferred.Add(int64(r.serveBundle(ctx, agentID, queues[agentID], kept[agentID])))
+				} else {
+					deferred.Add(int64(r.serve(ctx, queues[agentID])))
+				}
+			}
+			done <- struct{}{}
+		}()
+	}
+dispatch:
+	for i, agentID := range agents {
+		select {
+		case work <- agentID:
+		case <-ctx.Done():
+			for _, id := range agents[i:] {
+				deferred.Add(int64(len(queues[id])))
+			}
+			break dispatch
+		}
+	}
+	close(work)
+	for range workers {
+		<-done
+	}
+
+	if n := deferred.Load(); n > 0 {
+		r.logger.Warn().
+			Int64("deferred", n).
+			Dur("budget", r.cfg.TickBudget).
+			Msg("tick: budget exhausted, remaining rollouts deferred to the next tick")
+	}
+}
+
+// actionable reports whether the rollout is due for a push or a removal, and the job for it.
+// Failed rollouts out of retries are marked exhausted on the way.
+func (r *Runner) actionable(ctx context.Context, now time.Time, active map[string]bool, ss *model.Rollout) (job, bool) {
+	j := job{ss: ss}
+	switch ss.Status() {
+	case kind.SyncStatusPending, kind.SyncStatusDrift:
+	case kind.SyncStatusFailed, kind.SyncStatusRemoving:
+		if ss.Attempts() >= r.cfg.MaxRetries {
+			// Failed before exhaustion was recorded, or MaxRetries was lowered since.
+			ss.MarkExhausted()
+			r.save(ctx, ss, "markExhausted")
+			return job{}, false
+		}
+		if now.Before(ss.NextAttemptAt()) {
+			return job{}, false
+		}
+		// Removals do not depend on the deployment: the spec was undeployed or deleted.
+		j.remove = ss.Status() == kind.SyncStatusRemoving
+	default:
+		return job{}, false
+	}
+	if !j.remove && !r.deploymentActive(ctx, active, ss) {
+		return job{}, false
+	}
+	return j, true
+}
+
+// serve runs the jobs of one agent in order, each after the global rate limit allows it.
+// Jobs not started before ctx is done are left for the next tick; serve returns their number.
+//
+// Every push gets its own PushTimeout, independent of ctx: a push is never cut short,
+// so its outcome is always recorded.
+func (r *Runner) serve(ctx context.Context, q []job) int {
+	for i, j := range q {
+		if err := r.limit.wait(ctx); err != nil {
+			return len(q) - i
+		}
 
-		pushCtx, cancel := context.WithTimeout(ctx, r.cfg.PushTimeout)
-		r.push(pushCtx, ss.ID(), ss.SpecID(), ss.AgentID())
+		opCtx, cancel := context.WithTimeout(context.Background(), r.cfg.PushTimeout)
+		if j.remove {
+			r.remove(opCtx, j.ss)
+		} else {
+			r.push(opCtx, j.ss)
+		}
 		cancel()
 	}
+	return 0
+}
+
+// pullDelivery reports whether the agent receives its specs through discovery sync instead of
+// pushes, caching the answer per tick. Agents that cannot be read are left to the push path.
+func (r *Runner) pullDelivery(ctx context.Context, cache map[string]bool, agentID string) bool {
+	if pull, cached := cache[agentID]; cached {
+		return pull
+	}
+	ag, err := r.store.GetAgent(ctx, agentID)
+	cache[agentID] = err == nil && ag.Delivery() == kind.DeliveryPull
+	return cache[agentID]
 }
 
-func (r *Runner) push(ctx context.Context, rID, specID, agentID string) {
+// deploymentActive reports whether the deployment of the rollout's desired version allows pushes,
+// caching the answer per tick (see storage.DeploymentActive). A failed lookup holds the push.
+func (r *Runner) deploymentActive(ctx context.Context, cache map[string]bool, ss *model.Rollout) bool {
+	ok, err := storage.DeploymentActive(ctx, r.store, cache, ss)
+	if err != nil {
+		id := model.DeploymentID(ss.SpecID(), ss.DesiredVersion())
+		r.logger.Warn().Err(err).Str("deployment", id).Msg("tick: get deployment failed")
+		cache[id] = false
+	}
+	return ok
+}
+
+// push submits the content of the rollout's desired version to its agent, read from the
+// version's revision if the spec was edited since; a missing revision fails the push.
+func (r *Runner) push(ctx context.Context, ss *model.Rollout) {
+	var (
+		rID     = ss.ID()
+		specID  = ss.SpecID()
+		agentID = ss.AgentID()
+	)
+
 	ts, err := r.store.GetSpec(ctx, specID)
+	if err == nil {
+		ts, err = storage.SpecAt(ctx, r.store, ts, ss.DesiredVersion())
+	}
 	if err != nil {
 		r.logger.Warn().Err(err).
 			Str("rid", rID).
 			Str("spec_id", specID).
-			Msg("push: get spec failed")
-		r.markFailed(ctx, rID, "spec not found: "+err.Error())
+			Int("version", ss.DesiredVersion()).
+			Msg("push: get spec version failed")
+		r.markFailed(ctx, ss, "spec version not found: "+err.Error())
 		return
 	}
 	ag, err := r.store.GetAgent(ctx, agentID)
@@ -143,61 +382,151 @@ func (r *Runner) push(ctx context.Context, rID, specID, agentID string) {
 			Str("rid", rID).
 			Str("agent_id", agentID).
 			Msg("push: get agent failed")
-		r.markFailed(ctx, rID, "agent not found: "+err.Error())
+		r.markFailed(ctx, ss, "agent not found: "+err.Error())
 		return
 	}
-	ap, err := r.pool.Get(ag.Endpoint(), ag.EndpointType(), ag.APIVersion())
+	ap, err := r.pool.ForAgent(ag.ID(), ag.Endpoint(), ag.EndpointType(), ag.APIVersion())
 	if err != nil {
 		r.logger.Warn().Err(err).
 			Str("rid", rID).
 			Str("agent_id", agentID).
 			Str("endpoint", ag.Endpoint()).
 			Msg("push: get proxy failed")
-		r.markFailed(ctx, rID, "proxy error: "+err.Error())
+		r.markFailed(ctx, ss, "proxy error: "+err.Error())
 		return
 	}
 
-	err = ap.SubmitTask(ctx, proxy.TaskSubmission{Spec: ts.ToCreateSpec()})
+	err = ap.SubmitTask(ctx, proxy.TaskSubmission{Spec: ts.ToCreateSpec(), Version: ss.DesiredVersion()})
 	if err != nil {
 		r.logger.Warn().Err(err).
 			Str("rid", rID).
 			Str("spec_id", specID).
 			Str("agent_id", agentID).
 			Msg("push: submit task failed")
-		r.markFailed(ctx, rID, "submit error: "+err.Error())
+		r.markFailed(ctx, ss, "submit error: "+err.Error())
 		return
 	}
 
-	r.markSynced(ctx, rID, ts.Version())
+	r.markSynced(ctx, ss, ss.DesiredVersion())
 	r.logger.Info().
 		Str("spec_id", specID).
 		Str("agent_id", agentID).
-		Int("version", ts.Version()).
+		Int("version", ss.DesiredVersion()).
 		Msg("spec pushed to agent")
 }
 
-func (r *Runner) markSynced(ctx context.Context, rID string, version int) {
-	ss, err := r.store.GetRollout(ctx, rID)
+// remove cancels the rollout's task on its agent.
+func (r *Runner) remove(ctx context.Context, ss *model.Rollout) {
+	var (
+		rID     = ss.ID()
+		agentID = ss.AgentID()
+	)
+
+	ag, err := r.store.GetAgent(ctx, agentID)
+	if errors.Is(err, storage.ErrNotFound) {
+		// A deleted agent runs nothing anymore.
+		r.markRemoved(ctx, ss)
+		return
+	}
 	if err != nil {
-		r.logger.Error().Err(err).Str("rid", rID).Msg("markSynced: get failed")
+		r.logger.Warn().Err(err).
+			Str("rid", rID).
+			Str("agent_id", agentID).
+			Msg("remove: get agent failed")
+		r.markRemoveFailed(ctx, ss, "agent error: "+err.Error())
+		return
+	}
+	ap, err := r.pool.ForAgent(ag.ID(), ag.Endpoint(), ag.EndpointType(), ag.APIVersion())
+	if err != nil {
+		r.logger.Warn().Err(err).
+			Str("rid", rID).
+			Str("agent_id", agentID).
+			Str("endpoint", ag.Endpoint()).
+			Msg("remove: get proxy failed")
+		r.markRemoveFailed(ctx, ss, "proxy error: "+err.Error())
 		return
 	}
 
-	ss.MarkSynced(version)
-	if err = r.store.UpsertRollout(ctx, ss); err != nil {
-		r.logger.Error().Err(err).Str("rid", rID).Msg("markSynced: upsert failed")
+	if err = ap.CancelTask(ctx, ss.Slot()); err != nil {
+		r.logger.Warn().Err(err).
+			Str("rid", rID).
+			Str("agent_id", agentID).
+			Str("slot", ss.Slot()).
+			Msg("remove: cancel task failed")
+		r.markRemoveFailed(ctx, ss, "cancel error: "+err.Error())
+		return
 	}
+
+	r.markRemoved(ctx, ss)
+	r.logger.Info().
+		Str("spec_id", ss.SpecID()).
+		Str("agent_id", agentID).
+		Str("slot", ss.Slot()).
+		Msg("task removed from agent")
 }
 
-func (r *Runner) markFailed(ctx context.Context, rID, errMsg string) {
-	ss, err := r.store.GetRollout(ctx, rID)
-	if err != nil {
-		r.logger.Error().Err(err).Str("rid", rID).Msg("markFailed: get failed")
-		return
+// markRemoved records a finished removal; the rollout of a deleted spec is deleted instead.
+func (r *Runner) markRemoved(ctx context.Context, ss *model.Rollout) {
+	_, err := r.store.GetSpec(ctx, ss.SpecID())
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		if err = r.store.DeleteRollout(ctx, ss.ID()); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			r.logger.Error().Err(err).Str("rid", ss.ID()).Msg("markRemoved: delete failed")
+		}
+	case err != nil:
+		// Cancelling is idempotent: the next tick removes the task again.
+		r.logger.Error().Err(err).Str("rid", ss.ID()).Msg("markRemoved: get spec failed")
+	default:
+		ss.MarkRemoved()
+		r.save(ctx, ss, "markRemoved")
 	}
+}
 
+// markRemoveFailed records a failed removal; see markSynced for the conflict semantics.
+func (r *Runner) markRemoveFailed(ctx context.Context, ss *model.Rollout, errMsg string) {
+	ss.MarkRemoveFailed(errMsg)
+	r.retryLater(ss)
+	r.save(ctx, ss, "markRemoveFailed")
+}
+
+// markSynced records a successful push on the rollout as it was read at tick time.
+//
+// The write is conditional on the rollout's resource version: if it changed during
+// the push (e.g., a new Deploy), the result is stale and the next tick pushes again.
+func (r *Runner) markSynced(ctx context.Context, ss *model.Rollout, version int) {
+	ss.MarkSynced(version)
+	r.save(ctx, ss, "markSynced")
+}
+
+// markFailed records a failed push; see markSynced for the conflict semantics.
+func (r *Runner) markFailed(ctx context.Context, ss *model.Rollout, errMsg string) {
 	ss.MarkFailed(errMsg)
-	if err = r.store.UpsertRollout(ctx, ss); err != nil {
-		r.logger.Error().Err(err).Str("rid", rID).Msg("markFailed: upsert failed")
+	r.retryLater(ss)
+	r.save(ctx, ss, "markFailed")
+}
+
+// retryLater schedules the next attempt of a failed rollout with exponential backoff,
+// or marks it exhausted once MaxRetries attempts have failed.
+func (r *Runner) retryLater(ss *model.Rollout) {
+	if ss.Attempts() >= r.cfg.MaxRetries {
+		ss.MarkExhausted()
+		r.logger.Warn().
+			Str("rid", ss.ID()).
+			Int("attempts", ss.Attempts()).
+			Str("error", ss.Error()).
+			Msg("rollout exhausted its retries")
+		return
+	}
+	ss.ScheduleRetry(r.cfg.RetryBackoff.Delay(ss.Attempts(), ss.RetryDelay()))
+}
+
+func (r *Runner) save(ctx context.Context, ss *model.Rollout, op string) {
+	err := r.store.UpsertRollout(ctx, ss)
+	switch {
+	case err == nil:
+	case errors.Is(err, storage.ErrConflict):
+		r.logger.Info().Str("rid", ss.ID()).Msg(op + ": rollout changed during push, skipped")
+	default:
+		r.logger.Error().Err(err).Str("rid", ss.ID()).Msg(op + ": upsert failed")
 	}
 }
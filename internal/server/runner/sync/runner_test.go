@@ -0,0 +1,302 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+// gauge tracks how many calls run at once, overall and per agent, and when each one started.
+type gauge struct {
+	mu       gosync.Mutex
+	running  int
+	peak     int
+	perAgent map[string]int
+	agentMax map[string]int
+	started  []time.Time
+}
+
+func newGauge() *gauge {
+	return &gauge{perAgent: make(map[string]int), agentMax: make(map[string]int)}
+}
+
+// hold records a call to agentID lasting d.
+func (g *gauge) hold(agentID string, d time.Duration) {
+	g.mu.Lock()
+	g.running++
+	g.peak = max(g.peak, g.running)
+	g.perAgent[agentID]++
+	g.agentMax[agentID] = max(g.agentMax[agentID], g.perAgent[agentID])
+	g.started = append(g.started, time.Now())
+	g.mu.Unlock()
+
+	time.Sleep(d)
+
+	g.mu.Lock()
+	g.running--
+	g.perAgent[agentID]--
+	g.mu.Unlock()
+}
+
+func TestTick_BoundsWorkers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	for i := range 6 {
+		id := fmt.Sprintf("a%d", i)
+		mustAgent(t, ctx, st, id)
+		mustDeploy(t, ctx, st, "s"+id, id)
+	}
+	g := newGauge()
+	d := newFakeDialer()
+	d.submit = func(agentID string) error { g.hold(agentID, 20*time.Millisecond); return nil }
+	r := newTestRunner(t, Config{Workers: 2, PushRate: 1000}, st, d)
+
+	r.tick()
+
+	if g.peak != 2 {
+		t.Fatalf("expected exactly 2 concurrent pushes, got a peak of %d", g.peak)
+	}
+	if n := len(g.started); n != 6 {
+		t.Fatalf("expected every rollout pushed, got %d pushes", n)
+	}
+}
+
+func TestTick_OnePushPerAgentAtATime(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustAgent(t, ctx, st, "a1")
+	mustAgent(t, ctx, st, "a2")
+	for i := range 3 {
+		mustDeploy(t, ctx, st, fmt.Sprintf("s%d", i), "a1", "a2")
+	}
+	g := newGauge()
+	d := newFakeDialer()
+	d.submit = func(agentID string) error { g.hold(agentID, 20*time.Millisecond); return nil }
+	r := newTestRunner(t, Config{Workers: 4, PushRate: 1000}, st, d)
+
+	r.tick()
+
+	for _, id := range []string{"a1", "a2"} {
+		if g.agentMax[id] != 1 {
+			t.Fatalf("%s: expected one push at a time, got %d at once", id, g.agentMax[id])
+		}
+		if n := len(d.submissions(id)); n != 3 {
+			t.Fatalf("%s: expected 3 pushes, got %d", id, n)
+		}
+	}
+	if g.peak != 2 {
+		t.Fatalf("expected both agents served concurrently, got a peak of %d", g.peak)
+	}
+}
+
+func TestTick_RespectsPushRate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	for i := range 5 {
+		id := fmt.Sprintf("a%d", i)
+		mustAgent(t, ctx, st, id)
+		mustDeploy(t, ctx, st, "s"+id, id)
+	}
+	g := newGauge()
+	d := newFakeDialer()
+	d.submit = func(agentID string) error { g.hold(agentID, 0); return nil }
+	r := newTestRunner(t, Config{Workers: 5, PushRate: 20, PushBurst: 1}, st, d)
+
+	r.tick()
+
+	if n := len(g.started); n != 5 {
+		t.Fatalf("expected 5 pushes, got %d", n)
+	}
+	sort.Slice(g.started, func(i, j int) bool { return g.started[i].Before(g.started[j]) })
+	for i := 1; i < len(g.started); i++ {
+		// 20 pushes per second: one every 50ms, with some timer slack.
+		if gap := g.started[i].Sub(g.started[i-1]); gap < 40*time.Millisecond {
+			t.Fatalf("push %d started %v after the previous one, want at least 50ms", i, gap)
+		}
+	}
+}
+
+func TestTick_DefersPastBudget(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	for _, id := range []string{"a1", "a2", "a3"} {
+		mustAgent(t, ctx, st, id)
+	}
+	// a1 has a queue of two, a2 and a3 one rollout each.
+	mustDeploy(t, ctx, st, "s1", "a1", "a2", "a3")
+	mustDeploy(t, ctx, st, "s2", "a1")
+
+	d := newFakeDialer()
+	d.submit = func(string) error { time.Sleep(70 * time.Millisecond); return nil }
+	r := newTestRunner(t, Config{Workers: 1, PushRate: 1000, TickBudget: 100 * time.Millisecond}, st, d)
+
+	pending := func() int {
+		var n int
+		for _, rid := range [][2]string{{"s1", "a1"}, {"s1", "a2"}, {"s1", "a3"}, {"s2", "a1"}} {
+			if mustRollout(t, ctx, st, rid[0], rid[1]).Status() == kind.SyncStatusPending {
+				n++
+			}
+		}
+		return n
+	}
+
+	r.tick()
+	// Pushes started at 0 and 70ms run to completion; nothing starts after the 100ms budget.
+	if n := pending(); n != 2 {
+		t.Fatalf("expected 2 rollouts deferred past the budget, got %d pending", n)
+	}
+
+	r.tick()
+	r.tick()
+	if n := pending(); n != 0 {
+		t.Fatalf("expected the deferred rollouts pushed by the next ticks, got %d pending", n)
+	}
+}
+
+func TestPendingEvent(t *testing.T) {
+	t.Parallel()
+
+	rollout := func(change func(ss *model.Rollout)) *model.Rollout {
+		ss, err := model.NewRollout("s1", "a1", 1)
+		if err != nil {
+			t.Fatalf("NewRollout: %v", err)
+		}
+		change(ss)
+		return ss
+	}
+	cases := []struct {
+		name string
+		ev   storage.Event
+		want bool
+	}{
+		{"pending", storage.Event{Type: storage.EventUpdated, Object: rollout(func(*model.Rollout) {})}, true},
+		{"deleted", storage.Event{Type: storage.EventDeleted, Object: rollout(func(*model.Rollout) {})}, false},
+		{"synced", storage.Event{Type: storage.EventUpdated, Object: rollout(func(ss *model.Rollout) { ss.MarkSynced(1) })}, false},
+		{"removing", storage.Event{Type: storage.EventUpdated, Object: rollout(func(ss *model.Rollout) { ss.MarkRemoving("slot") })}, true},
+		{
+			name: "removal retry not yet due",
+			ev: storage.Event{Type: storage.EventUpdated, Object: rollout(func(ss *model.Rollout) {
+				ss.MarkRemoving("slot")
+				ss.MarkRemoveFailed("connection refused")
+				ss.ScheduleRetry(time.Minute)
+			})},
+			want: false,
+		},
+		{
+			name: "failed push",
+			ev: storage.Event{Type: storage.EventUpdated, Object: rollout(func(ss *model.Rollout) {
+				ss.MarkFailed("connection refused")
+				ss.ScheduleRetry(time.Minute)
+			})},
+			want: false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := pendingEvent(tc.ev); got != tc.want {
+				t.Fatalf("pendingEvent = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMarkFailed_DecorrelatedDelayGrowsFromPreviousDelay(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustAgent(t, ctx, st, "a1")
+	mustDeploy(t, ctx, st, "s1", "a1")
+	backoff := model.BackoffConfig{Jitter: kind.JitterDecorrelated, FirstMs: 10, MaxMs: 1_000_000, Factor: 2}
+	r := newTestRunner(t, Config{MaxRetries: 20, RetryBackoff: backoff}, st, newFakeDialer())
+
+	prev := 10 * time.Millisecond
+	for i := range 10 {
+		r.markFailed(ctx, mustRollout(t, ctx, st, "s1", "a1"), "connection refused")
+
+		ss := mustRollout(t, ctx, st, "s1", "a1")
+		got := ss.RetryDelay()
+		if got < 10*time.Millisecond || got > 3*prev {
+			t.Fatalf("retry %d: delay %v outside [10ms, %v]", i+1, got, 3*prev)
+		}
+		if at := ss.NextAttemptAt(); time.Until(at) > got {
+			t.Fatalf("retry %d: next attempt %v is further than the %v delay", i+1, at, got)
+		}
+		prev = got
+	}
+}
+
+func TestPush_SendsDesiredVersionContent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustAgent(t, ctx, st, "a1")
+	svc := mustDeploy(t, ctx, st, "s1", "a1")
+	deployed, err := st.GetSpec(ctx, "s1")
+	if err != nil {
+		t.Fatalf("GetSpec: %v", err)
+	}
+	want := deployed.ToCreateSpec()
+
+	// An edit that is not deployed yet must not reach the agent.
+	deployed.SetKindConfig(map[string]any{"command": "edited"})
+	if err = svc.Upsert(ctx, deployed, "tester"); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	d := newFakeDialer()
+	newTestRunner(t, Config{}, st, d).tick()
+
+	subs := d.submissions("a1")
+	if len(subs) != 1 {
+		t.Fatalf("expected one push, got %d", len(subs))
+	}
+	if subs[0].Version != 1 || !reflect.DeepEqual(subs[0].Spec, want) {
+		t.Fatalf("expected the deployed v1 content, got v%d %v", subs[0].Version, subs[0].Spec)
+	}
+	if ss := mustRollout(t, ctx, st, "s1", "a1"); ss.Status() != kind.SyncStatusSynced || ss.ActualVersion() != 1 {
+		t.Fatalf("expected synced at v1, got %s v%d", ss.Status(), ss.ActualVersion())
+	}
+}
+
+func TestPush_FailsWithoutRevision(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustAgent(t, ctx, st, "a1")
+	mustDeploy(t, ctx, st, "s1", "a1")
+	ss := mustRollout(t, ctx, st, "s1", "a1")
+	ss.MarkPending(7)
+	if err := st.UpsertRollout(ctx, ss); err != nil {
+		t.Fatalf("UpsertRollout: %v", err)
+	}
+	d := newFakeDialer()
+	newTestRunner(t, Config{}, st, d).tick()
+
+	if n := len(d.submissions("a1")); n != 0 {
+		t.Fatalf("a version without content must not be pushed, got %d pushes", n)
+	}
+	if got := mustRollout(t, ctx, st, "s1", "a1"); got.Status() != kind.SyncStatusFailed {
+		t.Fatalf("expected the push failed, got %s", got.Status())
+	}
+}
@@ -0,0 +1,154 @@
+package sync
+
+import (
+	"context"
+	gosync "sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	proxyv1 "github.com/soltiHQ/control-plane/api/proxy/v1"
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/proxy"
+	specsvc "github.com/soltiHQ/control-plane/internal/service/spec"
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+// fakeDialer is a proxy.Dialer whose agents record the calls they get.
+type fakeDialer struct {
+	mu        gosync.Mutex
+	submitted map[string][]proxy.TaskSubmission
+	bundles   map[string][]proxy.TaskBundle
+	cancelled map[string][]string
+
+	// submit, bundle and cancel, when set, run inside the corresponding call and return its error.
+	submit func(agentID string) error
+	bundle func(agentID string) error
+	cancel func(agentID string) error
+}
+
+func newFakeDialer() *fakeDialer {
+	return &fakeDialer{
+		submitted: make(map[string][]proxy.TaskSubmission),
+		bundles:   make(map[string][]proxy.TaskBundle),
+		cancelled: make(map[string][]string),
+	}
+}
+
+func (d *fakeDialer) ForAgent(agentID, _ string, _ kind.EndpointType, _ kind.APIVersion) (proxy.AgentProxy, error) {
+	return &fakeAgent{d: d, id: agentID}, nil
+}
+
+func (d *fakeDialer) submissions(agentID string) []proxy.TaskSubmission {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]proxy.TaskSubmission(nil), d.submitted[agentID]...)
+}
+
+func (d *fakeDialer) appliedBundles(agentID string) []proxy.TaskBundle {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]proxy.TaskBundle(nil), d.bundles[agentID]...)
+}
+
+type fakeAgent struct {
+	d  *fakeDialer
+	id string
+}
+
+func (a *fakeAgent) SubmitTask(_ context.Context, sub proxy.TaskSubmission) error {
+	if a.d.submit != nil {
+		if err := a.d.submit(a.id); err != nil {
+			return err
+		}
+	}
+	a.d.mu.Lock()
+	defer a.d.mu.Unlock()
+	a.d.submitted[a.id] = append(a.d.submitted[a.id], sub)
+	return nil
+}
+
+func (a *fakeAgent) ApplyBundle(_ context.Context, b proxy.TaskBundle) error {
+	if a.d.bundle != nil {
+		if err := a.d.bundle(a.id); err != nil {
+			return err
+		}
+	}
+	a.d.mu.Lock()
+	defer a.d.mu.Unlock()
+	a.d.bundles[a.id] = append(a.d.bundles[a.id], b)
+	return nil
+}
+
+func (a *fakeAgent) CancelTask(_ context.Context, slot string) error {
+	if a.d.cancel != nil {
+		if err := a.d.cancel(a.id); err != nil {
+			return err
+		}
+	}
+	a.d.mu.Lock()
+	defer a.d.mu.Unlock()
+	a.d.cancelled[a.id] = append(a.d.cancelled[a.id], slot)
+	return nil
+}
+
+func (a *fakeAgent) ListTasks(context.Context, proxy.TaskFilter) (*proxyv1.TaskListResponse, error) {
+	return &proxyv1.TaskListResponse{}, nil
+}
+
+func (a *fakeAgent) GetTask(context.Context, string) (*proxyv1.Task, error) {
+	return nil, proxy.ErrNotFound
+}
+
+func (a *fakeAgent) ExportSpecs(context.Context) ([]proxy.SpecExport, error) { return nil, nil }
+
+// newTestRunner creates a runner whose agents are served by d.
+func newTestRunner(t *testing.T, cfg Config, st storage.Storage, d *fakeDialer) *Runner {
+	t.Helper()
+	r, err := New(cfg, zerolog.Nop(), st, proxy.NewPool())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	r.pool = d
+	return r
+}
+
+func mustAgent(t *testing.T, ctx context.Context, st storage.Storage, id string) {
+	t.Helper()
+	a, err := model.NewAgent(id, id, "http://"+id)
+	if err != nil {
+		t.Fatalf("NewAgent: %v", err)
+	}
+	if err = st.UpsertAgent(ctx, a); err != nil {
+		t.Fatalf("UpsertAgent: %v", err)
+	}
+}
+
+// mustDeploy creates spec id with slot id and deploys it to targets.
+func mustDeploy(t *testing.T, ctx context.Context, st storage.Storage, id string, targets ...string) *specsvc.Service {
+	t.Helper()
+	ts, err := model.NewSpec(id, id, id)
+	if err != nil {
+		t.Fatalf("NewSpec: %v", err)
+	}
+	ts.SetKindConfig(map[string]any{"command": "sleep"})
+	ts.SetTargets(targets)
+
+	svc := specsvc.New(st)
+	if err = svc.Create(ctx, ts, "tester"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err = svc.Deploy(ctx, id, "tester"); err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	return svc
+}
+
+func mustRollout(t *testing.T, ctx context.Context, st storage.Storage, specID, agentID string) *model.Rollout {
+	t.Helper()
+	ss, err := st.GetRollout(ctx, model.RolloutID(specID, agentID))
+	if err != nil {
+		t.Fatalf("GetRollout(%s, %s): %v", specID, agentID, err)
+	}
+	return ss
+}
@@ -0,0 +1,37 @@
+package wave
+
+import "time"
+
+const (
+	defaultTickInterval = 10 * time.Second
+	defaultCheckTimeout = 15 * time.Second
+
+	defaultName    = "wave"
+	defaultWorkers = 16
+)
+
+// Config configures the wave runner.
+type Config struct {
+	TickInterval time.Duration
+	// CheckTimeout bounds one ListTasks call to an agent during a health check.
+	CheckTimeout time.Duration
+	Name         string
+	// Workers bounds the health checks of one spec run at once.
+	Workers int
+}
+
+func (c Config) withDefaults() Config {
+	if c.Name == "" {
+		c.Name = defaultName
+	}
+	if c.TickInterval <= 0 {
+		c.TickInterval = defaultTickInterval
+	}
+	if c.CheckTimeout <= 0 {
+		c.CheckTimeout = defaultCheckTimeout
+	}
+	if c.Workers <= 0 {
+		c.Workers = defaultWorkers
+	}
+	return c
+}
@@ -0,0 +1,332 @@
+// Package wave implements a server.Runner that drives progressive (canary / wave) deploys:
+//   - Lists rollouts on every tick and picks the specs that still have waiting rollouts
+//   - Checks the health of released rollouts via AgentProxy.ListTasks, up to Config.Workers at once
+//     (latest task of the slot running or succeeded is healthy; failed, timeout, canceled or
+//     exhausted is unhealthy, as is a rollout whose push retries are exhausted)
+//   - Releases the next wave (waiting → pending) once every released rollout is healthy and the
+//     strategy's pause has passed since the last one turned healthy
+//   - Halts the deploy (waiting → halted) when more rollouts are unhealthy than the strategy's
+//     max unavailable.
+//
+// Deploys whose deployment is paused or aborted are left alone.
+//
+// Released rollouts are pushed by the sync runner, which reacts to them becoming pending.
+package wave
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/proxy"
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+// Runner is a server.Runner that advances progressive deploys wave by wave.
+type Runner struct {
+	logger  zerolog.Logger
+	cfg     Config
+	store   storage.Storage
+	pool    proxy.Dialer
+	stop    chan struct{}
+	started atomic.Bool
+}
+
+// New creates a wave runner.
+func New(cfg Config, logger zerolog.Logger, store storage.Storage, pool *proxy.Pool) (*Runner, error) {
+	if store == nil {
+		return nil, errors.New("wave: store is nil")
+	}
+	if pool == nil {
+		return nil, errors.New("wave: proxy pool is nil")
+	}
+
+	cfg = cfg.withDefaults()
+	return &Runner{
+		logger: logger.With().Str("runner", cfg.Name).Logger(),
+		cfg:    cfg,
+		store:  store,
+		pool:   pool,
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+// Name returns the runner name.
+func (r *Runner) Name() string { return r.cfg.Name }
+
+// Start runs the wave loop until Stop is called.
+func (r *Runner) Start(_ context.Context) error {
+	if !r.started.CompareAndSwap(false, true) {
+		return errors.New("wave: already started")
+	}
+
+	ticker := time.NewTicker(r.cfg.TickInterval)
+	defer ticker.Stop()
+
+	r.logger.Info().
+		Dur("tick", r.cfg.TickInterval).
+		Msg("wave runner started")
+
+	for {
+		select {
+		case <-ticker.C:
+			r.tick()
+		case <-r.stop:
+			r.logger.Info().Msg("wave runner stopped")
+			return nil
+		}
+	}
+}
+
+// Stop signals the runner to exit. Safe to call multiple times.
+func (r *Runner) Stop(_ context.Context) error {
+	if !r.started.Load() {
+		return nil
+	}
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	return nil
+}
+
+func (r *Runner) tick() {
+	ctx := context.Background()
+
+	var (
+		bySpec  = make(map[string][]*model.Rollout)
+		waiting = make(map[string]struct{})
+		opts    = storage.ListOptions{Limit: storage.MaxListLimit}
+	)
+	for {
+		res, err := r.store.ListRollouts(ctx, nil, opts)
+		if err != nil {
+			r.logger.Error().Err(err).Msg("tick: list rollouts failed")
+			return
+		}
+		for _, ss := range res.Items {
+			bySpec[ss.SpecID()] = append(bySpec[ss.SpecID()], ss)
+			if ss.Status() == kind.SyncStatusWaiting {
+				waiting[ss.SpecID()] = struct{}{}
+			}
+		}
+		if res.NextCursor == "" {
+			break
+		}
+		opts.Cursor = res.NextCursor
+	}
+
+	for specID := range waiting {
+		r.advance(ctx, specID, bySpec[specID])
+	}
+}
+
+// advance checks the released rollouts of one spec and releases or halts its waiting ones.
+func (r *Runner) advance(ctx context.Context, specID string, rollouts []*model.Rollout) {
+	ts, err := r.store.GetSpec(ctx, specID)
+	if err != nil {
+		// Deleted specs take their rollouts with them; nothing to advance.
+		return
+	}
+
+	if d, err := r.store.GetDeployment(ctx, model.DeploymentID(specID, ts.DeployedVersion())); err == nil && !d.Active() {
+		return
+	}
+
+	var (
+		strategy = ts.Strategy()
+		version  = ts.DeployedVersion()
+
+		waiting, released []*model.Rollout
+	)
+	for _, ss := range rollouts {
+		if ss.DesiredVersion() != version {
+			continue
+		}
+		switch ss.Status() {
+		case kind.SyncStatusWaiting:
+			waiting = append(waiting, ss)
+		case kind.SyncStatusOrphaned, kind.SyncStatusHalted, kind.SyncStatusRemoving, kind.SyncStatusRemoved:
+			// No longer part of the rollout: dropped targets never settle and must not hold later waves.
+		default:
+			released = append(released, ss)
+		}
+	}
+	if len(waiting) == 0 {
+		return
+	}
+
+	var (
+		unhealthy, settling int
+		lastHealthy         time.Time
+	)
+	for i, st := range r.check(ctx, ts, released) {
+		ss := released[i]
+		switch st {
+		case stateHealthy:
+			if ss.HealthyAt().After(lastHealthy) {
+				lastHealthy = ss.HealthyAt()
+			}
+		case stateUnhealthy:
+			unhealthy++
+		default:
+			settling++
+		}
+	}
+
+	if unhealthy > strategy.MaxUnavailable {
+		reason := fmt.Sprintf("rollout halted: %d unhealthy agents, max unavailable %d", unhealthy, strategy.MaxUnavailable)
+		for _, ss := range waiting {
+			ss.MarkHalted(reason)
+			r.save(ctx, ss, "markHalted")
+		}
+		r.logger.Warn().
+			Str("spec_id", specID).
+			Int("version", version).
+			Int("unhealthy", unhealthy).
+			Int("halted", len(waiting)).
+			Msg("rollout halted")
+		return
+	}
+	if settling > 0 || time.Since(lastHealthy) < time.Duration(strategy.PauseMs)*time.Millisecond {
+		return
+	}
+
+	next := waiting[0].Wave()
+	for _, ss := range waiting {
+		next = min(next, ss.Wave())
+	}
+	var count int
+	for _, ss := range waiting {
+		if ss.Wave() != next {
+			continue
+		}
+		ss.MarkPending(version)
+		r.save(ctx, ss, "release")
+		count++
+	}
+	r.logger.Info().
+		Str("spec_id", specID).
+		Int("version", version).
+		Int("wave", next).
+		Int("agents", count).
+		Msg("wave released")
+}
+
+// check classifies the released rollouts, querying up to Config.Workers agents at once.
+func (r *Runner) check(ctx context.Context, ts *model.Spec, released []*model.Rollout) []state {
+	var (
+		out = make([]state, len(released))
+		sem = make(chan struct{}, r.cfg.Workers)
+		wg  sync.WaitGroup
+	)
+	for i, ss := range released {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			out[i] = r.health(ctx, ts, ss)
+			<-sem
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+type state uint8
+
+const (
+	stateSettling  state = iota // not pushed yet (or still retrying), or the agent has not reported a verdict
+	stateHealthy                // the agent reported the task running or succeeded
+	stateUnhealthy              // every push retry failed, or the task ended badly
+)
+
+// health classifies a released rollout, querying the agent for synced rollouts not yet known healthy.
+//
+// A rollout becomes healthy once; later task failures are left to the task's own restart policy.
+// A failed push still being retried by the sync runner is settling, not unhealthy: only an
+// exhausted rollout counts against MaxUnavailable.
+func (r *Runner) health(ctx context.Context, ts *model.Spec, ss *model.Rollout) state {
+	switch {
+	case !ss.HealthyAt().IsZero():
+		return stateHealthy
+	case ss.Status() == kind.SyncStatusExhausted:
+		return stateUnhealthy
+	case ss.Status() != kind.SyncStatusSynced:
+		return stateSettling
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, r.cfg.CheckTimeout)
+	defer cancel()
+
+	status, err := r.taskStatus(checkCtx, ss.AgentID(), ts.Slot())
+	if err != nil {
+		r.logger.Warn().Err(err).
+			Str("spec_id", ss.SpecID()).
+			Str("agent_id", ss.AgentID()).
+			Msg("health: list tasks failed")
+		return stateSettling
+	}
+	switch status {
+	case "running", "succeeded":
+		ss.MarkHealthy()
+		r.save(ctx, ss, "markHealthy")
+		return stateHealthy
+	case "failed", "timeout", "canceled", "exhausted":
+		return stateUnhealthy
+	default:
+		return stateSettling
+	}
+}
+
+// taskStatus returns the status of the most recently updated task of slot on the agent
+// ("" if the agent reports none, or is not dialed: a pull-mode agent's rollouts are marked
+// healthy from its discovery sync reports).
+func (r *Runner) taskStatus(ctx context.Context, agentID, slot string) (string, error) {
+	ag, err := r.store.GetAgent(ctx, agentID)
+	if err != nil {
+		return "", err
+	}
+	if ag.Delivery() == kind.DeliveryPull {
+		return "", nil
+	}
+	ap, err := r.pool.ForAgent(ag.ID(), ag.Endpoint(), ag.EndpointType(), ag.APIVersion())
+	if err != nil {
+		return "", err
+	}
+	res, err := ap.ListTasks(ctx, proxy.TaskFilter{Slot: slot})
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		status  string
+		updated int64
+	)
+	for _, t := range res.Tasks {
+		if t.Slot == slot && (status == "" || t.UpdatedAt > updated) {
+			status, updated = t.Status, t.UpdatedAt
+		}
+	}
+	return status, nil
+}
+
+// save writes the rollout conditionally on the version read at tick time: if it changed
+// meanwhile (a new Deploy, a push), the decision is stale and the next tick decides again.
+func (r *Runner) save(ctx context.Context, ss *model.Rollout, op string) {
+	err := r.store.UpsertRollout(ctx, ss)
+	switch {
+	case err == nil:
+	case errors.Is(err, storage.ErrConflict):
+		r.logger.Info().Str("rid", ss.ID()).Msg(op + ": rollout changed during check, skipped")
+	default:
+		r.logger.Error().Err(err).Str("rid", ss.ID()).Msg(op + ": upsert failed")
+	}
+}
@@ -0,0 +1,315 @@
+package wave
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	proxyv1 "github.com/soltiHQ/control-plane/api/proxy/v1"
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/proxy"
+	specsvc "github.com/soltiHQ/control-plane/internal/service/spec"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+func requireNoErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// fakeDialer is a proxy.Dialer whose agents report one task per slot in the status set in tasks.
+type fakeDialer struct {
+	mu     sync.Mutex
+	tasks  map[string]string // agent → status of its task
+	listed int
+
+	// list, when set, runs inside every ListTasks call.
+	list func()
+}
+
+func newFakeDialer() *fakeDialer {
+	return &fakeDialer{tasks: make(map[string]string)}
+}
+
+func (d *fakeDialer) ForAgent(agentID, _ string, _ kind.EndpointType, _ kind.APIVersion) (proxy.AgentProxy, error) {
+	return &fakeAgent{d: d, id: agentID}, nil
+}
+
+func (d *fakeDialer) set(agentID, status string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tasks[agentID] = status
+}
+
+func (d *fakeDialer) calls() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.listed
+}
+
+type fakeAgent struct {
+	d  *fakeDialer
+	id string
+}
+
+func (a *fakeAgent) ListTasks(_ context.Context, f proxy.TaskFilter) (*proxyv1.TaskListResponse, error) {
+	if a.d.list != nil {
+		a.d.list()
+	}
+	a.d.mu.Lock()
+	defer a.d.mu.Unlock()
+	a.d.listed++
+	status, ok := a.d.tasks[a.id]
+	if !ok {
+		return &proxyv1.TaskListResponse{}, nil
+	}
+	return &proxyv1.TaskListResponse{
+		Tasks: []proxyv1.Task{{ID: "t1", Slot: f.Slot, Status: status, UpdatedAt: 1}},
+		Total: 1,
+	}, nil
+}
+
+func (a *fakeAgent) GetTask(context.Context, string) (*proxyv1.Task, error) {
+	return nil, proxy.ErrNotFound
+}
+func (a *fakeAgent) SubmitTask(context.Context, proxy.TaskSubmission) error { return nil }
+func (a *fakeAgent) ApplyBundle(context.Context, proxy.TaskBundle) error    { return nil }
+func (a *fakeAgent) CancelTask(context.Context, string) error               { return nil }
+func (a *fakeAgent) ExportSpecs(context.Context) ([]proxy.SpecExport, error) {
+	return nil, nil
+}
+
+type fixture struct {
+	ctx context.Context
+	st  storage.Storage
+	svc *specsvc.Service
+	d   *fakeDialer
+	r   *Runner
+}
+
+// newFixture deploys spec s1 with the given strategy to the agents a0..a<n-1>, in that order,
+// and marks the rollouts of wave 0 synced.
+func newFixture(t *testing.T, cfg Config, strategy model.RolloutStrategy, n int) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	st := inmemory.New()
+
+	targets := make([]string, n)
+	for i := range targets {
+		targets[i] = fmt.Sprintf("a%d", i)
+		a, err := model.NewAgent(targets[i], targets[i], "http://"+targets[i])
+		requireNoErr(t, err)
+		requireNoErr(t, st.UpsertAgent(ctx, a))
+	}
+	ts, err := model.NewSpec("s1", "s1", "slot")
+	requireNoErr(t, err)
+	ts.SetKindConfig(map[string]any{"command": "sleep"})
+	ts.SetTargets(targets)
+	ts.SetStrategy(strategy)
+	svc := specsvc.New(st)
+	requireNoErr(t, svc.Create(ctx, ts, "tester"))
+	requireNoErr(t, svc.Deploy(ctx, "s1", "tester"))
+
+	f := &fixture{ctx: ctx, st: st, svc: svc, d: newFakeDialer()}
+	for _, id := range targets {
+		if ss := f.rollout(t, id); ss.Status() == kind.SyncStatusPending {
+			f.update(t, id, func(ss *model.Rollout) { ss.MarkSynced(1) })
+		}
+	}
+
+	f.r, err = New(cfg, zerolog.Nop(), st, proxy.NewPool())
+	requireNoErr(t, err)
+	f.r.pool = f.d
+	return f
+}
+
+func (f *fixture) rollout(t *testing.T, agentID string) *model.Rollout {
+	t.Helper()
+	ss, err := f.st.GetRollout(f.ctx, model.RolloutID("s1", agentID))
+	requireNoErr(t, err)
+	return ss
+}
+
+func (f *fixture) update(t *testing.T, agentID string, fn func(*model.Rollout)) {
+	t.Helper()
+	ss := f.rollout(t, agentID)
+	fn(ss)
+	requireNoErr(t, f.st.UpsertRollout(f.ctx, ss))
+}
+
+func (f *fixture) expect(t *testing.T, agentID string, want kind.SyncStatus) {
+	t.Helper()
+	if got := f.rollout(t, agentID).Status(); got != want {
+		t.Fatalf("%s: expected %s, got %s", agentID, want, got)
+	}
+}
+
+func TestAdvance_ReleasesNextWaveAfterPause(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, Config{}, model.RolloutStrategy{BatchSize: 1, PauseMs: 100}, 3)
+	f.expect(t, "a1", kind.SyncStatusWaiting)
+	f.d.set("a0", "running")
+
+	f.r.tick()
+	if f.rollout(t, "a0").HealthyAt().IsZero() {
+		t.Fatalf("expected a0 marked healthy")
+	}
+	f.expect(t, "a1", kind.SyncStatusWaiting)
+
+	time.Sleep(150 * time.Millisecond)
+	f.r.tick()
+	f.expect(t, "a1", kind.SyncStatusPending)
+	f.expect(t, "a2", kind.SyncStatusWaiting)
+}
+
+func TestAdvance_WaitsForSettlingRollouts(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, Config{}, model.RolloutStrategy{BatchSize: 1}, 2)
+	// The agent has no verdict yet.
+	f.r.tick()
+	f.expect(t, "a1", kind.SyncStatusWaiting)
+
+	f.d.set("a0", "running")
+	f.r.tick()
+	f.expect(t, "a1", kind.SyncStatusPending)
+}
+
+func TestAdvance_IgnoresDroppedTargets(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		drop func(*model.Rollout)
+	}{
+		{"removing", func(ss *model.Rollout) { ss.MarkRemoving("slot") }},
+		{"removed", func(ss *model.Rollout) { ss.MarkRemoving("slot"); ss.MarkRemoved() }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := newFixture(t, Config{}, model.RolloutStrategy{BatchSize: 1}, 3)
+			f.d.set("a0", "running")
+			f.r.tick()
+			f.expect(t, "a1", kind.SyncStatusPending)
+
+			// a1 leaves the targets before it reports: it never settles, and must not hold a2.
+			f.update(t, "a1", tc.drop)
+			f.r.tick()
+			f.expect(t, "a2", kind.SyncStatusPending)
+		})
+	}
+}
+
+func TestAdvance_MaxUnavailable(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name           string
+		maxUnavailable int
+		setup          func(t *testing.T, f *fixture)
+		want           kind.SyncStatus
+	}{
+		{
+			name:  "task failed",
+			setup: func(t *testing.T, f *fixture) { f.d.set("a0", "failed"); f.d.set("a1", "running") },
+			want:  kind.SyncStatusHalted,
+		},
+		{
+			name: "push retries exhausted",
+			setup: func(t *testing.T, f *fixture) {
+				f.update(t, "a0", func(ss *model.Rollout) { ss.MarkExhausted() })
+				f.d.set("a1", "running")
+			},
+			want: kind.SyncStatusHalted,
+		},
+		{
+			name: "push failed but retrying",
+			setup: func(t *testing.T, f *fixture) {
+				f.update(t, "a0", func(ss *model.Rollout) { ss.MarkFailed("connection refused") })
+				f.d.set("a1", "running")
+			},
+			want: kind.SyncStatusWaiting,
+		},
+		{
+			name:           "within max unavailable",
+			maxUnavailable: 1,
+			setup:          func(t *testing.T, f *fixture) { f.d.set("a0", "failed"); f.d.set("a1", "running") },
+			want:           kind.SyncStatusPending,
+		},
+		{
+			name:           "over max unavailable",
+			maxUnavailable: 1,
+			setup:          func(t *testing.T, f *fixture) { f.d.set("a0", "failed"); f.d.set("a1", "timeout") },
+			want:           kind.SyncStatusHalted,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := newFixture(t, Config{}, model.RolloutStrategy{CanaryCount: 2, MaxUnavailable: tc.maxUnavailable}, 3)
+			tc.setup(t, f)
+
+			f.r.tick()
+			f.expect(t, "a2", tc.want)
+		})
+	}
+}
+
+func TestAdvance_SkipsInactiveDeployments(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, Config{}, model.RolloutStrategy{BatchSize: 1}, 2)
+	f.d.set("a0", "running")
+	_, err := f.svc.PauseDeploy(f.ctx, "s1", "tester")
+	requireNoErr(t, err)
+
+	f.r.tick()
+	f.expect(t, "a1", kind.SyncStatusWaiting)
+	if n := f.d.calls(); n != 0 {
+		t.Fatalf("a paused deployment must not be checked, got %d ListTasks calls", n)
+	}
+
+	_, err = f.svc.ResumeDeploy(f.ctx, "s1", "tester")
+	requireNoErr(t, err)
+	f.r.tick()
+	f.expect(t, "a1", kind.SyncStatusPending)
+}
+
+func TestAdvance_BoundsConcurrentChecks(t *testing.T) {
+	t.Parallel()
+
+	f := newFixture(t, Config{Workers: 2}, model.RolloutStrategy{CanaryCount: 6}, 7)
+	for i := range 6 {
+		f.d.set(fmt.Sprintf("a%d", i), "running")
+	}
+	var running, peak atomic.Int32
+	f.d.list = func() {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+	}
+
+	f.r.tick()
+	if p := peak.Load(); p != 2 {
+		t.Fatalf("expected exactly 2 concurrent checks, got a peak of %d", p)
+	}
+	f.expect(t, "a6", kind.SyncStatusPending)
+}
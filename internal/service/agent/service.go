@@ -70,22 +70,31 @@ func (s *Service) Get(ctx context.Context, id string) (*model.Agent, error) {
 // If the agent already exists, control-plane owned labels and the original
 // createdAt timestamp are preserved because they are not part of the
 // discovery payload reported by the agent.
+//
+// The write is conditional on the version of the agent that was merged, so a
+// concurrent label patch is never lost; on conflict the merge is retried.
 func (s *Service) Upsert(ctx context.Context, m *model.Agent) error {
-	existing, err := s.store.GetAgent(ctx, m.ID())
-	switch {
-	case err == nil:
-		m.SetCreatedAt(existing.CreatedAt())
-		for k, v := range existing.LabelsAll() {
-			m.LabelAdd(k, v)
-		}
-		if m.HeartbeatInterval() == 0 && existing.HeartbeatInterval() > 0 {
-			m.SetHeartbeatInterval(existing.HeartbeatInterval())
+	return service.RetryOnConflict(ctx, func() error {
+		next := m.Clone()
+		next.SetResourceVersion(0)
+
+		existing, err := s.store.GetAgent(ctx, m.ID())
+		switch {
+		case err == nil:
+			next.SetResourceVersion(existing.ResourceVersion())
+			next.SetCreatedAt(existing.CreatedAt())
+			for k, v := range existing.LabelsAll() {
+				next.LabelAdd(k, v)
+			}
+			if next.HeartbeatInterval() == 0 && existing.HeartbeatInterval() > 0 {
+				next.SetHeartbeatInterval(existing.HeartbeatInterval())
+			}
+		case errors.Is(err, storage.ErrNotFound):
+		default:
+			return err
 		}
-	case errors.Is(err, storage.ErrNotFound):
-	default:
-		return err
-	}
-	return s.store.UpsertAgent(ctx, m)
+		return s.store.UpsertAgent(ctx, next)
+	})
 }
 
 // PatchLabels replaces labels for an agent.
@@ -94,16 +103,20 @@ func (s *Service) PatchLabels(ctx context.Context, req PatchLabels) (*model.Agen
 		return nil, storage.ErrInvalidArgument
 	}
 
-	agent, err := s.store.GetAgent(ctx, req.ID)
-	if err != nil {
-		return nil, err
-	}
-	if agent == nil {
-		return nil, storage.ErrInternal
-	}
+	var agent *model.Agent
+	err := service.RetryOnConflict(ctx, func() error {
+		var err error
+		if agent, err = s.store.GetAgent(ctx, req.ID); err != nil {
+			return err
+		}
+		if agent == nil {
+			return storage.ErrInternal
+		}
 
-	replaceLabels(agent, req.Labels)
-	if err = s.store.UpsertAgent(ctx, agent); err != nil {
+		replaceLabels(agent, req.Labels)
+		return s.store.UpsertAgent(ctx, agent)
+	})
+	if err != nil {
 		return nil, err
 	}
 	return agent.Clone(), nil
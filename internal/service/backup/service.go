@@ -0,0 +1,360 @@
+// Package backup implements full-state backup and restore:
+//   - Point-in-time export of every persistent entity to a versioned archive
+//   - Restore of an archive into an empty store (disaster recovery, backend migration).
+//
+// Sessions are not exported: they are short-lived, and restoring them would revive
+// refresh tokens issued by the old deployment.
+package backup
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/codec"
+)
+
+// Service provides backup and restore operations.
+type Service struct {
+	store storage.Storage
+	codec *codec.Codec
+}
+
+// New creates a new backup service.
+//
+// Archive entities are encoded with c, so a codec with a keyring keeps secrets sealed
+// in archives too (restoring them then needs that keyring); nil writes them in the clear.
+func New(store storage.Storage, c *codec.Codec) *Service {
+	if store == nil {
+		panic("backup.Service: store is nil")
+	}
+	return &Service{store: store, codec: c}
+}
+
+// Export writes an archive of the whole store to w.
+//
+// The entities are read in one transaction, so the archive is a consistent snapshot
+// at Manifest.Revision; writes wait only while the entities are collected, not while
+// the archive is written.
+func (s *Service) Export(ctx context.Context, w io.Writer) (*Manifest, error) {
+	var (
+		entries []entry
+		m       = &Manifest{Format: Format, Version: Version, Counts: make(map[storage.Kind]int)}
+	)
+	err := s.store.InTx(ctx, func(tx storage.Tx) error {
+		rev, err := s.store.Revision(ctx)
+		if err != nil {
+			return err
+		}
+		m.Revision = rev
+		m.CreatedAt = time.Now().UTC()
+
+		entries, err = s.collect(ctx, tx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err = enc.Encode(m); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if err = enc.Encode(e); err != nil {
+			return nil, err
+		}
+		m.Counts[e.Kind]++
+	}
+	if err = enc.Encode(trailer{End: true, Count: len(entries)}); err != nil {
+		return nil, err
+	}
+	if err = bw.Flush(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Restore loads an archive from r into the store.
+//
+// The archive is read and validated completely before anything is written; the
+// entities are then written in one transaction, so a failed restore leaves the
+// store untouched. Resource versions are reissued by the target store.
+//
+// Returns:
+//   - storage.ErrInvalidArgument if the archive is malformed, truncated or of another version.
+//   - storage.ErrAlreadyExists if the store already holds users, roles, agents, specs or rollouts.
+func (s *Service) Restore(ctx context.Context, r io.Reader) (*Manifest, error) {
+	m, entities, err := s.read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.store.InTx(ctx, func(tx storage.Tx) error {
+		if err := requireEmpty(ctx, tx); err != nil {
+			return err
+		}
+		for _, entity := range entities {
+			if err := put(ctx, tx, entity); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// collect encodes every exported entity, grouped by kind.
+func (s *Service) collect(ctx context.Context, tx storage.Tx) ([]entry, error) {
+	var out []entry
+	add := func(entity any) error {
+		k, data, err := s.codec.Encode(entity)
+		if err != nil {
+			return err
+		}
+		out = append(out, entry{Kind: k, Data: data})
+		return nil
+	}
+
+	if err := each(func(opts storage.ListOptions) (*storage.RoleListResult, error) {
+		return tx.ListRoles(ctx, nil, opts)
+	}, func(r *model.Role) error { return add(r) }); err != nil {
+		return nil, err
+	}
+
+	var userIDs []string
+	if err := each(func(opts storage.ListOptions) (*storage.UserListResult, error) {
+		return tx.ListUsers(ctx, nil, opts)
+	}, func(u *model.User) error {
+		userIDs = append(userIDs, u.ID())
+		return add(u)
+	}); err != nil {
+		return nil, err
+	}
+
+	var credIDs []string
+	for _, id := range userIDs {
+		creds, err := tx.ListCredentialsByUser(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range creds {
+			credIDs = append(credIDs, c.ID())
+			if err = add(c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, id := range credIDs {
+		v, err := tx.GetVerifierByCredential(ctx, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = add(v); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := each(func(opts storage.ListOptions) (*storage.AgentListResult, error) {
+		return tx.ListAgents(ctx, nil, opts)
+	}, func(a *model.Agent) error { return add(a) }); err != nil {
+		return nil, err
+	}
+	var specIDs []string
+	if err := each(func(opts storage.ListOptions) (*storage.SpecListResult, error) {
+		return tx.ListSpecs(ctx, nil, opts)
+	}, func(ts *model.Spec) error {
+		specIDs = append(specIDs, ts.ID())
+		return add(ts)
+	}); err != nil {
+		return nil, err
+	}
+	for _, id := range specIDs {
+		revisions, err := tx.ListSpecRevisionsBySpec(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, rev := range revisions {
+			if err = add(rev); err != nil {
+				return nil, err
+			}
+		}
+		deployments, err := tx.ListDeploymentsBySpec(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range deployments {
+			if err = add(d); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := each(func(opts storage.ListOptions) (*storage.RolloutListResult, error) {
+		return tx.ListRollouts(ctx, nil, opts)
+	}, func(ro *model.Rollout) error { return add(ro) }); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// each calls fn for every item of a paginated listing.
+func each[T any](list func(storage.ListOptions) (*storage.ListResult[T], error), fn func(T) error) error {
+	opts := storage.ListOptions{Limit: storage.MaxListLimit}
+	for {
+		res, err := list(opts)
+		if err != nil {
+			return err
+		}
+		for _, item := range res.Items {
+			if err = fn(item); err != nil {
+				return err
+			}
+		}
+		if res.NextCursor == "" {
+			return nil
+		}
+		opts.Cursor = res.NextCursor
+	}
+}
+
+// read decodes and validates a whole archive.
+func (s *Service) read(r io.Reader) (*Manifest, []any, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+
+	if !sc.Scan() {
+		return nil, nil, invalid("missing header", sc.Err())
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(sc.Bytes(), m); err != nil {
+		return nil, nil, invalid("header", err)
+	}
+	if m.Format != Format || m.Version != Version {
+		return nil, nil, invalid(fmt.Sprintf("unsupported archive %q version %d", m.Format, m.Version), nil)
+	}
+	m.Counts = make(map[storage.Kind]int)
+
+	var (
+		entities []any
+		line     = 1
+	)
+	for sc.Scan() {
+		line++
+
+		var t trailer
+		if err := json.Unmarshal(sc.Bytes(), &t); err == nil && t.End {
+			if t.Count != len(entities) {
+				return nil, nil, invalid(fmt.Sprintf("trailer counts %d entities, archive has %d", t.Count, len(entities)), nil)
+			}
+			if sc.Scan() {
+				return nil, nil, invalid(fmt.Sprintf("line %d: data after trailer", line+1), nil)
+			}
+			return m, entities, nil
+		}
+
+		var e entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, nil, invalid(fmt.Sprintf("line %d", line), err)
+		}
+		entity, err := s.codec.Decode(e.Kind, e.Data)
+		if err != nil {
+			return nil, nil, invalid(fmt.Sprintf("line %d", line), err)
+		}
+		entities = append(entities, entity)
+		m.Counts[e.Kind]++
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, invalid(fmt.Sprintf("line %d", line+1), err)
+	}
+	return nil, nil, invalid("missing trailer (truncated archive)", nil)
+}
+
+func invalid(what string, err error) error {
+	if err != nil {
+		return fmt.Errorf("%w: backup: %s: %v", storage.ErrInvalidArgument, what, err)
+	}
+	return fmt.Errorf("%w: backup: %s", storage.ErrInvalidArgument, what)
+}
+
+// requireEmpty fails unless every listable collection is empty.
+func requireEmpty(ctx context.Context, tx storage.Tx) error {
+	one := storage.ListOptions{Limit: 1}
+	checks := []struct {
+		kind  storage.Kind
+		count func() (int, error)
+	}{
+		{storage.KindUser, func() (int, error) { res, err := tx.ListUsers(ctx, nil, one); return size(res, err) }},
+		{storage.KindRole, func() (int, error) { res, err := tx.ListRoles(ctx, nil, one); return size(res, err) }},
+		{storage.KindAgent, func() (int, error) { res, err := tx.ListAgents(ctx, nil, one); return size(res, err) }},
+		{storage.KindSpec, func() (int, error) { res, err := tx.ListSpecs(ctx, nil, one); return size(res, err) }},
+		{storage.KindRollout, func() (int, error) { res, err := tx.ListRollouts(ctx, nil, one); return size(res, err) }},
+	}
+	for _, c := range checks {
+		n, err := c.count()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%w: backup: target store already has %s entities", storage.ErrAlreadyExists, c.kind)
+		}
+	}
+	return nil
+}
+
+func size[T any](res *storage.ListResult[T], err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	return len(res.Items), nil
+}
+
+// put writes a decoded entity unconditionally.
+func put(ctx context.Context, tx storage.Tx, entity any) error {
+	switch e := entity.(type) {
+	case *model.Role:
+		e.SetResourceVersion(0)
+		return tx.UpsertRole(ctx, e)
+	case *model.User:
+		e.SetResourceVersion(0)
+		return tx.UpsertUser(ctx, e)
+	case *model.Credential:
+		e.SetResourceVersion(0)
+		return tx.UpsertCredential(ctx, e)
+	case *model.Verifier:
+		e.SetResourceVersion(0)
+		return tx.UpsertVerifier(ctx, e)
+	case *model.Session:
+		e.SetResourceVersion(0)
+		return tx.CreateSession(ctx, e)
+	case *model.Agent:
+		e.SetResourceVersion(0)
+		return tx.UpsertAgent(ctx, e)
+	case *model.Spec:
+		e.SetResourceVersion(0)
+		return tx.UpsertSpec(ctx, e)
+	case *model.SpecRevision:
+		e.SetResourceVersion(0)
+		return tx.CreateSpecRevision(ctx, e)
+	case *model.Deployment:
+		e.SetResourceVersion(0)
+		return tx.UpsertDeployment(ctx, e)
+	case *model.Rollout:
+		e.SetResourceVersion(0)
+		return tx.UpsertRollout(ctx, e)
+	default:
+		return fmt.Errorf("%w: backup: unsupported entity %T", storage.ErrInternal, entity)
+	}
+}
@@ -0,0 +1,212 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/codec"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+func requireNoErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// seed fills st with one entity of every kind and returns the ID of the session.
+func seed(t *testing.T, ctx context.Context, st storage.Storage) string {
+	t.Helper()
+
+	role, err := model.NewRole("role-admin", "admin")
+	requireNoErr(t, err)
+	requireNoErr(t, role.PermissionAdd(kind.SystemBackup))
+	role.SetSeed(2)
+	requireNoErr(t, st.UpsertRole(ctx, role))
+
+	u, err := model.NewUser("u1", "alice")
+	requireNoErr(t, err)
+	requireNoErr(t, u.RoleAdd(role.ID()))
+	requireNoErr(t, st.UpsertUser(ctx, u))
+
+	c, err := model.NewCredential("c1", u.ID(), kind.Password)
+	requireNoErr(t, err)
+	requireNoErr(t, st.UpsertCredential(ctx, c))
+	v, err := model.NewVerifier("v1", c.ID(), kind.Password)
+	requireNoErr(t, err)
+	requireNoErr(t, v.DataSet("hash", "secret-hash"))
+	requireNoErr(t, st.UpsertVerifier(ctx, v))
+
+	sess, err := model.NewSession("sess1", u.ID(), c.ID(), kind.Password, []byte("refresh"), time.Now().Add(time.Hour))
+	requireNoErr(t, err)
+	requireNoErr(t, st.CreateSession(ctx, sess))
+
+	a, err := model.NewAgent("a1", "agent-1", "http://a1")
+	requireNoErr(t, err)
+	a.LabelAdd("env", "prod")
+	requireNoErr(t, st.UpsertAgent(ctx, a))
+
+	ts, err := model.NewSpec("s1", "spec-1", "job")
+	requireNoErr(t, err)
+	ts.SetKindConfig(map[string]any{"command": "sleep"})
+	requireNoErr(t, st.UpsertSpec(ctx, ts))
+	rev, err := model.NewSpecRevision(ts, "alice")
+	requireNoErr(t, err)
+	requireNoErr(t, st.CreateSpecRevision(ctx, rev))
+	d, err := model.NewDeployment(ts.ID(), ts.Version(), "alice")
+	requireNoErr(t, err)
+	requireNoErr(t, st.UpsertDeployment(ctx, d))
+
+	ro, err := model.NewRollout(ts.ID(), a.ID(), ts.Version())
+	requireNoErr(t, err)
+	ro.MarkSynced(ts.Version())
+	requireNoErr(t, st.UpsertRollout(ctx, ro))
+
+	return sess.ID()
+}
+
+func export(t *testing.T, ctx context.Context, st storage.Storage) (*Manifest, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	m, err := New(st, codec.New(nil)).Export(ctx, &buf)
+	requireNoErr(t, err)
+	return m, buf.Bytes()
+}
+
+func TestExportRestore_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	src := inmemory.New()
+	sessionID := seed(t, ctx, src)
+
+	m, archive := export(t, ctx, src)
+	want := map[storage.Kind]int{
+		storage.KindRole: 1, storage.KindUser: 1, storage.KindCredential: 1, storage.KindVerifier: 1,
+		storage.KindAgent: 1, storage.KindSpec: 1, storage.KindSpecRevision: 1, storage.KindDeployment: 1,
+		storage.KindRollout: 1,
+	}
+	for k, n := range want {
+		if m.Counts[k] != n {
+			t.Fatalf("export counts %d %s, want %d (all: %v)", m.Counts[k], k, n, m.Counts)
+		}
+	}
+	if m.Counts[storage.KindSession] != 0 {
+		t.Fatalf("sessions must not be exported, got %d", m.Counts[storage.KindSession])
+	}
+
+	dst := inmemory.New()
+	restored, err := New(dst, codec.New(nil)).Restore(ctx, bytes.NewReader(archive))
+	requireNoErr(t, err)
+	if restored.Revision != m.Revision || len(restored.Counts) != len(m.Counts) {
+		t.Fatalf("restore manifest %+v does not match export %+v", restored, m)
+	}
+
+	role, err := dst.GetRole(ctx, "role-admin")
+	requireNoErr(t, err)
+	if !role.PermissionHas(kind.SystemBackup) || role.Seed() != 2 {
+		t.Fatalf("role not restored as exported: perms=%v seed=%d", role.PermissionsAll(), role.Seed())
+	}
+	u, err := dst.GetUser(ctx, "u1")
+	requireNoErr(t, err)
+	if !u.RoleHas("role-admin") {
+		t.Fatalf("user lost its role")
+	}
+	v, err := dst.GetVerifierByCredential(ctx, "c1")
+	requireNoErr(t, err)
+	if h, _ := v.DataGet("hash"); h != "secret-hash" {
+		t.Fatalf("verifier data not restored, got %q", h)
+	}
+	a, err := dst.GetAgent(ctx, "a1")
+	requireNoErr(t, err)
+	if env, _ := a.Label("env"); env != "prod" {
+		t.Fatalf("agent labels not restored")
+	}
+	_, err = dst.GetSpecRevision(ctx, model.SpecRevisionID("s1", 1))
+	requireNoErr(t, err)
+	_, err = dst.GetDeployment(ctx, model.DeploymentID("s1", 1))
+	requireNoErr(t, err)
+	ro, err := dst.GetRollout(ctx, model.RolloutID("s1", "a1"))
+	requireNoErr(t, err)
+	if ro.Status() != kind.SyncStatusSynced || ro.ActualVersion() != 1 {
+		t.Fatalf("rollout not restored as exported: %s v%d", ro.Status(), ro.ActualVersion())
+	}
+
+	if _, err = dst.GetSession(ctx, sessionID); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("sessions must not be restored, got %v", err)
+	}
+}
+
+func TestRestore_RejectsDamagedArchives(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	src := inmemory.New()
+	seed(t, ctx, src)
+	_, archive := export(t, ctx, src)
+
+	lines := strings.SplitAfter(strings.TrimSuffix(string(archive), "\n"), "\n")
+	var (
+		header  = lines[0]
+		body    = strings.Join(lines[1:len(lines)-1], "")
+		trailer = lines[len(lines)-1]
+	)
+	cases := []struct {
+		name    string
+		archive string
+	}{
+		{"empty", ""},
+		{"bad header", "{not json\n" + body + trailer},
+		{"other version", strings.Replace(header, `"version":1`, `"version":99`, 1) + body + trailer},
+		{"truncated", header + body},
+		{"truncated mid-entity", header + body[:len(body)/2]},
+		{"trailer count mismatch", header + body + `{"end":true,"count":1}` + "\n"},
+		{"data after trailer", header + body + trailer + "\n" + lines[1]},
+		{"unknown kind", header + `{"kind":"widget","data":{}}` + "\n" + `{"end":true,"count":1}` + "\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			dst := inmemory.New()
+			_, err := New(dst, codec.New(nil)).Restore(ctx, strings.NewReader(tc.archive))
+			if !errors.Is(err, storage.ErrInvalidArgument) {
+				t.Fatalf("expected ErrInvalidArgument, got %v", err)
+			}
+			res, err := dst.ListRoles(ctx, nil, storage.ListOptions{Limit: 1})
+			requireNoErr(t, err)
+			if len(res.Items) != 0 {
+				t.Fatalf("a rejected archive must write nothing")
+			}
+		})
+	}
+}
+
+func TestRestore_RefusesNonEmptyStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	src := inmemory.New()
+	seed(t, ctx, src)
+	_, archive := export(t, ctx, src)
+
+	dst := inmemory.New()
+	a, err := model.NewAgent("existing", "existing", "http://existing")
+	requireNoErr(t, err)
+	requireNoErr(t, dst.UpsertAgent(ctx, a))
+
+	if _, err = New(dst, codec.New(nil)).Restore(ctx, bytes.NewReader(archive)); !errors.Is(err, storage.ErrAlreadyExists) {
+		t.Fatalf("expected ErrAlreadyExists, got %v", err)
+	}
+	if _, err = dst.GetRole(ctx, "role-admin"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("a refused restore must write nothing, got %v", err)
+	}
+}
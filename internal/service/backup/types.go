@@ -0,0 +1,52 @@
+package backup
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+const (
+	// Format identifies a backup archive in its header line.
+	Format = "lighthouse-backup"
+	// Version is the archive layout written by Export. Restore rejects other versions.
+	Version = 1
+
+	// maxLineSize bounds a single archive line (one encoded entity).
+	maxLineSize = 16 << 20
+)
+
+// Manifest is the header line of an archive.
+//
+// Archive layout (one JSON document per line):
+//
+//	{"format":"lighthouse-backup","version":1,"created_at":…,"revision":…}
+//	{"kind":"role","data":{…}}
+//	…
+//	{"end":true,"count":N}
+//
+// Entity data is the codec form shared with the persistent backends, so an archive
+// taken from one backend restores into any other.
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Revision is the store revision the archive is consistent with.
+	Revision uint64 `json:"revision"`
+
+	// Counts is the number of entities per kind; computed, not stored in the header.
+	Counts map[storage.Kind]int `json:"-"`
+}
+
+// entry is one entity line of an archive.
+type entry struct {
+	Kind storage.Kind    `json:"kind"`
+	Data json.RawMessage `json:"data"`
+}
+
+// trailer is the last line of an archive; its absence means the archive is truncated.
+type trailer struct {
+	End   bool `json:"end"`
+	Count int  `json:"count"`
+}
@@ -76,19 +76,21 @@ func (s *Service) Get(ctx context.Context, id string) (*model.Credential, error)
 	return c.Clone(), nil
 }
 
-// Delete removes a credential by ID and cascades verifier deletion.
+// Delete removes a credential by ID and cascades verifier deletion in one transaction.
 func (s *Service) Delete(ctx context.Context, req DeleteRequest) error {
 	if req.ID == "" {
 		return storage.ErrInvalidArgument
 	}
 
-	if err := s.store.DeleteVerifierByCredential(ctx, req.ID); err != nil {
-		return err
-	}
-	if err := s.store.DeleteCredential(ctx, req.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
-		return err
-	}
-	return nil
+	return s.store.InTx(ctx, func(tx storage.Tx) error {
+		if err := tx.DeleteVerifierByCredential(ctx, req.ID); err != nil {
+			return err
+		}
+		if err := tx.DeleteCredential(ctx, req.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		return nil
+	})
 }
 
 // SetPassword creates or replaces password auth material for a user.
@@ -123,20 +125,19 @@ func (s *Service) SetPassword(ctx context.Context, req SetPasswordRequest) error
 	if err != nil {
 		return storage.ErrInvalidArgument
 	}
-	if err = s.store.UpsertCredential(ctx, cred); err != nil {
-		return err
-	}
-
+	// Hash outside the transaction: it is slow and the transaction holds the store.
 	ver, err := authcred.NewPasswordVerifier(req.VerifierID, credID, req.Password, req.Cost)
 	if err != nil {
 		return err
 	}
 
-	if err = s.store.DeleteVerifierByCredential(ctx, credID); err != nil {
-		return err
-	}
-	if err = s.store.UpsertVerifier(ctx, ver); err != nil {
-		return err
-	}
-	return nil
+	return s.store.InTx(ctx, func(tx storage.Tx) error {
+		if err := tx.UpsertCredential(ctx, cred); err != nil {
+			return err
+		}
+		if err := tx.DeleteVerifierByCredential(ctx, credID); err != nil {
+			return err
+		}
+		return tx.UpsertVerifier(ctx, ver)
+	})
 }
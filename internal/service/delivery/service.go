@@ -0,0 +1,279 @@
+// Package delivery implements pull-based spec delivery for agents the control plane cannot dial:
+//   - Acknowledgment of the versions an agent reports on discovery sync (synced, drift, removed)
+//   - The agent's desired task set as a versioned bundle, returned in the sync response
+//   - Rollout health from the task events of agent streams.
+package delivery
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/proxy"
+	"github.com/soltiHQ/control-plane/internal/service"
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+// Service provides pull-based delivery operations.
+type Service struct {
+	store storage.Storage
+}
+
+// New creates a new delivery service.
+func New(store storage.Storage) *Service {
+	if store == nil {
+		panic("delivery.Service: store is nil")
+	}
+	return &Service{store: store}
+}
+
+// Sync acknowledges a pull-mode agent's report and returns its desired state.
+//
+// The report settles the agent's rollouts the way a push would:
+//
+//	pending / drift / failed, slot applied at the desired version  → synced
+//	synced, slot missing or at another version                     → drift
+//	synced, latest task running or succeeded                       → healthy (once)
+//	removing, slot missing                                         → removed (deleted if the spec is gone)
+//
+// The desired state holds the deliverable rollouts (pending, drift or failed, with an active
+// deployment) at their desired version, the other rollouts the agent runs at their actual
+// version, and the slots still to remove. It is sent in full until the agent has its revision
+// and has confirmed every delivery and removal in it; deliverable rollouts sent are recorded
+// as pushed.
+//
+// The desired state is computed from reads of the agent's rollouts; a transaction is opened
+// only to write the rollouts that changed, conditional on the versions read.
+func (s *Service) Sync(ctx context.Context, r Report) (*Desired, error) {
+	if r.AgentID == "" {
+		return nil, storage.ErrInvalidArgument
+	}
+
+	applied := make(map[string]AppliedTask, len(r.Applied))
+	for _, a := range r.Applied {
+		applied[a.Slot] = a
+	}
+
+	var out *Desired
+	err := service.RetryOnConflict(ctx, func() error {
+		var err error
+		out, err = s.sync(ctx, r, applied)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// sync runs one attempt of Sync.
+func (s *Service) sync(ctx context.Context, r Report, applied map[string]AppliedTask) (*Desired, error) {
+	rollouts, err := s.store.ListRolloutsByAgent(ctx, r.AgentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		specs   = make(map[string]*model.Spec)
+		active  = make(map[string]bool)
+		changed = make(map[string]*model.Rollout)
+		deleted []string
+		pushed  []*model.Rollout
+		tasks   []proxy.TaskSubmission
+		remove  []string
+	)
+	for _, ss := range rollouts {
+		ts, err := cachedSpec(ctx, s.store, specs, ss.SpecID())
+		if err != nil {
+			return nil, err
+		}
+
+		if ss.Status() == kind.SyncStatusRemoving {
+			_, running := applied[ss.Slot()]
+			switch {
+			case running:
+				remove = append(remove, ss.Slot())
+			case ts == nil:
+				deleted = append(deleted, ss.ID())
+			default:
+				ss.MarkRemoved()
+				changed[ss.ID()] = ss
+			}
+			continue
+		}
+		if ts == nil {
+			// Deleted specs take their rollouts with them.
+			continue
+		}
+
+		a, running := applied[ts.Slot()]
+		if ack(ss, a, running) {
+			changed[ss.ID()] = ss
+		}
+
+		var version int
+		if deliverable(ss) {
+			ok, err := storage.DeploymentActive(ctx, s.store, active, ss)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				version = ss.DesiredVersion()
+				pushed = append(pushed, ss)
+			}
+		}
+		if version == 0 && ss.RunsOnAgent() {
+			version = ss.ActualVersion()
+		}
+		if version == 0 {
+			continue
+		}
+		content, err := storage.SpecAt(ctx, s.store, ts, version)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			// A version whose content is gone is left out: the agent keeps what it runs in the slot.
+		case err != nil:
+			return nil, err
+		default:
+			tasks = append(tasks, proxy.TaskSubmission{Spec: content.ToCreateSpec(), Version: version})
+		}
+	}
+
+	b := proxy.NewTaskBundle(tasks, remove)
+	out := &Desired{Bundle: b, Changed: b.Revision != r.Revision || len(pushed) > 0 || len(remove) > 0}
+	if out.Changed {
+		now := time.Now()
+		for _, ss := range pushed {
+			ss.SetLastPushedAt(now)
+			changed[ss.ID()] = ss
+		}
+	} else {
+		out.Bundle = proxy.TaskBundle{Revision: b.Revision}
+	}
+
+	if len(changed) == 0 && len(deleted) == 0 {
+		return out, nil
+	}
+	err = s.store.InTx(ctx, func(tx storage.Tx) error {
+		for _, id := range deleted {
+			if err := tx.DeleteRollout(ctx, id); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+		}
+		for _, ss := range changed {
+			if err := tx.UpsertRollout(ctx, ss); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TaskEvent records a task state change reported on an agent stream: the agent's synced rollout
+// of the slot is marked healthy (once) when the task runs or succeeded, as the wave runner does
+// after ListTasks. Other events change nothing, and write nothing.
+func (s *Service) TaskEvent(ctx context.Context, agentID, slot, status string) error {
+	if agentID == "" || slot == "" {
+		return storage.ErrInvalidArgument
+	}
+	if !healthy(status) {
+		return nil
+	}
+
+	return service.RetryOnConflict(ctx, func() error {
+		rollouts, err := s.store.ListRolloutsByAgent(ctx, agentID)
+		if err != nil {
+			return err
+		}
+
+		var (
+			specs  = make(map[string]*model.Spec)
+			marked []*model.Rollout
+		)
+		for _, ss := range rollouts {
+			if ss.Status() != kind.SyncStatusSynced || !ss.HealthyAt().IsZero() {
+				continue
+			}
+			ts, err := cachedSpec(ctx, s.store, specs, ss.SpecID())
+			if err != nil {
+				return err
+			}
+			if ts == nil || ts.Slot() != slot {
+				continue
+			}
+			ss.MarkHealthy()
+			marked = append(marked, ss)
+		}
+		if len(marked) == 0 {
+			return nil
+		}
+
+		return s.store.InTx(ctx, func(tx storage.Tx) error {
+			for _, ss := range marked {
+				if err := tx.UpsertRollout(ctx, ss); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// ack applies the agent's report for the rollout's slot (running is false if the slot is
+// not reported) and reports whether the rollout changed.
+func ack(ss *model.Rollout, a AppliedTask, running bool) bool {
+	switch ss.Status() {
+	case kind.SyncStatusPending, kind.SyncStatusDrift, kind.SyncStatusFailed, kind.SyncStatusUnknown:
+		if !running || a.Version != ss.DesiredVersion() {
+			return false
+		}
+		ss.MarkSynced(a.Version)
+	case kind.SyncStatusSynced:
+		if !running || a.Version != ss.ActualVersion() {
+			ss.MarkDrift()
+			return true
+		}
+		if !ss.HealthyAt().IsZero() || !healthy(a.Status) {
+			return false
+		}
+	default:
+		return false
+	}
+	if ss.HealthyAt().IsZero() && healthy(a.Status) {
+		ss.MarkHealthy()
+	}
+	return true
+}
+
+func healthy(status string) bool { return status == "running" || status == "succeeded" }
+
+// deliverable reports whether the rollout's desired version still has to reach the agent.
+func deliverable(ss *model.Rollout) bool {
+	switch ss.Status() {
+	case kind.SyncStatusPending, kind.SyncStatusDrift, kind.SyncStatusFailed:
+		return true
+	}
+	return false
+}
+
+// cachedSpec returns a spec by ID, nil if it was deleted.
+func cachedSpec(ctx context.Context, st storage.SpecStore, cache map[string]*model.Spec, id string) (*model.Spec, error) {
+	if ts, ok := cache[id]; ok {
+		return ts, nil
+	}
+	ts, err := st.GetSpec(ctx, id)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		ts = nil
+	case err != nil:
+		return nil, err
+	}
+	cache[id] = ts
+	return ts, nil
+}
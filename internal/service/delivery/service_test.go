@@ -0,0 +1,250 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	specsvc "github.com/soltiHQ/control-plane/internal/service/spec"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+func mkDeployed(t *testing.T, ctx context.Context, st storage.Storage, id, slot string, targets ...string) *specsvc.Service {
+	t.Helper()
+	ts, err := model.NewSpec(id, id, slot)
+	if err != nil {
+		t.Fatalf("NewSpec: %v", err)
+	}
+	ts.SetKindConfig(map[string]any{"command": "sleep"})
+	ts.SetTargets(targets)
+
+	svc := specsvc.New(st)
+	if err = svc.Create(ctx, ts, "tester"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err = svc.Deploy(ctx, id, "tester"); err != nil {
+		t.Fatalf("Deploy: %v", err)
+	}
+	return svc
+}
+
+func mustRollout(t *testing.T, ctx context.Context, st storage.Storage, specID, agentID string) *model.Rollout {
+	t.Helper()
+	ss, err := st.GetRollout(ctx, model.RolloutID(specID, agentID))
+	if err != nil {
+		t.Fatalf("GetRollout(%s, %s): %v", specID, agentID, err)
+	}
+	return ss
+}
+
+func mustSync(t *testing.T, ctx context.Context, svc *Service, r Report) *Desired {
+	t.Helper()
+	out, err := svc.Sync(ctx, r)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	return out
+}
+
+func TestSync_RejectsEmptyAgentID(t *testing.T) {
+	t.Parallel()
+
+	svc := New(inmemory.New())
+	if _, err := svc.Sync(context.Background(), Report{}); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument, got %v", err)
+	}
+}
+
+func TestSync_UnknownAgent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svc := New(inmemory.New())
+
+	first := mustSync(t, ctx, svc, Report{AgentID: "ghost"})
+	if !first.Changed || first.Bundle.Revision == "" {
+		t.Fatalf("first sync must send a revision, got %+v", first)
+	}
+	if len(first.Bundle.Tasks) != 0 || len(first.Bundle.Remove) != 0 {
+		t.Fatalf("unknown agent must get an empty bundle, got %+v", first.Bundle)
+	}
+
+	again := mustSync(t, ctx, svc, Report{AgentID: "ghost", Revision: first.Bundle.Revision})
+	if again.Changed {
+		t.Fatalf("expected unchanged once the revision is confirmed, got %+v", again)
+	}
+}
+
+func TestSync_DeliversAndAcknowledges(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mkDeployed(t, ctx, st, "s1", "job", "a1")
+	svc := New(st)
+
+	sent := mustSync(t, ctx, svc, Report{AgentID: "a1"})
+	if !sent.Changed || len(sent.Bundle.Tasks) != 1 || sent.Bundle.Tasks[0].Version != 1 {
+		t.Fatalf("expected the deployed version in the bundle, got %+v", sent.Bundle)
+	}
+	ss := mustRollout(t, ctx, st, "s1", "a1")
+	if ss.Status() != kind.SyncStatusPending || ss.LastPushedAt().IsZero() {
+		t.Fatalf("expected pending rollout recorded as pushed, got %s pushed=%v", ss.Status(), ss.LastPushedAt())
+	}
+
+	// Same revision, but the delivery is not confirmed yet: still sent.
+	unconfirmed := mustSync(t, ctx, svc, Report{AgentID: "a1", Revision: sent.Bundle.Revision})
+	if !unconfirmed.Changed || len(unconfirmed.Bundle.Tasks) != 1 {
+		t.Fatalf("expected resend while unconfirmed, got %+v", unconfirmed)
+	}
+
+	acked := mustSync(t, ctx, svc, Report{
+		AgentID:  "a1",
+		Revision: sent.Bundle.Revision,
+		Applied:  []AppliedTask{{Slot: "job", Version: 1, Status: "running"}},
+	})
+	if acked.Changed {
+		t.Fatalf("expected unchanged after acknowledgment, got %+v", acked)
+	}
+	if acked.Bundle.Revision != sent.Bundle.Revision || len(acked.Bundle.Tasks) != 0 {
+		t.Fatalf("unchanged bundle must carry only the revision, got %+v", acked.Bundle)
+	}
+	ss = mustRollout(t, ctx, st, "s1", "a1")
+	if ss.Status() != kind.SyncStatusSynced || ss.ActualVersion() != 1 || ss.HealthyAt().IsZero() {
+		t.Fatalf("expected synced healthy v1, got %s v%d healthy=%v", ss.Status(), ss.ActualVersion(), ss.HealthyAt())
+	}
+}
+
+func TestSync_RevisionMismatchResendsState(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mkDeployed(t, ctx, st, "s1", "job", "a1")
+	svc := New(st)
+
+	applied := []AppliedTask{{Slot: "job", Version: 1, Status: "running"}}
+	first := mustSync(t, ctx, svc, Report{AgentID: "a1", Applied: applied})
+	if !first.Changed {
+		t.Fatalf("expected first sync to be changed")
+	}
+
+	stale := mustSync(t, ctx, svc, Report{AgentID: "a1", Revision: "stale", Applied: applied})
+	if !stale.Changed || stale.Bundle.Revision != first.Bundle.Revision || len(stale.Bundle.Tasks) != 1 {
+		t.Fatalf("expected the full state for a stale revision, got %+v", stale)
+	}
+
+	rv := mustRollout(t, ctx, st, "s1", "a1").ResourceVersion()
+	same := mustSync(t, ctx, svc, Report{AgentID: "a1", Revision: first.Bundle.Revision, Applied: applied})
+	if same.Changed {
+		t.Fatalf("expected unchanged for the current revision, got %+v", same)
+	}
+	if got := mustRollout(t, ctx, st, "s1", "a1").ResourceVersion(); got != rv {
+		t.Fatalf("a confirmed sync must not write the rollout: version %d → %d", rv, got)
+	}
+}
+
+func TestSync_MarksDrift(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mkDeployed(t, ctx, st, "s1", "job", "a1")
+	svc := New(st)
+
+	mustSync(t, ctx, svc, Report{AgentID: "a1", Applied: []AppliedTask{{Slot: "job", Version: 1}}})
+	if got := mustRollout(t, ctx, st, "s1", "a1").Status(); got != kind.SyncStatusSynced {
+		t.Fatalf("expected synced, got %s", got)
+	}
+
+	out := mustSync(t, ctx, svc, Report{AgentID: "a1", Applied: []AppliedTask{{Slot: "job", Version: 7}}})
+	if got := mustRollout(t, ctx, st, "s1", "a1").Status(); got != kind.SyncStatusDrift {
+		t.Fatalf("expected drift, got %s", got)
+	}
+	if !out.Changed || len(out.Bundle.Tasks) != 1 || out.Bundle.Tasks[0].Version != 1 {
+		t.Fatalf("expected the desired version redelivered, got %+v", out.Bundle)
+	}
+}
+
+func TestSync_Removals(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	specs := mkDeployed(t, ctx, st, "s1", "job", "a1")
+	svc := New(st)
+
+	running := []AppliedTask{{Slot: "job", Version: 1, Status: "running"}}
+	mustSync(t, ctx, svc, Report{AgentID: "a1", Applied: running})
+	if err := specs.Undeploy(ctx, "s1", "tester"); err != nil {
+		t.Fatalf("Undeploy: %v", err)
+	}
+
+	out := mustSync(t, ctx, svc, Report{AgentID: "a1", Applied: running})
+	if !out.Changed || len(out.Bundle.Tasks) != 0 || len(out.Bundle.Remove) != 1 || out.Bundle.Remove[0] != "job" {
+		t.Fatalf("expected the slot to remove, got %+v", out.Bundle)
+	}
+	// Confirmed revision, slot still running: the removal is sent again.
+	if again := mustSync(t, ctx, svc, Report{AgentID: "a1", Revision: out.Bundle.Revision, Applied: running}); !again.Changed {
+		t.Fatalf("expected the removal resent until confirmed")
+	}
+
+	mustSync(t, ctx, svc, Report{AgentID: "a1", Revision: out.Bundle.Revision})
+	if got := mustRollout(t, ctx, st, "s1", "a1").Status(); got != kind.SyncStatusRemoved {
+		t.Fatalf("expected removed, got %s", got)
+	}
+}
+
+func TestSync_RemovalOfDeletedSpecDeletesRollout(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	specs := mkDeployed(t, ctx, st, "s1", "job", "a1")
+	svc := New(st)
+
+	running := []AppliedTask{{Slot: "job", Version: 1}}
+	mustSync(t, ctx, svc, Report{AgentID: "a1", Applied: running})
+	if err := specs.Delete(ctx, "s1", true); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	out := mustSync(t, ctx, svc, Report{AgentID: "a1", Applied: running})
+	if len(out.Bundle.Remove) != 1 {
+		t.Fatalf("expected the slot of the deleted spec to remove, got %+v", out.Bundle)
+	}
+	mustSync(t, ctx, svc, Report{AgentID: "a1"})
+	if _, err := st.GetRollout(ctx, model.RolloutID("s1", "a1")); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected the rollout deleted, got %v", err)
+	}
+}
+
+func TestTaskEvent_MarksSyncedRolloutHealthy(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mkDeployed(t, ctx, st, "s1", "job", "a1")
+	svc := New(st)
+
+	mustSync(t, ctx, svc, Report{AgentID: "a1", Applied: []AppliedTask{{Slot: "job", Version: 1, Status: "pending"}}})
+	if !mustRollout(t, ctx, st, "s1", "a1").HealthyAt().IsZero() {
+		t.Fatalf("rollout must not be healthy yet")
+	}
+
+	if err := svc.TaskEvent(ctx, "a1", "other", "running"); err != nil {
+		t.Fatalf("TaskEvent: %v", err)
+	}
+	if !mustRollout(t, ctx, st, "s1", "a1").HealthyAt().IsZero() {
+		t.Fatalf("an event of another slot must not mark the rollout healthy")
+	}
+	if err := svc.TaskEvent(ctx, "a1", "job", "succeeded"); err != nil {
+		t.Fatalf("TaskEvent: %v", err)
+	}
+	if mustRollout(t, ctx, st, "s1", "a1").HealthyAt().IsZero() {
+		t.Fatalf("expected the rollout healthy")
+	}
+}
@@ -0,0 +1,30 @@
+package delivery
+
+import "github.com/soltiHQ/control-plane/internal/proxy"
+
+// Report is what a pull-mode agent states on a discovery sync.
+//
+// Applied lists every slot the agent runs; a slot missing from it is not running.
+// Revision is the revision of the last desired state the agent received ("" on first sync).
+type Report struct {
+	AgentID  string
+	Revision string
+	Applied  []AppliedTask
+}
+
+// AppliedTask is one slot running on the agent, with the control-plane version it applied
+// and the status of its latest task ("" if unknown).
+type AppliedTask struct {
+	Slot    string
+	Version int
+	Status  string
+}
+
+// Desired is the desired state of an agent after a report was acknowledged.
+//
+// Bundle is in the ApplyBundle format; when Changed is false the agent already runs
+// Bundle.Revision as confirmed and Bundle carries no tasks or removals.
+type Desired struct {
+	Bundle  proxy.TaskBundle
+	Changed bool
+}
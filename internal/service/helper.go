@@ -1,6 +1,14 @@
 package service
 
-import "github.com/soltiHQ/control-plane/internal/storage"
+import (
+	"context"
+	"errors"
+
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+// conflictRetries bounds the number of attempts made by RetryOnConflict.
+const conflictRetries = 5
 
 // NormalizeListLimit clamps the requested page size to a safe range.
 //
@@ -15,3 +23,20 @@ func NormalizeListLimit(qlimit, dlimit int) int {
 	}
 	return qlimit
 }
+
+// RetryOnConflict runs fn until it returns anything but [storage.ErrConflict], up to a fixed number of attempts.
+//
+// fn must re-read the entities it writes so that every attempt starts from the current stored state.
+// The last conflict is returned when attempts are exhausted.
+func RetryOnConflict(ctx context.Context, fn func() error) error {
+	var err error
+	for range conflictRetries {
+		if err = fn(); !errors.Is(err, storage.ErrConflict) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
@@ -1,14 +1,22 @@
 // Package spec implements task spec management use-cases:
 //   - Paginated listing and retrieval
 //   - Creation, update with version increment, and deletion
-//   - Deployment (rollout creation for target agents)
+//   - Revision history and rollback to an earlier version
+//   - Deployment (rollout creation for explicit and label-selected target agents)
+//     with a dry-run plan and pause, resume and abort controls
+//   - Undeploy (task removal from agents), optionally cascaded from deletion
+//   - Manual retry of failed and exhausted rollouts
 //   - Rollout querying by spec.
 package spec
 
 import (
 	"context"
+	"errors"
+	"sort"
 
+	"github.com/soltiHQ/control-plane/domain/kind"
 	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/domain/selector"
 	"github.com/soltiHQ/control-plane/internal/service"
 	"github.com/soltiHQ/control-plane/internal/storage"
 )
@@ -61,36 +69,177 @@ func (s *Service) Get(ctx context.Context, id string) (*model.Spec, error) {
 	return ts.Clone(), nil
 }
 
-// Create persists a new spec.
-func (s *Service) Create(ctx context.Context, ts *model.Spec) error {
+// Create persists a new spec and records its first revision; author is the subject making the change.
+func (s *Service) Create(ctx context.Context, ts *model.Spec, author string) error {
 	if ts == nil {
 		return storage.ErrInvalidArgument
 	}
-	return s.store.UpsertSpec(ctx, ts)
+	return s.store.InTx(ctx, func(tx storage.Tx) error {
+		if err := tx.UpsertSpec(ctx, ts); err != nil {
+			return err
+		}
+		return recordRevision(ctx, tx, ts, author)
+	})
 }
 
-// Upsert persists changes to an existing task spec and increments its version.
-func (s *Service) Upsert(ctx context.Context, ts *model.Spec) error {
+// Upsert persists changes to an existing task spec, increments its version and records
+// the new revision; author is the subject making the change.
+//
+// The write is conditional on ts.ResourceVersion (see [storage.SpecStore.UpsertSpec]);
+// storage.ErrConflict means the spec was modified since it was read.
+func (s *Service) Upsert(ctx context.Context, ts *model.Spec, author string) error {
 	if ts == nil {
 		return storage.ErrInvalidArgument
 	}
+	return s.store.InTx(ctx, func(tx storage.Tx) error {
+		current, err := tx.GetSpec(ctx, ts.ID())
+		if err != nil {
+			return err
+		}
+		if err = recordBaseRevision(ctx, tx, current); err != nil {
+			return err
+		}
 
-	if _, err := s.store.GetSpec(ctx, ts.ID()); err != nil {
-		return err
-	}
-	ts.IncrementVersion()
-	return s.store.UpsertSpec(ctx, ts)
+		ts.IncrementVersion()
+		if err = tx.UpsertSpec(ctx, ts); err != nil {
+			return err
+		}
+		return recordRevision(ctx, tx, ts, author)
+	})
 }
 
-// Delete removes a task spec and all associated rollouts.
-func (s *Service) Delete(ctx context.Context, id string) error {
+// Delete removes a task spec with all associated rollouts, revisions and deployments in one transaction.
+//
+// With undeploy, rollouts whose task may run on an agent are kept and marked removing instead:
+// the sync runner removes the task and then deletes the rollout. Without it, agents keep
+// running the task.
+func (s *Service) Delete(ctx context.Context, id string, undeploy bool) error {
 	if id == "" {
 		return storage.ErrInvalidArgument
 	}
-	if err := s.store.DeleteRolloutsBySpec(ctx, id); err != nil {
+	return s.store.InTx(ctx, func(tx storage.Tx) error {
+		if undeploy {
+			ts, err := tx.GetSpec(ctx, id)
+			if err != nil {
+				return err
+			}
+			if err = undeployRollouts(ctx, tx, ts, true); err != nil {
+				return err
+			}
+		} else if err := tx.DeleteRolloutsBySpec(ctx, id); err != nil {
+			return err
+		}
+		if err := tx.DeleteSpecRevisionsBySpec(ctx, id); err != nil {
+			return err
+		}
+		if err := tx.DeleteDeploymentsBySpec(ctx, id); err != nil {
+			return err
+		}
+		return tx.DeleteSpec(ctx, id)
+	})
+}
+
+// Revisions returns the revision history of a spec, newest first.
+//
+// Each entry carries the content changes against the version before it; the oldest
+// recorded revision has none. Specs created before revisions were recorded start their
+// history at the version they had when first edited.
+func (s *Service) Revisions(ctx context.Context, specID string) ([]Revision, error) {
+	if specID == "" {
+		return nil, storage.ErrInvalidArgument
+	}
+	if _, err := s.store.GetSpec(ctx, specID); err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.store.ListSpecRevisionsBySpec(ctx, specID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Version() < revisions[j].Version() })
+
+	out := make([]Revision, len(revisions))
+	var prev *model.Spec
+	for i, rev := range revisions {
+		cur, err := rev.Spec()
+		if err != nil {
+			return nil, err
+		}
+		entry := Revision{Revision: rev.Clone()}
+		if prev != nil {
+			entry.Changes = model.DiffSpecs(prev, cur)
+		}
+		out[len(revisions)-1-i] = entry
+		prev = cur
+	}
+	return out, nil
+}
+
+// Rollback restores the content of revision to as a new version of the spec and deploys it.
+//
+// The restored version gets its own revision (authored by author), so a rollback can itself
+// be rolled back. Everything happens in one transaction, see [Service.Deploy].
+// Returns storage.ErrNotFound if the spec or the revision does not exist.
+func (s *Service) Rollback(ctx context.Context, specID string, to int, author string) (*model.Spec, error) {
+	if specID == "" || to < 1 {
+		return nil, storage.ErrInvalidArgument
+	}
+
+	var out *model.Spec
+	err := s.store.InTx(ctx, func(tx storage.Tx) error {
+		ts, err := tx.GetSpec(ctx, specID)
+		if err != nil {
+			return err
+		}
+		rev, err := tx.GetSpecRevision(ctx, model.SpecRevisionID(specID, to))
+		if err != nil {
+			return err
+		}
+		old, err := rev.Spec()
+		if err != nil {
+			return err
+		}
+		if err = recordBaseRevision(ctx, tx, ts); err != nil {
+			return err
+		}
+
+		ts.SetContent(old)
+		ts.IncrementVersion()
+		if err = tx.UpsertSpec(ctx, ts); err != nil {
+			return err
+		}
+		if err = recordRevision(ctx, tx, ts, author); err != nil {
+			return err
+		}
+		if err = deploy(ctx, tx, ts, author); err != nil {
+			return err
+		}
+		out = ts.Clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// recordRevision stores the current content of ts as its revision.
+func recordRevision(ctx context.Context, tx storage.Tx, ts *model.Spec, author string) error {
+	rev, err := model.NewSpecRevision(ts, author)
+	if err != nil {
 		return err
 	}
-	return s.store.DeleteSpec(ctx, id)
+	return tx.CreateSpecRevision(ctx, rev)
+}
+
+// recordBaseRevision records the stored version of ts if it has no revision yet
+// (specs created before revisions were kept), so the next change has something to diff against.
+func recordBaseRevision(ctx context.Context, tx storage.Tx, ts *model.Spec) error {
+	_, err := tx.GetSpecRevision(ctx, model.SpecRevisionID(ts.ID(), ts.Version()))
+	if errors.Is(err, storage.ErrNotFound) {
+		return recordRevision(ctx, tx, ts, "")
+	}
+	return err
 }
 
 // RolloutsBySpec returns all rollout records associated with a spec.
@@ -116,35 +265,421 @@ func (s *Service) RolloutsBySpec(ctx context.Context, specID string, filter stor
 
 // Deploy initiates distribution of a spec to all its target agents.
 //
-// For each agent in [model.Spec.Targets] the method either updates an existing rollout record or creates a new one,
-// setting status to pending with the current spec version.
+// The targets are the agents listed in [model.Spec.Targets] plus every current agent whose labels
+// match [model.Spec.TargetLabels] (all pairs must match; an empty map selects no agent by label).
+// For each target the method either updates an existing rollout record or creates a new one,
+// setting status to pending with the current spec version. All rollouts are written in one transaction:
+// either every target is marked or none is.
+//
+// With a progressive [model.Spec.Strategy] only the first wave is marked pending; the other
+// targets are marked waiting with their wave number and released by the wave runner.
+//
+// The deployed version is recorded on the spec and tracked by an active [model.Deployment]
+// (actor is the subject deploying); from then on the reconcile runner keeps the label-selected
+// targets in line with the fleet. The sync runner will later pick up pending rollouts and push
+// the spec payload to the agents.
+func (s *Service) Deploy(ctx context.Context, specID string, actor string) error {
+	return s.store.InTx(ctx, func(tx storage.Tx) error {
+		ts, err := tx.GetSpec(ctx, specID)
+		if err != nil {
+			return err
+		}
+		return deploy(ctx, tx, ts, actor)
+	})
+}
+
+// PlanDeploy returns what Deploy would do right now, without writing anything: the agents
+// the spec targets with the rollout created or updated for each, the rollouts left alone,
+// and the content diff between the versions on the agents and the spec's current version.
+//
+// The plan is read without a transaction, through the spec and agent indexes, so it does not
+// hold up writers; it may be outdated by the time the spec is actually deployed.
+func (s *Service) PlanDeploy(ctx context.Context, specID string) (*DeployPlan, error) {
+	if specID == "" {
+		return nil, storage.ErrInvalidArgument
+	}
+
+	ts, err := s.store.GetSpec(ctx, specID)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := resolveTargets(ctx, s.store, ts)
+	if err != nil {
+		return nil, err
+	}
+	rollouts, err := s.store.ListRolloutsBySpec(ctx, specID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*model.Rollout, len(rollouts))
+	for _, ss := range rollouts {
+		existing[ss.AgentID()] = ss
+	}
+
+	plan := &DeployPlan{
+		Spec:     ts.Clone(),
+		Rollouts: make([]PlannedRollout, 0, len(targets)),
+		Diffs:    make(map[int][]model.SpecChange),
+	}
+	var (
+		strategy = ts.Strategy()
+		versions = make(map[int]struct{})
+	)
+	for i, agentID := range targets {
+		p := PlannedRollout{AgentID: agentID, Wave: strategy.WaveOf(i, len(targets))}
+		ss, ok := existing[agentID]
+		switch {
+		case !ok:
+			p.Action = PlanCreate
+			versions[0] = struct{}{}
+		case ss.Status() == kind.SyncStatusSynced && ss.ActualVersion() == ts.Version():
+			p.Action, p.Current = PlanUnchanged, ss.Clone()
+		default:
+			p.Action, p.Current = PlanUpdate, ss.Clone()
+			versions[ss.ActualVersion()] = struct{}{}
+		}
+		plan.Rollouts = append(plan.Rollouts, p)
+		delete(existing, agentID)
+	}
+
+	untargeted := make([]string, 0, len(existing))
+	for agentID := range existing {
+		untargeted = append(untargeted, agentID)
+	}
+	sort.Strings(untargeted)
+	for _, agentID := range untargeted {
+		plan.Rollouts = append(plan.Rollouts, PlannedRollout{
+			AgentID: agentID,
+			Action:  PlanUntargeted,
+			Current: existing[agentID].Clone(),
+		})
+	}
+
+	for v := range versions {
+		if v == ts.Version() {
+			continue
+		}
+		var from *model.Spec
+		if v > 0 {
+			rev, err := s.store.GetSpecRevision(ctx, model.SpecRevisionID(specID, v))
+			switch {
+			case err == nil:
+			case errors.Is(err, storage.ErrNotFound):
+				continue
+			default:
+				return nil, err
+			}
+			if from, err = rev.Spec(); err != nil {
+				return nil, err
+			}
+		}
+		plan.Diffs[v] = model.DiffSpecs(from, ts)
+	}
+	return plan, nil
+}
+
+// Undeploy removes the spec's task from every agent it was delivered to.
+//
+// In one transaction the spec is marked undeployed (so the reconcile runner stops targeting agents),
+// the current deployment is aborted, rollouts that never reached their agent are marked removed and
+// the others removing; the sync runner then cancels the task on each agent and marks them removed.
+// A new Deploy brings the spec back.
+func (s *Service) Undeploy(ctx context.Context, specID string, actor string) error {
+	if specID == "" {
+		return storage.ErrInvalidArgument
+	}
+	return s.store.InTx(ctx, func(tx storage.Tx) error {
+		ts, err := tx.GetSpec(ctx, specID)
+		if err != nil {
+			return err
+		}
+
+		if v := ts.DeployedVersion(); v > 0 {
+			d, err := tx.GetDeployment(ctx, model.DeploymentID(specID, v))
+			switch {
+			case err == nil:
+				if d.Abort(actor) {
+					if err = tx.UpsertDeployment(ctx, d); err != nil {
+						return err
+					}
+				}
+			case !errors.Is(err, storage.ErrNotFound):
+				return err
+			}
+		}
+
+		ts.MarkUndeployed()
+		if err = tx.UpsertSpec(ctx, ts); err != nil {
+			return err
+		}
+		return undeployRollouts(ctx, tx, ts, false)
+	})
+}
+
+// Deployment returns the deployment of the spec's deployed version.
 //
-// The sync runner will later pick up pending rollouts and push the spec payload to the agents.
-func (s *Service) Deploy(ctx context.Context, specID string) error {
+// Returns storage.ErrNotFound if the spec does not exist or was never deployed.
+func (s *Service) Deployment(ctx context.Context, specID string) (*model.Deployment, error) {
+	if specID == "" {
+		return nil, storage.ErrInvalidArgument
+	}
 	ts, err := s.store.GetSpec(ctx, specID)
+	if err != nil {
+		return nil, err
+	}
+	if ts.DeployedVersion() == 0 {
+		return nil, storage.ErrNotFound
+	}
+	d, err := s.store.GetDeployment(ctx, model.DeploymentID(specID, ts.DeployedVersion()))
+	if err != nil {
+		return nil, err
+	}
+	return d.Clone(), nil
+}
+
+// PauseDeploy suspends the current deployment: the sync runner stops pushing its rollouts
+// and the wave runner stops releasing waves until ResumeDeploy.
+//
+// Returns storage.ErrNotFound if the spec was never deployed and storage.ErrConflict
+// unless the deployment is active.
+func (s *Service) PauseDeploy(ctx context.Context, specID string, actor string) (*model.Deployment, error) {
+	return s.controlDeploy(ctx, specID, func(_ storage.Tx, d *model.Deployment) (bool, error) {
+		return d.Pause(actor), nil
+	})
+}
+
+// ResumeDeploy reactivates a paused deployment.
+//
+// Returns storage.ErrNotFound if the spec was never deployed and storage.ErrConflict
+// unless the deployment is paused.
+func (s *Service) ResumeDeploy(ctx context.Context, specID string, actor string) (*model.Deployment, error) {
+	return s.controlDeploy(ctx, specID, func(_ storage.Tx, d *model.Deployment) (bool, error) {
+		return d.Resume(actor), nil
+	})
+}
+
+// AbortDeploy stops the current deployment for good and halts its rollouts that have not
+// reached their agent yet (pending, waiting, failed, drift); synced rollouts are left as they are.
+// Only a new deploy supersedes an aborted one.
+//
+// Returns storage.ErrNotFound if the spec was never deployed and storage.ErrConflict
+// if the deployment is already aborted.
+func (s *Service) AbortDeploy(ctx context.Context, specID string, actor string) (*model.Deployment, error) {
+	return s.controlDeploy(ctx, specID, func(tx storage.Tx, d *model.Deployment) (bool, error) {
+		if !d.Abort(actor) {
+			return false, nil
+		}
+		return true, haltRollouts(ctx, tx, d, "deploy aborted")
+	})
+}
+
+// controlDeploy applies a state change to the current deployment of a spec in one transaction;
+// change reports whether the transition is allowed.
+func (s *Service) controlDeploy(ctx context.Context, specID string, change func(storage.Tx, *model.Deployment) (bool, error)) (*model.Deployment, error) {
+	if specID == "" {
+		return nil, storage.ErrInvalidArgument
+	}
+
+	var out *model.Deployment
+	err := s.store.InTx(ctx, func(tx storage.Tx) error {
+		ts, err := tx.GetSpec(ctx, specID)
+		if err != nil {
+			return err
+		}
+		if ts.DeployedVersion() == 0 {
+			return storage.ErrNotFound
+		}
+		d, err := tx.GetDeployment(ctx, model.DeploymentID(specID, ts.DeployedVersion()))
+		if err != nil {
+			return err
+		}
+
+		ok, err := change(tx, d)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return storage.ErrConflict
+		}
+		if err = tx.UpsertDeployment(ctx, d); err != nil {
+			return err
+		}
+		out = d.Clone()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Retry makes the failed and exhausted rollouts of a spec due right away with a fresh
+// attempt budget, as well as removing ones that have failed before (see [model.Rollout.Retry]);
+// with agentID, only that agent's rollout. It returns the number of rollouts retried.
+//
+// Returns storage.ErrNotFound if the spec, or the agent's rollout, does not exist.
+func (s *Service) Retry(ctx context.Context, specID, agentID string) (int, error) {
+	if specID == "" {
+		return 0, storage.ErrInvalidArgument
+	}
+
+	var n int
+	err := s.store.InTx(ctx, func(tx storage.Tx) error {
+		var rollouts []*model.Rollout
+		if agentID != "" {
+			ss, err := tx.GetRollout(ctx, model.RolloutID(specID, agentID))
+			if err != nil {
+				return err
+			}
+			rollouts = []*model.Rollout{ss}
+		} else {
+			if _, err := tx.GetSpec(ctx, specID); err != nil {
+				return err
+			}
+			var err error
+			if rollouts, err = tx.ListRolloutsBySpec(ctx, specID); err != nil {
+				return err
+			}
+		}
+
+		for _, ss := range rollouts {
+			if !ss.Retry() {
+				continue
+			}
+			if err := tx.UpsertRollout(ctx, ss); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// haltRollouts marks the rollouts of d's spec version that have not reached their agent halted.
+func haltRollouts(ctx context.Context, tx storage.Tx, d *model.Deployment, reason string) error {
+	rollouts, err := tx.ListRolloutsBySpec(ctx, d.SpecID())
 	if err != nil {
 		return err
 	}
+	for _, ss := range rollouts {
+		if ss.DesiredVersion() != d.Version() {
+			continue
+		}
+		switch ss.Status() {
+		case kind.SyncStatusExhausted:
+			if ss.Slot() != "" {
+				// A removal, not a delivery of this version.
+				continue
+			}
+			fallthrough
+		case kind.SyncStatusPending, kind.SyncStatusWaiting, kind.SyncStatusFailed, kind.SyncStatusDrift:
+			ss.MarkHalted(reason)
+			if err = tx.UpsertRollout(ctx, ss); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-	var existing *model.Rollout
-	for _, agentID := range ts.Targets() {
-		existing, err = s.store.GetRollout(ctx, model.RolloutID(specID, agentID))
-		if err == nil {
-			existing.MarkPending(ts.Version())
-			if err = s.store.UpsertRollout(ctx, existing); err != nil {
+// undeployRollouts marks the rollouts of ts removing, with the slot to remove from the agent.
+//
+// Rollouts that were never pushed have nothing to remove and are marked removed right away;
+// with drop (the spec is being deleted) they, and already removed ones, are deleted instead.
+func undeployRollouts(ctx context.Context, tx storage.Tx, ts *model.Spec, drop bool) error {
+	rollouts, err := tx.ListRolloutsBySpec(ctx, ts.ID())
+	if err != nil {
+		return err
+	}
+	for _, ss := range rollouts {
+		status := ss.Status()
+		if status == kind.SyncStatusRemoving {
+			continue
+		}
+		delivered := status != kind.SyncStatusRemoved && (ss.ActualVersion() > 0 || !ss.LastPushedAt().IsZero())
+
+		switch {
+		case delivered:
+			ss.MarkRemoving(ts.Slot())
+		case drop:
+			if err = tx.DeleteRollout(ctx, ss.ID()); err != nil {
 				return err
 			}
 			continue
+		case status == kind.SyncStatusRemoved:
+			continue
+		default:
+			ss.MarkRemoved()
+		}
+		if err = tx.UpsertRollout(ctx, ss); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		var rollout *model.Rollout
-		rollout, err = model.NewRollout(specID, agentID, ts.Version())
-		if err != nil {
+// deploy marks ts deployed at its current version, (re)starts the version's deployment
+// and points every target's rollout at it.
+func deploy(ctx context.Context, tx storage.Tx, ts *model.Spec, actor string) error {
+	ts.MarkDeployed()
+	if err := tx.UpsertSpec(ctx, ts); err != nil {
+		return err
+	}
+
+	d, err := tx.GetDeployment(ctx, model.DeploymentID(ts.ID(), ts.Version()))
+	switch {
+	case err == nil:
+		d.Restart(actor)
+	case errors.Is(err, storage.ErrNotFound):
+		if d, err = model.NewDeployment(ts.ID(), ts.Version(), actor); err != nil {
 			return err
 		}
-		if err = s.store.UpsertRollout(ctx, rollout); err != nil {
+	default:
+		return err
+	}
+	if err = tx.UpsertDeployment(ctx, d); err != nil {
+		return err
+	}
+
+	targets, err := resolveTargets(ctx, tx, ts)
+	if err != nil {
+		return err
+	}
+	strategy := ts.Strategy()
+	for i, agentID := range targets {
+		rollout, err := tx.GetRollout(ctx, model.RolloutID(ts.ID(), agentID))
+		switch {
+		case err == nil:
+		case errors.Is(err, storage.ErrNotFound):
+			if rollout, err = model.NewRollout(ts.ID(), agentID, ts.Version()); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		rollout.MarkTargeted(ts.Version(), strategy.WaveOf(i, len(targets)))
+		if err = tx.UpsertRollout(ctx, rollout); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// resolveTargets returns the targets of ts in deploy order (see model.Spec.ResolveTargets),
+// listing the agents matched by its target labels through ListAgentsBySelector.
+func resolveTargets(ctx context.Context, st storage.AgentStore, ts *model.Spec) ([]string, error) {
+	labels := ts.TargetLabels()
+	if len(labels) == 0 {
+		return ts.Targets(), nil
+	}
+	agents, err := st.ListAgentsBySelector(ctx, selector.FromLabels(labels))
+	if err != nil {
+		return nil, err
+	}
+	return ts.ResolveTargets(agents), nil
+}
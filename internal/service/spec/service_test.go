@@ -0,0 +1,428 @@
+package spec
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+func requireNoErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func mustAgent(t *testing.T, ctx context.Context, st storage.Storage, id string, labels map[string]string) {
+	t.Helper()
+	a, err := model.NewAgent(id, id, "http://"+id)
+	requireNoErr(t, err)
+	for k, v := range labels {
+		a.LabelAdd(k, v)
+	}
+	requireNoErr(t, st.UpsertAgent(ctx, a))
+}
+
+func mkSpec(t *testing.T, id string) *model.Spec {
+	t.Helper()
+	ts, err := model.NewSpec(id, id, "slot-"+id)
+	requireNoErr(t, err)
+	ts.SetKindConfig(map[string]any{"command": "sleep"})
+	return ts
+}
+
+// rolloutAgents returns the agent IDs of the rollouts of a spec, sorted.
+func rolloutAgents(t *testing.T, ctx context.Context, st storage.Storage, specID string) []string {
+	t.Helper()
+	res, err := st.ListRollouts(ctx, inmemory.NewRolloutFilter().BySpecID(specID), storage.ListOptions{Limit: storage.MaxListLimit})
+	requireNoErr(t, err)
+	out := make([]string, 0, len(res.Items))
+	for _, ss := range res.Items {
+		out = append(out, ss.AgentID())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestDeploy_MergesExplicitAndLabelTargets(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustAgent(t, ctx, st, "a1", map[string]string{"env": "prod"})
+	mustAgent(t, ctx, st, "a2", map[string]string{"env": "prod"})
+	mustAgent(t, ctx, st, "a3", map[string]string{"env": "dev"})
+
+	ts := mkSpec(t, "s1")
+	ts.SetTargets([]string{"a2", "x9"})
+	ts.SetTargetLabels(map[string]string{"env": "prod"})
+	svc := New(st)
+	requireNoErr(t, svc.Create(ctx, ts, "tester"))
+
+	got, err := resolveTargets(ctx, st, ts)
+	requireNoErr(t, err)
+	if want := []string{"a2", "x9", "a1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolveTargets = %v, want %v (explicit first, then matched, no duplicates)", got, want)
+	}
+
+	plan, err := svc.PlanDeploy(ctx, "s1")
+	requireNoErr(t, err)
+	if n := len(plan.Rollouts); n != 3 {
+		t.Fatalf("expected 3 planned rollouts, got %d", n)
+	}
+
+	requireNoErr(t, svc.Deploy(ctx, "s1", "tester"))
+	if got, want := rolloutAgents(t, ctx, st, "s1"), []string{"a1", "a2", "x9"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("rollouts for %v, want %v", got, want)
+	}
+	for _, id := range []string{"a1", "a2", "x9"} {
+		ss, err := st.GetRollout(ctx, model.RolloutID("s1", id))
+		requireNoErr(t, err)
+		if ss.Status() != kind.SyncStatusPending || ss.DesiredVersion() != 1 {
+			t.Fatalf("%s: expected pending v1, got %s v%d", id, ss.Status(), ss.DesiredVersion())
+		}
+	}
+}
+
+func TestCreateUpsert_RecordRevisions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	svc := New(st)
+	requireNoErr(t, svc.Create(ctx, mkSpec(t, "s1"), "alice"))
+
+	ts, err := svc.Get(ctx, "s1")
+	requireNoErr(t, err)
+	ts.SetKindConfig(map[string]any{"command": "echo"})
+	requireNoErr(t, svc.Upsert(ctx, ts, "bob"))
+
+	revs, err := svc.Revisions(ctx, "s1")
+	requireNoErr(t, err)
+	if len(revs) != 2 {
+		t.Fatalf("expected 2 revisions, got %d", len(revs))
+	}
+	if r := revs[0]; r.Revision.Version() != 2 || r.Revision.Author() != "bob" || len(r.Changes) == 0 {
+		t.Fatalf("expected newest v2 by bob with changes, got v%d by %q, %d changes",
+			r.Revision.Version(), r.Revision.Author(), len(r.Changes))
+	}
+	if r := revs[1]; r.Revision.Version() != 1 || r.Revision.Author() != "alice" || len(r.Changes) != 0 {
+		t.Fatalf("expected oldest v1 by alice without changes, got v%d by %q, %d changes",
+			r.Revision.Version(), r.Revision.Author(), len(r.Changes))
+	}
+	old, err := revs[1].Revision.Spec()
+	requireNoErr(t, err)
+	if got := old.KindConfig()["command"]; got != "sleep" {
+		t.Fatalf("expected revision 1 to keep its content, got command %v", got)
+	}
+}
+
+func TestUpsert_RecordsBaseRevisionOfUntrackedSpec(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	// Stored before revisions were recorded.
+	requireNoErr(t, st.UpsertSpec(ctx, mkSpec(t, "s1")))
+
+	svc := New(st)
+	ts, err := svc.Get(ctx, "s1")
+	requireNoErr(t, err)
+	requireNoErr(t, svc.Upsert(ctx, ts, "bob"))
+
+	revs, err := svc.Revisions(ctx, "s1")
+	requireNoErr(t, err)
+	if len(revs) != 2 || revs[1].Revision.Version() != 1 || revs[1].Revision.Author() != "" {
+		t.Fatalf("expected an unauthored base revision v1 under v2, got %d revisions", len(revs))
+	}
+}
+
+func TestRollback_CreatesVersionAndDeploys(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	mustAgent(t, ctx, st, "a1", nil)
+	svc := New(st)
+
+	ts := mkSpec(t, "s1")
+	ts.SetTargets([]string{"a1"})
+	requireNoErr(t, svc.Create(ctx, ts, "alice"))
+	requireNoErr(t, svc.Deploy(ctx, "s1", "alice"))
+	ts, err := svc.Get(ctx, "s1")
+	requireNoErr(t, err)
+	ts.SetKindConfig(map[string]any{"command": "echo"})
+	requireNoErr(t, svc.Upsert(ctx, ts, "alice"))
+	requireNoErr(t, svc.Deploy(ctx, "s1", "alice"))
+
+	got, err := svc.Rollback(ctx, "s1", 1, "bob")
+	requireNoErr(t, err)
+	if got.Version() != 3 || got.DeployedVersion() != 3 || got.KindConfig()["command"] != "sleep" {
+		t.Fatalf("expected v3 deployed with v1's content, got v%d deployed v%d command %v",
+			got.Version(), got.DeployedVersion(), got.KindConfig()["command"])
+	}
+
+	revs, err := svc.Revisions(ctx, "s1")
+	requireNoErr(t, err)
+	if r := revs[0].Revision; r.Version() != 3 || r.Author() != "bob" {
+		t.Fatalf("expected a v3 revision by bob, got v%d by %q", r.Version(), r.Author())
+	}
+	d, err := svc.Deployment(ctx, "s1")
+	requireNoErr(t, err)
+	if d.Version() != 3 {
+		t.Fatalf("expected the deployment of v3, got v%d", d.Version())
+	}
+	ss, err := st.GetRollout(ctx, model.RolloutID("s1", "a1"))
+	requireNoErr(t, err)
+	if ss.Status() != kind.SyncStatusPending || ss.DesiredVersion() != 3 {
+		t.Fatalf("expected the rollout pending v3, got %s v%d", ss.Status(), ss.DesiredVersion())
+	}
+}
+
+func TestRollback_UnknownRevision(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	svc := New(st)
+	requireNoErr(t, svc.Create(ctx, mkSpec(t, "s1"), "alice"))
+
+	if _, err := svc.Rollback(ctx, "s1", 7, "bob"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := svc.Rollback(ctx, "s1", 0, "bob"); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument, got %v", err)
+	}
+	ts, err := svc.Get(ctx, "s1")
+	requireNoErr(t, err)
+	if ts.Version() != 1 {
+		t.Fatalf("a failed rollback must not change the spec, got v%d", ts.Version())
+	}
+}
+
+// deployTo creates spec id targeting agents (registered on the way) and deploys it.
+func deployTo(t *testing.T, ctx context.Context, st storage.Storage, svc *Service, id string, strategy model.RolloutStrategy, agents ...string) {
+	t.Helper()
+	for _, a := range agents {
+		mustAgent(t, ctx, st, a, nil)
+	}
+	ts := mkSpec(t, id)
+	ts.SetTargets(agents)
+	ts.SetStrategy(strategy)
+	requireNoErr(t, svc.Create(ctx, ts, "tester"))
+	requireNoErr(t, svc.Deploy(ctx, id, "tester"))
+}
+
+func markSynced(t *testing.T, ctx context.Context, st storage.Storage, specID, agentID string) {
+	t.Helper()
+	ss, err := st.GetRollout(ctx, model.RolloutID(specID, agentID))
+	requireNoErr(t, err)
+	ss.MarkSynced(ss.DesiredVersion())
+	requireNoErr(t, st.UpsertRollout(ctx, ss))
+}
+
+func TestUndeploy(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	svc := New(st)
+	deployTo(t, ctx, st, svc, "s1", model.RolloutStrategy{}, "a1", "a2")
+	markSynced(t, ctx, st, "s1", "a1")
+
+	requireNoErr(t, svc.Undeploy(ctx, "s1", "tester"))
+
+	ts, err := svc.Get(ctx, "s1")
+	requireNoErr(t, err)
+	if ts.DeployedVersion() != 0 {
+		t.Fatalf("expected the spec undeployed, got deployed v%d", ts.DeployedVersion())
+	}
+	d, err := st.GetDeployment(ctx, model.DeploymentID("s1", 1))
+	requireNoErr(t, err)
+	if d.State() != kind.DeploymentAborted {
+		t.Fatalf("expected the deployment aborted, got %s", d.State())
+	}
+	delivered, err := st.GetRollout(ctx, model.RolloutID("s1", "a1"))
+	requireNoErr(t, err)
+	if delivered.Status() != kind.SyncStatusRemoving || delivered.Slot() != "slot-s1" {
+		t.Fatalf("expected the delivered rollout removing slot-s1, got %s %q", delivered.Status(), delivered.Slot())
+	}
+	never, err := st.GetRollout(ctx, model.RolloutID("s1", "a2"))
+	requireNoErr(t, err)
+	if never.Status() != kind.SyncStatusRemoved {
+		t.Fatalf("expected the never pushed rollout removed, got %s", never.Status())
+	}
+
+	// A new deploy brings the spec back.
+	requireNoErr(t, svc.Deploy(ctx, "s1", "tester"))
+	for _, id := range []string{"a1", "a2"} {
+		ss, err := st.GetRollout(ctx, model.RolloutID("s1", id))
+		requireNoErr(t, err)
+		if ss.Status() != kind.SyncStatusPending {
+			t.Fatalf("%s: expected pending after redeploy, got %s", id, ss.Status())
+		}
+	}
+}
+
+func TestDelete_Undeploy(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	svc := New(st)
+	deployTo(t, ctx, st, svc, "s1", model.RolloutStrategy{}, "a1", "a2")
+	markSynced(t, ctx, st, "s1", "a1")
+
+	requireNoErr(t, svc.Delete(ctx, "s1", true))
+
+	if _, err := st.GetSpec(ctx, "s1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected the spec deleted, got %v", err)
+	}
+	if got, want := rolloutAgents(t, ctx, st, "s1"), []string{"a1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected only the delivered rollout kept for removal, got %v", got)
+	}
+	if _, err := st.GetDeployment(ctx, model.DeploymentID("s1", 1)); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected the deployment deleted, got %v", err)
+	}
+}
+
+func TestDeploymentControls(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	svc := New(st)
+	deployTo(t, ctx, st, svc, "s1", model.RolloutStrategy{BatchSize: 1}, "a1", "a2", "a3")
+	markSynced(t, ctx, st, "s1", "a1")
+
+	var (
+		pause  = svc.PauseDeploy
+		resume = svc.ResumeDeploy
+		abort  = svc.AbortDeploy
+	)
+	steps := []struct {
+		name    string
+		control func(context.Context, string, string) (*model.Deployment, error)
+		err     error
+		state   kind.DeploymentState
+	}{
+		{"resume active", resume, storage.ErrConflict, kind.DeploymentActive},
+		{"pause", pause, nil, kind.DeploymentPaused},
+		{"pause paused", pause, storage.ErrConflict, kind.DeploymentPaused},
+		{"resume", resume, nil, kind.DeploymentActive},
+		{"pause again", pause, nil, kind.DeploymentPaused},
+		{"abort paused", abort, nil, kind.DeploymentAborted},
+		{"abort aborted", abort, storage.ErrConflict, kind.DeploymentAborted},
+		{"resume aborted", resume, storage.ErrConflict, kind.DeploymentAborted},
+	}
+	for _, step := range steps {
+		d, err := step.control(ctx, "s1", "tester")
+		if !errors.Is(err, step.err) {
+			t.Fatalf("%s: expected error %v, got %v", step.name, step.err, err)
+		}
+		if err == nil && d.State() != step.state {
+			t.Fatalf("%s: returned state %s, want %s", step.name, d.State(), step.state)
+		}
+		if d, err = svc.Deployment(ctx, "s1"); err != nil || d.State() != step.state {
+			t.Fatalf("%s: stored state %v (%v), want %s", step.name, d, err, step.state)
+		}
+	}
+
+	want := map[string]kind.SyncStatus{
+		"a1": kind.SyncStatusSynced,
+		"a2": kind.SyncStatusHalted,
+		"a3": kind.SyncStatusHalted,
+	}
+	for id, status := range want {
+		ss, err := st.GetRollout(ctx, model.RolloutID("s1", id))
+		requireNoErr(t, err)
+		if ss.Status() != status {
+			t.Fatalf("%s: expected %s after abort, got %s", id, status, ss.Status())
+		}
+	}
+
+	// Only a new deploy supersedes an aborted one.
+	requireNoErr(t, svc.Deploy(ctx, "s1", "tester"))
+	d, err := svc.Deployment(ctx, "s1")
+	requireNoErr(t, err)
+	if d.State() != kind.DeploymentActive {
+		t.Fatalf("expected a redeploy to reactivate the deployment, got %s", d.State())
+	}
+}
+
+func TestDeploymentControls_NeverDeployed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svc := New(inmemory.New())
+	requireNoErr(t, svc.Create(ctx, mkSpec(t, "s1"), "tester"))
+
+	if _, err := svc.PauseDeploy(ctx, "s1", "tester"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := svc.AbortDeploy(ctx, "missing", "tester"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestRollback_ReactivatesAbortedDeploy(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	svc := New(st)
+	deployTo(t, ctx, st, svc, "s1", model.RolloutStrategy{}, "a1")
+	_, err := svc.AbortDeploy(ctx, "s1", "tester")
+	requireNoErr(t, err)
+
+	ts, err := svc.Rollback(ctx, "s1", 1, "tester")
+	requireNoErr(t, err)
+	d, err := svc.Deployment(ctx, "s1")
+	requireNoErr(t, err)
+	if d.Version() != ts.Version() || d.State() != kind.DeploymentActive {
+		t.Fatalf("expected an active deployment of v%d, got v%d %s", ts.Version(), d.Version(), d.State())
+	}
+	ss, err := st.GetRollout(ctx, model.RolloutID("s1", "a1"))
+	requireNoErr(t, err)
+	if ss.Status() != kind.SyncStatusPending || ss.DesiredVersion() != ts.Version() {
+		t.Fatalf("expected the halted rollout pending v%d, got %s v%d", ts.Version(), ss.Status(), ss.DesiredVersion())
+	}
+}
+
+func TestPlanDeploy_Actions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	st := inmemory.New()
+	svc := New(st)
+	deployTo(t, ctx, st, svc, "s1", model.RolloutStrategy{}, "a1", "a2", "a3")
+	markSynced(t, ctx, st, "s1", "a1")
+	mustAgent(t, ctx, st, "a4", nil)
+
+	ts, err := svc.Get(ctx, "s1")
+	requireNoErr(t, err)
+	ts.SetTargets([]string{"a1", "a2", "a4"})
+	requireNoErr(t, svc.Upsert(ctx, ts, "tester"))
+	markSynced(t, ctx, st, "s1", "a2")
+
+	plan, err := svc.PlanDeploy(ctx, "s1")
+	requireNoErr(t, err)
+	got := make(map[string]PlanAction, len(plan.Rollouts))
+	for _, p := range plan.Rollouts {
+		got[p.AgentID] = p.Action
+	}
+	want := map[string]PlanAction{"a1": PlanUpdate, "a2": PlanUpdate, "a4": PlanCreate, "a3": PlanUntargeted}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("plan actions %v, want %v", got, want)
+	}
+	if _, ok := plan.Diffs[1]; !ok {
+		t.Fatalf("expected a diff from v1, got diffs for %v", plan.Diffs)
+	}
+}
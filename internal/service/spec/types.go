@@ -19,3 +19,48 @@ type Page struct {
 	Items      []*model.Spec
 	NextCursor string
 }
+
+// Revision is one entry of a spec's revision history.
+//
+// Changes lists the content differences against the previous recorded version
+// (empty for the oldest one).
+type Revision struct {
+	Revision *model.SpecRevision
+	Changes  []model.SpecChange
+}
+
+// PlanAction is what a Deploy would do with the rollout of one agent.
+type PlanAction string
+
+const (
+	// PlanCreate creates a rollout for an agent the spec was never deployed to.
+	PlanCreate PlanAction = "create"
+	// PlanUpdate points an existing rollout at the new version.
+	PlanUpdate PlanAction = "update"
+	// PlanUnchanged re-pushes the version the agent already runs.
+	PlanUnchanged PlanAction = "unchanged"
+	// PlanUntargeted leaves the rollout of an agent that is no longer targeted as it is.
+	PlanUntargeted PlanAction = "untargeted"
+)
+
+// PlannedRollout is the planned outcome of a Deploy for one agent.
+//
+// Current is the agent's rollout as it is now (nil for PlanCreate); Wave is the wave the
+// rollout would be released in (0 for PlanUntargeted).
+type PlannedRollout struct {
+	AgentID string
+	Action  PlanAction
+	Current *model.Rollout
+	Wave    int
+}
+
+// DeployPlan is the outcome of a Deploy, computed without changing anything.
+//
+// Diffs holds the content changes from each version currently confirmed on a planned agent
+// to the version being deployed, keyed by that version (0: nothing confirmed yet, every field
+// is new). Versions whose revision was not recorded have no entry.
+type DeployPlan struct {
+	Spec     *model.Spec
+	Rollouts []PlannedRollout
+	Diffs    map[int][]model.SpecChange
+}
@@ -81,41 +81,45 @@ func (s *Service) GetBySubject(ctx context.Context, subject string) (*model.User
 	return u.Clone(), nil
 }
 
-// Delete a user by ID.
+// Delete a user by ID together with its sessions, credentials and verifiers.
+//
+// Everything is removed in one transaction: a failure leaves the user intact.
 func (s *Service) Delete(ctx context.Context, id string) error {
 	if id == "" {
 		return storage.ErrInvalidArgument
 	}
 
-	if err := s.store.DeleteSessionsByUser(ctx, id); err != nil {
-		s.logger.Warn().Err(err).Str("user_id", id).Msg("delete: failed to remove sessions")
-		return err
-	}
-
-	creds, err := s.store.ListCredentialsByUser(ctx, id)
-	if err != nil {
-		s.logger.Warn().Err(err).Str("user_id", id).Msg("delete: failed to list credentials")
-		return err
-	}
-	for _, c := range creds {
-		if c == nil {
-			continue
+	return s.store.InTx(ctx, func(tx storage.Tx) error {
+		if err := tx.DeleteSessionsByUser(ctx, id); err != nil {
+			s.logger.Warn().Err(err).Str("user_id", id).Msg("delete: failed to remove sessions")
+			return err
 		}
 
-		if err = s.store.DeleteVerifierByCredential(ctx, c.ID()); err != nil {
-			s.logger.Warn().Err(err).Str("user_id", id).Str("credential_id", c.ID()).Msg("delete: failed to remove verifier")
+		creds, err := tx.ListCredentialsByUser(ctx, id)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("user_id", id).Msg("delete: failed to list credentials")
 			return err
 		}
-		if err = s.store.DeleteCredential(ctx, c.ID()); err != nil && !errors.Is(err, storage.ErrNotFound) {
-			s.logger.Warn().Err(err).Str("user_id", id).Str("credential_id", c.ID()).Msg("delete: failed to remove credential")
+		for _, c := range creds {
+			if c == nil {
+				continue
+			}
+
+			if err = tx.DeleteVerifierByCredential(ctx, c.ID()); err != nil {
+				s.logger.Warn().Err(err).Str("user_id", id).Str("credential_id", c.ID()).Msg("delete: failed to remove verifier")
+				return err
+			}
+			if err = tx.DeleteCredential(ctx, c.ID()); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				s.logger.Warn().Err(err).Str("user_id", id).Str("credential_id", c.ID()).Msg("delete: failed to remove credential")
+				return err
+			}
+		}
+		if err = tx.DeleteUser(ctx, id); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Warn().Err(err).Str("user_id", id).Msg("delete: failed to remove user record")
 			return err
 		}
-	}
-	if err = s.store.DeleteUser(ctx, id); err != nil && !errors.Is(err, storage.ErrNotFound) {
-		s.logger.Warn().Err(err).Str("user_id", id).Msg("delete: failed to remove user record")
-		return err
-	}
-	return nil
+		return nil
+	})
 }
 
 // Upsert creates or replaces a user.
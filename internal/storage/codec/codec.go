@@ -0,0 +1,263 @@
+// Package codec converts domain entities to and from their persisted form.
+//
+// Persistent backends share one on-disk representation: the JSON encoding of
+// the entity snapshot (model.AgentSnapshot, model.SpecSnapshot, …), tagged with
+// its storage.Kind. Keeping the format in one place lets backups written by one
+// backend be restored into another.
+//
+// A Codec built with a keyring additionally seals the secret fields — credential
+// secrets and verifier data — into a keyring.Envelope stored as "sealed" next to the
+// other fields; the envelope names the key it was sealed under. Records without an
+// envelope (written before encryption was enabled) still decode, and are sealed the
+// next time they are written.
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/keyring"
+)
+
+// Codec encodes and decodes entities, optionally sealing their secrets.
+//
+// The zero value and a nil *Codec store secrets in the clear, like Encode and Decode.
+type Codec struct {
+	keys *keyring.Keyring
+}
+
+// New returns a codec sealing secrets with keys; nil keys disable encryption.
+func New(keys *keyring.Keyring) *Codec {
+	return &Codec{keys: keys}
+}
+
+// plain is the codec behind the package-level Encode and Decode.
+var plain = &Codec{}
+
+// sealedCredential is the persisted form of a credential; Secrets is empty when Sealed is set.
+type sealedCredential struct {
+	model.CredentialSnapshot
+	Sealed *keyring.Envelope `json:"sealed,omitempty"`
+}
+
+// sealedVerifier is the persisted form of a verifier; Data is empty when Sealed is set.
+type sealedVerifier struct {
+	model.VerifierSnapshot
+	Sealed *keyring.Envelope `json:"sealed,omitempty"`
+}
+
+// KindOf returns the storage kind of a domain entity.
+//
+// Returns storage.ErrInvalidArgument for unsupported types.
+func KindOf(entity any) (storage.Kind, error) {
+	switch entity.(type) {
+	case *model.Agent:
+		return storage.KindAgent, nil
+	case *model.User:
+		return storage.KindUser, nil
+	case *model.Role:
+		return storage.KindRole, nil
+	case *model.Credential:
+		return storage.KindCredential, nil
+	case *model.Verifier:
+		return storage.KindVerifier, nil
+	case *model.Session:
+		return storage.KindSession, nil
+	case *model.Spec:
+		return storage.KindSpec, nil
+	case *model.SpecRevision:
+		return storage.KindSpecRevision, nil
+	case *model.Deployment:
+		return storage.KindDeployment, nil
+	case *model.Rollout:
+		return storage.KindRollout, nil
+	default:
+		return "", fmt.Errorf("%w: codec: unsupported entity %T", storage.ErrInvalidArgument, entity)
+	}
+}
+
+// Encode serializes a domain entity into its persisted form, without encryption.
+//
+// Returns storage.ErrInvalidArgument for nil or unsupported entities.
+func Encode(entity any) (storage.Kind, []byte, error) {
+	return plain.Encode(entity)
+}
+
+// Decode restores a domain entity of the given kind from its persisted form.
+//
+// The returned value is one of the model entity pointers (*model.Agent, *model.Spec, …).
+// Records with sealed secrets fail to decode, see Codec.Decode.
+// Returns storage.ErrInvalidArgument for unknown kinds and storage.ErrInternal for corrupt data.
+func Decode(k storage.Kind, data []byte) (any, error) {
+	return plain.Decode(k, data)
+}
+
+// Encode serializes a domain entity into its persisted form.
+//
+// Returns storage.ErrInvalidArgument for nil or unsupported entities and
+// storage.ErrInternal if sealing fails.
+func (c *Codec) Encode(entity any) (storage.Kind, []byte, error) {
+	k, err := KindOf(entity)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var snap any
+	switch e := entity.(type) {
+	case *model.Agent:
+		if e != nil {
+			snap = e.Snapshot()
+		}
+	case *model.User:
+		if e != nil {
+			snap = e.Snapshot()
+		}
+	case *model.Role:
+		if e != nil {
+			snap = e.Snapshot()
+		}
+	case *model.Credential:
+		if e != nil {
+			rec := sealedCredential{CredentialSnapshot: e.Snapshot()}
+			if rec.Sealed, err = c.seal(k, rec.ID, rec.Secrets); err != nil {
+				return "", nil, err
+			}
+			if rec.Sealed != nil {
+				rec.Secrets = nil
+			}
+			snap = rec
+		}
+	case *model.Verifier:
+		if e != nil {
+			rec := sealedVerifier{VerifierSnapshot: e.Snapshot()}
+			if rec.Sealed, err = c.seal(k, rec.ID, rec.Data); err != nil {
+				return "", nil, err
+			}
+			if rec.Sealed != nil {
+				rec.Data = nil
+			}
+			snap = rec
+		}
+	case *model.Session:
+		if e != nil {
+			snap = e.Snapshot()
+		}
+	case *model.Spec:
+		if e != nil {
+			snap = e.Snapshot()
+		}
+	case *model.SpecRevision:
+		if e != nil {
+			snap = e.Snapshot()
+		}
+	case *model.Deployment:
+		if e != nil {
+			snap = e.Snapshot()
+		}
+	case *model.Rollout:
+		if e != nil {
+			snap = e.Snapshot()
+		}
+	}
+	if snap == nil {
+		return "", nil, storage.ErrInvalidArgument
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: codec: encode %s: %v", storage.ErrInternal, k, err)
+	}
+	return k, data, nil
+}
+
+// Decode restores a domain entity of the given kind from its persisted form.
+//
+// The returned value is one of the model entity pointers (*model.Agent, *model.Spec, …).
+// Returns storage.ErrInvalidArgument for unknown kinds and storage.ErrInternal for corrupt
+// data or sealed secrets that cannot be opened (no keyring, unknown key, failed authentication).
+func (c *Codec) Decode(k storage.Kind, data []byte) (any, error) {
+	switch k {
+	case storage.KindAgent:
+		return decode(k, data, model.AgentFromSnapshot)
+	case storage.KindUser:
+		return decode(k, data, model.UserFromSnapshot)
+	case storage.KindRole:
+		return decode(k, data, model.RoleFromSnapshot)
+	case storage.KindCredential:
+		return decode(k, data, func(rec sealedCredential) (*model.Credential, error) {
+			if err := c.open(k, rec.ID, rec.Sealed, &rec.Secrets); err != nil {
+				return nil, err
+			}
+			return model.CredentialFromSnapshot(rec.CredentialSnapshot)
+		})
+	case storage.KindVerifier:
+		return decode(k, data, func(rec sealedVerifier) (*model.Verifier, error) {
+			if err := c.open(k, rec.ID, rec.Sealed, &rec.Data); err != nil {
+				return nil, err
+			}
+			return model.VerifierFromSnapshot(rec.VerifierSnapshot)
+		})
+	case storage.KindSession:
+		return decode(k, data, model.SessionFromSnapshot)
+	case storage.KindSpec:
+		return decode(k, data, model.SpecFromSnapshot)
+	case storage.KindSpecRevision:
+		return decode(k, data, model.SpecRevisionFromSnapshot)
+	case storage.KindDeployment:
+		return decode(k, data, model.DeploymentFromSnapshot)
+	case storage.KindRollout:
+		return decode(k, data, model.RolloutFromSnapshot)
+	default:
+		return nil, fmt.Errorf("%w: codec: unknown kind %q", storage.ErrInvalidArgument, k)
+	}
+}
+
+func decode[S any, T any](k storage.Kind, data []byte, restore func(S) (T, error)) (any, error) {
+	var snap S
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("%w: codec: decode %s: %v", storage.ErrInternal, k, err)
+	}
+	entity, err := restore(snap)
+	if err != nil {
+		return nil, fmt.Errorf("%w: codec: restore %s: %v", storage.ErrInternal, k, err)
+	}
+	return entity, nil
+}
+
+// seal encrypts the secret fields of a record, or returns nil without a keyring or secrets.
+func (c *Codec) seal(k storage.Kind, id string, secrets map[string]string) (*keyring.Envelope, error) {
+	if c == nil || c.keys == nil || len(secrets) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, fmt.Errorf("%w: codec: seal %s: %v", storage.ErrInternal, k, err)
+	}
+	env, err := c.keys.Seal(data, recordAAD(k, id))
+	if err != nil {
+		return nil, fmt.Errorf("%w: codec: seal %s: %v", storage.ErrInternal, k, err)
+	}
+	return env, nil
+}
+
+// open decrypts a sealed envelope into secrets; records without an envelope are left as they are.
+func (c *Codec) open(k storage.Kind, id string, env *keyring.Envelope, secrets *map[string]string) error {
+	if env == nil {
+		return nil
+	}
+	if c == nil || c.keys == nil {
+		return fmt.Errorf("secrets sealed with key %q, but no keyring is configured", env.KeyID)
+	}
+	data, err := c.keys.Open(env, recordAAD(k, id))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, secrets)
+}
+
+// recordAAD binds a sealed value to the record it belongs to.
+func recordAAD(k storage.Kind, id string) []byte {
+	return []byte(string(k) + "\x00" + id)
+}
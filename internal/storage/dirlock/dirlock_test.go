@@ -0,0 +1,31 @@
+package dirlock
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAcquire_Exclusive(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	l, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if _, err = Acquire(dir); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked while held, err=%v", err)
+	}
+
+	if err = l.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err = l.Release(); err != nil {
+		t.Fatalf("second Release: %v", err)
+	}
+	re, err := Acquire(dir)
+	if err != nil {
+		t.Fatalf("expected Acquire after Release to succeed, err=%v", err)
+	}
+	_ = re.Release()
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package dirlock
+
+import (
+	"errors"
+	"os"
+)
+
+var errHeld = errors.New("held")
+
+// lock is a no-op where flock is not available: the directory is not guarded.
+func lock(*os.File) error { return nil }
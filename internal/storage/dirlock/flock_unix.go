@@ -0,0 +1,22 @@
+//go:build unix
+
+package dirlock
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var errHeld = syscall.EWOULDBLOCK
+
+// lock takes an exclusive flock on f without waiting. The lock belongs to the open file,
+// so a second Acquire in the same process conflicts as well.
+func lock(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
@@ -31,4 +31,9 @@ var (
 	//
 	// Callers may retry with backoff (timeouts, transient network errors, leader elections, etc).
 	ErrUnavailable = errors.New("storage: unavailable")
+	// ErrCompacted indicates a watch cannot resume from the requested revision.
+	//
+	// The changes after that revision are no longer retained; callers must list the
+	// current state and watch again from a recent revision.
+	ErrCompacted = errors.New("storage: revision compacted")
 )
@@ -0,0 +1,26 @@
+package filestore
+
+import (
+	"testing"
+
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+	"github.com/soltiHQ/control-plane/internal/storage/storagetest"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	storagetest.Run(t, storagetest.Backend{
+		New: func(t *testing.T) storage.Storage {
+			s, err := Open(t.TempDir())
+			requireNoErr(t, err)
+			t.Cleanup(func() { _ = s.Close() })
+			return s
+		},
+		AgentsByLabel: func(key, value string) storage.AgentFilter {
+			return inmemory.NewAgentFilter().ByLabel(key, value)
+		},
+		RolloutsBySpec: func(specID string) storage.RolloutFilter {
+			return inmemory.NewRolloutFilter().BySpecID(specID)
+		},
+	})
+}
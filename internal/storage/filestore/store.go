@@ -0,0 +1,424 @@
+// Package filestore provides a durable, file-backed implementation of storage.Storage.
+//
+// Every entity is kept as one JSON record under <dir>/<kind>/, written atomically
+// (temp file → fsync → rename → directory fsync) before the mutation becomes visible.
+// Reads are served from an in-memory index (inmemory.Store) rebuilt from disk on Open.
+//
+// A transaction touches several files, so it is first written as a redo intent
+// (<dir>/intent.json) and then applied file by file. Open re-applies an intent left
+// behind by a crash, which makes transactions all-or-nothing on disk as well.
+//
+// The directory is locked (see dirlock) from Open until Close, so a second store, such as
+// the backup CLI next to a running server, cannot open it concurrently.
+//
+// Records are encoded by a codec.Codec (WithCodec); one built with a keyring seals
+// credential secrets and verifier data, and Rewrap re-seals them after key rotation.
+//
+// Because queries are evaluated by that index, the list ordering, cursor format and
+// filter types are those of the inmemory backend: callers build filters with
+// inmemory.New*Filter, exactly as they would against inmemory.Store.
+package filestore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/codec"
+	"github.com/soltiHQ/control-plane/internal/storage/dirlock"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+// Compile-time check that Store implements storage.Storage.
+var _ storage.Storage = (*Store)(nil)
+
+const (
+	recordExt  = ".json"
+	tempExt    = ".tmp"
+	intentName = "intent.json"
+)
+
+// Store is a file-backed storage.Storage.
+//
+// All read and write methods are provided by the embedded inmemory.Store;
+// filestore only makes its mutations durable.
+type Store struct {
+	*inmemory.Store
+
+	dir   string
+	files *files
+	lock  *dirlock.Lock
+}
+
+// Option configures a Store.
+type Option func(*files)
+
+// WithCodec sets the codec records are written and read with (default: codec.Encode / codec.Decode).
+func WithCodec(c *codec.Codec) Option {
+	return func(f *files) {
+		f.codec = c
+	}
+}
+
+// Open loads (or initializes) a file store rooted at dir.
+//
+// Leftover temporary files from an interrupted write are removed and a pending
+// transaction intent is applied. A record that cannot be decoded fails Open instead
+// of being skipped. A directory held by another open store fails with dirlock.ErrLocked.
+func Open(dir string, opts ...Option) (s *Store, err error) {
+	if dir == "" {
+		return nil, errors.New("filestore: dir is empty")
+	}
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("filestore: %w", err)
+	}
+	lock, err := dirlock.Acquire(dir)
+	if err != nil {
+		return nil, fmt.Errorf("filestore: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = lock.Release()
+		}
+	}()
+
+	files := &files{dir: dir}
+	for _, opt := range opts {
+		opt(files)
+	}
+	for _, k := range storage.Kinds {
+		if err = os.MkdirAll(files.kindDir(k), 0o700); err != nil {
+			return nil, fmt.Errorf("filestore: %w", err)
+		}
+	}
+	if err = files.recover(); err != nil {
+		return nil, err
+	}
+
+	mem := inmemory.New(inmemory.WithJournal(files))
+	for _, k := range storage.Kinds {
+		if err = files.load(k, mem); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{Store: mem, dir: dir, files: files, lock: lock}, nil
+}
+
+// Close releases the directory lock. Writes are durable once they return, so there is
+// nothing to flush; the store must not be used afterwards.
+func (s *Store) Close() error {
+	return s.lock.Release()
+}
+
+// Dir returns the root directory of the store.
+func (s *Store) Dir() string { return s.dir }
+
+// Rewrap rewrites every credential and verifier record with the store's codec.
+//
+// Once the codec's keyring holds a new active key, Rewrap seals all secrets under it,
+// after which the previous key can be retired. Each record is rewritten in its own
+// short transaction, so the store keeps serving while Rewrap runs.
+func (s *Store) Rewrap(ctx context.Context) error {
+	type ref struct {
+		kind storage.Kind
+		id   string
+	}
+	var refs []ref
+	err := s.Range(ctx, func(entity any) error {
+		switch e := entity.(type) {
+		case *model.Credential:
+			refs = append(refs, ref{storage.KindCredential, e.ID()})
+		case *model.Verifier:
+			refs = append(refs, ref{storage.KindVerifier, e.ID()})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range refs {
+		err = s.InTx(ctx, func(tx storage.Tx) error {
+			var (
+				entity any
+				err    error
+			)
+			if r.kind == storage.KindCredential {
+				entity, err = tx.GetCredential(ctx, r.id)
+			} else {
+				entity, err = tx.GetVerifier(ctx, r.id)
+			}
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			// Other writers are held off by the transaction, so the file cannot go backwards.
+			return s.files.Record(r.kind, inmemory.OpPut, r.id, entity)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// files persists journal records as one file per entity.
+type files struct {
+	dir   string
+	codec *codec.Codec
+
+	mu sync.Mutex
+	// broken is set when a committed transaction could not be applied to its files;
+	// the intent stays on disk and every later write is refused until the store is reopened.
+	broken error
+}
+
+var _ inmemory.BatchJournal = (*files)(nil)
+
+// intentEntry is one mutation of a transaction intent; Data is the codec record of a put.
+type intentEntry struct {
+	Kind storage.Kind    `json:"kind"`
+	Op   string          `json:"op"`
+	ID   string          `json:"id"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+func (f *files) kindDir(k storage.Kind) string {
+	return filepath.Join(f.dir, string(k))
+}
+
+func (f *files) path(k storage.Kind, id string) string {
+	return filepath.Join(f.kindDir(k), base64.RawURLEncoding.EncodeToString([]byte(id))+recordExt)
+}
+
+// Record implements inmemory.Journal.
+func (f *files) Record(k storage.Kind, op inmemory.Op, id string, entity any) error {
+	if err := f.usable(); err != nil {
+		return err
+	}
+
+	switch op {
+	case inmemory.OpPut:
+		_, data, err := f.codec.Encode(entity)
+		if err != nil {
+			return err
+		}
+		if err = f.write(k, id, data); err != nil {
+			return fmt.Errorf("%w: filestore: write %s %q: %v", storage.ErrUnavailable, k, id, err)
+		}
+		return nil
+	case inmemory.OpDelete:
+		if err := f.remove(k, id); err != nil {
+			return fmt.Errorf("%w: filestore: remove %s %q: %v", storage.ErrUnavailable, k, id, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: filestore: unknown op %d", storage.ErrInternal, op)
+	}
+}
+
+// RecordBatch implements inmemory.BatchJournal.
+//
+// Once the intent is durable the transaction counts as committed: if applying it to the
+// record files fails halfway, the store refuses further writes and the next Open finishes it.
+func (f *files) RecordBatch(entries []inmemory.Entry) error {
+	if err := f.usable(); err != nil {
+		return err
+	}
+
+	batch := make([]intentEntry, 0, len(entries))
+	for _, e := range entries {
+		ie := intentEntry{Kind: e.Kind, Op: e.Op.String(), ID: e.ID}
+		if e.Op == inmemory.OpPut {
+			_, data, err := f.codec.Encode(e.Entity)
+			if err != nil {
+				return err
+			}
+			ie.Data = data
+		}
+		batch = append(batch, ie)
+	}
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("%w: filestore: encode intent: %v", storage.ErrInternal, err)
+	}
+	if err = writeFile(f.dir, filepath.Join(f.dir, intentName), data); err != nil {
+		return fmt.Errorf("%w: filestore: write intent: %v", storage.ErrUnavailable, err)
+	}
+
+	if err = f.apply(batch); err != nil {
+		f.mu.Lock()
+		f.broken = err
+		f.mu.Unlock()
+	}
+	return nil
+}
+
+func (f *files) usable() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.broken != nil {
+		return fmt.Errorf("%w: filestore: pending transaction not applied, reopen the store: %v", storage.ErrUnavailable, f.broken)
+	}
+	return nil
+}
+
+// apply writes the entries of an intent to their record files and removes the intent.
+func (f *files) apply(batch []intentEntry) error {
+	for _, e := range batch {
+		if !slices.Contains(storage.Kinds, e.Kind) {
+			return fmt.Errorf("filestore: intent: unknown kind %q", e.Kind)
+		}
+		switch e.Op {
+		case inmemory.OpPut.String():
+			if err := f.write(e.Kind, e.ID, e.Data); err != nil {
+				return err
+			}
+		case inmemory.OpDelete.String():
+			if err := f.remove(e.Kind, e.ID); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("filestore: intent: unknown op %q", e.Op)
+		}
+	}
+	if err := os.Remove(filepath.Join(f.dir, intentName)); err != nil {
+		return err
+	}
+	return syncDir(f.dir)
+}
+
+// recover applies the intent of a transaction interrupted by a crash, if any.
+func (f *files) recover() error {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return fmt.Errorf("filestore: %w", err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), tempExt) {
+			if err = os.Remove(filepath.Join(f.dir, e.Name())); err != nil {
+				return fmt.Errorf("filestore: %w", err)
+			}
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(f.dir, intentName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("filestore: %w", err)
+	}
+	var batch []intentEntry
+	if err = json.Unmarshal(data, &batch); err != nil {
+		return fmt.Errorf("filestore: %s: %w", intentName, err)
+	}
+	if err = f.apply(batch); err != nil {
+		return fmt.Errorf("filestore: apply %s: %w", intentName, err)
+	}
+	return nil
+}
+
+// write atomically replaces the record file of an entity.
+func (f *files) write(k storage.Kind, id string, data []byte) error {
+	return writeFile(f.kindDir(k), f.path(k, id), data)
+}
+
+// writeFile atomically replaces path, a file in dir.
+func writeFile(dir, path string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, "*"+tempExt)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// remove deletes the record file of an entity; a missing file is not an error.
+func (f *files) remove(k storage.Kind, id string) error {
+	if err := os.Remove(f.path(k, id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return syncDir(f.kindDir(k))
+}
+
+// load restores every record of kind k into mem.
+func (f *files) load(k storage.Kind, mem *inmemory.Store) error {
+	dir := f.kindDir(k)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("filestore: %w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, tempExt) {
+			if err = os.Remove(filepath.Join(dir, name)); err != nil {
+				return fmt.Errorf("filestore: %w", err)
+			}
+			continue
+		}
+		if !strings.HasSuffix(name, recordExt) {
+			continue
+		}
+
+		id, err := base64.RawURLEncoding.DecodeString(strings.TrimSuffix(name, recordExt))
+		if err != nil {
+			return fmt.Errorf("filestore: %s/%s: malformed record name", k, name)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("filestore: %w", err)
+		}
+		entity, err := f.codec.Decode(k, data)
+		if err != nil {
+			return fmt.Errorf("filestore: %s/%s: %w", k, name, err)
+		}
+		if got := entity.(interface{ ID() string }).ID(); got != string(id) {
+			return fmt.Errorf("filestore: %s/%s: record id %q does not match file name", k, name, got)
+		}
+		if err = mem.Restore(entity); err != nil {
+			return fmt.Errorf("filestore: %s/%s: %w", k, name, err)
+		}
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+	return d.Sync()
+}
@@ -0,0 +1,324 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/codec"
+	"github.com/soltiHQ/control-plane/internal/storage/dirlock"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+	"github.com/soltiHQ/control-plane/internal/storage/keyring"
+)
+
+func requireNoErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStore_PersistsAcrossReopen(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := Open(dir)
+	requireNoErr(t, err)
+
+	a, err := model.NewAgentFrom(model.AgentParams{ID: "agent/1", Name: "agent-1", Endpoint: "http://agent-1", DeliveryMode: 1})
+	requireNoErr(t, err)
+	a.LabelAdd("env", "prod")
+	requireNoErr(t, s.UpsertAgent(ctx, a))
+
+	u, err := model.NewUser("u1", "sub-1")
+	requireNoErr(t, err)
+	requireNoErr(t, u.RoleAdd("r1"))
+	requireNoErr(t, s.UpsertUser(ctx, u))
+
+	ts, err := model.NewSpec("spec-1", "web", "worker")
+	requireNoErr(t, err)
+	ts.SetKindConfig(map[string]any{"command": "sleep"})
+	ts.IncrementVersion()
+	requireNoErr(t, s.UpsertSpec(ctx, ts))
+
+	ro, err := model.NewRollout(ts.ID(), a.ID(), ts.Version())
+	requireNoErr(t, err)
+	ro.MarkFailed("boom")
+	ro.ScheduleRetry(time.Minute)
+	retryAt := ro.NextAttemptAt()
+	requireNoErr(t, s.UpsertRollout(ctx, ro))
+
+	sess, err := model.NewSession("s1", u.ID(), "c1", kind.Password, []byte("hash"), time.Now().Add(time.Hour))
+	requireNoErr(t, err)
+	requireNoErr(t, s.CreateSession(ctx, sess))
+	requireNoErr(t, s.RevokeSession(ctx, sess.ID(), time.Now()))
+	requireNoErr(t, s.Close())
+
+	re, err := Open(dir)
+	requireNoErr(t, err)
+
+	gotAgent, err := re.GetAgent(ctx, a.ID())
+	requireNoErr(t, err)
+	if v, _ := gotAgent.Label("env"); v != "prod" {
+		t.Fatalf("expected label env=prod, got=%q", v)
+	}
+	if gotAgent.Delivery() != kind.DeliveryPull {
+		t.Fatalf("expected pull delivery, got=%q", gotAgent.Delivery())
+	}
+	if !gotAgent.UpdatedAt().Equal(a.UpdatedAt()) {
+		t.Fatalf("expected UpdatedAt preserved: %v != %v", gotAgent.UpdatedAt(), a.UpdatedAt())
+	}
+
+	gotUser, err := re.GetUserBySubject(ctx, "sub-1")
+	requireNoErr(t, err)
+	if !gotUser.RoleHas("r1") {
+		t.Fatalf("expected role r1 to be restored")
+	}
+
+	gotSpec, err := re.GetSpec(ctx, ts.ID())
+	requireNoErr(t, err)
+	if gotSpec.Version() != 2 || gotSpec.KindConfig()["command"] != "sleep" {
+		t.Fatalf("unexpected spec: version=%d config=%v", gotSpec.Version(), gotSpec.KindConfig())
+	}
+	if gotSpec.ResourceVersion() != ts.ResourceVersion() {
+		t.Fatalf("expected resource version %d, got=%d", ts.ResourceVersion(), gotSpec.ResourceVersion())
+	}
+	requireNoErr(t, re.UpsertSpec(ctx, gotSpec))
+	if gotSpec.ResourceVersion() <= ro.ResourceVersion() {
+		t.Fatalf("expected versions to continue after reopen, got=%d", gotSpec.ResourceVersion())
+	}
+
+	gotRollout, err := re.GetRollout(ctx, ro.ID())
+	requireNoErr(t, err)
+	if gotRollout.Status() != kind.SyncStatusFailed || gotRollout.Attempts() != 1 || gotRollout.Error() != "boom" {
+		t.Fatalf("unexpected rollout: status=%s attempts=%d err=%q", gotRollout.Status(), gotRollout.Attempts(), gotRollout.Error())
+	}
+	if !gotRollout.NextAttemptAt().Equal(retryAt) {
+		t.Fatalf("expected next attempt %v, got=%v", retryAt, gotRollout.NextAttemptAt())
+	}
+	if gotRollout.RetryDelay() != time.Minute {
+		t.Fatalf("expected retry delay %v, got=%v", time.Minute, gotRollout.RetryDelay())
+	}
+
+	gotSess, err := re.GetSession(ctx, sess.ID())
+	requireNoErr(t, err)
+	if !gotSess.Revoked() {
+		t.Fatalf("expected session revocation to be persisted")
+	}
+}
+
+func TestStore_DeletePersists(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := Open(dir)
+	requireNoErr(t, err)
+
+	for _, agentID := range []string{"a1", "a2"} {
+		ro, err := model.NewRollout("spec-1", agentID, 1)
+		requireNoErr(t, err)
+		requireNoErr(t, s.UpsertRollout(ctx, ro))
+	}
+	requireNoErr(t, s.DeleteRolloutsBySpec(ctx, "spec-1"))
+	requireNoErr(t, s.Close())
+
+	re, err := Open(dir)
+	requireNoErr(t, err)
+
+	res, err := re.ListRollouts(ctx, inmemory.NewRolloutFilter().BySpecID("spec-1"), storage.ListOptions{})
+	requireNoErr(t, err)
+	if len(res.Items) != 0 {
+		t.Fatalf("expected no rollouts after reopen, got=%d", len(res.Items))
+	}
+}
+
+func TestStore_ListUsesInmemoryFilters(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s, err := Open(t.TempDir())
+	requireNoErr(t, err)
+
+	type foreignFilter struct{}
+	_, err = s.ListAgents(ctx, &foreignFilter{}, storage.ListOptions{})
+	if !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument, err=%v", err)
+	}
+
+	_, err = s.ListAgents(ctx, inmemory.NewAgentFilter(), storage.ListOptions{})
+	requireNoErr(t, err)
+}
+
+func TestStore_WriteFailureAbortsMutation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := Open(dir)
+	requireNoErr(t, err)
+
+	// Replacing the kind directory with a file makes every write fail.
+	agents := filepath.Join(dir, string(storage.KindAgent))
+	requireNoErr(t, os.RemoveAll(agents))
+	requireNoErr(t, os.WriteFile(agents, nil, 0o600))
+
+	a, err := model.NewAgent("a1", "agent-1", "http://agent-1")
+	requireNoErr(t, err)
+	if err = s.UpsertAgent(ctx, a); !errors.Is(err, storage.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, err=%v", err)
+	}
+	if _, err = s.GetAgent(ctx, a.ID()); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected failed write to stay invisible, err=%v", err)
+	}
+}
+
+func TestOpen_CorruptRecord(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s, err := Open(dir)
+	requireNoErr(t, err)
+	requireNoErr(t, s.Close())
+
+	f := &files{dir: dir}
+	requireNoErr(t, os.WriteFile(f.path(storage.KindSpec, "spec-1"), []byte("{not json"), 0o600))
+
+	if _, err = Open(dir); !errors.Is(err, storage.ErrInternal) {
+		t.Fatalf("expected ErrInternal for corrupt record, err=%v", err)
+	}
+}
+
+func TestOpen_RemovesTempFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s, err := Open(dir)
+	requireNoErr(t, err)
+	requireNoErr(t, s.Close())
+
+	tmp := filepath.Join(dir, string(storage.KindUser), "123"+tempExt)
+	requireNoErr(t, os.WriteFile(tmp, []byte("partial"), 0o600))
+
+	_, err = Open(dir)
+	requireNoErr(t, err)
+	if _, err = os.Stat(tmp); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected temp file to be removed, err=%v", err)
+	}
+}
+
+func TestStore_TxIntentCompletedOnOpen(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := Open(dir)
+	requireNoErr(t, err)
+
+	// The agent record cannot be written, so the transaction is committed through its
+	// intent but only partially applied to the record files.
+	agents := filepath.Join(dir, string(storage.KindAgent))
+	requireNoErr(t, os.RemoveAll(agents))
+	requireNoErr(t, os.WriteFile(agents, nil, 0o600))
+
+	r, err := model.NewRole("r1", "admin")
+	requireNoErr(t, err)
+	a, err := model.NewAgent("a1", "agent-1", "http://agent-1")
+	requireNoErr(t, err)
+	err = s.InTx(ctx, func(tx storage.Tx) error {
+		if err := tx.UpsertRole(ctx, r); err != nil {
+			return err
+		}
+		return tx.UpsertAgent(ctx, a)
+	})
+	requireNoErr(t, err)
+
+	if err = s.UpsertRole(ctx, r); !errors.Is(err, storage.ErrUnavailable) {
+		t.Fatalf("expected writes to be refused with a pending intent, err=%v", err)
+	}
+
+	requireNoErr(t, os.Remove(agents))
+	requireNoErr(t, s.Close())
+	re, err := Open(dir)
+	requireNoErr(t, err)
+	if _, err = re.GetRole(ctx, "r1"); err != nil {
+		t.Fatalf("expected r1 after reopen, err=%v", err)
+	}
+	if _, err = re.GetAgent(ctx, "a1"); err != nil {
+		t.Fatalf("expected a1 to be recovered from the intent, err=%v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, intentName)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected intent to be removed, err=%v", err)
+	}
+}
+
+func TestStore_RewrapRotatesKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	k1, k2 := bytes.Repeat([]byte{1}, keyring.KeySize), bytes.Repeat([]byte{2}, keyring.KeySize)
+
+	old, err := keyring.New("k1", map[string][]byte{"k1": k1})
+	requireNoErr(t, err)
+	s, err := Open(dir, WithCodec(codec.New(old)))
+	requireNoErr(t, err)
+
+	c, err := model.NewCredential("c1", "u1", kind.Password)
+	requireNoErr(t, err)
+	requireNoErr(t, c.SetSecret("token", "top-secret"))
+	requireNoErr(t, s.UpsertCredential(ctx, c))
+
+	raw, err := os.ReadFile(s.files.path(storage.KindCredential, "c1"))
+	requireNoErr(t, err)
+	if bytes.Contains(raw, []byte("top-secret")) || !bytes.Contains(raw, []byte(`"kid":"k1"`)) {
+		t.Fatalf("expected the secret sealed under k1: %s", raw)
+	}
+
+	// Rotate: k2 becomes active while k1 still opens existing records.
+	rotated, err := keyring.New("k2", map[string][]byte{"k1": k1, "k2": k2})
+	requireNoErr(t, err)
+	s.files.codec = codec.New(rotated)
+	requireNoErr(t, s.Rewrap(ctx))
+
+	// k1 can be retired.
+	only, err := keyring.New("k2", map[string][]byte{"k2": k2})
+	requireNoErr(t, err)
+	requireNoErr(t, s.Close())
+	reopened, err := Open(dir, WithCodec(codec.New(only)))
+	requireNoErr(t, err)
+	got, err := reopened.GetCredential(ctx, "c1")
+	requireNoErr(t, err)
+	if v, _ := got.Secret("token"); v != "top-secret" {
+		t.Fatalf("expected the secret after rewrap, got=%q", v)
+	}
+}
+
+func TestOpen_DirLocked(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s, err := Open(dir)
+	requireNoErr(t, err)
+
+	if _, err = Open(dir); !errors.Is(err, dirlock.ErrLocked) {
+		t.Fatalf("expected ErrLocked while the store is open, err=%v", err)
+	}
+	requireNoErr(t, s.Close())
+
+	re, err := Open(dir)
+	requireNoErr(t, err)
+	requireNoErr(t, re.Close())
+}
@@ -5,13 +5,29 @@ import (
 
 	"github.com/soltiHQ/control-plane/domain/kind"
 	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/domain/selector"
 )
 
+// indexHint names a secondary index that narrows the candidates of a filter.
+//
+// The first indexed predicate of a filter sets it; all predicates are still evaluated.
+type indexHint struct {
+	name string
+	key  string
+}
+
+func (h *indexHint) narrow(name, key string) {
+	if h.name == "" {
+		h.name, h.key = name, key
+	}
+}
+
 // AgentFilter provides predicate-based filtering for in-memory agent queries.
 //
 // Filters are composed by chaining builder methods. All predicates are ANDed together.
 // AgentFilter is mutable and not safe for concurrent use.
 type AgentFilter struct {
+	hint       indexHint
 	predicates []func(*model.Agent) bool
 }
 
@@ -28,6 +44,7 @@ func (f *AgentFilter) ByPlatform(platform string) *AgentFilter {
 
 // ByLabel matches agents that have a label with the given key and value.
 func (f *AgentFilter) ByLabel(key, value string) *AgentFilter {
+	f.hint.narrow(indexLabel, IndexKey(key, value))
 	f.predicates = append(f.predicates, func(a *model.Agent) bool {
 		v, ok := a.Label(key)
 		return ok && v == value
@@ -35,6 +52,21 @@ func (f *AgentFilter) ByLabel(key, value string) *AgentFilter {
 	return f
 }
 
+// BySelector matches agents whose labels satisfy sel; an empty selector matches all agents.
+func (f *AgentFilter) BySelector(sel selector.Selector) *AgentFilter {
+	if sel.Empty() {
+		return f
+	}
+	for _, r := range sel {
+		if (r.Op == selector.OpEquals || r.Op == selector.OpIn) && len(r.Values) == 1 {
+			f.hint.narrow(indexLabel, IndexKey(r.Key, r.Values[0]))
+			break
+		}
+	}
+	f.predicates = append(f.predicates, func(a *model.Agent) bool { return sel.Matches(a.LabelsAll()) })
+	return f
+}
+
 // ByOS matches agents running the specified operating system.
 func (f *AgentFilter) ByOS(os string) *AgentFilter {
 	f.predicates = append(f.predicates, func(a *model.Agent) bool { return a.OS() == os })
@@ -157,6 +189,7 @@ func (f *UserFilter) Query(q string) *UserFilter {
 // Filters are composed by chaining builder methods. All predicates are ANDed together.
 // RoleFilter is mutable and not safe for concurrent use.
 type RoleFilter struct {
+	hint       indexHint
 	predicates []func(*model.Role) bool
 }
 
@@ -167,6 +200,7 @@ func NewRoleFilter() *RoleFilter {
 
 // ByName matches roles with the specified name.
 func (f *RoleFilter) ByName(name string) *RoleFilter {
+	f.hint.narrow(indexName, name)
 	f.predicates = append(f.predicates, func(r *model.Role) bool { return r.Name() == name })
 	return f
 }
@@ -218,6 +252,15 @@ func (f *SpecFilter) Query(q string) *SpecFilter {
 	return f
 }
 
+// BySelector matches task specs whose runner labels satisfy sel; an empty selector matches all task specs.
+func (f *SpecFilter) BySelector(sel selector.Selector) *SpecFilter {
+	if sel.Empty() {
+		return f
+	}
+	f.predicates = append(f.predicates, func(ts *model.Spec) bool { return sel.Matches(ts.RunnerLabels()) })
+	return f
+}
+
 // Matches reports whether the given task spec satisfies all predicates.
 func (f *SpecFilter) Matches(ts *model.Spec) bool {
 	for _, pred := range f.predicates {
@@ -233,6 +276,7 @@ func (f *SpecFilter) Matches(ts *model.Spec) bool {
 // Filters are composed by chaining builder methods. All predicates are ANDed together.
 // RolloutFilter is mutable and not safe for concurrent use.
 type RolloutFilter struct {
+	hint       indexHint
 	predicates []func(*model.Rollout) bool
 }
 
@@ -243,12 +287,14 @@ func NewRolloutFilter() *RolloutFilter {
 
 // BySpecID matches rollouts for a given spec.
 func (f *RolloutFilter) BySpecID(id string) *RolloutFilter {
+	f.hint.narrow(indexSpec, id)
 	f.predicates = append(f.predicates, func(ss *model.Rollout) bool { return ss.SpecID() == id })
 	return f
 }
 
 // ByAgentID matches rollouts for a given agent.
 func (f *RolloutFilter) ByAgentID(id string) *RolloutFilter {
+	f.hint.narrow(indexAgent, id)
 	f.predicates = append(f.predicates, func(ss *model.Rollout) bool { return ss.AgentID() == id })
 	return f
 }
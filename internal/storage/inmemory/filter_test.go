@@ -3,9 +3,12 @@ package inmemory
 import (
 	"context"
 	"errors"
+	"slices"
 	"testing"
 
 	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/domain/selector"
 	"github.com/soltiHQ/control-plane/internal/storage"
 )
 
@@ -45,6 +48,121 @@ func TestAgentFilter_Matches_AllPredicatesANDed(t *testing.T) {
 	}
 }
 
+func TestAgentFilter_BySelector(t *testing.T) {
+	t.Parallel()
+
+	a := mkAgent(t, "a1")
+	a.LabelAdd("env", "prod")
+	a.LabelAdd("tier", "edge")
+	a.LabelAdd("region", "eu-west/1")
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env==prod", true},
+		{"env=dev", false},
+		{"env!=dev", true},
+		{"env!=prod", false},
+		{"missing!=x", true},
+		{"env in (prod,stage)", true},
+		{"env in (dev,stage)", false},
+		{"env notin (dev)", true},
+		{"env notin (prod, dev)", false},
+		{"missing notin (x)", true},
+		{"region", true},
+		{"canary", false},
+		{"!canary", true},
+		{"!env", false},
+		{"region=eu-west/1", true},
+		{" env in (prod) , tier!=db , !canary ", true},
+		{"env=prod,tier=core", false},
+	}
+	for _, tc := range cases {
+		sel, err := selector.Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.expr, err)
+		}
+		if got := NewAgentFilter().BySelector(sel).Matches(a); got != tc.want {
+			t.Fatalf("selector %q: got %v, want %v", tc.expr, got, tc.want)
+		}
+
+		again, err := selector.Parse(sel.String())
+		if err != nil || again.String() != sel.String() {
+			t.Fatalf("selector %q: String() %q does not round-trip: %v", tc.expr, sel.String(), err)
+		}
+	}
+
+	for _, expr := range []string{"=prod", "env=prod,", "env in prod", "env in ()", "env in (a b)", "env <> x", "!", "env=prod tier=db"} {
+		if _, err := selector.Parse(expr); !errors.Is(err, selector.ErrInvalid) {
+			t.Fatalf("Parse(%q): expected ErrInvalid, err=%v", expr, err)
+		}
+	}
+}
+
+func TestSpecFilter_BySelector(t *testing.T) {
+	t.Parallel()
+
+	ts, err := model.NewSpec("s1", "spec-1", "slot-1")
+	requireNoErr(t, err)
+	ts.SetRunnerLabels(map[string]string{"team": "core"})
+	ts.SetTargetLabels(map[string]string{"env": "prod"})
+
+	for expr, want := range map[string]bool{
+		"team=core":            true,
+		"team in (core,infra)": true,
+		"env=prod":             false, // target labels select agents, they are not the spec's labels
+		"!team":                false,
+	} {
+		sel, err := selector.Parse(expr)
+		requireNoErr(t, err)
+		if got := NewSpecFilter().BySelector(sel).Matches(ts); got != want {
+			t.Fatalf("selector %q: got %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestStore_ListAgents_BySelector(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := New()
+	for id, env := range map[string]string{"a1": "prod", "a2": "stage", "a3": "dev"} {
+		a := mkAgent(t, id)
+		a.LabelAdd("env", env)
+		if id == "a1" {
+			a.LabelAdd("canary", "true")
+		}
+		requireNoErr(t, s.UpsertAgent(ctx, a))
+	}
+
+	list := func(expr string) []string {
+		t.Helper()
+		sel, err := selector.Parse(expr)
+		requireNoErr(t, err)
+		res, err := s.ListAgents(ctx, NewAgentFilter().BySelector(sel), storage.ListOptions{})
+		requireNoErr(t, err)
+		ids := make([]string, 0, len(res.Items))
+		for _, a := range res.Items {
+			ids = append(ids, a.ID())
+		}
+		slices.Sort(ids)
+		return ids
+	}
+
+	if got := list("env in (prod,stage),!canary"); !slices.Equal(got, []string{"a2"}) {
+		t.Fatalf("got %v, want [a2]", got)
+	}
+	if got := list("env in (prod)"); !slices.Equal(got, []string{"a1"}) {
+		t.Fatalf("indexed lookup: got %v, want [a1]", got)
+	}
+	if got := list("env!=prod"); !slices.Equal(got, []string{"a2", "a3"}) {
+		t.Fatalf("got %v, want [a2 a3]", got)
+	}
+}
+
 func TestUserFilter_Matches_AllPredicatesANDed(t *testing.T) {
 	t.Parallel()
 
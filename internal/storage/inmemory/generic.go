@@ -2,7 +2,6 @@ package inmemory
 
 import (
 	"context"
-	"sort"
 	"sync"
 
 	"github.com/soltiHQ/control-plane/domain"
@@ -12,14 +11,32 @@ import (
 // GenericStore provides thread-safe in-memory CRUD operations for any domain.Entity type.
 //
 // Type parameter T must implement domain.Entity[T].
+//
+// Every write stamps the stored entity with a new resource version; see the storage
+// package documentation for the compare-and-swap contract of Upsert.
+//
+// Entities are kept in list order and in the declared secondary indexes as they are
+// written, so a page costs O(log n + page) instead of a full sort.
 type GenericStore[T domain.Entity[T]] struct {
-	mu   sync.RWMutex
-	data map[string]T
+	mu sync.RWMutex
+	*table[T]
+
+	kind    storage.Kind
+	journal Journal
+	rev     *revision
+
+	// gate is the store-wide transaction lock, taken before mu. It is nil for standalone
+	// stores and for transaction views, whose transaction already holds it exclusively.
+	gate *sync.RWMutex
+	// tx is set on transaction views: writes are staged there instead of committed.
+	tx *txState
 }
 
-// NewGenericStore creates an empty generic store for type T.
-func NewGenericStore[T domain.Entity[T]]() *GenericStore[T] {
-	return &GenericStore[T]{data: make(map[string]T)}
+// NewGenericStore creates an empty generic store for type T with the given secondary indexes.
+//
+// It panics if an index has no name or key func, or if two indexes share a name.
+func NewGenericStore[T domain.Entity[T]](indexes ...Index[T]) *GenericStore[T] {
+	return &GenericStore[T]{table: newTable(indexes), rev: &revision{}}
 }
 
 func validateEntity[T domain.Entity[T]](entity T) error {
@@ -39,7 +56,8 @@ func validateEntity[T domain.Entity[T]](entity T) error {
 
 // Create inserts a new entity and fails if it already exists.
 //
-// The entity is deep-cloned before storage to prevent external mutations.
+// The entity is deep-cloned before storage to prevent external mutations;
+// on success, the assigned resource version is set on the passed entity.
 // Returns storage.ErrInvalidArgument if the entity has empty ID or violates storage invariants.
 // Returns storage.ErrAlreadyExists if the ID already exists.
 func (s *GenericStore[T]) Create(_ context.Context, entity T) error {
@@ -48,13 +66,18 @@ func (s *GenericStore[T]) Create(_ context.Context, entity T) error {
 	}
 	id := entity.ID()
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.lock()
+	defer unlock()
 
 	if _, ok := s.data[id]; ok {
 		return storage.ErrAlreadyExists
 	}
-	s.data[id] = entity.Clone()
+
+	next := entity.Clone()
+	if err := s.put(storage.EventCreated, id, next); err != nil {
+		return err
+	}
+	entity.SetResourceVersion(next.ResourceVersion())
 	return nil
 }
 
@@ -67,8 +90,8 @@ func (s *GenericStore[T]) Update(_ context.Context, id string, fn func(cur T) (T
 		return storage.ErrInvalidArgument
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.lock()
+	defer unlock()
 
 	cur, ok := s.data[id]
 	if !ok {
@@ -87,14 +110,18 @@ func (s *GenericStore[T]) Update(_ context.Context, id string, fn func(cur T) (T
 		return storage.ErrInvalidArgument
 	}
 
-	s.data[id] = next.Clone()
-	return nil
+	return s.put(storage.EventUpdated, id, next.Clone())
 }
 
 // Upsert inserts or fully replaces an entity.
 //
-// The entity is deep-cloned before storage to prevent external mutations.
+// A non-zero resource version on the entity makes the write conditional: it succeeds only
+// if the stored entity exists and has the same version.
+//
+// The entity is deep-cloned before storage to prevent external mutations;
+// on success, the assigned resource version is set on the passed entity.
 // Returns storage.ErrInvalidArgument if the entity violates storage invariants.
+// Returns storage.ErrConflict if the expected version does not match.
 func (s *GenericStore[T]) Upsert(_ context.Context, entity T) error {
 	if err := validateEntity(entity); err != nil {
 		return err
@@ -102,10 +129,23 @@ func (s *GenericStore[T]) Upsert(_ context.Context, entity T) error {
 
 	id := entity.ID()
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.lock()
+	defer unlock()
+
+	cur, exists := s.data[id]
+	if want := entity.ResourceVersion(); want != 0 && (!exists || cur.ResourceVersion() != want) {
+		return storage.ErrConflict
+	}
 
-	s.data[id] = entity.Clone()
+	typ := storage.EventCreated
+	if exists {
+		typ = storage.EventUpdated
+	}
+	next := entity.Clone()
+	if err := s.put(typ, id, next); err != nil {
+		return err
+	}
+	entity.SetResourceVersion(next.ResourceVersion())
 	return nil
 }
 
@@ -119,8 +159,8 @@ func (s *GenericStore[T]) Get(_ context.Context, id string) (T, error) {
 		return zero, storage.ErrInvalidArgument
 	}
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	unlock := s.rlock()
+	defer unlock()
 
 	entity, ok := s.data[id]
 	if !ok {
@@ -146,8 +186,8 @@ func (s *GenericStore[T]) GetMany(_ context.Context, ids []string) ([]T, error)
 		}
 	}
 
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	unlock := s.rlock()
+	defer unlock()
 
 	out := make([]T, 0, len(ids))
 	for _, id := range ids {
@@ -168,75 +208,105 @@ func (s *GenericStore[T]) GetMany(_ context.Context, ids []string) ([]T, error)
 //
 // Pagination ordering is (UpdatedAt DESC, ID ASC).
 // Cursor is an opaque token produced by this backend; a malformed cursor returns ErrInvalidArgument.
+// The scan starts at the cursor and stops once the page is full.
 func (s *GenericStore[T]) List(ctx context.Context, predicate func(T) bool, opts storage.ListOptions) (*storage.ListResult[T], error) {
 	cur, err := decodeCursor(opts.Cursor)
 	if err != nil {
 		return nil, err
 	}
 
-	limit := storage.NormalizeLimit(opts.Limit)
+	s.settleShared()
+	unlock := s.rlock()
+	defer unlock()
 
-	// snapshot under read lock
-	s.mu.RLock()
-	if len(s.data) == 0 {
-		s.mu.RUnlock()
-		return &storage.ListResult[T]{Items: []T{}, NextCursor: ""}, nil
+	return page(ctx, s.order, predicate, opts, cur)
+}
+
+// ListByIndex is List restricted to the entities having key in the named index.
+//
+// Returns storage.ErrInvalidArgument if the index does not exist.
+func (s *GenericStore[T]) ListByIndex(ctx context.Context, name, key string, predicate func(T) bool, opts storage.ListOptions) (*storage.ListResult[T], error) {
+	cur, err := decodeCursor(opts.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	ix, ok := s.indexes[name]
+	if !ok {
+		return nil, storage.ErrInvalidArgument
 	}
 
-	snapshot := make([]T, 0, len(s.data))
-	i := 0
-	for _, entity := range s.data {
+	s.settleShared()
+	unlock := s.rlock()
+	defer unlock()
+
+	return page(ctx, ix.buckets[key], predicate, opts, cur)
+}
+
+// ByIndex returns clones of every entity having key in the named index, in list order.
+//
+// Returns storage.ErrInvalidArgument if the index does not exist.
+func (s *GenericStore[T]) ByIndex(ctx context.Context, name, key string) ([]T, error) {
+	ix, ok := s.indexes[name]
+	if !ok {
+		return nil, storage.ErrInvalidArgument
+	}
+
+	s.settleShared()
+	unlock := s.rlock()
+	defer unlock()
+
+	b := ix.buckets[key]
+	out := make([]T, 0, len(b))
+	for i, e := range b {
 		if i%1000 == 0 {
 			select {
 			case <-ctx.Done():
-				s.mu.RUnlock()
 				return nil, ctx.Err()
 			default:
 			}
 		}
-		i++
-
-		if predicate == nil || predicate(entity) {
-			snapshot = append(snapshot, entity.Clone())
-		}
-	}
-	s.mu.RUnlock()
-
-	if len(snapshot) == 0 {
-		return &storage.ListResult[T]{Items: []T{}, NextCursor: ""}, nil
+		out = append(out, e.Clone())
 	}
+	return out, nil
+}
 
-	// sort once (ctx cannot interrupt sort.Slice in the middle; acceptable for inmemory)
-	sort.Slice(snapshot, func(i, j int) bool {
-		ti, tj := snapshot[i].UpdatedAt(), snapshot[j].UpdatedAt()
-		if !ti.Equal(tj) {
-			return ti.After(tj) // DESC
-		}
-		return snapshot[i].ID() < snapshot[j].ID() // ASC
-	})
+// page collects up to opts.Limit clones of the items after cur that match predicate.
+func page[T domain.Entity[T]](ctx context.Context, items sorted[T], predicate func(T) bool, opts storage.ListOptions, cur cursor) (*storage.ListResult[T], error) {
+	limit := storage.NormalizeLimit(opts.Limit)
 
 	start := 0
 	if opts.Cursor != "" {
-		start, err = findCursorPosition(ctx, snapshot, cur)
-		if err != nil {
-			return nil, err
-		}
+		start = items.after(cur)
 	}
 
-	if start >= len(snapshot) {
-		return &storage.ListResult[T]{Items: []T{}, NextCursor: ""}, nil
-	}
+	var (
+		out  = make([]T, 0, min(limit, len(items)-start))
+		more bool
+	)
+	for i := start; i < len(items); i++ {
+		if (i-start)%1000 == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
+		}
 
-	end := start + limit
-	if end > len(snapshot) {
-		end = len(snapshot)
+		e := items[i]
+		if predicate != nil && !predicate(e) {
+			continue
+		}
+		if len(out) == limit {
+			more = true
+			break
+		}
+		out = append(out, e.Clone())
 	}
 
-	page := snapshot[start:end]
-
 	var nextCursor string
-	if end < len(snapshot) {
-		last := page[len(page)-1]
+	if more {
+		last := out[len(out)-1]
+		var err error
 		nextCursor, err = encodeCursor(cursor{
 			UpdatedAtUnixNano: last.UpdatedAt().UnixNano(),
 			ID:                last.ID(),
@@ -247,7 +317,7 @@ func (s *GenericStore[T]) List(ctx context.Context, predicate func(T) bool, opts
 	}
 
 	return &storage.ListResult[T]{
-		Items:      page,
+		Items:      out,
 		NextCursor: nextCursor,
 	}, nil
 }
@@ -260,45 +330,169 @@ func (s *GenericStore[T]) Delete(_ context.Context, id string) error {
 		return storage.ErrInvalidArgument
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	unlock := s.lock()
+	defer unlock()
 
-	if _, ok := s.data[id]; !ok {
+	cur, ok := s.data[id]
+	if !ok {
 		return storage.ErrNotFound
 	}
-	delete(s.data, id)
-	return nil
+
+	if s.tx != nil {
+		s.tx.stage(Entry{Kind: s.kind, Op: OpDelete, ID: id}, s.undo(id), func(rev uint64) change {
+			s.unset(id)
+			return newChange(storage.EventDeleted, s.kind, rev, id, cur)
+		})
+		return nil
+	}
+
+	return s.rev.commit(func(rev uint64) (change, error) {
+		var zero T
+		if err := s.record(OpDelete, id, zero); err != nil {
+			return change{}, err
+		}
+		s.unset(id)
+		return newChange(storage.EventDeleted, s.kind, rev, id, cur), nil
+	})
 }
 
-// findCursorPosition returns the index of the first item strictly after the cursor under ordering (UpdatedAt DESC, ID ASC).
-func findCursorPosition[T domain.Entity[T]](ctx context.Context, items []T, cur cursor) (int, error) {
-	for i, e := range items {
+// all returns clones of every stored entity in unspecified order.
+func (s *GenericStore[T]) all(ctx context.Context) ([]T, error) {
+	unlock := s.rlock()
+	defer unlock()
+
+	out := make([]T, 0, len(s.data))
+	i := 0
+	for _, entity := range s.data {
 		if i%1000 == 0 {
 			select {
 			case <-ctx.Done():
-				return 0, ctx.Err()
+				return nil, ctx.Err()
 			default:
 			}
 		}
+		i++
+
+		out = append(out, entity.Clone())
+	}
+	return out, nil
+}
 
-		eu := e.UpdatedAt().UnixNano()
+// restore stores an entity verbatim without recording it in the journal.
+//
+// Used when rebuilding state from durable media. The entity keeps its resource version
+// and the version counter is advanced past it.
+func (s *GenericStore[T]) restore(entity T) error {
+	if err := validateEntity(entity); err != nil {
+		return err
+	}
+
+	unlock := s.lock()
+	defer unlock()
+
+	s.load(entity.ID(), entity.Clone())
+	s.rev.observe(entity.ResourceVersion())
+	return nil
+}
 
-		// exact match -> start after it
-		if eu == cur.UpdatedAtUnixNano && e.ID() == cur.ID {
-			return i + 1, nil
+// put stamps next with the next revision, journals it and stores it.
+//
+// Must be called with s.mu held for writing; next must be owned by the store.
+// On a transaction view the write is applied at once but journaled and published on commit.
+func (s *GenericStore[T]) put(typ storage.EventType, id string, next T) error {
+	if s.tx != nil {
+		s.tx.stage(Entry{Kind: s.kind, Op: OpPut, ID: id, Entity: next}, s.undo(id), func(rev uint64) change {
+			next.SetResourceVersion(rev)
+			s.set(id, next)
+			return newChange(typ, s.kind, rev, id, next)
+		})
+		return nil
+	}
+
+	return s.rev.commit(func(rev uint64) (change, error) {
+		next.SetResourceVersion(rev)
+		if err := s.record(OpPut, id, next); err != nil {
+			return change{}, err
 		}
+		s.set(id, next)
+		return newChange(typ, s.kind, rev, id, next), nil
+	})
+}
 
-		// strictly after cursor in (DESC, ASC) order:
-		//   UpdatedAt smaller => later
-		//   UpdatedAt equal and ID greater => later
-		if eu < cur.UpdatedAtUnixNano {
-			return i, nil
+// undo returns a function restoring the current state of id.
+//
+// Must be called with s.mu held for writing.
+func (s *GenericStore[T]) undo(id string) func() {
+	prev, existed := s.data[id]
+	return func() {
+		if existed {
+			s.set(id, prev)
+		} else {
+			s.unset(id)
 		}
-		if eu == cur.UpdatedAtUnixNano && e.ID() > cur.ID {
-			return i, nil
+	}
+}
+
+// lock write-locks the collection, entering the store-wide gate first.
+func (s *GenericStore[T]) lock() (unlock func()) {
+	if s.gate != nil {
+		s.gate.RLock()
+	}
+	s.mu.Lock()
+	return func() {
+		s.mu.Unlock()
+		if s.gate != nil {
+			s.gate.RUnlock()
+		}
+	}
+}
+
+// rlock read-locks the collection, entering the store-wide gate first.
+func (s *GenericStore[T]) rlock() (unlock func()) {
+	if s.gate != nil {
+		s.gate.RLock()
+	}
+	s.mu.RLock()
+	return func() {
+		s.mu.RUnlock()
+		if s.gate != nil {
+			s.gate.RUnlock()
 		}
 	}
+}
 
-	// the cursor is after all items -> nothing left
-	return len(items), nil
+// view returns a transaction view sharing the collection's data.
+//
+// The caller must hold the store-wide gate exclusively for the lifetime of the view.
+func (s *GenericStore[T]) view(tx *txState) *GenericStore[T] {
+	return &GenericStore[T]{
+		table:   s.table,
+		kind:    s.kind,
+		journal: s.journal,
+		rev:     s.rev,
+		tx:      tx,
+	}
+}
+
+// settleShared sorts the table after restores before a read takes the shared lock.
+func (s *GenericStore[T]) settleShared() {
+	if !s.unsorted.Load() {
+		return
+	}
+	unlock := s.lock()
+	defer unlock()
+	s.settle()
+}
+
+// record forwards a mutation to the attached journal, if any.
+//
+// Must be called with s.mu held for writing.
+func (s *GenericStore[T]) record(op Op, id string, entity T) error {
+	if s.journal == nil {
+		return nil
+	}
+	if op == OpDelete {
+		return s.journal.Record(s.kind, op, id, nil)
+	}
+	return s.journal.Record(s.kind, op, id, entity)
 }
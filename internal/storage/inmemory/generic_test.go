@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"slices"
 	"testing"
 	"time"
 
@@ -16,6 +17,7 @@ type testEntity struct {
 	id        string
 	createdAt time.Time
 	updatedAt time.Time
+	version   uint64
 	payload   map[string]string
 }
 
@@ -28,9 +30,11 @@ func newTestEntity(id string, t time.Time) *testEntity {
 	}
 }
 
-func (e *testEntity) ID() string           { return e.id }
-func (e *testEntity) CreatedAt() time.Time { return e.createdAt }
-func (e *testEntity) UpdatedAt() time.Time { return e.updatedAt }
+func (e *testEntity) ID() string                  { return e.id }
+func (e *testEntity) CreatedAt() time.Time        { return e.createdAt }
+func (e *testEntity) UpdatedAt() time.Time        { return e.updatedAt }
+func (e *testEntity) ResourceVersion() uint64     { return e.version }
+func (e *testEntity) SetResourceVersion(v uint64) { e.version = v }
 func (e *testEntity) Clone() *testEntity {
 	if e == nil {
 		return nil
@@ -39,6 +43,7 @@ func (e *testEntity) Clone() *testEntity {
 		id:        e.id,
 		createdAt: e.createdAt,
 		updatedAt: e.updatedAt,
+		version:   e.version,
 	}
 	if e.payload != nil {
 		cp.payload = make(map[string]string, len(e.payload))
@@ -146,6 +151,65 @@ func TestGenericStore_UpsertReplace(t *testing.T) {
 	}
 }
 
+func TestGenericStore_UpsertResourceVersion(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewGenericStore[*testEntity]()
+
+	e := newTestEntity("a", time.Unix(10, 0).UTC())
+	if err := s.Upsert(ctx, e); err != nil {
+		t.Fatalf("Upsert() err=%v", err)
+	}
+	v1 := e.ResourceVersion()
+	if v1 == 0 {
+		t.Fatalf("expected a resource version to be set on the passed entity")
+	}
+
+	// Two readers of the same version: the first write wins, the second conflicts.
+	r1, _ := s.Get(ctx, "a")
+	r2, _ := s.Get(ctx, "a")
+	if r1.ResourceVersion() != v1 {
+		t.Fatalf("expected Get to return version %d, got=%d", v1, r1.ResourceVersion())
+	}
+	r1.payload["k"] = "r1"
+	if err := s.Upsert(ctx, r1); err != nil {
+		t.Fatalf("Upsert(r1) err=%v", err)
+	}
+	if r1.ResourceVersion() <= v1 {
+		t.Fatalf("expected version to increase, got=%d after %d", r1.ResourceVersion(), v1)
+	}
+	r2.payload["k"] = "r2"
+	if err := s.Upsert(ctx, r2); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("expected ErrConflict for stale version, err=%v", err)
+	}
+	if got, _ := s.Get(ctx, "a"); got.payload["k"] != "r1" {
+		t.Fatalf("expected conflicting write to be rejected, got=%v", got.payload)
+	}
+
+	// Update bumps the version as well.
+	err := s.Update(ctx, "a", func(cur *testEntity) (*testEntity, error) { return cur, nil })
+	if err != nil {
+		t.Fatalf("Update() err=%v", err)
+	}
+	if got, _ := s.Get(ctx, "a"); got.ResourceVersion() <= r1.ResourceVersion() {
+		t.Fatalf("expected Update to bump version, got=%d", got.ResourceVersion())
+	}
+
+	// A conditional upsert of a deleted entity conflicts instead of recreating it.
+	if err = s.Delete(ctx, "a"); err != nil {
+		t.Fatalf("Delete() err=%v", err)
+	}
+	if err = s.Upsert(ctx, r1); !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("expected ErrConflict for deleted entity, err=%v", err)
+	}
+
+	// Zero version is unconditional.
+	if err = s.Upsert(ctx, newTestEntity("a", time.Unix(30, 0).UTC())); err != nil {
+		t.Fatalf("unconditional Upsert() err=%v", err)
+	}
+}
+
 func TestGenericStore_Update(t *testing.T) {
 	t.Parallel()
 
@@ -280,6 +344,125 @@ func TestGenericStore_List_Filtering(t *testing.T) {
 	}
 }
 
+// payloadIndex indexes test entities by every payload value.
+var payloadIndex = Index[*testEntity]{Name: "payload", Keys: func(e *testEntity) []string {
+	keys := make([]string, 0, len(e.payload))
+	for _, v := range e.payload {
+		keys = append(keys, v)
+	}
+	return keys
+}}
+
+func ids(items []*testEntity) []string {
+	out := make([]string, 0, len(items))
+	for _, e := range items {
+		out = append(out, e.ID())
+	}
+	return out
+}
+
+func TestGenericStore_Index(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewGenericStore(payloadIndex)
+
+	a := newTestEntity("a", time.Unix(1, 0).UTC())
+	a.payload = map[string]string{"x": "red", "y": "red", "z": "blue"} // duplicate keys are indexed once
+	b := newTestEntity("b", time.Unix(2, 0).UTC())
+	b.payload = map[string]string{"x": "red"}
+	c := newTestEntity("c", time.Unix(3, 0).UTC())
+	c.payload = map[string]string{"x": "green"}
+	for _, e := range []*testEntity{a, b, c} {
+		if err := s.Upsert(ctx, e); err != nil {
+			t.Fatalf("Upsert(%s) err=%v", e.ID(), err)
+		}
+	}
+
+	got, err := s.ByIndex(ctx, "payload", "red")
+	if err != nil {
+		t.Fatalf("ByIndex() err=%v", err)
+	}
+	if want := []string{"b", "a"}; !slices.Equal(ids(got), want) {
+		t.Fatalf("expected %v in list order, got=%v", want, ids(got))
+	}
+
+	// An update moves the entity between buckets and within the order.
+	err = s.Update(ctx, "a", func(cur *testEntity) (*testEntity, error) {
+		cur.updatedAt = time.Unix(4, 0).UTC()
+		cur.payload = map[string]string{"x": "green"}
+		return cur, nil
+	})
+	if err != nil {
+		t.Fatalf("Update() err=%v", err)
+	}
+	if got, _ = s.ByIndex(ctx, "payload", "red"); !slices.Equal(ids(got), []string{"b"}) {
+		t.Fatalf("expected a to leave the red bucket, got=%v", ids(got))
+	}
+	if got, _ = s.ByIndex(ctx, "payload", "blue"); len(got) != 0 {
+		t.Fatalf("expected the blue bucket to be empty, got=%v", ids(got))
+	}
+
+	page1, err := s.ListByIndex(ctx, "payload", "green", nil, storage.ListOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("ListByIndex() err=%v", err)
+	}
+	if !slices.Equal(ids(page1.Items), []string{"a"}) || page1.NextCursor == "" {
+		t.Fatalf("unexpected first page: %v cursor=%q", ids(page1.Items), page1.NextCursor)
+	}
+	page2, err := s.ListByIndex(ctx, "payload", "green", nil, storage.ListOptions{Limit: 1, Cursor: page1.NextCursor})
+	if err != nil {
+		t.Fatalf("ListByIndex(page2) err=%v", err)
+	}
+	if !slices.Equal(ids(page2.Items), []string{"c"}) || page2.NextCursor != "" {
+		t.Fatalf("unexpected second page: %v cursor=%q", ids(page2.Items), page2.NextCursor)
+	}
+
+	if err = s.Delete(ctx, "c"); err != nil {
+		t.Fatalf("Delete() err=%v", err)
+	}
+	if got, _ = s.ByIndex(ctx, "payload", "green"); !slices.Equal(ids(got), []string{"a"}) {
+		t.Fatalf("expected c to leave the index, got=%v", ids(got))
+	}
+
+	if _, err = s.ByIndex(ctx, "missing", "red"); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument for unknown index, err=%v", err)
+	}
+}
+
+func TestGenericStore_RestoreSortsLazily(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := NewGenericStore(payloadIndex)
+
+	for i, id := range []string{"b", "d", "a", "c"} {
+		e := newTestEntity(id, time.Unix(int64(i%2), 0).UTC())
+		if err := s.restore(e); err != nil {
+			t.Fatalf("restore(%s) err=%v", id, err)
+		}
+	}
+
+	res, err := s.List(ctx, nil, storage.ListOptions{})
+	if err != nil {
+		t.Fatalf("List() err=%v", err)
+	}
+	if want := []string{"c", "d", "a", "b"}; !slices.Equal(ids(res.Items), want) {
+		t.Fatalf("expected %v after restore, got=%v", want, ids(res.Items))
+	}
+	if got, _ := s.ByIndex(ctx, "payload", "v"); !slices.Equal(ids(got), []string{"c", "d", "a", "b"}) {
+		t.Fatalf("expected the index bucket in list order, got=%v", ids(got))
+	}
+
+	// Writes after a restore keep the order.
+	if err = s.Upsert(ctx, newTestEntity("e", time.Unix(5, 0).UTC())); err != nil {
+		t.Fatalf("Upsert() err=%v", err)
+	}
+	if res, _ = s.List(ctx, nil, storage.ListOptions{Limit: 1}); res.Items[0].ID() != "e" {
+		t.Fatalf("expected e first, got=%v", ids(res.Items))
+	}
+}
+
 func TestCursor_BackendValidation(t *testing.T) {
 	t.Parallel()
 
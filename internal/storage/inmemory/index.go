@@ -0,0 +1,211 @@
+package inmemory
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/soltiHQ/control-plane/domain"
+)
+
+// IndexFunc returns the secondary index keys of an entity.
+//
+// An entity may have no key (it is then absent from the index), one key, or several
+// (e.g. one per label). Keys must depend only on the entity's state: stored entities
+// are never mutated, so the keys computed on insert are the ones removed later.
+type IndexFunc[T any] func(entity T) []string
+
+// Index declares a named secondary index of a GenericStore.
+type Index[T any] struct {
+	Name string
+	Keys IndexFunc[T]
+}
+
+// IndexKey joins the parts of a compound index key, e.g. IndexKey(userID, string(auth)).
+func IndexKey(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// table is the state of a collection: entities by ID, the list order and the secondary indexes.
+//
+// A GenericStore and its transaction views share one table.
+type table[T domain.Entity[T]] struct {
+	data    map[string]T
+	order   sorted[T]
+	indexes map[string]*index[T]
+
+	// unsorted is set by restore, which appends without ordering; the first access that
+	// needs the order sorts everything once, so bulk loads stay O(n log n).
+	unsorted atomic.Bool
+}
+
+func newTable[T domain.Entity[T]](indexes []Index[T]) *table[T] {
+	t := &table[T]{
+		data:    make(map[string]T),
+		indexes: make(map[string]*index[T], len(indexes)),
+	}
+	for _, ix := range indexes {
+		if ix.Name == "" || ix.Keys == nil {
+			panic("inmemory: index name or key func is empty")
+		}
+		if _, ok := t.indexes[ix.Name]; ok {
+			panic("inmemory: duplicate index " + ix.Name)
+		}
+		t.indexes[ix.Name] = &index[T]{keys: ix.Keys, buckets: make(map[string]sorted[T])}
+	}
+	return t
+}
+
+// set stores entity under id, replacing the previous state in the order and indexes.
+//
+// Must be called with the collection write-locked.
+func (t *table[T]) set(id string, entity T) {
+	t.settle()
+	if prev, ok := t.data[id]; ok {
+		t.detach(prev)
+	}
+	t.data[id] = entity
+	t.order.insert(entity)
+	for _, ix := range t.indexes {
+		ix.add(entity)
+	}
+}
+
+// unset removes the entity stored under id, if any.
+//
+// Must be called with the collection write-locked.
+func (t *table[T]) unset(id string) {
+	t.settle()
+	if prev, ok := t.data[id]; ok {
+		t.detach(prev)
+		delete(t.data, id)
+	}
+}
+
+// load stores entity without ordering it; see unsorted.
+//
+// Must be called with the collection write-locked.
+func (t *table[T]) load(id string, entity T) {
+	if prev, ok := t.data[id]; ok {
+		t.settle()
+		t.detach(prev)
+	}
+	t.data[id] = entity
+	t.order = append(t.order, entity)
+	for _, ix := range t.indexes {
+		for _, k := range ix.keysOf(entity) {
+			ix.buckets[k] = append(ix.buckets[k], entity)
+		}
+	}
+	t.unsorted.Store(true)
+}
+
+func (t *table[T]) detach(prev T) {
+	t.order.remove(prev)
+	for _, ix := range t.indexes {
+		ix.remove(prev)
+	}
+}
+
+// settle sorts the order and the index buckets after restores.
+//
+// Must be called with the collection write-locked.
+func (t *table[T]) settle() {
+	if !t.unsorted.Load() {
+		return
+	}
+	t.order.sort()
+	for _, ix := range t.indexes {
+		for _, b := range ix.buckets {
+			b.sort()
+		}
+	}
+	t.unsorted.Store(false)
+}
+
+// index maps keys to the entities having them, each bucket kept in list order.
+type index[T domain.Entity[T]] struct {
+	keys    IndexFunc[T]
+	buckets map[string]sorted[T]
+}
+
+// keysOf returns the distinct keys of entity.
+func (ix *index[T]) keysOf(entity T) []string {
+	keys := ix.keys(entity)
+	if len(keys) < 2 {
+		return keys
+	}
+	keys = slices.Clone(keys)
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+func (ix *index[T]) add(entity T) {
+	for _, k := range ix.keysOf(entity) {
+		b := ix.buckets[k]
+		b.insert(entity)
+		ix.buckets[k] = b
+	}
+}
+
+func (ix *index[T]) remove(entity T) {
+	for _, k := range ix.keysOf(entity) {
+		b := ix.buckets[k]
+		b.remove(entity)
+		if len(b) == 0 {
+			delete(ix.buckets, k)
+		} else {
+			ix.buckets[k] = b
+		}
+	}
+}
+
+// sorted holds entities in list order: (UpdatedAt DESC, ID ASC).
+//
+// Lookups are binary searches; inserts and removals shift the tail of the slice.
+type sorted[T domain.Entity[T]] []T
+
+// precedes reports whether e sorts strictly before the position (updatedAt, id).
+func precedes[T domain.Entity[T]](e T, updatedAt int64, id string) bool {
+	u := e.UpdatedAt().UnixNano()
+	return u > updatedAt || (u == updatedAt && e.ID() < id)
+}
+
+// search returns the index of the first entity not before (updatedAt, id).
+func (s sorted[T]) search(updatedAt int64, id string) int {
+	return sort.Search(len(s), func(i int) bool { return !precedes(s[i], updatedAt, id) })
+}
+
+// after returns the index of the first entity strictly after the cursor position.
+func (s sorted[T]) after(c cursor) int {
+	i := s.search(c.UpdatedAtUnixNano, c.ID)
+	if i < len(s) && s[i].ID() == c.ID && s[i].UpdatedAt().UnixNano() == c.UpdatedAtUnixNano {
+		i++
+	}
+	return i
+}
+
+func (s *sorted[T]) insert(e T) {
+	i := s.search(e.UpdatedAt().UnixNano(), e.ID())
+	*s = slices.Insert(*s, i, e)
+}
+
+func (s *sorted[T]) remove(e T) {
+	i := s.search(e.UpdatedAt().UnixNano(), e.ID())
+	if i < len(*s) && (*s)[i].ID() == e.ID() {
+		*s = slices.Delete(*s, i, i+1)
+	}
+}
+
+func (s sorted[T]) sort() {
+	slices.SortFunc(s, func(a, b T) int {
+		if precedes(a, b.UpdatedAt().UnixNano(), b.ID()) {
+			return -1
+		}
+		if precedes(b, a.UpdatedAt().UnixNano(), a.ID()) {
+			return 1
+		}
+		return 0
+	})
+}
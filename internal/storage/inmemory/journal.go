@@ -0,0 +1,65 @@
+package inmemory
+
+import "github.com/soltiHQ/control-plane/internal/storage"
+
+// Op identifies a mutation recorded in a Journal.
+type Op uint8
+
+const (
+	// OpPut records an insert or a full replacement of an entity.
+	OpPut Op = iota + 1
+	// OpDelete records the removal of an entity.
+	OpDelete
+)
+
+// String returns the human-readable operation label.
+func (o Op) String() string {
+	switch o {
+	case OpPut:
+		return "put"
+	case OpDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Journal receives every mutation applied to a Store.
+//
+// Record is called while the affected collection is write-locked, before the
+// change becomes visible to readers. Returning an error aborts the mutation and
+// the error is returned to the caller unchanged, so a journal backed by durable
+// media gives write-ahead semantics: nothing is acknowledged that was not recorded.
+//
+// For OpPut, entity is the value about to be stored; it must not be retained or mutated.
+// For OpDelete, entity is nil.
+type Journal interface {
+	Record(k storage.Kind, op Op, id string, entity any) error
+}
+
+// Entry is one mutation of a committed transaction.
+type Entry struct {
+	Kind   storage.Kind
+	Op     Op
+	ID     string
+	Entity any // nil for OpDelete
+}
+
+// BatchJournal is a Journal that records the mutations of a transaction as one unit.
+//
+// RecordBatch is called once per committed transaction, before any of its writes
+// becomes visible. It must record either all entries or none. A plain Journal gets
+// the entries one Record call at a time instead: the store stays all-or-nothing in
+// memory, but a failure halfway may leave a prefix of the transaction recorded.
+type BatchJournal interface {
+	Journal
+	RecordBatch(entries []Entry) error
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithJournal attaches a journal that records every mutation of the store.
+func WithJournal(j Journal) Option {
+	return func(s *Store) { s.journal = j }
+}
@@ -0,0 +1,89 @@
+package inmemory
+
+import (
+	"sync"
+
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+// revision sequences the writes of a Store.
+//
+// It hands out resource versions in commit order and, when a feed is attached,
+// publishes one change per committed write. Collections call commit while holding
+// their own write lock, so the lock order is always collection → revision.
+type revision struct {
+	mu   sync.Mutex
+	n    uint64 // last committed revision
+	feed *feed  // nil for standalone GenericStores
+}
+
+// commit runs fn with the next revision and publishes the change it returns.
+//
+// If fn fails, the revision is not consumed and nothing is published.
+func (r *revision) commit(fn func(rev uint64) (change, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := fn(r.n + 1)
+	if err != nil {
+		return err
+	}
+	r.n++
+	if r.feed != nil {
+		r.feed.publish(c)
+	}
+	return nil
+}
+
+// observe raises the counter to at least v so that restored versions are never reissued.
+func (r *revision) observe(v uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if v > r.n {
+		r.n = v
+	}
+}
+
+// current returns the last committed revision.
+func (r *revision) current() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.n
+}
+
+// change is a committed write as retained by the feed.
+type change struct {
+	// obj is the stored entity (for deletes, the last stored state). The store never
+	// mutates stored entities in place, so it is safe to match on, but it must be
+	// cloned before it leaves the package.
+	obj   any
+	clone func() any
+
+	id   string
+	kind storage.Kind
+	rev  uint64
+	typ  storage.EventType
+}
+
+func newChange[T interface{ Clone() T }](typ storage.EventType, k storage.Kind, rev uint64, id string, obj T) change {
+	return change{
+		obj:   obj,
+		clone: func() any { return obj.Clone() },
+		id:    id,
+		kind:  k,
+		rev:   rev,
+		typ:   typ,
+	}
+}
+
+func (c change) event() storage.Event {
+	return storage.Event{
+		Object:   c.clone(),
+		ID:       c.id,
+		Kind:     c.kind,
+		Revision: c.rev,
+		Type:     c.typ,
+	}
+}
@@ -2,11 +2,15 @@ package inmemory
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
+	"github.com/soltiHQ/control-plane/domain"
 	"github.com/soltiHQ/control-plane/domain/kind"
 	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/domain/selector"
 	"github.com/soltiHQ/control-plane/internal/storage"
 )
 
@@ -21,6 +25,8 @@ var (
 	_ storage.SessionStore   = (*Store)(nil)
 	_ storage.SpecStore  = (*Store)(nil)
 	_ storage.RolloutStore = (*Store)(nil)
+	_ storage.SpecRevisionStore = (*Store)(nil)
+	_ storage.DeploymentStore = (*Store)(nil)
 )
 
 // Store provides an in-memory implementation of storage.Storage using GenericStore.
@@ -33,20 +39,227 @@ type Store struct {
 	sessions    *GenericStore[*model.Session]
 	specs   *GenericStore[*model.Spec]
 	rollouts *GenericStore[*model.Rollout]
+	revisions *GenericStore[*model.SpecRevision]
+	deployments *GenericStore[*model.Deployment]
+
+	journal Journal
+	rev     *revision
+
+	// gate serializes transactions against every other operation: single operations
+	// hold it shared, InTx holds it exclusively.
+	gate sync.RWMutex
+	// tx is set on the view passed to a transaction function.
+	tx *txState
 }
 
 // New creates a new in-memory store with an empty state.
-func New() *Store {
-	return &Store{
-		agents:      NewGenericStore[*model.Agent](),
-		users:       NewGenericStore[*model.User](),
-		roles:       NewGenericStore[*model.Role](),
-		credentials: NewGenericStore[*model.Credential](),
-		verifiers:   NewGenericStore[*model.Verifier](),
-		sessions:    NewGenericStore[*model.Session](),
-		specs:   NewGenericStore[*model.Spec](),
-		rollouts: NewGenericStore[*model.Rollout](),
+func New(opts ...Option) *Store {
+	s := &Store{rev: &revision{feed: newFeed()}}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.agents = newCollection(s, storage.KindAgent,
+		Index[*model.Agent]{Name: indexLabel, Keys: agentLabelKeys},
+	)
+	s.users = newCollection(s, storage.KindUser,
+		Index[*model.User]{Name: indexSubject, Keys: keyOf((*model.User).Subject)},
+	)
+	s.roles = newCollection(s, storage.KindRole,
+		Index[*model.Role]{Name: indexName, Keys: keyOf((*model.Role).Name)},
+	)
+	s.credentials = newCollection(s, storage.KindCredential,
+		Index[*model.Credential]{Name: indexUser, Keys: keyOf((*model.Credential).UserID)},
+		Index[*model.Credential]{Name: indexUserAuth, Keys: keyOf(credentialUserAuthKey)},
+	)
+	s.verifiers = newCollection(s, storage.KindVerifier,
+		Index[*model.Verifier]{Name: indexCredential, Keys: keyOf((*model.Verifier).CredentialID)},
+	)
+	s.sessions = newCollection(s, storage.KindSession,
+		Index[*model.Session]{Name: indexUser, Keys: keyOf((*model.Session).UserID)},
+	)
+	s.specs = newCollection[*model.Spec](s, storage.KindSpec)
+	s.revisions = newCollection(s, storage.KindSpecRevision,
+		Index[*model.SpecRevision]{Name: indexSpec, Keys: keyOf((*model.SpecRevision).SpecID)},
+	)
+	s.deployments = newCollection(s, storage.KindDeployment,
+		Index[*model.Deployment]{Name: indexSpec, Keys: keyOf((*model.Deployment).SpecID)},
+	)
+	s.rollouts = newCollection(s, storage.KindRollout,
+		Index[*model.Rollout]{Name: indexSpec, Keys: keyOf((*model.Rollout).SpecID)},
+		Index[*model.Rollout]{Name: indexAgent, Keys: keyOf((*model.Rollout).AgentID)},
+	)
+	return s
+}
+
+// Secondary indexes of the Store collections.
+const (
+	indexLabel      = "label"      // agents by IndexKey(label key, value)
+	indexSubject    = "subject"    // users by subject
+	indexName       = "name"       // roles by name
+	indexUser       = "user"       // credentials and sessions by user ID
+	indexUserAuth   = "user_auth"  // credentials by IndexKey(user ID, auth kind)
+	indexCredential = "credential" // verifiers by credential ID
+	indexSpec       = "spec"       // rollouts, spec revisions and deployments by spec ID
+	indexAgent      = "agent"      // rollouts by agent ID
+)
+
+// keyOf turns a single-valued attribute into an IndexFunc; empty values are not indexed.
+func keyOf[T any](attr func(T) string) IndexFunc[T] {
+	return func(e T) []string {
+		if k := attr(e); k != "" {
+			return []string{k}
+		}
+		return nil
+	}
+}
+
+func agentLabelKeys(a *model.Agent) []string {
+	labels := a.LabelsAll()
+	keys := make([]string, 0, len(labels))
+	for k, v := range labels {
+		keys = append(keys, IndexKey(k, v))
+	}
+	return keys
+}
+
+func credentialUserAuthKey(c *model.Credential) string {
+	return IndexKey(c.UserID(), string(c.AuthKind()))
+}
+
+// single returns the only result of a lookup on a unique index.
+//
+// More than one result means the uniqueness invariant was broken: ErrInternal.
+func single[T any](items []T, err error, what string) (T, error) {
+	var zero T
+	switch {
+	case err != nil:
+		return zero, err
+	case len(items) == 0:
+		return zero, storage.ErrNotFound
+	case len(items) > 1:
+		return zero, fmt.Errorf("%w: non-unique %s", storage.ErrInternal, what)
+	default:
+		return items[0], nil
+	}
+}
+
+// listHinted lists through the index named by hint, or the whole collection without one.
+func listHinted[T domain.Entity[T]](ctx context.Context, g *GenericStore[T], hint indexHint, predicate func(T) bool, opts storage.ListOptions) (*storage.ListResult[T], error) {
+	if hint.name == "" {
+		return g.List(ctx, predicate, opts)
+	}
+	return g.ListByIndex(ctx, hint.name, hint.key, predicate, opts)
+}
+
+// collectHinted is listHinted over every page.
+func collectHinted[T domain.Entity[T]](ctx context.Context, g *GenericStore[T], hint indexHint, predicate func(T) bool) ([]T, error) {
+	var (
+		out  []T
+		opts = storage.ListOptions{Limit: storage.MaxListLimit}
+	)
+	for {
+		res, err := listHinted(ctx, g, hint, predicate, opts)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, res.Items...)
+		if res.NextCursor == "" {
+			return out, nil
+		}
+		opts.Cursor = res.NextCursor
+	}
+}
+
+func newCollection[T domain.Entity[T]](s *Store, k storage.Kind, indexes ...Index[T]) *GenericStore[T] {
+	g := NewGenericStore(indexes...)
+	g.kind = k
+	g.journal = s.journal
+	g.rev = s.rev
+	g.gate = &s.gate
+	return g
+}
+
+// Restore loads an entity verbatim, bypassing the journal.
+//
+// It is meant for backends rebuilding state from durable media before the store
+// starts serving requests; regular callers must use the Upsert/Create methods.
+// The entity keeps its resource version; later writes are assigned greater ones.
+// Returns storage.ErrInvalidArgument for nil or unsupported entities.
+func (s *Store) Restore(entity any) error {
+	switch e := entity.(type) {
+	case *model.Agent:
+		return s.agents.restore(e)
+	case *model.User:
+		return s.users.restore(e)
+	case *model.Role:
+		return s.roles.restore(e)
+	case *model.Credential:
+		return s.credentials.restore(e)
+	case *model.Verifier:
+		return s.verifiers.restore(e)
+	case *model.Session:
+		return s.sessions.restore(e)
+	case *model.Spec:
+		return s.specs.restore(e)
+	case *model.SpecRevision:
+		return s.revisions.restore(e)
+	case *model.Deployment:
+		return s.deployments.restore(e)
+	case *model.Rollout:
+		return s.rollouts.restore(e)
+	default:
+		return storage.ErrInvalidArgument
+	}
+}
+
+// Range calls fn with a clone of every stored entity, collection by collection in storage.Kinds order.
+//
+// Each collection is copied under its own read lock: the view is consistent per collection,
+// not across collections. Iteration stops at the first error returned by fn.
+func (s *Store) Range(ctx context.Context, fn func(entity any) error) error {
+	for _, k := range storage.Kinds {
+		var err error
+		switch k {
+		case storage.KindAgent:
+			err = rangeCollection(ctx, s.agents, fn)
+		case storage.KindUser:
+			err = rangeCollection(ctx, s.users, fn)
+		case storage.KindRole:
+			err = rangeCollection(ctx, s.roles, fn)
+		case storage.KindCredential:
+			err = rangeCollection(ctx, s.credentials, fn)
+		case storage.KindVerifier:
+			err = rangeCollection(ctx, s.verifiers, fn)
+		case storage.KindSession:
+			err = rangeCollection(ctx, s.sessions, fn)
+		case storage.KindSpec:
+			err = rangeCollection(ctx, s.specs, fn)
+		case storage.KindSpecRevision:
+			err = rangeCollection(ctx, s.revisions, fn)
+		case storage.KindDeployment:
+			err = rangeCollection(ctx, s.deployments, fn)
+		case storage.KindRollout:
+			err = rangeCollection(ctx, s.rollouts, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rangeCollection[T domain.Entity[T]](ctx context.Context, g *GenericStore[T], fn func(entity any) error) error {
+	items, err := g.all(ctx)
+	if err != nil {
+		return err
 	}
+	for _, item := range items {
+		if err = fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // --- Agents ---
@@ -63,7 +276,10 @@ func (s *Store) GetAgent(ctx context.Context, id string) (*model.Agent, error) {
 }
 
 func (s *Store) ListAgents(ctx context.Context, filter storage.AgentFilter, opts storage.ListOptions) (*storage.AgentListResult, error) {
-	var predicate func(*model.Agent) bool
+	var (
+		predicate func(*model.Agent) bool
+		hint      indexHint
+	)
 
 	if filter != nil {
 		f, ok := filter.(*AgentFilter)
@@ -71,8 +287,14 @@ func (s *Store) ListAgents(ctx context.Context, filter storage.AgentFilter, opts
 			return nil, storage.ErrInvalidArgument
 		}
 		predicate = f.Matches
+		hint = f.hint
 	}
-	return s.agents.List(ctx, predicate, opts)
+	return listHinted(ctx, s.agents, hint, predicate, opts)
+}
+
+func (s *Store) ListAgentsBySelector(ctx context.Context, sel selector.Selector) ([]*model.Agent, error) {
+	f := NewAgentFilter().BySelector(sel)
+	return collectHinted(ctx, s.agents, f.hint, f.Matches)
 }
 
 func (s *Store) DeleteAgent(ctx context.Context, id string) error {
@@ -96,36 +318,8 @@ func (s *Store) GetUserBySubject(ctx context.Context, subject string) (*model.Us
 	if subject == "" {
 		return nil, storage.ErrInvalidArgument
 	}
-
-	s.users.mu.RLock()
-	defer s.users.mu.RUnlock()
-
-	var (
-		found *model.User
-		i     int
-	)
-	for _, u := range s.users.data {
-		if i%1000 == 0 {
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			default:
-			}
-		}
-		i++
-
-		if u.Subject() != subject {
-			continue
-		}
-		if found != nil {
-			return nil, fmt.Errorf("%w: non-unique user subject %q", storage.ErrInternal, subject)
-		}
-		found = u
-	}
-	if found == nil {
-		return nil, storage.ErrNotFound
-	}
-	return found.Clone(), nil
+	users, err := s.users.ByIndex(ctx, indexSubject, subject)
+	return single(users, err, fmt.Sprintf("user subject %q", subject))
 }
 
 func (s *Store) ListUsers(ctx context.Context, filter storage.UserFilter, opts storage.ListOptions) (*storage.UserListResult, error) {
@@ -163,51 +357,15 @@ func (s *Store) GetCredentialByUserAndAuth(ctx context.Context, userID string, a
 	if userID == "" {
 		return nil, storage.ErrInvalidArgument
 	}
-
-	s.credentials.mu.RLock()
-	defer s.credentials.mu.RUnlock()
-
-	var (
-		found *model.Credential
-		i     int
-	)
-	for _, c := range s.credentials.data {
-		if i%1000 == 0 {
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			default:
-			}
-		}
-		i++
-
-		if c.UserID() != userID || c.AuthKind() != auth {
-			continue
-		}
-		if found != nil {
-			return nil, fmt.Errorf("%w: non-unique credential for user %q auth %q", storage.ErrInternal, userID, auth)
-		}
-		found = c
-	}
-	if found == nil {
-		return nil, storage.ErrNotFound
-	}
-	return found.Clone(), nil
+	creds, err := s.credentials.ByIndex(ctx, indexUserAuth, IndexKey(userID, string(auth)))
+	return single(creds, err, fmt.Sprintf("credential for user %q auth %q", userID, auth))
 }
 
 func (s *Store) ListCredentialsByUser(ctx context.Context, userID string) ([]*model.Credential, error) {
 	if userID == "" {
 		return nil, storage.ErrInvalidArgument
 	}
-
-	res, err := s.credentials.List(ctx, func(c *model.Credential) bool {
-		return c.UserID() == userID
-	}, storage.ListOptions{Limit: storage.MaxListLimit})
-	if err != nil {
-		return nil, err
-	}
-
-	return res.Items, nil
+	return s.credentials.ByIndex(ctx, indexUser, userID)
 }
 
 func (s *Store) DeleteCredential(ctx context.Context, id string) error {
@@ -231,36 +389,8 @@ func (s *Store) GetVerifierByCredential(ctx context.Context, credentialID string
 	if credentialID == "" {
 		return nil, storage.ErrInvalidArgument
 	}
-
-	s.verifiers.mu.RLock()
-	defer s.verifiers.mu.RUnlock()
-
-	var (
-		found *model.Verifier
-		i     int
-	)
-	for _, v := range s.verifiers.data {
-		if i%1000 == 0 {
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			default:
-			}
-		}
-		i++
-
-		if v.CredentialID() != credentialID {
-			continue
-		}
-		if found != nil {
-			return nil, fmt.Errorf("%w: non-unique verifier for credential %q", storage.ErrInternal, credentialID)
-		}
-		found = v
-	}
-	if found == nil {
-		return nil, storage.ErrNotFound
-	}
-	return found.Clone(), nil
+	verifiers, err := s.verifiers.ByIndex(ctx, indexCredential, credentialID)
+	return single(verifiers, err, fmt.Sprintf("verifier for credential %q", credentialID))
 }
 
 func (s *Store) DeleteVerifier(ctx context.Context, id string) error {
@@ -272,30 +402,14 @@ func (s *Store) DeleteVerifierByCredential(ctx context.Context, credentialID str
 		return storage.ErrInvalidArgument
 	}
 
-	s.verifiers.mu.RLock()
-	var (
-		ids = make([]string, 0, 1)
-		i   = 0
-	)
-	for id, v := range s.verifiers.data {
-		if i%1000 == 0 {
-			select {
-			case <-ctx.Done():
-				s.verifiers.mu.RUnlock()
-				return ctx.Err()
-			default:
-			}
-		}
-		i++
-
-		if v.CredentialID() == credentialID {
-			ids = append(ids, id)
-		}
+	verifiers, err := s.verifiers.ByIndex(ctx, indexCredential, credentialID)
+	if err != nil {
+		return err
 	}
-	s.verifiers.mu.RUnlock()
-
-	for _, id := range ids {
-		_ = s.verifiers.Delete(ctx, id)
+	for _, v := range verifiers {
+		if err = s.verifiers.Delete(ctx, v.ID()); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
 	}
 	return nil
 }
@@ -317,14 +431,7 @@ func (s *Store) ListSessionsByUser(ctx context.Context, userID string) ([]*model
 	if userID == "" {
 		return nil, storage.ErrInvalidArgument
 	}
-
-	res, err := s.sessions.List(ctx, func(sess *model.Session) bool {
-		return sess.UserID() == userID
-	}, storage.ListOptions{Limit: storage.MaxListLimit})
-	if err != nil {
-		return nil, err
-	}
-	return res.Items, nil
+	return s.sessions.ByIndex(ctx, indexUser, userID)
 }
 
 func (s *Store) RotateRefresh(ctx context.Context, sessionID string, newHash []byte, newExpiresAt time.Time) error {
@@ -372,7 +479,9 @@ func (s *Store) DeleteSessionsByUser(ctx context.Context, userID string) error {
 		if sess == nil {
 			continue
 		}
-		_ = s.sessions.Delete(ctx, sess.ID())
+		if err = s.sessions.Delete(ctx, sess.ID()); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
 	}
 	return nil
 }
@@ -435,41 +544,15 @@ func (s *Store) GetRoleByName(ctx context.Context, name string) (*model.Role, er
 	if name == "" {
 		return nil, storage.ErrInvalidArgument
 	}
-
-	s.roles.mu.RLock()
-	defer s.roles.mu.RUnlock()
-
-	var (
-		found *model.Role
-		i     int
-	)
-	for _, r := range s.roles.data {
-		if i%1000 == 0 {
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			default:
-			}
-		}
-		i++
-
-		if r.Name() != name {
-			continue
-		}
-		if found != nil {
-			return nil, fmt.Errorf("%w: non-unique role name %q", storage.ErrInternal, name)
-		}
-		found = r
-	}
-
-	if found == nil {
-		return nil, storage.ErrNotFound
-	}
-	return found.Clone(), nil
+	roles, err := s.roles.ByIndex(ctx, indexName, name)
+	return single(roles, err, fmt.Sprintf("role name %q", name))
 }
 
 func (s *Store) ListRoles(ctx context.Context, filter storage.RoleFilter, opts storage.ListOptions) (*storage.RoleListResult, error) {
-	var predicate func(*model.Role) bool
+	var (
+		predicate func(*model.Role) bool
+		hint      indexHint
+	)
 
 	if filter != nil {
 		f, ok := filter.(*RoleFilter)
@@ -477,8 +560,9 @@ func (s *Store) ListRoles(ctx context.Context, filter storage.RoleFilter, opts s
 			return nil, storage.ErrInvalidArgument
 		}
 		predicate = f.Matches
+		hint = f.hint
 	}
-	return s.roles.List(ctx, predicate, opts)
+	return listHinted(ctx, s.roles, hint, predicate, opts)
 }
 
 func (s *Store) DeleteRole(ctx context.Context, id string) error {
@@ -515,6 +599,80 @@ func (s *Store) DeleteSpec(ctx context.Context, id string) error {
 	return s.specs.Delete(ctx, id)
 }
 
+// --- Spec revisions ---
+
+func (s *Store) CreateSpecRevision(ctx context.Context, r *model.SpecRevision) error {
+	if r == nil {
+		return storage.ErrInvalidArgument
+	}
+	return s.revisions.Create(ctx, r)
+}
+
+func (s *Store) GetSpecRevision(ctx context.Context, id string) (*model.SpecRevision, error) {
+	return s.revisions.Get(ctx, id)
+}
+
+func (s *Store) ListSpecRevisionsBySpec(ctx context.Context, specID string) ([]*model.SpecRevision, error) {
+	if specID == "" {
+		return nil, storage.ErrInvalidArgument
+	}
+	return s.revisions.ByIndex(ctx, indexSpec, specID)
+}
+
+func (s *Store) DeleteSpecRevisionsBySpec(ctx context.Context, specID string) error {
+	if specID == "" {
+		return storage.ErrInvalidArgument
+	}
+
+	revisions, err := s.revisions.ByIndex(ctx, indexSpec, specID)
+	if err != nil {
+		return err
+	}
+	for _, r := range revisions {
+		if err = s.revisions.Delete(ctx, r.ID()); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- Deployments ---
+
+func (s *Store) UpsertDeployment(ctx context.Context, d *model.Deployment) error {
+	if d == nil {
+		return storage.ErrInvalidArgument
+	}
+	return s.deployments.Upsert(ctx, d)
+}
+
+func (s *Store) GetDeployment(ctx context.Context, id string) (*model.Deployment, error) {
+	return s.deployments.Get(ctx, id)
+}
+
+func (s *Store) ListDeploymentsBySpec(ctx context.Context, specID string) ([]*model.Deployment, error) {
+	if specID == "" {
+		return nil, storage.ErrInvalidArgument
+	}
+	return s.deployments.ByIndex(ctx, indexSpec, specID)
+}
+
+func (s *Store) DeleteDeploymentsBySpec(ctx context.Context, specID string) error {
+	if specID == "" {
+		return storage.ErrInvalidArgument
+	}
+
+	deployments, err := s.deployments.ByIndex(ctx, indexSpec, specID)
+	if err != nil {
+		return err
+	}
+	for _, d := range deployments {
+		if err = s.deployments.Delete(ctx, d.ID()); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
 // --- Rollouts ---
 
 func (s *Store) UpsertRollout(ctx context.Context, ss *model.Rollout) error {
@@ -529,7 +687,10 @@ func (s *Store) GetRollout(ctx context.Context, id string) (*model.Rollout, erro
 }
 
 func (s *Store) ListRollouts(ctx context.Context, filter storage.RolloutFilter, opts storage.ListOptions) (*storage.RolloutListResult, error) {
-	var predicate func(*model.Rollout) bool
+	var (
+		predicate func(*model.Rollout) bool
+		hint      indexHint
+	)
 
 	if filter != nil {
 		f, ok := filter.(*RolloutFilter)
@@ -537,8 +698,23 @@ func (s *Store) ListRollouts(ctx context.Context, filter storage.RolloutFilter,
 			return nil, storage.ErrInvalidArgument
 		}
 		predicate = f.Matches
+		hint = f.hint
 	}
-	return s.rollouts.List(ctx, predicate, opts)
+	return listHinted(ctx, s.rollouts, hint, predicate, opts)
+}
+
+func (s *Store) ListRolloutsBySpec(ctx context.Context, specID string) ([]*model.Rollout, error) {
+	if specID == "" {
+		return nil, storage.ErrInvalidArgument
+	}
+	return s.rollouts.ByIndex(ctx, indexSpec, specID)
+}
+
+func (s *Store) ListRolloutsByAgent(ctx context.Context, agentID string) ([]*model.Rollout, error) {
+	if agentID == "" {
+		return nil, storage.ErrInvalidArgument
+	}
+	return s.rollouts.ByIndex(ctx, indexAgent, agentID)
 }
 
 func (s *Store) DeleteRollout(ctx context.Context, id string) error {
@@ -550,17 +726,14 @@ func (s *Store) DeleteRolloutsBySpec(ctx context.Context, specID string) error {
 		return storage.ErrInvalidArgument
 	}
 
-	s.rollouts.mu.RLock()
-	ids := make([]string, 0)
-	for id, ss := range s.rollouts.data {
-		if ss.SpecID() == specID {
-			ids = append(ids, id)
-		}
+	rollouts, err := s.rollouts.ByIndex(ctx, indexSpec, specID)
+	if err != nil {
+		return err
 	}
-	s.rollouts.mu.RUnlock()
-
-	for _, id := range ids {
-		_ = s.rollouts.Delete(ctx, id)
+	for _, ro := range rollouts {
+		if err = s.rollouts.Delete(ctx, ro.ID()); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
 	}
 	return nil
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
 	"github.com/soltiHQ/control-plane/internal/storage"
 )
 
@@ -399,3 +400,128 @@ func TestStore_Roles_GetRoles_MissingID_ReturnsNotFound(t *testing.T) {
 		t.Fatalf("expected ErrNotFound, err=%v", err)
 	}
 }
+
+func TestStore_Range(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := New()
+
+	requireNoErr(t, s.UpsertAgent(ctx, mkAgent(t, "a1")))
+	requireNoErr(t, s.UpsertRole(ctx, mkRole(t, "r1", "admin")))
+	requireNoErr(t, s.UpsertUser(ctx, mkUser(t, "u1", "sub-1")))
+
+	var seen []string
+	requireNoErr(t, s.Range(ctx, func(entity any) error {
+		seen = append(seen, entity.(interface{ ID() string }).ID())
+		return nil
+	}))
+	// storage.Kinds order: roles, users, …, agents.
+	if len(seen) != 3 || seen[0] != "r1" || seen[1] != "u1" || seen[2] != "a1" {
+		t.Fatalf("unexpected range order: %v", seen)
+	}
+
+	stop := errors.New("stop")
+	if err := s.Range(ctx, func(any) error { return stop }); !errors.Is(err, stop) {
+		t.Fatalf("expected Range to return callback error, err=%v", err)
+	}
+}
+
+func TestStore_ResourceVersions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := New()
+
+	a := mkAgent(t, "a1")
+	r := mkRole(t, "r1", "admin")
+	requireNoErr(t, s.UpsertAgent(ctx, a))
+	requireNoErr(t, s.UpsertRole(ctx, r))
+	// One counter is shared by all collections.
+	if a.ResourceVersion() != 1 || r.ResourceVersion() != 2 {
+		t.Fatalf("expected versions 1 and 2, got=%d and %d", a.ResourceVersion(), r.ResourceVersion())
+	}
+
+	// Restore keeps versions verbatim and advances the counter past them.
+	re := New()
+	restored := mkAgent(t, "a2")
+	restored.SetResourceVersion(41)
+	requireNoErr(t, re.Restore(restored))
+	got, err := re.GetAgent(ctx, "a2")
+	requireNoErr(t, err)
+	if got.ResourceVersion() != 41 {
+		t.Fatalf("expected restored version 41, got=%d", got.ResourceVersion())
+	}
+	requireNoErr(t, re.UpsertAgent(ctx, got))
+	if got.ResourceVersion() != 42 {
+		t.Fatalf("expected next version 42, got=%d", got.ResourceVersion())
+	}
+}
+
+type failingJournal struct{ err error }
+
+func (j failingJournal) Record(storage.Kind, Op, string, any) error { return j.err }
+
+func TestStore_JournalErrorAbortsMutation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := New(WithJournal(failingJournal{err: storage.ErrUnavailable}))
+
+	if err := s.UpsertAgent(ctx, mkAgent(t, "a1")); !errors.Is(err, storage.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, err=%v", err)
+	}
+	if _, err := s.GetAgent(ctx, "a1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected aborted upsert to stay invisible, err=%v", err)
+	}
+
+	requireNoErr(t, s.Restore(mkAgent(t, "a2")))
+	if err := s.DeleteAgent(ctx, "a2"); !errors.Is(err, storage.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, err=%v", err)
+	}
+	if _, err := s.GetAgent(ctx, "a2"); err != nil {
+		t.Fatalf("expected aborted delete to keep the entity, err=%v", err)
+	}
+}
+
+func TestStore_IndexedFilters(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := New()
+
+	a1 := mkAgent(t, "a1")
+	a1.LabelAdd("env", "prod")
+	a2 := mkAgent(t, "a2")
+	a2.LabelAdd("env", "prod")
+	a2.LabelAdd("tier", "web")
+	a3 := mkAgent(t, "a3")
+	a3.LabelAdd("env", "dev")
+	for _, a := range []*model.Agent{a1, a2, a3} {
+		requireNoErr(t, s.UpsertAgent(ctx, a))
+	}
+
+	res, err := s.ListAgents(ctx, NewAgentFilter().ByLabel("env", "prod").ByLabel("tier", "web"), storage.ListOptions{})
+	requireNoErr(t, err)
+	if len(res.Items) != 1 || res.Items[0].ID() != "a2" {
+		t.Fatalf("expected only a2, got=%d items", len(res.Items))
+	}
+
+	ro := mkRollout(t, "s1", "a1")
+	requireNoErr(t, s.UpsertRollout(ctx, ro))
+	requireNoErr(t, s.UpsertRollout(ctx, mkRollout(t, "s1", "a2")))
+	requireNoErr(t, s.UpsertRollout(ctx, mkRollout(t, "s2", "a1")))
+	ro.MarkSynced(1)
+	requireNoErr(t, s.UpsertRollout(ctx, ro))
+
+	rs, err := s.ListRollouts(ctx, NewRolloutFilter().BySpecID("s1").ByStatus(kind.SyncStatusPending), storage.ListOptions{})
+	requireNoErr(t, err)
+	if len(rs.Items) != 1 || rs.Items[0].AgentID() != "a2" {
+		t.Fatalf("expected the pending s1 rollout on a2, got=%d items", len(rs.Items))
+	}
+	rs, err = s.ListRollouts(ctx, NewRolloutFilter().ByAgentID("a1"), storage.ListOptions{})
+	requireNoErr(t, err)
+	if len(rs.Items) != 2 {
+		t.Fatalf("expected 2 rollouts on a1, got=%d", len(rs.Items))
+	}
+}
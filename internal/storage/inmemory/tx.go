@@ -0,0 +1,138 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+// txState collects the writes of a running transaction.
+//
+// Writes are applied to the shared collections immediately (nobody else can observe
+// them while the transaction holds the gate) and remembered three times: as journal
+// entries and watch changes to emit on commit, and as undo steps for rollback.
+type txState struct {
+	rev     uint64 // last revision assigned inside the transaction
+	entries []Entry
+	changes []change
+	undo    []func()
+}
+
+// stage applies a write with the next transaction revision and remembers it.
+func (t *txState) stage(e Entry, undo func(), apply func(rev uint64) change) {
+	t.rev++
+	t.changes = append(t.changes, apply(t.rev))
+	t.entries = append(t.entries, e)
+	t.undo = append(t.undo, undo)
+}
+
+// rollback reverts every staged write, newest first.
+func (t *txState) rollback() {
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+	t.entries, t.changes, t.undo = nil, nil, nil
+}
+
+// InTx implements storage.Transactor.
+//
+// A transaction holds the store exclusively: concurrent reads and writes wait until
+// it commits or rolls back, so fn should not block on anything but the store.
+// The journal receives the whole transaction at commit, as one RecordBatch call if it
+// implements BatchJournal; a journal error rolls the transaction back.
+// Calling InTx on the view passed to fn joins the running transaction.
+func (s *Store) InTx(ctx context.Context, fn func(tx storage.Tx) error) (err error) {
+	if fn == nil {
+		return storage.ErrInvalidArgument
+	}
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	s.gate.Lock()
+	defer s.gate.Unlock()
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	t := &txState{rev: s.rev.current()}
+	committed := false
+	defer func() {
+		if !committed {
+			t.rollback()
+		}
+	}()
+
+	if err = fn(s.view(t)); err != nil {
+		return err
+	}
+	if err = s.rev.commitBatch(t.changes, func() error { return recordBatch(s.journal, t.entries) }); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// view returns the Store seen by a transaction function.
+func (s *Store) view(t *txState) *Store {
+	return &Store{
+		agents:      s.agents.view(t),
+		users:       s.users.view(t),
+		roles:       s.roles.view(t),
+		credentials: s.credentials.view(t),
+		verifiers:   s.verifiers.view(t),
+		sessions:    s.sessions.view(t),
+		specs:       s.specs.view(t),
+		revisions:   s.revisions.view(t),
+		deployments: s.deployments.view(t),
+		rollouts:    s.rollouts.view(t),
+		journal:     s.journal,
+		rev:         s.rev,
+		tx:          t,
+	}
+}
+
+// commitBatch records and publishes the changes staged by a transaction.
+//
+// The changes carry consecutive revisions following the current one; if record fails,
+// no revision is consumed and nothing is published.
+func (r *revision) commitBatch(changes []change, record func() error) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if first := changes[0].rev; first != r.n+1 {
+		return fmt.Errorf("%w: transaction starts at revision %d, store is at %d", storage.ErrInternal, first, r.n)
+	}
+	if err := record(); err != nil {
+		return err
+	}
+	r.n = changes[len(changes)-1].rev
+	if r.feed != nil {
+		for _, c := range changes {
+			r.feed.publish(c)
+		}
+	}
+	return nil
+}
+
+// recordBatch forwards the entries of a transaction to the journal, if any.
+func recordBatch(j Journal, entries []Entry) error {
+	if j == nil {
+		return nil
+	}
+	if b, ok := j.(BatchJournal); ok {
+		return b.RecordBatch(entries)
+	}
+	for _, e := range entries {
+		if err := j.Record(e.Kind, e.Op, e.ID, e.Entity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
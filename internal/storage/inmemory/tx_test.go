@@ -0,0 +1,205 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+// batchJournal collects committed transactions and fails them on demand.
+type batchJournal struct {
+	records int
+	batches [][]Entry
+	err     error
+}
+
+func (j *batchJournal) Record(storage.Kind, Op, string, any) error {
+	j.records++
+	return nil
+}
+
+func (j *batchJournal) RecordBatch(entries []Entry) error {
+	if j.err != nil {
+		return j.err
+	}
+	j.batches = append(j.batches, entries)
+	return nil
+}
+
+func TestStore_InTx_Commit(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	j := &batchJournal{}
+	s := New(WithJournal(j))
+
+	requireNoErr(t, s.UpsertRollout(ctx, mkRollout(t, "s1", "a1")))
+	requireNoErr(t, s.UpsertRollout(ctx, mkRollout(t, "s1", "a2")))
+	from, err := s.Revision(ctx)
+	requireNoErr(t, err)
+	events, err := s.Watch(ctx, storage.KindRollout, nil, 0)
+	requireNoErr(t, err)
+
+	ro := mkRollout(t, "s2", "a1")
+	err = s.InTx(ctx, func(tx storage.Tx) error {
+		if err := tx.DeleteRolloutsBySpec(ctx, "s1"); err != nil {
+			return err
+		}
+		if err := tx.UpsertRollout(ctx, ro); err != nil {
+			return err
+		}
+		// Reads inside the transaction observe its own writes.
+		res, err := tx.ListRollouts(ctx, NewRolloutFilter().BySpecID("s1"), storage.ListOptions{})
+		if err != nil {
+			return err
+		}
+		if len(res.Items) != 0 {
+			t.Errorf("expected deleted rollouts to be invisible inside the transaction, got=%d", len(res.Items))
+		}
+		return nil
+	})
+	requireNoErr(t, err)
+
+	if len(j.batches) != 1 || len(j.batches[0]) != 3 || j.records != 2 {
+		t.Fatalf("expected one batch of 3 entries after 2 single records, got batches=%d records=%d", len(j.batches), j.records)
+	}
+	if ro.ResourceVersion() != from+3 {
+		t.Fatalf("expected version %d on the passed entity, got=%d", from+3, ro.ResourceVersion())
+	}
+	for want := from + 1; want <= from+3; want++ {
+		if ev := nextEvent(t, events); ev.Revision != want {
+			t.Fatalf("expected consecutive revisions, want=%d got=%d", want, ev.Revision)
+		}
+	}
+	res, err := s.ListRollouts(ctx, nil, storage.ListOptions{})
+	requireNoErr(t, err)
+	if len(res.Items) != 1 || res.Items[0].ID() != ro.ID() {
+		t.Fatalf("unexpected rollouts after commit: %+v", res.Items)
+	}
+}
+
+func TestStore_InTx_Rollback(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	j := &batchJournal{}
+	s := New(WithJournal(j))
+
+	a := mkAgent(t, "a1")
+	requireNoErr(t, s.UpsertAgent(ctx, a))
+	before, err := s.Revision(ctx)
+	requireNoErr(t, err)
+
+	errStop := errors.New("stop")
+	err = s.InTx(ctx, func(tx storage.Tx) error {
+		requireNoErr(t, tx.DeleteAgent(ctx, "a1"))
+		requireNoErr(t, tx.UpsertAgent(ctx, mkAgent(t, "a2")))
+		requireNoErr(t, tx.UpsertUser(ctx, mkUser(t, "u1", "alice")))
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("expected the function error, err=%v", err)
+	}
+
+	got, err := s.GetAgent(ctx, "a1")
+	requireNoErr(t, err)
+	if got.ResourceVersion() != a.ResourceVersion() {
+		t.Fatalf("expected a1 restored at version %d, got=%d", a.ResourceVersion(), got.ResourceVersion())
+	}
+	if _, err = s.GetAgent(ctx, "a2"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected a2 to be rolled back, err=%v", err)
+	}
+	if _, err = s.GetUserBySubject(ctx, "alice"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected u1 to be rolled back, err=%v", err)
+	}
+	if rev, _ := s.Revision(ctx); rev != before {
+		t.Fatalf("expected revision to stay at %d, got=%d", before, rev)
+	}
+	if len(j.batches) != 0 {
+		t.Fatalf("expected nothing journaled, got=%d batches", len(j.batches))
+	}
+
+	// Later writes continue from the committed revision.
+	requireNoErr(t, s.UpsertAgent(ctx, mkAgent(t, "a3")))
+	if rev, _ := s.Revision(ctx); rev != before+1 {
+		t.Fatalf("expected revision %d, got=%d", before+1, rev)
+	}
+}
+
+func TestStore_InTx_JournalErrorAndPanicRollBack(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	j := &batchJournal{err: storage.ErrUnavailable}
+	s := New(WithJournal(j))
+
+	err := s.InTx(ctx, func(tx storage.Tx) error {
+		return tx.UpsertAgent(ctx, mkAgent(t, "a1"))
+	})
+	if !errors.Is(err, storage.ErrUnavailable) {
+		t.Fatalf("expected journal error, err=%v", err)
+	}
+	if _, err = s.GetAgent(ctx, "a1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected a1 to be rolled back, err=%v", err)
+	}
+
+	j.err = nil
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected the panic to propagate")
+			}
+		}()
+		_ = s.InTx(ctx, func(tx storage.Tx) error {
+			requireNoErr(t, tx.UpsertAgent(ctx, mkAgent(t, "a1")))
+			panic("boom")
+		})
+	}()
+	if _, err = s.GetAgent(ctx, "a1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected a1 to be rolled back after panic, err=%v", err)
+	}
+
+	// The store is usable afterwards.
+	requireNoErr(t, s.UpsertAgent(ctx, mkAgent(t, "a1")))
+}
+
+func TestStore_InTx_ConflictAndNesting(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := New()
+
+	a := mkAgent(t, "a1")
+	requireNoErr(t, s.UpsertAgent(ctx, a))
+	stale := a.Clone()
+	requireNoErr(t, s.UpsertAgent(ctx, a))
+
+	err := s.InTx(ctx, func(tx storage.Tx) error {
+		requireNoErr(t, tx.UpsertAgent(ctx, mkAgent(t, "a2")))
+		return tx.UpsertAgent(ctx, stale)
+	})
+	if !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("expected ErrConflict, err=%v", err)
+	}
+	if _, err = s.GetAgent(ctx, "a2"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected a2 to be rolled back, err=%v", err)
+	}
+
+	// A nested InTx joins the outer transaction instead of deadlocking.
+	err = s.InTx(ctx, func(tx storage.Tx) error {
+		return tx.(storage.Transactor).InTx(ctx, func(inner storage.Tx) error {
+			return inner.UpsertAgent(ctx, mkAgent(t, "a2"))
+		})
+	})
+	requireNoErr(t, err)
+	if _, err = s.GetAgent(ctx, "a2"); err != nil {
+		t.Fatalf("expected a2 after nested commit, err=%v", err)
+	}
+
+	if err = s.InTx(ctx, nil); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument for nil fn, err=%v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package inmemory
+
+import (
+	"context"
+
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+const (
+	// watchHistory is the number of most recent changes retained for resuming watches.
+	watchHistory = 4096
+	// watchBuffer is the number of live events a watcher may lag behind before it is dropped.
+	watchBuffer = 256
+)
+
+// feed retains recent changes and fans them out to watchers.
+//
+// It has no lock of its own: every method is called with the owning revision's mutex held.
+type feed struct {
+	// history is a ring buffer of the latest changes, oldest at head.
+	history []change
+	head    int
+	size    int
+
+	watchers map[*watcher]struct{}
+}
+
+func newFeed() *feed {
+	return &feed{
+		history:  make([]change, watchHistory),
+		watchers: make(map[*watcher]struct{}),
+	}
+}
+
+type watcher struct {
+	match func(obj any) bool
+	ch    chan storage.Event
+	done  chan struct{}
+	kind  storage.Kind
+}
+
+func (w *watcher) accepts(c change) bool {
+	return c.kind == w.kind && (w.match == nil || w.match(c.obj))
+}
+
+func (f *feed) publish(c change) {
+	if f.size < len(f.history) {
+		f.history[(f.head+f.size)%len(f.history)] = c
+		f.size++
+	} else {
+		f.history[f.head] = c
+		f.head = (f.head + 1) % len(f.history)
+	}
+
+	for w := range f.watchers {
+		if !w.accepts(c) {
+			continue
+		}
+		select {
+		case w.ch <- c.event():
+		default:
+			// A slow consumer must not stall writers: drop it, it will re-list and resume.
+			f.drop(w)
+		}
+	}
+}
+
+// since returns the retained changes after rev, or storage.ErrCompacted if some were already evicted.
+func (f *feed) since(rev, last uint64) ([]change, error) {
+	if rev >= last {
+		return nil, nil
+	}
+
+	oldest := last + 1
+	if f.size > 0 {
+		oldest = f.history[f.head].rev
+	}
+	if rev+1 < oldest {
+		return nil, storage.ErrCompacted
+	}
+
+	out := make([]change, 0, last-rev)
+	for i := 0; i < f.size; i++ {
+		if c := f.history[(f.head+i)%len(f.history)]; c.rev > rev {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (f *feed) drop(w *watcher) {
+	if _, ok := f.watchers[w]; !ok {
+		return
+	}
+	delete(f.watchers, w)
+	close(w.ch)
+	close(w.done)
+}
+
+// watch registers a watcher and preloads it with the retained changes after from.
+func (r *revision) watch(ctx context.Context, k storage.Kind, match func(any) bool, from uint64) (<-chan storage.Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var backlog []change
+	if from > 0 {
+		replay, err := r.feed.since(from, r.n)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range replay {
+			if c.kind == k && (match == nil || match(c.obj)) {
+				backlog = append(backlog, c)
+			}
+		}
+	}
+
+	w := &watcher{
+		match: match,
+		ch:    make(chan storage.Event, watchBuffer+len(backlog)),
+		done:  make(chan struct{}),
+		kind:  k,
+	}
+	for _, c := range backlog {
+		w.ch <- c.event()
+	}
+	r.feed.watchers[w] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.mu.Lock()
+			r.feed.drop(w)
+			r.mu.Unlock()
+		case <-w.done:
+		}
+	}()
+	return w.ch, nil
+}
+
+// Revision implements storage.Watcher.
+func (s *Store) Revision(_ context.Context) (uint64, error) {
+	return s.rev.current(), nil
+}
+
+// Watch implements storage.Watcher.
+//
+// The last watchHistory changes are retained for resuming; a watcher lagging more than
+// watchBuffer events behind is dropped (its channel is closed).
+func (s *Store) Watch(ctx context.Context, k storage.Kind, filter any, fromRevision uint64) (<-chan storage.Event, error) {
+	match, err := watchPredicate(k, filter)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.rev.watch(ctx, k, match, fromRevision)
+}
+
+// watchPredicate converts a list filter of kind k into a predicate over stored entities.
+func watchPredicate(k storage.Kind, filter any) (func(any) bool, error) {
+	switch k {
+	case storage.KindAgent:
+		return predicateOf[*AgentFilter, *model.Agent](filter)
+	case storage.KindUser:
+		return predicateOf[*UserFilter, *model.User](filter)
+	case storage.KindRole:
+		return predicateOf[*RoleFilter, *model.Role](filter)
+	case storage.KindSpec:
+		return predicateOf[*SpecFilter, *model.Spec](filter)
+	case storage.KindRollout:
+		return predicateOf[*RolloutFilter, *model.Rollout](filter)
+	case storage.KindCredential, storage.KindVerifier, storage.KindSession, storage.KindSpecRevision, storage.KindDeployment:
+		if filter != nil {
+			return nil, storage.ErrInvalidArgument
+		}
+		return nil, nil
+	default:
+		return nil, storage.ErrInvalidArgument
+	}
+}
+
+func predicateOf[F interface{ Matches(T) bool }, T any](filter any) (func(any) bool, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	f, ok := filter.(F)
+	if !ok {
+		return nil, storage.ErrInvalidArgument
+	}
+	return func(obj any) bool {
+		e, ok := obj.(T)
+		return ok && f.Matches(e)
+	}, nil
+}
@@ -0,0 +1,172 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+func mkRollout(t *testing.T, specID, agentID string) *model.Rollout {
+	t.Helper()
+	ro, err := model.NewRollout(specID, agentID, 1)
+	requireNoErr(t, err)
+	return ro
+}
+
+func nextEvent(t *testing.T, events <-chan storage.Event) storage.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatalf("watch channel closed unexpectedly")
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for an event")
+	}
+	return storage.Event{}
+}
+
+func TestStore_Watch_LiveEvents(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := New()
+
+	events, err := s.Watch(ctx, storage.KindRollout, NewRolloutFilter().BySpecID("s1"), 0)
+	requireNoErr(t, err)
+
+	ro := mkRollout(t, "s1", "a1")
+	requireNoErr(t, s.UpsertRollout(ctx, ro))
+	requireNoErr(t, s.UpsertRollout(ctx, mkRollout(t, "s2", "a1"))) // filtered out
+	requireNoErr(t, s.UpsertAgent(ctx, mkAgent(t, "a1")))           // other kind
+	ro.MarkSynced(1)
+	requireNoErr(t, s.UpsertRollout(ctx, ro))
+	requireNoErr(t, s.DeleteRollout(ctx, ro.ID()))
+
+	created := nextEvent(t, events)
+	if created.Type != storage.EventCreated || created.ID != ro.ID() || created.Kind != storage.KindRollout {
+		t.Fatalf("unexpected first event: %+v", created)
+	}
+	updated := nextEvent(t, events)
+	got, ok := updated.Object.(*model.Rollout)
+	if updated.Type != storage.EventUpdated || !ok || got.Status() != kind.SyncStatusSynced {
+		t.Fatalf("unexpected update event: %+v", updated)
+	}
+	if got.ResourceVersion() != updated.Revision || updated.Revision <= created.Revision {
+		t.Fatalf("expected increasing revisions matching resource versions: %d, %d", created.Revision, updated.Revision)
+	}
+	deleted := nextEvent(t, events)
+	if deleted.Type != storage.EventDeleted || deleted.Revision <= updated.Revision {
+		t.Fatalf("unexpected delete event: %+v", deleted)
+	}
+
+	if rev, _ := s.Revision(ctx); rev != deleted.Revision {
+		t.Fatalf("expected store revision %d, got=%d", deleted.Revision, rev)
+	}
+}
+
+func TestStore_Watch_ResumeFromRevision(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := New()
+
+	requireNoErr(t, s.UpsertAgent(ctx, mkAgent(t, "a1")))
+	from, err := s.Revision(ctx)
+	requireNoErr(t, err)
+	requireNoErr(t, s.UpsertAgent(ctx, mkAgent(t, "a2")))
+	requireNoErr(t, s.DeleteAgent(ctx, "a1"))
+
+	events, err := s.Watch(ctx, storage.KindAgent, nil, from)
+	requireNoErr(t, err)
+	if ev := nextEvent(t, events); ev.ID != "a2" || ev.Type != storage.EventCreated {
+		t.Fatalf("unexpected replayed event: %+v", ev)
+	}
+	if ev := nextEvent(t, events); ev.ID != "a1" || ev.Type != storage.EventDeleted {
+		t.Fatalf("unexpected replayed event: %+v", ev)
+	}
+
+	// Live events follow the replay.
+	requireNoErr(t, s.UpsertAgent(ctx, mkAgent(t, "a3")))
+	if ev := nextEvent(t, events); ev.ID != "a3" {
+		t.Fatalf("unexpected live event: %+v", ev)
+	}
+}
+
+func TestStore_Watch_Compacted(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := New()
+
+	// Restored state carries revisions the feed never saw.
+	a := mkAgent(t, "a1")
+	a.SetResourceVersion(50)
+	requireNoErr(t, s.Restore(a))
+
+	if _, err := s.Watch(ctx, storage.KindAgent, nil, 10); !errors.Is(err, storage.ErrCompacted) {
+		t.Fatalf("expected ErrCompacted, err=%v", err)
+	}
+	if _, err := s.Watch(ctx, storage.KindAgent, nil, 50); err != nil {
+		t.Fatalf("expected watch from the current revision to succeed, err=%v", err)
+	}
+}
+
+func TestStore_Watch_InvalidArguments(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	s := New()
+
+	if _, err := s.Watch(ctx, storage.KindRollout, NewAgentFilter(), 0); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument for foreign filter, err=%v", err)
+	}
+	if _, err := s.Watch(ctx, storage.KindSession, NewUserFilter(), 0); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument for filter on unfilterable kind, err=%v", err)
+	}
+	if _, err := s.Watch(ctx, storage.Kind("nope"), nil, 0); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Fatalf("expected ErrInvalidArgument for unknown kind, err=%v", err)
+	}
+}
+
+func TestStore_Watch_ClosedOnCancelAndOverflow(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New()
+
+	events, err := s.Watch(ctx, storage.KindAgent, nil, 0)
+	requireNoErr(t, err)
+	cancel()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatalf("expected no events after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected channel to be closed after cancel")
+	}
+
+	slow, err := s.Watch(context.Background(), storage.KindAgent, nil, 0)
+	requireNoErr(t, err)
+	a := mkAgent(t, "a1")
+	for range watchBuffer + 1 {
+		a.SetResourceVersion(0)
+		requireNoErr(t, s.UpsertAgent(context.Background(), a))
+	}
+	n := 0
+	for range slow {
+		n++
+	}
+	if n != watchBuffer {
+		t.Fatalf("expected %d buffered events before the slow watcher was dropped, got=%d", watchBuffer, n)
+	}
+}
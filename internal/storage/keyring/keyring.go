@@ -0,0 +1,258 @@
+// Package keyring implements envelope encryption for secrets persisted by storage backends.
+//
+// A Keyring holds key-encryption keys (KEKs) by ID. Seal encrypts data under a fresh
+// random data key (DEK) with AES-256-GCM, then wraps the DEK under the active KEK; the
+// resulting Envelope records the ID of that KEK. Open unwraps with whichever key the
+// envelope names, so records sealed under older keys stay readable while they exist.
+//
+// Keys are loaded from a file or an environment variable in the same format, one key per line:
+//
+//	# id:base64(32 random bytes) — the first key is active
+//	2026-10:q2Vq3h…
+//	2026-01:8fJ0sd…
+//
+// Rotating the master key means prepending a new line, reloading the keyring and
+// re-wrapping the stored records (see filestore.Store.Rewrap and wal.Store.Rewrap);
+// the old line can be dropped once nothing is sealed under it anymore.
+package keyring
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// KeySize is the size of every key-encryption and data key (AES-256).
+const KeySize = 32
+
+var (
+	// ErrUnknownKey indicates an envelope names a key the keyring does not hold.
+	ErrUnknownKey = errors.New("keyring: unknown key")
+	// ErrDecrypt indicates an envelope failed authentication (wrong key, tampered data or AAD).
+	ErrDecrypt = errors.New("keyring: decryption failed")
+	// ErrInvalidKeys indicates a malformed key file or variable.
+	ErrInvalidKeys = errors.New("keyring: invalid keys")
+)
+
+// Envelope is a sealed value.
+//
+// Both byte fields are a GCM nonce followed by the ciphertext; JSON encodes them as base64.
+type Envelope struct {
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"dek"`
+	Ciphertext []byte `json:"data"`
+}
+
+// Keyring holds key-encryption keys. It is safe for concurrent use.
+type Keyring struct {
+	source func() ([]byte, error)
+
+	mu     sync.RWMutex
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// New returns a keyring holding keys, sealing with the one named active.
+func New(active string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{}
+	if err := k.set(active, keys); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// LoadFile returns a keyring read from path; Reload reads the file again.
+func LoadFile(path string) (*Keyring, error) {
+	return load(func() ([]byte, error) { return os.ReadFile(path) })
+}
+
+// LoadEnv returns a keyring read from the environment variable name; Reload reads it again.
+//
+// Besides newlines, keys in a variable may be separated by commas.
+func LoadEnv(name string) (*Keyring, error) {
+	return load(func() ([]byte, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is not set", ErrInvalidKeys, name)
+		}
+		return []byte(strings.ReplaceAll(v, ",", "\n")), nil
+	})
+}
+
+func load(source func() ([]byte, error)) (*Keyring, error) {
+	k := &Keyring{source: source}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload replaces the keys with the current content of the source.
+//
+// On error the previous keys stay in use. Keyrings built with New have no source and
+// reload as a no-op.
+func (k *Keyring) Reload() error {
+	if k.source == nil {
+		return nil
+	}
+	data, err := k.source()
+	if err != nil {
+		return err
+	}
+	active, keys, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	return k.set(active, keys)
+}
+
+// Parse reads keys in the key file format and returns them with the active key ID.
+func Parse(data []byte) (active string, keys map[string][]byte, err error) {
+	keys = make(map[string][]byte)
+	for n, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		id, enc, ok := strings.Cut(string(line), ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return "", nil, fmt.Errorf("%w: line %d: expected id:base64-key", ErrInvalidKeys, n+1)
+		}
+		if _, dup := keys[id]; dup {
+			return "", nil, fmt.Errorf("%w: line %d: duplicate key %q", ErrInvalidKeys, n+1, id)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(enc))
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: line %d: key %q: %v", ErrInvalidKeys, n+1, id, err)
+		}
+		keys[id] = key
+		if active == "" {
+			active = id
+		}
+	}
+	if active == "" {
+		return "", nil, fmt.Errorf("%w: no keys", ErrInvalidKeys)
+	}
+	return active, keys, nil
+}
+
+func (k *Keyring) set(active string, keys map[string][]byte) error {
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return fmt.Errorf("%w: key %q: %v", ErrInvalidKeys, id, err)
+		}
+		aeads[id] = aead
+	}
+	if _, ok := aeads[active]; !ok {
+		return fmt.Errorf("%w: active key %q not found", ErrInvalidKeys, active)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.active, k.keys = active, aeads
+	return nil
+}
+
+// ActiveID returns the ID of the key new envelopes are sealed under.
+func (k *Keyring) ActiveID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// Seal encrypts plaintext under a fresh data key wrapped by the active key.
+//
+// aad is authenticated but not stored; Open must be given the same value. Binding it
+// to the record identity prevents sealed values from being swapped between records.
+func (k *Keyring) Seal(plaintext, aad []byte) (*Envelope, error) {
+	k.mu.RLock()
+	id, kek := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+
+	dek := make([]byte, KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	data, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := seal(data, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(kek, dek, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{KeyID: id, WrappedKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+// Open decrypts an envelope sealed by Seal with the same aad.
+//
+// Returns ErrUnknownKey if the envelope's key is not held and ErrDecrypt if
+// authentication fails.
+func (k *Keyring) Open(env *Envelope, aad []byte) ([]byte, error) {
+	if env == nil {
+		return nil, fmt.Errorf("%w: empty envelope", ErrDecrypt)
+	}
+	k.mu.RLock()
+	kek, ok := k.keys[env.KeyID]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, env.KeyID)
+	}
+
+	dek, err := open(kek, env.WrappedKey, []byte(env.KeyID))
+	if err != nil {
+		return nil, err
+	}
+	data, err := newAEAD(dek)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return open(data, env.Ciphertext, aad)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce || ciphertext.
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: short ciphertext", ErrDecrypt)
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	out, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return out, nil
+}
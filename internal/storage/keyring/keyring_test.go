@@ -0,0 +1,124 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func requireNoErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func key(b byte) []byte { return bytes.Repeat([]byte{b}, KeySize) }
+
+func line(id string, k []byte) string { return id + ":" + base64.StdEncoding.EncodeToString(k) + "\n" }
+
+func TestKeyring_SealOpen(t *testing.T) {
+	t.Parallel()
+
+	kr, err := New("k1", map[string][]byte{"k1": key(1)})
+	requireNoErr(t, err)
+
+	env, err := kr.Seal([]byte("secret"), []byte("credential/c1"))
+	requireNoErr(t, err)
+	if env.KeyID != "k1" || bytes.Contains(env.Ciphertext, []byte("secret")) {
+		t.Fatalf("unexpected envelope: %+v", env)
+	}
+
+	got, err := kr.Open(env, []byte("credential/c1"))
+	requireNoErr(t, err)
+	if string(got) != "secret" {
+		t.Fatalf("expected the plaintext back, got=%q", got)
+	}
+
+	if _, err = kr.Open(env, []byte("credential/c2")); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expected ErrDecrypt for another record, err=%v", err)
+	}
+	tampered := *env
+	tampered.Ciphertext = bytes.Clone(env.Ciphertext)
+	tampered.Ciphertext[len(tampered.Ciphertext)-1] ^= 1
+	if _, err = kr.Open(&tampered, []byte("credential/c1")); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("expected ErrDecrypt for tampered data, err=%v", err)
+	}
+	tampered = *env
+	tampered.KeyID = "k9"
+	if _, err = kr.Open(&tampered, []byte("credential/c1")); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, err=%v", err)
+	}
+}
+
+func TestKeyring_ReloadRotates(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "kek")
+	requireNoErr(t, os.WriteFile(path, []byte("# keys\n"+line("k1", key(1))), 0o600))
+
+	kr, err := LoadFile(path)
+	requireNoErr(t, err)
+	old, err := kr.Seal([]byte("secret"), nil)
+	requireNoErr(t, err)
+
+	// Prepend a new key: it becomes active while the old one still opens existing envelopes.
+	requireNoErr(t, os.WriteFile(path, []byte(line("k2", key(2))+line("k1", key(1))), 0o600))
+	requireNoErr(t, kr.Reload())
+	if kr.ActiveID() != "k2" {
+		t.Fatalf("expected k2 to be active, got=%q", kr.ActiveID())
+	}
+	if _, err = kr.Open(old, nil); err != nil {
+		t.Fatalf("expected the old key to still open, err=%v", err)
+	}
+	env, err := kr.Seal([]byte("secret"), nil)
+	requireNoErr(t, err)
+	if env.KeyID != "k2" {
+		t.Fatalf("expected new envelopes under k2, got=%q", env.KeyID)
+	}
+
+	// A broken file keeps the previous keys.
+	requireNoErr(t, os.WriteFile(path, []byte("k3:not-base64\n"), 0o600))
+	if err = kr.Reload(); !errors.Is(err, ErrInvalidKeys) {
+		t.Fatalf("expected ErrInvalidKeys, err=%v", err)
+	}
+	if kr.ActiveID() != "k2" {
+		t.Fatalf("expected k2 to stay active, got=%q", kr.ActiveID())
+	}
+}
+
+func TestKeyring_LoadEnv(t *testing.T) {
+	t.Setenv("TEST_KEK", line("k2", key(2))+","+line("k1", key(1)))
+
+	kr, err := LoadEnv("TEST_KEK")
+	requireNoErr(t, err)
+	if kr.ActiveID() != "k2" {
+		t.Fatalf("expected k2 to be active, got=%q", kr.ActiveID())
+	}
+	if _, err = LoadEnv("TEST_KEK_UNSET"); !errors.Is(err, ErrInvalidKeys) {
+		t.Fatalf("expected ErrInvalidKeys for an unset variable, err=%v", err)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"empty":     "# nothing\n",
+		"no id":     ":" + base64.StdEncoding.EncodeToString(key(1)),
+		"duplicate": line("k1", key(1)) + line("k1", key(2)),
+		"short key": line("k1", []byte("short")),
+	}
+	for name, data := range cases {
+		if _, keys, err := Parse([]byte(data)); err == nil {
+			if _, err = New("k1", keys); err == nil {
+				t.Errorf("%s: expected an error", name)
+			}
+		} else if !errors.Is(err, ErrInvalidKeys) {
+			t.Errorf("%s: expected ErrInvalidKeys, err=%v", name, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package storage
+
+// Kind identifies an entity collection within Storage.
+//
+// Kinds are stable identifiers: persistent backends write them to disk,
+// so existing values must never be renamed.
+type Kind string
+
+const (
+	KindAgent      Kind = "agent"
+	KindUser       Kind = "user"
+	KindRole       Kind = "role"
+	KindCredential Kind = "credential"
+	KindVerifier   Kind = "verifier"
+	KindSession    Kind = "session"
+	KindSpec       Kind = "spec"
+	KindRollout    Kind = "rollout"
+
+	KindSpecRevision Kind = "spec_revision"
+	KindDeployment   Kind = "deployment"
+)
+
+// Kinds lists every entity collection in a stable order.
+//
+// Referenced entities come before the entities referencing them
+// (roles before users, users before credentials, …), so restoring
+// collections in this order never produces dangling references.
+var Kinds = []Kind{
+	KindRole,
+	KindUser,
+	KindCredential,
+	KindVerifier,
+	KindSession,
+	KindAgent,
+	KindSpec,
+	KindSpecRevision,
+	KindDeployment,
+	KindRollout,
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/soltiHQ/control-plane/domain/model"
+)
+
+// SpecAt returns the content of a version of ts: ts itself when it is at that version, its
+// recorded revision otherwise. It returns ErrNotFound if the revision was not recorded.
+func SpecAt(ctx context.Context, st SpecRevisionStore, ts *model.Spec, version int) (*model.Spec, error) {
+	if ts.Version() == version {
+		return ts, nil
+	}
+	rev, err := st.GetSpecRevision(ctx, model.SpecRevisionID(ts.ID(), version))
+	if err != nil {
+		return nil, err
+	}
+	return rev.Spec()
+}
+
+// DeploymentActive reports whether the deployment of the rollout's desired version allows
+// delivery, caching the answer by deployment ID. Rollouts deployed before deployments were
+// tracked have none and are delivered.
+func DeploymentActive(ctx context.Context, st DeploymentStore, cache map[string]bool, ss *model.Rollout) (bool, error) {
+	id := model.DeploymentID(ss.SpecID(), ss.DesiredVersion())
+	if ok, cached := cache[id]; cached {
+		return ok, nil
+	}
+
+	d, err := st.GetDeployment(ctx, id)
+	switch {
+	case err == nil:
+		cache[id] = d.Active()
+	case errors.Is(err, ErrNotFound):
+		cache[id] = true
+	default:
+		return false, err
+	}
+	return cache[id], nil
+}
@@ -1,7 +1,7 @@
 // Package storage defines persistence contracts for control-plane domain entities.
 //
 // It provides backend-agnostic interfaces describing how domain objects
-// (User, Role, Agent, Credential, Session, Verifier) are stored and retrieved.
+// (User, Role, Agent, Credential, Session, Verifier, Spec, SpecRevision, Deployment, Rollout) are stored and retrieved.
 //
 // Design goals
 //
@@ -22,6 +22,24 @@
 //     validate that a provided filter was constructed for that backend and
 //     return ErrInvalidArgument otherwise.
 //
+// # Resource versions
+//
+// Every successful write consumes a revision from a store-wide, monotonically
+// increasing counter. Creates and updates stamp it on the entity as its resource
+// version (also on the entity passed in); entities returned by reads carry their
+// current version. Deletes consume a revision too, so Watcher events are totally ordered.
+//
+// Upserts are compare-and-swap: an entity with a non-zero ResourceVersion is written
+// only if the stored entity still has that version; otherwise the backend returns
+// ErrConflict (also when the entity was deleted meanwhile). A zero version makes the
+// upsert unconditional, which is what freshly constructed entities have.
+//
+// # Transactions
+//
+// Transactor.InTx groups writes to any collections into one all-or-nothing unit.
+// Inside a transaction the usual per-write rules (validation, compare-and-swap) still
+// apply; an error returned by fn discards every write made in it.
+//
 // Error model
 //
 //   - ErrInvalidArgument — caller error (bad input, malformed cursor, wrong filter).
@@ -30,6 +48,7 @@
 //   - ErrConflict — concurrent modification or version mismatch.
 //   - ErrUnavailable — temporary backend failure (retryable).
 //   - ErrInternal — unexpected or invariant-violating storage failure.
+//   - ErrCompacted — a watch cannot resume from the requested revision.
 package storage
 
 import (
@@ -38,6 +57,7 @@ import (
 
 	"github.com/soltiHQ/control-plane/domain/kind"
 	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/domain/selector"
 )
 
 // AgentListResult contains a page of agent results with pagination support.
@@ -73,6 +93,7 @@ type AgentStore interface {
 	//
 	// Returns:
 	//   - ErrInvalidArgument if the agent violates storage-level invariants.
+	//   - ErrConflict if the resource version is set and no longer matches the stored one.
 	//   - ErrUnavailable if the backend is temporarily unavailable.
 	//   - ErrInternal for unexpected storage failures.
 	UpsertAgent(ctx context.Context, a *model.Agent) error
@@ -96,6 +117,15 @@ type AgentStore interface {
 	//   - ErrInternal for unexpected storage failures.
 	ListAgents(ctx context.Context, filter AgentFilter, opts ListOptions) (*AgentListResult, error)
 
+	// ListAgentsBySelector retrieves all agents whose labels satisfy sel, in no particular order.
+	//
+	// An empty selector matches every agent.
+	//
+	// Returns:
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	//   - ErrInternal for unexpected storage failures.
+	ListAgentsBySelector(ctx context.Context, sel selector.Selector) ([]*model.Agent, error)
+
 	// DeleteAgent removes an agent by its unique identifier.
 	//
 	// Returns:
@@ -112,6 +142,7 @@ type UserStore interface {
 	//
 	// Returns:
 	//   - ErrInvalidArgument if the user is nil or violates storage-level invariants.
+	//   - ErrConflict if the resource version is set and no longer matches the stored one.
 	//   - ErrUnavailable if the backend is temporarily unavailable.
 	//   - ErrInternal for unexpected storage failures.
 	UpsertUser(ctx context.Context, u *model.User) error
@@ -160,6 +191,7 @@ type CredentialStore interface {
 	//
 	// Returns:
 	//   - ErrInvalidArgument if the credential is nil or violates storage-level invariants.
+	//   - ErrConflict if the resource version is set and no longer matches the stored one.
 	//   - ErrUnavailable if the backend is temporarily unavailable.
 	//   - ErrInternal for unexpected storage failures.
 	UpsertCredential(ctx context.Context, c *model.Credential) error
@@ -206,6 +238,7 @@ type VerifierStore interface {
 	//
 	// Returns:
 	//   - ErrInvalidArgument if the verifier is nil or violates storage-level invariants.
+	//   - ErrConflict if the resource version is set and no longer matches the stored one.
 	//   - ErrUnavailable if the backend is temporarily unavailable.
 	//   - ErrInternal for unexpected storage failures.
 	UpsertVerifier(ctx context.Context, v *model.Verifier) error
@@ -318,6 +351,7 @@ type RoleStore interface {
 	//
 	// Returns:
 	//   - ErrInvalidArgument if the role is nil or violates storage-level invariants.
+	//   - ErrConflict if the resource version is set and no longer matches the stored one.
 	//   - ErrUnavailable if the backend is temporarily unavailable.
 	//   - ErrInternal for unexpected storage failures.
 	UpsertRole(ctx context.Context, r *model.Role) error
@@ -374,6 +408,7 @@ type SpecStore interface {
 	//
 	// Returns:
 	//   - ErrInvalidArgument if the spec is nil or violates storage-level invariants.
+	//   - ErrConflict if the resource version is set and no longer matches the stored one.
 	//   - ErrUnavailable if the backend is temporarily unavailable.
 	//   - ErrInternal for unexpected storage failures.
 	UpsertSpec(ctx context.Context, ts *model.Spec) error
@@ -407,6 +442,87 @@ type SpecStore interface {
 	DeleteSpec(ctx context.Context, id string) error
 }
 
+// SpecRevisionStore defines persistence operations for spec revisions.
+//
+// Revisions (model.SpecRevision) are immutable: they are created once and only
+// removed together with their spec.
+type SpecRevisionStore interface {
+	// CreateSpecRevision stores a new revision.
+	//
+	// Returns:
+	//   - ErrInvalidArgument if the revision is nil or has an empty ID.
+	//   - ErrAlreadyExists if a revision with the same ID (spec and version) already exists.
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	//   - ErrInternal for unexpected storage failures.
+	CreateSpecRevision(ctx context.Context, r *model.SpecRevision) error
+
+	// GetSpecRevision retrieves a revision by its unique identifier (see model.SpecRevisionID).
+	//
+	// Returns:
+	//   - ErrNotFound if no revision with the given ID exists.
+	//   - ErrInvalidArgument if the ID is empty.
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	//   - ErrInternal for unexpected storage failures.
+	GetSpecRevision(ctx context.Context, id string) (*model.SpecRevision, error)
+
+	// ListSpecRevisionsBySpec retrieves all revisions of a spec, in no particular order.
+	//
+	// Returns:
+	//   - ErrInvalidArgument if specID is empty.
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	//   - ErrInternal for unexpected storage failures.
+	ListSpecRevisionsBySpec(ctx context.Context, specID string) ([]*model.SpecRevision, error)
+
+	// DeleteSpecRevisionsBySpec removes all revisions of a spec.
+	//
+	// Idempotent: if the spec has no revisions, the operation is a no-op.
+	//
+	// Returns:
+	//   - ErrInvalidArgument if specID is empty.
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	//   - ErrInternal for unexpected storage failures.
+	DeleteSpecRevisionsBySpec(ctx context.Context, specID string) error
+}
+
+// DeploymentStore defines persistence operations for spec deployments.
+type DeploymentStore interface {
+	// UpsertDeployment creates a new deployment or replaces an existing one.
+	//
+	// Returns:
+	//   - ErrInvalidArgument if the deployment is nil or violates storage-level invariants.
+	//   - ErrConflict if the resource version is set and no longer matches the stored one.
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	//   - ErrInternal for unexpected storage failures.
+	UpsertDeployment(ctx context.Context, d *model.Deployment) error
+
+	// GetDeployment retrieves a deployment by its unique identifier (see model.DeploymentID).
+	//
+	// Returns:
+	//   - ErrNotFound if no deployment with the given ID exists.
+	//   - ErrInvalidArgument if the ID is empty.
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	//   - ErrInternal for unexpected storage failures.
+	GetDeployment(ctx context.Context, id string) (*model.Deployment, error)
+
+	// ListDeploymentsBySpec retrieves all deployments of a spec, in no particular order.
+	//
+	// Returns:
+	//   - ErrInvalidArgument if specID is empty.
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	//   - ErrInternal for unexpected storage failures.
+	ListDeploymentsBySpec(ctx context.Context, specID string) ([]*model.Deployment, error)
+
+	// DeleteDeploymentsBySpec removes all deployments of a spec.
+	//
+	// Idempotent: if the spec has no deployments, the operation is a no-op.
+	//
+	// Returns:
+	//   - ErrInvalidArgument if specID is empty.
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	//   - ErrInternal for unexpected storage failures.
+	DeleteDeploymentsBySpec(ctx context.Context, specID string) error
+}
+
 // RolloutStore defines persistence operations for rollout entities.
 //
 // A rollout (model.Rollout) tracks the delivery state of a single Spec
@@ -416,6 +532,7 @@ type RolloutStore interface {
 	//
 	// Returns:
 	//   - ErrInvalidArgument if the rollout is nil or violates storage-level invariants.
+	//   - ErrConflict if the resource version is set and no longer matches the stored one.
 	//   - ErrUnavailable if the backend is temporarily unavailable.
 	//   - ErrInternal for unexpected storage failures.
 	UpsertRollout(ctx context.Context, ss *model.Rollout) error
@@ -439,6 +556,22 @@ type RolloutStore interface {
 	//   - ErrInternal for unexpected storage failures.
 	ListRollouts(ctx context.Context, filter RolloutFilter, opts ListOptions) (*RolloutListResult, error)
 
+	// ListRolloutsBySpec retrieves all rollouts of a spec, in no particular order.
+	//
+	// Returns:
+	//   - ErrInvalidArgument if specID is empty.
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	//   - ErrInternal for unexpected storage failures.
+	ListRolloutsBySpec(ctx context.Context, specID string) ([]*model.Rollout, error)
+
+	// ListRolloutsByAgent retrieves all rollouts on an agent, in no particular order.
+	//
+	// Returns:
+	//   - ErrInvalidArgument if agentID is empty.
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	//   - ErrInternal for unexpected storage failures.
+	ListRolloutsByAgent(ctx context.Context, agentID string) ([]*model.Rollout, error)
+
 	// DeleteRollout removes a rollout by its unique identifier.
 	//
 	// Returns:
@@ -469,4 +602,8 @@ type Storage interface {
 	RoleStore
 	UserStore
 	SpecStore
+	SpecRevisionStore
+	DeploymentStore
+	Watcher
+	Transactor
 }
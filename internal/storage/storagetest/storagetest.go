@@ -0,0 +1,784 @@
+// Package storagetest is a conformance suite for storage.Storage implementations.
+//
+// It exercises the documented contract — sentinel errors, defensive cloning, ordering and
+// cursor stability, filter rejection, limit clamping, compare-and-swap, transactions and
+// watch — against a fresh store per test. A backend runs it from its own tests:
+//
+//	func TestStore_Conformance(t *testing.T) {
+//		storagetest.Run(t, storagetest.Backend{
+//			New:            func(t *testing.T) storage.Storage { return mybackend.New() },
+//			AgentsByLabel:  func(k, v string) storage.AgentFilter { return mybackend.AgentLabel(k, v) },
+//			RolloutsBySpec: func(id string) storage.RolloutFilter { return mybackend.RolloutSpec(id) },
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/domain/selector"
+	"github.com/soltiHQ/control-plane/internal/storage"
+)
+
+// Backend describes the implementation under test.
+type Backend struct {
+	// New returns an empty store. It is called once per test; release resources with t.Cleanup.
+	New func(t *testing.T) storage.Storage
+
+	// AgentsByLabel returns the backend's agent filter matching a single label.
+	// Filter tests are skipped when nil.
+	AgentsByLabel func(key, value string) storage.AgentFilter
+	// RolloutsBySpec returns the backend's rollout filter matching a single spec ID.
+	// Filter tests are skipped when nil.
+	RolloutsBySpec func(specID string) storage.RolloutFilter
+}
+
+// foreignFilter satisfies every filter marker but belongs to no backend.
+type foreignFilter struct{}
+
+// Run executes the whole suite as parallel subtests of t.
+func Run(t *testing.T, b Backend) {
+	t.Helper()
+	if b.New == nil {
+		t.Fatal("storagetest: Backend.New is nil")
+	}
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, b Backend)
+	}{
+		{"SentinelErrors", testSentinelErrors},
+		{"IdempotentBulkDeletes", testIdempotentBulkDeletes},
+		{"Lookups", testLookups},
+		{"DefensiveCloning", testDefensiveCloning},
+		{"ResourceVersions", testResourceVersions},
+		{"OrderingAndPagination", testOrderingAndPagination},
+		{"CursorStableUnderConcurrentWrites", testCursorStability},
+		{"FilterTypeRejection", testFilterTypeRejection},
+		{"LimitClamping", testLimitClamping},
+		{"Filters", testFilters},
+		{"Transactions", testTransactions},
+		{"Watch", testWatch},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			tc.fn(t, b)
+		})
+	}
+}
+
+func testSentinelErrors(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.New(t)
+
+	notFound := map[string]error{
+		"GetAgent":                   get(s.GetAgent(ctx, "missing")),
+		"GetUser":                    get(s.GetUser(ctx, "missing")),
+		"GetUserBySubject":           get(s.GetUserBySubject(ctx, "missing")),
+		"GetCredential":              get(s.GetCredential(ctx, "missing")),
+		"GetCredentialByUserAndAuth": get(s.GetCredentialByUserAndAuth(ctx, "missing", kind.Password)),
+		"GetVerifier":                get(s.GetVerifier(ctx, "missing")),
+		"GetVerifierByCredential":    get(s.GetVerifierByCredential(ctx, "missing")),
+		"GetSession":                 get(s.GetSession(ctx, "missing")),
+		"GetRole":                    get(s.GetRole(ctx, "missing")),
+		"GetRoles":                   get(s.GetRoles(ctx, []string{"missing"})),
+		"GetRoleByName":              get(s.GetRoleByName(ctx, "missing")),
+		"GetSpec":                    get(s.GetSpec(ctx, "missing")),
+		"GetRollout":                 get(s.GetRollout(ctx, "missing")),
+		"GetSpecRevision":            get(s.GetSpecRevision(ctx, "missing")),
+		"GetDeployment":              get(s.GetDeployment(ctx, "missing")),
+		"DeleteAgent":                s.DeleteAgent(ctx, "missing"),
+		"DeleteUser":                 s.DeleteUser(ctx, "missing"),
+		"DeleteCredential":           s.DeleteCredential(ctx, "missing"),
+		"DeleteVerifier":             s.DeleteVerifier(ctx, "missing"),
+		"DeleteSession":              s.DeleteSession(ctx, "missing"),
+		"DeleteRole":                 s.DeleteRole(ctx, "missing"),
+		"DeleteSpec":                 s.DeleteSpec(ctx, "missing"),
+		"DeleteRollout":              s.DeleteRollout(ctx, "missing"),
+		"RotateRefresh":              s.RotateRefresh(ctx, "missing", []byte("h"), time.Now().Add(time.Hour)),
+		"RevokeSession":              s.RevokeSession(ctx, "missing", time.Now()),
+	}
+	for op, err := range notFound {
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound, err=%v", op, err)
+		}
+	}
+
+	invalid := map[string]error{
+		"UpsertAgent":                s.UpsertAgent(ctx, nil),
+		"UpsertUser":                 s.UpsertUser(ctx, nil),
+		"UpsertCredential":           s.UpsertCredential(ctx, nil),
+		"UpsertVerifier":             s.UpsertVerifier(ctx, nil),
+		"CreateSession":              s.CreateSession(ctx, nil),
+		"UpsertRole":                 s.UpsertRole(ctx, nil),
+		"UpsertSpec":                 s.UpsertSpec(ctx, nil),
+		"UpsertRollout":              s.UpsertRollout(ctx, nil),
+		"CreateSpecRevision":         s.CreateSpecRevision(ctx, nil),
+		"ListSpecRevisionsBySpec":    get(s.ListSpecRevisionsBySpec(ctx, "")),
+		"DeleteSpecRevisionsBySpec":  s.DeleteSpecRevisionsBySpec(ctx, ""),
+		"UpsertDeployment":           s.UpsertDeployment(ctx, nil),
+		"ListDeploymentsBySpec":      get(s.ListDeploymentsBySpec(ctx, "")),
+		"DeleteDeploymentsBySpec":    s.DeleteDeploymentsBySpec(ctx, ""),
+		"GetAgent":                   get(s.GetAgent(ctx, "")),
+		"GetUserBySubject":           get(s.GetUserBySubject(ctx, "")),
+		"GetCredentialByUserAndAuth": get(s.GetCredentialByUserAndAuth(ctx, "", kind.Password)),
+		"ListCredentialsByUser":      get(s.ListCredentialsByUser(ctx, "")),
+		"GetVerifierByCredential":    get(s.GetVerifierByCredential(ctx, "")),
+		"ListSessionsByUser":         get(s.ListSessionsByUser(ctx, "")),
+		"GetRoles(nil)":              get(s.GetRoles(ctx, nil)),
+		"GetRoles(empty id)":         get(s.GetRoles(ctx, []string{""})),
+		"GetRoleByName":              get(s.GetRoleByName(ctx, "")),
+		"DeleteSpec":                 s.DeleteSpec(ctx, ""),
+		"DeleteSessionsByUser":       s.DeleteSessionsByUser(ctx, ""),
+		"DeleteRolloutsBySpec":       s.DeleteRolloutsBySpec(ctx, ""),
+		"ListRolloutsBySpec":         get(s.ListRolloutsBySpec(ctx, "")),
+		"ListRolloutsByAgent":        get(s.ListRolloutsByAgent(ctx, "")),
+		"DeleteVerifierByCredential": s.DeleteVerifierByCredential(ctx, ""),
+		"RotateRefresh":              s.RotateRefresh(ctx, "s1", nil, time.Now()),
+		"RevokeSession":              s.RevokeSession(ctx, "s1", time.Time{}),
+		"InTx":                       s.InTx(ctx, nil),
+	}
+	for op, err := range invalid {
+		if !errors.Is(err, storage.ErrInvalidArgument) {
+			t.Errorf("%s: expected ErrInvalidArgument, err=%v", op, err)
+		}
+	}
+
+	sess := newSession(t, "s1", "u1")
+	must(t, s.CreateSession(ctx, sess))
+	if err := s.CreateSession(ctx, newSession(t, "s1", "u1")); !errors.Is(err, storage.ErrAlreadyExists) {
+		t.Errorf("CreateSession: expected ErrAlreadyExists for duplicate ID, err=%v", err)
+	}
+
+	must(t, s.CreateSpecRevision(ctx, newSpecRevision(t, "spec-1", 1)))
+	if err := s.CreateSpecRevision(ctx, newSpecRevision(t, "spec-1", 1)); !errors.Is(err, storage.ErrAlreadyExists) {
+		t.Errorf("CreateSpecRevision: expected ErrAlreadyExists for duplicate version, err=%v", err)
+	}
+}
+
+func testIdempotentBulkDeletes(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.New(t)
+
+	must(t, s.DeleteSessionsByUser(ctx, "nobody"))
+	must(t, s.DeleteRolloutsBySpec(ctx, "nothing"))
+	must(t, s.DeleteVerifierByCredential(ctx, "nothing"))
+	must(t, s.DeleteSpecRevisionsBySpec(ctx, "nothing"))
+	must(t, s.DeleteDeploymentsBySpec(ctx, "nothing"))
+
+	must(t, s.CreateSession(ctx, newSession(t, "s1", "u1")))
+	must(t, s.CreateSession(ctx, newSession(t, "s2", "u1")))
+	must(t, s.CreateSession(ctx, newSession(t, "s3", "u2")))
+	must(t, s.DeleteSessionsByUser(ctx, "u1"))
+	if left, err := s.ListSessionsByUser(ctx, "u1"); err != nil || len(left) != 0 {
+		t.Errorf("DeleteSessionsByUser: expected no sessions left, got=%d err=%v", len(left), err)
+	}
+	if _, err := s.GetSession(ctx, "s3"); err != nil {
+		t.Errorf("DeleteSessionsByUser: expected other users' sessions to stay, err=%v", err)
+	}
+
+	must(t, s.UpsertRollout(ctx, newRollout(t, "spec-1", "a1")))
+	must(t, s.UpsertRollout(ctx, newRollout(t, "spec-1", "a2")))
+	must(t, s.UpsertRollout(ctx, newRollout(t, "spec-2", "a1")))
+	must(t, s.DeleteRolloutsBySpec(ctx, "spec-1"))
+	if _, err := s.GetRollout(ctx, model.RolloutID("spec-1", "a1")); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("DeleteRolloutsBySpec: expected spec-1 rollouts to be gone, err=%v", err)
+	}
+	if _, err := s.GetRollout(ctx, model.RolloutID("spec-2", "a1")); err != nil {
+		t.Errorf("DeleteRolloutsBySpec: expected spec-2 rollouts to stay, err=%v", err)
+	}
+
+	must(t, s.CreateSpecRevision(ctx, newSpecRevision(t, "spec-1", 1)))
+	must(t, s.CreateSpecRevision(ctx, newSpecRevision(t, "spec-1", 2)))
+	must(t, s.CreateSpecRevision(ctx, newSpecRevision(t, "spec-2", 1)))
+	if revs, err := s.ListSpecRevisionsBySpec(ctx, "spec-1"); err != nil || len(revs) != 2 {
+		t.Errorf("ListSpecRevisionsBySpec: expected 2 revisions, got=%d err=%v", len(revs), err)
+	}
+	must(t, s.DeleteSpecRevisionsBySpec(ctx, "spec-1"))
+	if revs, err := s.ListSpecRevisionsBySpec(ctx, "spec-1"); err != nil || len(revs) != 0 {
+		t.Errorf("DeleteSpecRevisionsBySpec: expected no revisions left, got=%d err=%v", len(revs), err)
+	}
+	if _, err := s.GetSpecRevision(ctx, model.SpecRevisionID("spec-2", 1)); err != nil {
+		t.Errorf("DeleteSpecRevisionsBySpec: expected spec-2 revisions to stay, err=%v", err)
+	}
+
+	must(t, s.UpsertDeployment(ctx, newDeployment(t, "spec-1", 1)))
+	must(t, s.UpsertDeployment(ctx, newDeployment(t, "spec-1", 2)))
+	must(t, s.UpsertDeployment(ctx, newDeployment(t, "spec-2", 1)))
+	if deps, err := s.ListDeploymentsBySpec(ctx, "spec-1"); err != nil || len(deps) != 2 {
+		t.Errorf("ListDeploymentsBySpec: expected 2 deployments, got=%d err=%v", len(deps), err)
+	}
+	must(t, s.DeleteDeploymentsBySpec(ctx, "spec-1"))
+	if deps, err := s.ListDeploymentsBySpec(ctx, "spec-1"); err != nil || len(deps) != 0 {
+		t.Errorf("DeleteDeploymentsBySpec: expected no deployments left, got=%d err=%v", len(deps), err)
+	}
+	if _, err := s.GetDeployment(ctx, model.DeploymentID("spec-2", 1)); err != nil {
+		t.Errorf("DeleteDeploymentsBySpec: expected spec-2 deployments to stay, err=%v", err)
+	}
+}
+
+func testLookups(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.New(t)
+
+	u := newUser(t, "u1", "alice")
+	must(t, s.UpsertUser(ctx, u))
+	if got, err := s.GetUserBySubject(ctx, "alice"); err != nil || got.ID() != "u1" {
+		t.Errorf("GetUserBySubject: expected u1, err=%v", err)
+	}
+
+	r1, r2 := newRole(t, "r1", "admin"), newRole(t, "r2", "viewer")
+	must(t, s.UpsertRole(ctx, r1))
+	must(t, s.UpsertRole(ctx, r2))
+	if got, err := s.GetRoleByName(ctx, "viewer"); err != nil || got.ID() != "r2" {
+		t.Errorf("GetRoleByName: expected r2, err=%v", err)
+	}
+	roles, err := s.GetRoles(ctx, []string{"r2", "r1", "r2"})
+	must(t, err)
+	if len(roles) != 3 || roles[0].ID() != "r2" || roles[1].ID() != "r1" || roles[2].ID() != "r2" {
+		t.Errorf("GetRoles: expected the order of ids with duplicates preserved, got=%d roles", len(roles))
+	}
+
+	c := newCredential(t, "c1", "u1", kind.Password)
+	must(t, s.UpsertCredential(ctx, c))
+	must(t, s.UpsertCredential(ctx, newCredential(t, "c2", "u2", kind.Password)))
+	if got, err := s.GetCredentialByUserAndAuth(ctx, "u1", kind.Password); err != nil || got.ID() != "c1" {
+		t.Errorf("GetCredentialByUserAndAuth: expected c1, err=%v", err)
+	}
+	if creds, err := s.ListCredentialsByUser(ctx, "u1"); err != nil || len(creds) != 1 {
+		t.Errorf("ListCredentialsByUser: expected 1 credential, got=%d err=%v", len(creds), err)
+	}
+
+	v := newVerifier(t, "v1", "c1", kind.Password)
+	must(t, s.UpsertVerifier(ctx, v))
+	if got, err := s.GetVerifierByCredential(ctx, "c1"); err != nil || got.ID() != "v1" {
+		t.Errorf("GetVerifierByCredential: expected v1, err=%v", err)
+	}
+	must(t, s.DeleteVerifierByCredential(ctx, "c1"))
+	if _, err = s.GetVerifier(ctx, "v1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("DeleteVerifierByCredential: expected v1 to be gone, err=%v", err)
+	}
+
+	sess := newSession(t, "s1", "u1")
+	must(t, s.CreateSession(ctx, sess))
+	exp := time.Now().Add(2 * time.Hour).UTC().Truncate(time.Second)
+	must(t, s.RotateRefresh(ctx, "s1", []byte("rotated"), exp))
+	got, err := s.GetSession(ctx, "s1")
+	must(t, err)
+	if string(got.RefreshHash()) != "rotated" || !got.ExpiresAt().Equal(exp) {
+		t.Errorf("RotateRefresh: expected new hash and expiry, got=%q %v", got.RefreshHash(), got.ExpiresAt())
+	}
+	must(t, s.RevokeSession(ctx, "s1", time.Now()))
+	if got, err = s.GetSession(ctx, "s1"); err != nil || !got.Revoked() {
+		t.Errorf("RevokeSession: expected a revoked session, err=%v", err)
+	}
+
+	for i, env := range []string{"prod", "dev", "prod"} {
+		a := newAgent(t, fmt.Sprintf("a%d", i))
+		a.LabelAdd("env", env)
+		must(t, s.UpsertAgent(ctx, a))
+	}
+	if agents, err := s.ListAgentsBySelector(ctx, selector.FromLabels(map[string]string{"env": "prod"})); err != nil || len(agents) != 2 {
+		t.Errorf("ListAgentsBySelector: expected 2 prod agents, got=%d err=%v", len(agents), err)
+	}
+	notProd, err := selector.Parse("env!=prod")
+	must(t, err)
+	if agents, err := s.ListAgentsBySelector(ctx, notProd); err != nil || len(agents) != 1 || agents[0].ID() != "a1" {
+		t.Errorf("ListAgentsBySelector: expected a1 only, got=%d err=%v", len(agents), err)
+	}
+	if agents, err := s.ListAgentsBySelector(ctx, nil); err != nil || len(agents) != 3 {
+		t.Errorf("ListAgentsBySelector: expected every agent for an empty selector, got=%d err=%v", len(agents), err)
+	}
+
+	must(t, s.UpsertRollout(ctx, newRollout(t, "spec-1", "a0")))
+	must(t, s.UpsertRollout(ctx, newRollout(t, "spec-1", "a1")))
+	must(t, s.UpsertRollout(ctx, newRollout(t, "spec-2", "a0")))
+	if rollouts, err := s.ListRolloutsBySpec(ctx, "spec-1"); err != nil || len(rollouts) != 2 {
+		t.Errorf("ListRolloutsBySpec: expected 2 rollouts, got=%d err=%v", len(rollouts), err)
+	}
+	if rollouts, err := s.ListRolloutsByAgent(ctx, "a0"); err != nil || len(rollouts) != 2 {
+		t.Errorf("ListRolloutsByAgent: expected 2 rollouts, got=%d err=%v", len(rollouts), err)
+	}
+}
+
+func testDefensiveCloning(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.New(t)
+
+	a := newAgent(t, "a1")
+	a.LabelAdd("env", "prod")
+	must(t, s.UpsertAgent(ctx, a))
+
+	// Mutating the written entity must not reach the store.
+	a.LabelAdd("env", "dev")
+	got, err := s.GetAgent(ctx, "a1")
+	must(t, err)
+	if v, _ := got.Label("env"); v != "prod" {
+		t.Errorf("expected stored label to be unaffected by the caller, got=%q", v)
+	}
+
+	// Neither must mutating a returned entity.
+	got.LabelAdd("env", "staging")
+	res, err := s.ListAgents(ctx, nil, storage.ListOptions{})
+	must(t, err)
+	if len(res.Items) != 1 {
+		t.Fatalf("expected 1 agent, got=%d", len(res.Items))
+	}
+	if v, _ := res.Items[0].Label("env"); v != "prod" {
+		t.Errorf("expected stored label to be unaffected by Get results, got=%q", v)
+	}
+	res.Items[0].LabelAdd("env", "qa")
+	if again, _ := s.GetAgent(ctx, "a1"); again != nil {
+		if v, _ := again.Label("env"); v != "prod" {
+			t.Errorf("expected stored label to be unaffected by List results, got=%q", v)
+		}
+	}
+}
+
+func testResourceVersions(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.New(t)
+
+	a := newAgent(t, "a1")
+	must(t, s.UpsertAgent(ctx, a))
+	v1 := a.ResourceVersion()
+	if v1 == 0 {
+		t.Fatalf("expected a resource version on the written entity")
+	}
+
+	stale, err := s.GetAgent(ctx, "a1")
+	must(t, err)
+	if stale.ResourceVersion() != v1 {
+		t.Errorf("expected Get to return version %d, got=%d", v1, stale.ResourceVersion())
+	}
+	must(t, s.UpsertAgent(ctx, a))
+	if a.ResourceVersion() <= v1 {
+		t.Errorf("expected the version to increase, got=%d after %d", a.ResourceVersion(), v1)
+	}
+	if err = s.UpsertAgent(ctx, stale); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict for a stale version, err=%v", err)
+	}
+
+	must(t, s.DeleteAgent(ctx, "a1"))
+	if err = s.UpsertAgent(ctx, a); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("expected ErrConflict for a deleted entity, err=%v", err)
+	}
+	a.SetResourceVersion(0)
+	if err = s.UpsertAgent(ctx, a); err != nil {
+		t.Errorf("expected an unconditional upsert to succeed, err=%v", err)
+	}
+}
+
+func testOrderingAndPagination(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.New(t)
+
+	const n = 23
+	for i := range n {
+		must(t, s.UpsertAgent(ctx, newAgent(t, fmt.Sprintf("a%02d", i))))
+	}
+
+	var (
+		all    []*model.Agent
+		cursor string
+		pages  int
+	)
+	for {
+		res, err := s.ListAgents(ctx, nil, storage.ListOptions{Limit: 5, Cursor: cursor})
+		must(t, err)
+		if len(res.Items) > 5 {
+			t.Fatalf("page %d: expected at most 5 items, got=%d", pages, len(res.Items))
+		}
+		all = append(all, res.Items...)
+		pages++
+		if res.NextCursor == "" {
+			break
+		}
+		if pages > n {
+			t.Fatalf("pagination does not terminate")
+		}
+		cursor = res.NextCursor
+	}
+
+	if len(all) != n {
+		t.Fatalf("expected %d agents across pages, got=%d", n, len(all))
+	}
+	requireOrdered(t, all)
+	seen := make(map[string]bool, n)
+	for _, a := range all {
+		if seen[a.ID()] {
+			t.Fatalf("agent %s returned twice", a.ID())
+		}
+		seen[a.ID()] = true
+	}
+
+	empty, err := s.ListSpecs(ctx, nil, storage.ListOptions{})
+	must(t, err)
+	if len(empty.Items) != 0 || empty.NextCursor != "" {
+		t.Errorf("expected an empty final page for an empty collection, got=%d items cursor=%q", len(empty.Items), empty.NextCursor)
+	}
+}
+
+func testCursorStability(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.New(t)
+
+	const n = 60
+	seeded := make(map[string]bool, n)
+	for i := range n {
+		id := fmt.Sprintf("seed-%02d", i)
+		must(t, s.UpsertAgent(ctx, newAgent(t, id)))
+		seeded[id] = true
+	}
+
+	// New entities sort before every seeded one, so they must not shift the pages after a cursor.
+	var (
+		wg   sync.WaitGroup
+		stop = make(chan struct{})
+		errs = make(chan error, 1)
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			a, err := model.NewAgent(fmt.Sprintf("new-%04d", i), "new", "http://new")
+			if err == nil {
+				err = s.UpsertAgent(ctx, a)
+			}
+			if err != nil {
+				select {
+				case errs <- err:
+				default:
+				}
+				return
+			}
+		}
+	}()
+
+	seen := make(map[string]int)
+	cursor := ""
+	for {
+		res, err := s.ListAgents(ctx, nil, storage.ListOptions{Limit: 7, Cursor: cursor})
+		if err != nil {
+			close(stop)
+			wg.Wait()
+			t.Fatalf("ListAgents: %v", err)
+		}
+		for _, a := range res.Items {
+			seen[a.ID()]++
+		}
+		if res.NextCursor == "" {
+			break
+		}
+		cursor = res.NextCursor
+	}
+	close(stop)
+	wg.Wait()
+	select {
+	case err := <-errs:
+		t.Fatalf("concurrent writer: %v", err)
+	default:
+	}
+
+	for id, count := range seen {
+		if count > 1 {
+			t.Errorf("agent %s returned %d times", id, count)
+		}
+	}
+	for id := range seeded {
+		if seen[id] != 1 {
+			t.Errorf("seeded agent %s missing from the paged result", id)
+		}
+	}
+}
+
+func testFilterTypeRejection(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.New(t)
+	f := foreignFilter{}
+
+	lists := map[string]error{
+		"ListAgents":   get(s.ListAgents(ctx, f, storage.ListOptions{})),
+		"ListUsers":    get(s.ListUsers(ctx, f, storage.ListOptions{})),
+		"ListRoles":    get(s.ListRoles(ctx, f, storage.ListOptions{})),
+		"ListSpecs":    get(s.ListSpecs(ctx, f, storage.ListOptions{})),
+		"ListRollouts": get(s.ListRollouts(ctx, f, storage.ListOptions{})),
+	}
+	for op, err := range lists {
+		if !errors.Is(err, storage.ErrInvalidArgument) {
+			t.Errorf("%s: expected ErrInvalidArgument for a foreign filter, err=%v", op, err)
+		}
+	}
+
+	if _, err := s.ListAgents(ctx, nil, storage.ListOptions{Cursor: "not a cursor"}); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Errorf("ListAgents: expected ErrInvalidArgument for a malformed cursor, err=%v", err)
+	}
+	if _, err := s.Watch(ctx, storage.KindAgent, f, 0); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Errorf("Watch: expected ErrInvalidArgument for a foreign filter, err=%v", err)
+	}
+}
+
+func testLimitClamping(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.New(t)
+
+	const n = storage.MaxListLimit + 10
+	must(t, s.InTx(ctx, func(tx storage.Tx) error {
+		for i := range n {
+			a, err := model.NewAgent(fmt.Sprintf("a%04d", i), "agent", "http://agent")
+			if err != nil {
+				return err
+			}
+			if err = tx.UpsertAgent(ctx, a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	cases := []struct {
+		limit int
+		want  int
+	}{
+		{0, storage.DefaultListLimit},
+		{-1, storage.DefaultListLimit},
+		{1, 1},
+		{storage.MaxListLimit + 1000, storage.MaxListLimit},
+	}
+	for _, tc := range cases {
+		res, err := s.ListAgents(ctx, nil, storage.ListOptions{Limit: tc.limit})
+		must(t, err)
+		if len(res.Items) != tc.want || res.NextCursor == "" {
+			t.Errorf("limit %d: expected %d items and a next cursor, got=%d cursor=%q", tc.limit, tc.want, len(res.Items), res.NextCursor)
+		}
+	}
+}
+
+func testFilters(t *testing.T, b Backend) {
+	if b.AgentsByLabel == nil || b.RolloutsBySpec == nil {
+		t.Skip("backend filters not provided")
+	}
+	ctx := context.Background()
+	s := b.New(t)
+
+	for i, env := range []string{"prod", "dev", "prod"} {
+		a := newAgent(t, fmt.Sprintf("a%d", i))
+		a.LabelAdd("env", env)
+		must(t, s.UpsertAgent(ctx, a))
+	}
+	res, err := s.ListAgents(ctx, b.AgentsByLabel("env", "prod"), storage.ListOptions{})
+	must(t, err)
+	if len(res.Items) != 2 {
+		t.Errorf("expected 2 prod agents, got=%d", len(res.Items))
+	}
+	requireOrdered(t, res.Items)
+
+	must(t, s.UpsertRollout(ctx, newRollout(t, "spec-1", "a0")))
+	must(t, s.UpsertRollout(ctx, newRollout(t, "spec-1", "a1")))
+	must(t, s.UpsertRollout(ctx, newRollout(t, "spec-2", "a0")))
+	page, err := s.ListRollouts(ctx, b.RolloutsBySpec("spec-1"), storage.ListOptions{Limit: 1})
+	must(t, err)
+	if len(page.Items) != 1 || page.NextCursor == "" {
+		t.Fatalf("expected a first page of one spec-1 rollout, got=%d cursor=%q", len(page.Items), page.NextCursor)
+	}
+	rest, err := s.ListRollouts(ctx, b.RolloutsBySpec("spec-1"), storage.ListOptions{Limit: 1, Cursor: page.NextCursor})
+	must(t, err)
+	if len(rest.Items) != 1 || rest.NextCursor != "" || rest.Items[0].ID() == page.Items[0].ID() {
+		t.Errorf("expected the other spec-1 rollout on the last page, got=%d cursor=%q", len(rest.Items), rest.NextCursor)
+	}
+}
+
+func testTransactions(t *testing.T, b Backend) {
+	ctx := context.Background()
+	s := b.New(t)
+
+	must(t, s.UpsertRollout(ctx, newRollout(t, "spec-1", "a1")))
+	before, err := s.Revision(ctx)
+	must(t, err)
+
+	errStop := errors.New("stop")
+	err = s.InTx(ctx, func(tx storage.Tx) error {
+		if err := tx.DeleteRolloutsBySpec(ctx, "spec-1"); err != nil {
+			return err
+		}
+		if err := tx.UpsertAgent(ctx, newAgent(t, "a1")); err != nil {
+			return err
+		}
+		if err := tx.CreateSpecRevision(ctx, newSpecRevision(t, "spec-1", 1)); err != nil {
+			return err
+		}
+		if _, err := tx.GetAgent(ctx, "a1"); err != nil {
+			t.Errorf("expected the transaction to read its own writes, err=%v", err)
+		}
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("expected the function error from InTx, err=%v", err)
+	}
+	if _, err = s.GetRollout(ctx, model.RolloutID("spec-1", "a1")); err != nil {
+		t.Errorf("expected the delete to be rolled back, err=%v", err)
+	}
+	if _, err = s.GetAgent(ctx, "a1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected the insert to be rolled back, err=%v", err)
+	}
+	if _, err = s.GetSpecRevision(ctx, model.SpecRevisionID("spec-1", 1)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected the revision to be rolled back, err=%v", err)
+	}
+	if rev, _ := s.Revision(ctx); rev != before {
+		t.Errorf("expected a rolled-back transaction to consume no revision, got=%d want=%d", rev, before)
+	}
+
+	must(t, s.InTx(ctx, func(tx storage.Tx) error {
+		if err := tx.DeleteRolloutsBySpec(ctx, "spec-1"); err != nil {
+			return err
+		}
+		return tx.UpsertAgent(ctx, newAgent(t, "a1"))
+	}))
+	if _, err = s.GetRollout(ctx, model.RolloutID("spec-1", "a1")); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("expected the delete to be committed, err=%v", err)
+	}
+	if _, err = s.GetAgent(ctx, "a1"); err != nil {
+		t.Errorf("expected the insert to be committed, err=%v", err)
+	}
+}
+
+func testWatch(t *testing.T, b Backend) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := b.New(t)
+
+	// A zero fromRevision means "future changes only", so start from a non-zero one.
+	must(t, s.UpsertAgent(ctx, newAgent(t, "a0")))
+	from, err := s.Revision(ctx)
+	must(t, err)
+	a := newAgent(t, "a1")
+	must(t, s.UpsertAgent(ctx, a))
+	must(t, s.DeleteAgent(ctx, "a1"))
+
+	events, err := s.Watch(ctx, storage.KindAgent, nil, from)
+	must(t, err)
+	var last uint64
+	for _, want := range []storage.EventType{storage.EventCreated, storage.EventDeleted} {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatalf("watch closed before %s", want)
+			}
+			if ev.Type != want || ev.ID != "a1" || ev.Revision <= last {
+				t.Fatalf("unexpected event: %+v (want %s after revision %d)", ev, want, last)
+			}
+			last = ev.Revision
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+	if last != a.ResourceVersion()+1 {
+		t.Errorf("expected the delete to follow the write revision %d, got=%d", a.ResourceVersion(), last)
+	}
+
+	if _, err = s.Watch(ctx, storage.Kind("nope"), nil, 0); !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Errorf("Watch: expected ErrInvalidArgument for an unknown kind, err=%v", err)
+	}
+}
+
+// requireOrdered fails unless items follow (UpdatedAt DESC, ID ASC).
+func requireOrdered(t *testing.T, items []*model.Agent) {
+	t.Helper()
+	for i := 1; i < len(items); i++ {
+		prev, cur := items[i-1], items[i]
+		if prev.UpdatedAt().Before(cur.UpdatedAt()) ||
+			(prev.UpdatedAt().Equal(cur.UpdatedAt()) && prev.ID() >= cur.ID()) {
+			t.Fatalf("items %d and %d out of order: %s@%v, %s@%v", i-1, i, prev.ID(), prev.UpdatedAt(), cur.ID(), cur.UpdatedAt())
+		}
+	}
+}
+
+func get[T any](_ T, err error) error { return err }
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func newAgent(t *testing.T, id string) *model.Agent {
+	t.Helper()
+	a, err := model.NewAgent(id, "agent-"+id, "http://"+id)
+	must(t, err)
+	return a
+}
+
+func newUser(t *testing.T, id, subject string) *model.User {
+	t.Helper()
+	u, err := model.NewUser(id, subject)
+	must(t, err)
+	return u
+}
+
+func newRole(t *testing.T, id, name string) *model.Role {
+	t.Helper()
+	r, err := model.NewRole(id, name)
+	must(t, err)
+	return r
+}
+
+func newCredential(t *testing.T, id, userID string, auth kind.Auth) *model.Credential {
+	t.Helper()
+	c, err := model.NewCredential(id, userID, auth)
+	must(t, err)
+	return c
+}
+
+func newVerifier(t *testing.T, id, credentialID string, auth kind.Auth) *model.Verifier {
+	t.Helper()
+	v, err := model.NewVerifier(id, credentialID, auth)
+	must(t, err)
+	return v
+}
+
+func newSession(t *testing.T, id, userID string) *model.Session {
+	t.Helper()
+	sess, err := model.NewSession(id, userID, "cred-"+userID, kind.Password, []byte("hash-"+id), time.Now().Add(time.Hour))
+	must(t, err)
+	return sess
+}
+
+func newRollout(t *testing.T, specID, agentID string) *model.Rollout {
+	t.Helper()
+	ro, err := model.NewRollout(specID, agentID, 1)
+	must(t, err)
+	return ro
+}
+
+func newSpecRevision(t *testing.T, specID string, version int) *model.SpecRevision {
+	t.Helper()
+	ts, err := model.NewSpec(specID, "web", "worker")
+	must(t, err)
+	for ts.Version() < version {
+		ts.IncrementVersion()
+	}
+	rev, err := model.NewSpecRevision(ts, "alice")
+	must(t, err)
+	return rev
+}
+
+func newDeployment(t *testing.T, specID string, version int) *model.Deployment {
+	t.Helper()
+	d, err := model.NewDeployment(specID, version, "alice")
+	must(t, err)
+	return d
+}
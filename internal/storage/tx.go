@@ -0,0 +1,37 @@
+package storage
+
+import "context"
+
+// Tx is the view of a Storage inside a transaction.
+//
+// It offers the same entity operations as Storage. Reads observe the writes made
+// earlier in the same transaction; other callers observe none of them until commit.
+// A Tx must not be used after the function it was passed to has returned.
+type Tx interface {
+	CredentialStore
+	VerifierStore
+	SessionStore
+	RolloutStore
+	AgentStore
+	RoleStore
+	UserStore
+	SpecStore
+	SpecRevisionStore
+	DeploymentStore
+}
+
+// Transactor runs multi-entity mutations atomically.
+type Transactor interface {
+	// InTx runs fn in a transaction.
+	//
+	// If fn returns nil, all its writes are committed together: they become visible,
+	// durable and published to watchers at once, each with its own revision. If fn
+	// returns an error (or panics), none of them is applied and the error is returned
+	// unchanged. Resource versions stamped on entities passed to a rolled-back
+	// transaction are meaningless.
+	//
+	// Returns:
+	//   - ErrInvalidArgument if fn is nil.
+	//   - ErrUnavailable if the backend cannot commit the writes.
+	InTx(ctx context.Context, fn func(tx Tx) error) error
+}
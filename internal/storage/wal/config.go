@@ -0,0 +1,36 @@
+package wal
+
+import (
+	"time"
+
+	"github.com/soltiHQ/control-plane/internal/storage/codec"
+)
+
+const (
+	defaultSnapshotInterval  = time.Minute
+	defaultSnapshotThreshold = 10000
+)
+
+// Config configures the write-ahead log.
+type Config struct {
+	// SnapshotInterval is how often the compaction loop checks the log size.
+	SnapshotInterval time.Duration
+	// SnapshotThreshold is the number of records since the last snapshot that triggers compaction.
+	SnapshotThreshold int
+	// NoSync skips fsync after each record: faster, but a power loss may drop the latest writes.
+	NoSync bool
+	// RepairTail cuts a truncated or corrupt log tail instead of failing Open.
+	RepairTail bool
+	// Codec encodes log records and snapshots; nil writes secrets in the clear.
+	Codec *codec.Codec
+}
+
+func (c Config) withDefaults() Config {
+	if c.SnapshotInterval <= 0 {
+		c.SnapshotInterval = defaultSnapshotInterval
+	}
+	if c.SnapshotThreshold <= 0 {
+		c.SnapshotThreshold = defaultSnapshotThreshold
+	}
+	return c
+}
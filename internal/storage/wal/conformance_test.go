@@ -0,0 +1,21 @@
+package wal
+
+import (
+	"testing"
+
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+	"github.com/soltiHQ/control-plane/internal/storage/storagetest"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	storagetest.Run(t, storagetest.Backend{
+		New: func(t *testing.T) storage.Storage { return open(t, t.TempDir(), testConfig()) },
+		AgentsByLabel: func(key, value string) storage.AgentFilter {
+			return inmemory.NewAgentFilter().ByLabel(key, value)
+		},
+		RolloutsBySpec: func(specID string) storage.RolloutFilter {
+			return inmemory.NewRolloutFilter().BySpecID(specID)
+		},
+	})
+}
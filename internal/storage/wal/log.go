@@ -0,0 +1,286 @@
+package wal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/codec"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+const (
+	segmentPrefix = "wal-"
+	segmentExt    = ".log"
+
+	// frameHeaderSize is the length prefix (uint32) followed by the CRC-32C of the payload (uint32).
+	frameHeaderSize = 8
+	// maxRecordSize bounds a single record; a larger length prefix is treated as corruption.
+	maxRecordSize = 64 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// opBatch marks a record holding the mutations of one transaction in Batch.
+const opBatch = "batch"
+
+// record is the payload of one log frame.
+type record struct {
+	Seq  uint64          `json:"seq"`
+	Kind storage.Kind    `json:"kind,omitempty"`
+	Op   string          `json:"op"`
+	ID   string          `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+
+	// Batch holds the mutations of a transaction (Op is opBatch); they have no Seq of their own.
+	Batch []record `json:"batch,omitempty"`
+}
+
+// segment is a log file holding records starting at sequence first.
+type segment struct {
+	first uint64
+	path  string
+}
+
+func segmentName(first uint64) string {
+	return fmt.Sprintf("%s%020d%s", segmentPrefix, first, segmentExt)
+}
+
+// listSegments returns the log segments in dir ordered by their first sequence.
+func listSegments(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []segment
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentExt), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: malformed segment name %q", ErrCorrupt, name)
+		}
+		out = append(out, segment{first: first, path: filepath.Join(dir, name)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].first < out[j].first })
+	return out, nil
+}
+
+// readSegment decodes every frame of a segment and calls fn for each record.
+//
+// It returns the offset just past the last valid frame. A partial frame at the end
+// yields ErrTruncated, a checksum or decoding failure yields ErrCorrupt; in both
+// cases the returned offset marks where the valid prefix ends.
+func readSegment(path string, fn func(rec record) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var (
+		off    int64
+		header [frameHeaderSize]byte
+	)
+	for {
+		if _, err = io.ReadFull(f, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return off, nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return off, fmt.Errorf("%w: %s: partial frame header at offset %d", ErrTruncated, filepath.Base(path), off)
+			}
+			return off, err
+		}
+
+		size := binary.LittleEndian.Uint32(header[0:4])
+		sum := binary.LittleEndian.Uint32(header[4:8])
+		if size == 0 || size > maxRecordSize {
+			return off, fmt.Errorf("%w: %s: invalid frame length %d at offset %d", ErrCorrupt, filepath.Base(path), size, off)
+		}
+
+		payload := make([]byte, size)
+		if _, err = io.ReadFull(f, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return off, fmt.Errorf("%w: %s: partial frame payload at offset %d", ErrTruncated, filepath.Base(path), off)
+			}
+			return off, err
+		}
+		if crc32.Checksum(payload, crcTable) != sum {
+			return off, fmt.Errorf("%w: %s: checksum mismatch at offset %d", ErrCorrupt, filepath.Base(path), off)
+		}
+
+		var rec record
+		if err = json.Unmarshal(payload, &rec); err != nil {
+			return off, fmt.Errorf("%w: %s: undecodable record at offset %d: %v", ErrCorrupt, filepath.Base(path), off, err)
+		}
+		if err = fn(rec); err != nil {
+			return off, err
+		}
+		off += int64(frameHeaderSize) + int64(size)
+	}
+}
+
+// appender appends records to the active segment and implements inmemory.BatchJournal.
+type appender struct {
+	mu sync.Mutex
+
+	dir    string
+	noSync bool
+	codec  *codec.Codec
+
+	file *os.File
+	seq  uint64 // last assigned sequence
+	// pending counts records appended since the last snapshot.
+	pending int
+}
+
+var _ inmemory.BatchJournal = (*appender)(nil)
+
+// Record implements inmemory.Journal.
+func (a *appender) Record(k storage.Kind, op inmemory.Op, id string, entity any) error {
+	rec, err := a.newRecord(k, op, id, entity)
+	if err != nil {
+		return err
+	}
+	return a.append(rec)
+}
+
+// RecordBatch implements inmemory.BatchJournal.
+//
+// The whole transaction is written as a single frame, so a torn write loses all of it.
+func (a *appender) RecordBatch(entries []inmemory.Entry) error {
+	rec := record{Op: opBatch, Batch: make([]record, 0, len(entries))}
+	for _, e := range entries {
+		sub, err := a.newRecord(e.Kind, e.Op, e.ID, e.Entity)
+		if err != nil {
+			return err
+		}
+		rec.Batch = append(rec.Batch, sub)
+	}
+	return a.append(rec)
+}
+
+func (a *appender) newRecord(k storage.Kind, op inmemory.Op, id string, entity any) (record, error) {
+	rec := record{Kind: k, Op: op.String(), ID: id}
+	if op == inmemory.OpPut {
+		_, data, err := a.codec.Encode(entity)
+		if err != nil {
+			return record{}, err
+		}
+		rec.Data = data
+	}
+	return rec, nil
+}
+
+// append assigns the next sequence to rec and writes it as one frame.
+func (a *appender) append(rec record) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return fmt.Errorf("%w: wal: log is closed", storage.ErrUnavailable)
+	}
+
+	rec.Seq = a.seq + 1
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("%w: wal: encode record: %v", storage.ErrInternal, err)
+	}
+
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	copy(frame[frameHeaderSize:], payload)
+
+	if _, err = a.file.Write(frame); err != nil {
+		return fmt.Errorf("%w: wal: append: %v", storage.ErrUnavailable, err)
+	}
+	if !a.noSync {
+		if err = a.file.Sync(); err != nil {
+			return fmt.Errorf("%w: wal: sync: %v", storage.ErrUnavailable, err)
+		}
+	}
+
+	a.seq = rec.Seq
+	a.pending++
+	return nil
+}
+
+// rotate closes the active segment and starts a new one after the current sequence.
+//
+// It returns the last sequence covered by the closed segments, or ok=false when
+// nothing was appended since the previous rotation (unless force is set).
+func (a *appender) rotate(force bool) (cut uint64, ok bool, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.pending == 0 && !force {
+		return 0, false, nil
+	}
+	if a.file == nil {
+		return 0, false, fmt.Errorf("%w: wal: log is closed", storage.ErrUnavailable)
+	}
+
+	next, err := createSegment(a.dir, a.seq+1)
+	if err != nil {
+		return 0, false, err
+	}
+	if err = a.file.Close(); err != nil {
+		_ = next.Close()
+		return 0, false, err
+	}
+
+	a.file = next
+	a.pending = 0
+	return a.seq, true, nil
+}
+
+func (a *appender) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Sync()
+	if cerr := a.file.Close(); err == nil {
+		err = cerr
+	}
+	a.file = nil
+	return err
+}
+
+func createSegment(dir string, first uint64) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(first)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err = syncDir(dir); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+	return d.Sync()
+}
@@ -0,0 +1,354 @@
+// Package wal adds write-ahead logging and snapshot recovery to the in-memory store.
+//
+// Reads and writes are served by inmemory.Store; every mutation is first appended to
+// an on-disk log (see inmemory.Journal). A background loop periodically writes a full
+// snapshot and drops the log segments it covers. On Open the latest snapshot is loaded
+// and the remaining log records are replayed on top of it.
+//
+// Layout:
+//
+//	<dir>/
+//	├── snapshot.json                  header, one entity per line, trailer
+//	└── wal-<first-seq>.log            frames: len(uint32) | crc32c(uint32) | JSON record
+//
+// A transaction (see storage.Transactor) is logged as a single batch record, so replay
+// applies either all of its mutations or none.
+//
+// A partial frame at the end of the newest segment (ErrTruncated) or a checksum mismatch
+// (ErrCorrupt) fails Open unless Config.RepairTail is set, in which case the log is cut
+// at the last valid record and the damage is reported through Recovery.
+//
+// Records and snapshots are encoded with Config.Codec; one built with a keyring seals
+// credential secrets and verifier data, and Rewrap re-seals them after key rotation.
+//
+// Like filestore, the directory is locked (see dirlock) from Open until Close, and
+// filters and cursors are those of the inmemory backend.
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/codec"
+	"github.com/soltiHQ/control-plane/internal/storage/dirlock"
+	"github.com/soltiHQ/control-plane/internal/storage/inmemory"
+)
+
+var (
+	// ErrTruncated indicates a log ends in the middle of a record (typically a crash during append).
+	ErrTruncated = errors.New("wal: truncated record")
+	// ErrCorrupt indicates a log or snapshot failed checksum or decoding.
+	ErrCorrupt = errors.New("wal: corrupt data")
+)
+
+// Compile-time check that Store implements storage.Storage.
+var _ storage.Storage = (*Store)(nil)
+
+// Recovery describes what Open restored.
+type Recovery struct {
+	// SnapshotSeq is the log sequence covered by the loaded snapshot (0 without snapshot).
+	SnapshotSeq uint64
+	// Replayed is the number of log records applied on top of the snapshot.
+	Replayed int
+	// LastSeq is the last valid log sequence.
+	LastSeq uint64
+	// TailErr describes a damaged log tail that was cut off (only with Config.RepairTail).
+	TailErr error
+	// TruncatedBytes is the number of bytes removed from the log tail.
+	TruncatedBytes int64
+}
+
+// Store is an inmemory.Store made durable by a write-ahead log.
+type Store struct {
+	*inmemory.Store
+
+	cfg      Config
+	dir      string
+	log      *appender
+	lock     *dirlock.Lock
+	recovery Recovery
+
+	compactMu sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Open replays the snapshot and log in dir and starts the compaction loop.
+//
+// A directory held by another open store fails with dirlock.ErrLocked.
+func Open(dir string, cfg Config) (_ *Store, err error) {
+	if dir == "" {
+		return nil, errors.New("wal: dir is empty")
+	}
+	cfg = cfg.withDefaults()
+
+	if err = os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+	lock, err := dirlock.Acquire(dir)
+	if err != nil {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = lock.Release()
+		}
+	}()
+
+	state := newReplayState(cfg.Codec)
+	snapSeq, err := readSnapshot(dir, state)
+	if err != nil {
+		return nil, err
+	}
+
+	rec, err := replay(dir, snapSeq, state, cfg.RepairTail)
+	if err != nil {
+		return nil, err
+	}
+	rec.SnapshotSeq = snapSeq
+
+	log := &appender{dir: dir, noSync: cfg.NoSync, codec: cfg.Codec, seq: rec.LastSeq, pending: rec.Replayed}
+	mem := inmemory.New(inmemory.WithJournal(log))
+	for _, entity := range state.entities() {
+		if err = mem.Restore(entity); err != nil {
+			return nil, fmt.Errorf("wal: restore: %w", err)
+		}
+	}
+
+	if log.file, err = openActiveSegment(dir, rec.LastSeq); err != nil {
+		return nil, fmt.Errorf("wal: %w", err)
+	}
+
+	s := &Store{
+		Store:    mem,
+		cfg:      cfg,
+		dir:      dir,
+		log:      log,
+		lock:     lock,
+		recovery: rec,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Recovery reports what Open restored from disk.
+func (s *Store) Recovery() Recovery { return s.recovery }
+
+// Compact writes a snapshot of the current state and removes the log segments it covers.
+//
+// It is a no-op when nothing was logged since the previous snapshot.
+func (s *Store) Compact(ctx context.Context) error {
+	return s.compact(ctx, false)
+}
+
+// Rewrap rewrites the whole state with the configured codec.
+//
+// Once the codec's keyring holds a new active key, Rewrap writes a fresh snapshot,
+// sealing every secret under it, and drops all log segments, after which the previous
+// key can be retired. It is a compaction that runs even when nothing was logged, so
+// the store keeps serving meanwhile.
+func (s *Store) Rewrap(ctx context.Context) error {
+	return s.compact(ctx, true)
+}
+
+func (s *Store) compact(ctx context.Context, force bool) error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	cut, ok, err := s.log.rotate(force)
+	if err != nil || !ok {
+		return err
+	}
+	if err = writeSnapshot(ctx, s.dir, cut, s.Store, s.cfg.Codec); err != nil {
+		return fmt.Errorf("wal: snapshot: %w", err)
+	}
+
+	segments, err := listSegments(s.dir)
+	if err != nil {
+		return fmt.Errorf("wal: %w", err)
+	}
+	for _, seg := range segments {
+		if seg.first > cut {
+			continue
+		}
+		if err = os.Remove(seg.path); err != nil {
+			return fmt.Errorf("wal: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close stops the compaction loop, closes the log and releases the directory lock.
+//
+// Subsequent mutations fail with storage.ErrUnavailable.
+func (s *Store) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+		err = errors.Join(s.log.close(), s.lock.Release())
+	})
+	return err
+}
+
+func (s *Store) loop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.log.mu.Lock()
+			pending := s.log.pending
+			s.log.mu.Unlock()
+
+			if pending < s.cfg.SnapshotThreshold {
+				continue
+			}
+			// Failures leave the log intact; the next tick retries.
+			_ = s.Compact(context.Background())
+		}
+	}
+}
+
+// replay applies every log record after snapSeq to state.
+func replay(dir string, snapSeq uint64, state *replayState, repair bool) (Recovery, error) {
+	var rec Recovery
+	rec.LastSeq = snapSeq
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return rec, fmt.Errorf("wal: %w", err)
+	}
+
+	for i, seg := range segments {
+		last := i == len(segments)-1
+
+		off, err := readSegment(seg.path, func(r record) error {
+			if r.Seq <= snapSeq {
+				return nil
+			}
+			if r.Seq != rec.LastSeq+1 {
+				return fmt.Errorf("%w: %s: sequence gap: expected %d, found %d", ErrCorrupt, seg.path, rec.LastSeq+1, r.Seq)
+			}
+			if err := state.apply(r); err != nil {
+				return fmt.Errorf("%w: %s: record %d: %v", ErrCorrupt, seg.path, r.Seq, err)
+			}
+			rec.LastSeq = r.Seq
+			rec.Replayed++
+			return nil
+		})
+		if err == nil {
+			continue
+		}
+
+		// Only the newest segment may end in a damaged record: older segments were
+		// closed cleanly before a new one was started.
+		tailDamage := errors.Is(err, ErrTruncated) || errors.Is(err, ErrCorrupt)
+		if !last || !tailDamage || !repair {
+			return rec, err
+		}
+
+		info, statErr := os.Stat(seg.path)
+		if statErr != nil {
+			return rec, fmt.Errorf("wal: %w", statErr)
+		}
+		if err := os.Truncate(seg.path, off); err != nil {
+			return rec, fmt.Errorf("wal: repair: %w", err)
+		}
+		rec.TailErr = err
+		rec.TruncatedBytes = info.Size() - off
+	}
+	return rec, nil
+}
+
+// openActiveSegment opens the newest segment for appending, or creates one after lastSeq.
+func openActiveSegment(dir string, lastSeq uint64) (*os.File, error) {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if n := len(segments); n > 0 {
+		return createSegment(dir, segments[n-1].first)
+	}
+	return createSegment(dir, lastSeq+1)
+}
+
+// replayState accumulates the final state while loading the snapshot and the log.
+type replayState struct {
+	codec  *codec.Codec
+	byKind map[storage.Kind]map[string]any
+}
+
+func newReplayState(c *codec.Codec) *replayState {
+	st := &replayState{codec: c, byKind: make(map[storage.Kind]map[string]any, len(storage.Kinds))}
+	for _, k := range storage.Kinds {
+		st.byKind[k] = make(map[string]any)
+	}
+	return st
+}
+
+func (st *replayState) put(k storage.Kind, entity any) error {
+	m, ok := st.byKind[k]
+	if !ok {
+		return fmt.Errorf("unknown kind %q", k)
+	}
+	e, ok := entity.(interface{ ID() string })
+	if !ok {
+		return fmt.Errorf("entity %T has no id", entity)
+	}
+	m[e.ID()] = entity
+	return nil
+}
+
+func (st *replayState) apply(r record) error {
+	switch r.Op {
+	case opBatch:
+		for i, sub := range r.Batch {
+			if sub.Op == opBatch {
+				return fmt.Errorf("batch entry %d: nested batch", i)
+			}
+			if err := st.apply(sub); err != nil {
+				return fmt.Errorf("batch entry %d: %w", i, err)
+			}
+		}
+		return nil
+	case inmemory.OpPut.String():
+		entity, err := st.codec.Decode(r.Kind, r.Data)
+		if err != nil {
+			return err
+		}
+		return st.put(r.Kind, entity)
+	case inmemory.OpDelete.String():
+		m, ok := st.byKind[r.Kind]
+		if !ok {
+			return fmt.Errorf("unknown kind %q", r.Kind)
+		}
+		delete(m, r.ID)
+		return nil
+	default:
+		return fmt.Errorf("unknown op %q", r.Op)
+	}
+}
+
+func (st *replayState) entities() []any {
+	var out []any
+	for _, k := range storage.Kinds {
+		for _, e := range st.byKind[k] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
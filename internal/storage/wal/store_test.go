@@ -0,0 +1,351 @@
+package wal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soltiHQ/control-plane/domain/kind"
+	"github.com/soltiHQ/control-plane/domain/model"
+	"github.com/soltiHQ/control-plane/internal/storage"
+	"github.com/soltiHQ/control-plane/internal/storage/codec"
+	"github.com/soltiHQ/control-plane/internal/storage/dirlock"
+	"github.com/soltiHQ/control-plane/internal/storage/keyring"
+)
+
+func requireNoErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// testConfig keeps the compaction loop out of the way; tests call Compact explicitly.
+func testConfig() Config {
+	return Config{SnapshotInterval: time.Hour}
+}
+
+func open(t *testing.T, dir string, cfg Config) *Store {
+	t.Helper()
+	s, err := Open(dir, cfg)
+	requireNoErr(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func putAgent(t *testing.T, s *Store, id string) {
+	t.Helper()
+	a, err := model.NewAgent(id, "agent-"+id, "http://"+id)
+	requireNoErr(t, err)
+	requireNoErr(t, s.UpsertAgent(context.Background(), a))
+}
+
+func activeSegment(t *testing.T, dir string) string {
+	t.Helper()
+	segments, err := listSegments(dir)
+	requireNoErr(t, err)
+	if len(segments) == 0 {
+		t.Fatalf("expected at least one segment")
+	}
+	return segments[len(segments)-1].path
+}
+
+func TestStore_ReplayAfterCrash(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := open(t, dir, testConfig())
+	putAgent(t, s, "a1")
+	putAgent(t, s, "a2")
+	requireNoErr(t, s.DeleteAgent(ctx, "a2"))
+
+	sess, err := model.NewSession("s1", "u1", "c1", kind.Password, []byte("hash"), time.Now().Add(time.Hour))
+	requireNoErr(t, err)
+	requireNoErr(t, s.CreateSession(ctx, sess))
+	requireNoErr(t, s.RotateRefresh(ctx, sess.ID(), []byte("hash-2"), time.Now().Add(2*time.Hour)))
+
+	// No Close: dropping only the directory lock, as the kernel does when the process
+	// exits, and reopening simulates a crash.
+	requireNoErr(t, s.lock.Release())
+	re := open(t, dir, testConfig())
+
+	if _, err = re.GetAgent(ctx, "a1"); err != nil {
+		t.Fatalf("expected a1 to be replayed, err=%v", err)
+	}
+	if _, err = re.GetAgent(ctx, "a2"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected a2 deletion to be replayed, err=%v", err)
+	}
+	got, err := re.GetSession(ctx, sess.ID())
+	requireNoErr(t, err)
+	if string(got.RefreshHash()) != "hash-2" {
+		t.Fatalf("expected rotated refresh hash, got=%q", got.RefreshHash())
+	}
+	if rec := re.Recovery(); rec.Replayed != 5 || rec.LastSeq != 5 {
+		t.Fatalf("unexpected recovery: %+v", rec)
+	}
+}
+
+func TestStore_CompactDropsCoveredSegments(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := open(t, dir, testConfig())
+	putAgent(t, s, "a1")
+	putAgent(t, s, "a2")
+	requireNoErr(t, s.Compact(ctx))
+
+	putAgent(t, s, "a3")
+	requireNoErr(t, s.DeleteAgent(ctx, "a1"))
+
+	segments, err := listSegments(dir)
+	requireNoErr(t, err)
+	if len(segments) != 1 || segments[0].first != 3 {
+		t.Fatalf("expected a single segment starting at 3, got=%+v", segments)
+	}
+
+	requireNoErr(t, s.Close())
+	re := open(t, dir, testConfig())
+
+	rec := re.Recovery()
+	if rec.SnapshotSeq != 2 || rec.Replayed != 2 || rec.LastSeq != 4 {
+		t.Fatalf("unexpected recovery: %+v", rec)
+	}
+	res, err := re.ListAgents(ctx, nil, storage.ListOptions{})
+	requireNoErr(t, err)
+	if len(res.Items) != 2 {
+		t.Fatalf("expected 2 agents, got=%d", len(res.Items))
+	}
+	if _, err = re.GetAgent(ctx, "a1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected a1 to stay deleted, err=%v", err)
+	}
+
+	// Sequence continues after reopen.
+	putAgent(t, re, "a4")
+	requireNoErr(t, re.Close())
+	if rec = open(t, dir, testConfig()).Recovery(); rec.LastSeq != 5 {
+		t.Fatalf("expected LastSeq=5, got=%+v", rec)
+	}
+}
+
+func TestStore_CompactNoop(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s := open(t, dir, testConfig())
+	requireNoErr(t, s.Compact(context.Background()))
+
+	if _, err := os.Stat(dir + "/" + snapshotName); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no snapshot for an empty log, err=%v", err)
+	}
+}
+
+func TestOpen_TruncatedTail(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s := open(t, dir, testConfig())
+	putAgent(t, s, "a1")
+	putAgent(t, s, "a2")
+	requireNoErr(t, s.Close())
+
+	path := activeSegment(t, dir)
+	info, err := os.Stat(path)
+	requireNoErr(t, err)
+	requireNoErr(t, os.Truncate(path, info.Size()-3))
+
+	if _, err = Open(dir, testConfig()); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, err=%v", err)
+	}
+
+	cfg := testConfig()
+	cfg.RepairTail = true
+	re := open(t, dir, cfg)
+
+	rec := re.Recovery()
+	if !errors.Is(rec.TailErr, ErrTruncated) || rec.TruncatedBytes == 0 || rec.LastSeq != 1 {
+		t.Fatalf("unexpected recovery: %+v", rec)
+	}
+	if _, err = re.GetAgent(context.Background(), "a2"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected damaged record to be cut, err=%v", err)
+	}
+
+	// The repaired log accepts new records and reopens cleanly.
+	putAgent(t, re, "a3")
+	requireNoErr(t, re.Close())
+	if rec = open(t, dir, testConfig()).Recovery(); rec.LastSeq != 2 || rec.TailErr != nil {
+		t.Fatalf("unexpected recovery after repair: %+v", rec)
+	}
+}
+
+func TestOpen_CorruptTail(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s := open(t, dir, testConfig())
+	putAgent(t, s, "a1")
+	requireNoErr(t, s.Close())
+
+	path := activeSegment(t, dir)
+	data, err := os.ReadFile(path)
+	requireNoErr(t, err)
+	data[len(data)-2] ^= 0xff
+	requireNoErr(t, os.WriteFile(path, data, 0o600))
+
+	if _, err = Open(dir, testConfig()); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, err=%v", err)
+	}
+}
+
+func TestOpen_CorruptSnapshot(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s := open(t, dir, testConfig())
+	putAgent(t, s, "a1")
+	requireNoErr(t, s.Compact(context.Background()))
+	requireNoErr(t, s.Close())
+
+	path := dir + "/" + snapshotName
+	data, err := os.ReadFile(path)
+	requireNoErr(t, err)
+	// Drop the trailer line.
+	requireNoErr(t, os.WriteFile(path, data[:len(data)-len(`{"end":true,"count":1}`)-1], 0o600))
+
+	if _, err = Open(dir, testConfig()); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, err=%v", err)
+	}
+}
+
+func TestStore_ClosedRejectsWrites(t *testing.T) {
+	t.Parallel()
+
+	s := open(t, t.TempDir(), testConfig())
+	requireNoErr(t, s.Close())
+
+	a, err := model.NewAgent("a1", "agent-1", "http://a1")
+	requireNoErr(t, err)
+	if err = s.UpsertAgent(context.Background(), a); !errors.Is(err, storage.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, err=%v", err)
+	}
+}
+
+func TestStore_TxReplayedAsOneRecord(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := open(t, dir, testConfig())
+	putAgent(t, s, "a1")
+	err := s.InTx(ctx, func(tx storage.Tx) error {
+		if err := tx.DeleteAgent(ctx, "a1"); err != nil {
+			return err
+		}
+		a, err := model.NewAgent("a2", "agent-a2", "http://a2")
+		if err != nil {
+			return err
+		}
+		return tx.UpsertAgent(ctx, a)
+	})
+	requireNoErr(t, err)
+	requireNoErr(t, s.Close())
+
+	re := open(t, dir, testConfig())
+	if rec := re.Recovery(); rec.Replayed != 2 || rec.LastSeq != 2 {
+		t.Fatalf("unexpected recovery: %+v", rec)
+	}
+	if _, err = re.GetAgent(ctx, "a1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected a1 deletion to be replayed, err=%v", err)
+	}
+	if _, err = re.GetAgent(ctx, "a2"); err != nil {
+		t.Fatalf("expected a2 to be replayed, err=%v", err)
+	}
+
+	// A torn transaction frame is cut as a whole.
+	requireNoErr(t, re.Close())
+	path := activeSegment(t, dir)
+	info, err := os.Stat(path)
+	requireNoErr(t, err)
+	requireNoErr(t, os.Truncate(path, info.Size()-3))
+
+	cfg := testConfig()
+	cfg.RepairTail = true
+	cut := open(t, dir, cfg)
+	if _, err = cut.GetAgent(ctx, "a1"); err != nil {
+		t.Fatalf("expected a1 to survive the cut transaction, err=%v", err)
+	}
+	if _, err = cut.GetAgent(ctx, "a2"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected a2 to be cut with its transaction, err=%v", err)
+	}
+}
+
+func TestStore_RewrapRotatesKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	k1, k2 := bytes.Repeat([]byte{1}, keyring.KeySize), bytes.Repeat([]byte{2}, keyring.KeySize)
+
+	path := filepath.Join(dir, "kek")
+	writeKeys := func(lines ...string) {
+		requireNoErr(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600))
+	}
+	writeKeys("k1:" + base64.StdEncoding.EncodeToString(k1))
+	keys, err := keyring.LoadFile(path)
+	requireNoErr(t, err)
+
+	cfg := testConfig()
+	cfg.Codec = codec.New(keys)
+	s, err := Open(filepath.Join(dir, "wal"), cfg)
+	requireNoErr(t, err)
+
+	v, err := model.NewVerifier("v1", "c1", kind.Password)
+	requireNoErr(t, err)
+	requireNoErr(t, v.DataSet("hash", "$2a$hash"))
+	requireNoErr(t, s.UpsertVerifier(ctx, v))
+	requireNoErr(t, s.Compact(ctx))
+	putAgent(t, s, "a1")
+
+	// Rotate without reopening: reload the keyring, then rewrap.
+	writeKeys("k2:"+base64.StdEncoding.EncodeToString(k2), "k1:"+base64.StdEncoding.EncodeToString(k1))
+	requireNoErr(t, keys.Reload())
+	requireNoErr(t, s.Rewrap(ctx))
+	requireNoErr(t, s.Close())
+
+	// k1 can be retired: nothing on disk is sealed under it anymore.
+	writeKeys("k2:" + base64.StdEncoding.EncodeToString(k2))
+	requireNoErr(t, keys.Reload())
+	reopened := open(t, filepath.Join(dir, "wal"), cfg)
+	got, err := reopened.GetVerifier(ctx, "v1")
+	requireNoErr(t, err)
+	if h, _ := got.DataGet("hash"); h != "$2a$hash" {
+		t.Fatalf("expected the verifier data after rewrap, got=%q", h)
+	}
+	if _, err = reopened.GetAgent(ctx, "a1"); err != nil {
+		t.Fatalf("expected a1 after rewrap, err=%v", err)
+	}
+}
+
+func TestOpen_DirLocked(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	s, err := Open(dir, testConfig())
+	requireNoErr(t, err)
+
+	if _, err = Open(dir, testConfig()); !errors.Is(err, dirlock.ErrLocked) {
+		t.Fatalf("expected ErrLocked while the store is open, err=%v", err)
+	}
+	requireNoErr(t, s.Close())
+	open(t, dir, testConfig())
+}
@@ -0,0 +1,80 @@
+package storage
+
+import "context"
+
+// EventType describes what happened to an entity.
+type EventType uint8
+
+const (
+	// EventCreated reports an entity that did not exist before the write.
+	EventCreated EventType = iota + 1
+	// EventUpdated reports a replacement of an existing entity.
+	EventUpdated
+	// EventDeleted reports the removal of an entity.
+	EventDeleted
+)
+
+// String returns the human-readable event type label.
+func (t EventType) String() string {
+	switch t {
+	case EventCreated:
+		return "created"
+	case EventUpdated:
+		return "updated"
+	case EventDeleted:
+		return "deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a single committed change of a stored entity.
+type Event struct {
+	// Object is a clone of the entity after the change (for EventDeleted, its last stored state).
+	// The concrete type matches Kind (e.g. *model.Rollout for KindRollout).
+	Object any
+	// ID is the identifier of the changed entity.
+	ID string
+	// Kind is the collection of the changed entity.
+	Kind Kind
+	// Revision is the store revision of the change.
+	// For created and updated entities it equals Object's resource version.
+	Revision uint64
+	// Type tells whether the entity was created, updated or deleted.
+	Type EventType
+}
+
+// Watcher streams changes of stored entities.
+//
+// Every committed write consumes one store revision and produces exactly one event,
+// so revisions of a single watch are strictly increasing. The usual pattern to observe
+// a collection without gaps is:
+//
+//	rev, _ := store.Revision(ctx)
+//	list … (may already include changes after rev)
+//	events, _ := store.Watch(ctx, kind, filter, rev)
+type Watcher interface {
+	// Revision returns the revision of the latest committed write.
+	//
+	// Returns:
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	Revision(ctx context.Context) (uint64, error)
+
+	// Watch streams events for entities of kind k that match filter.
+	//
+	// filter is the backend-specific list filter of that kind (e.g. the storage.RolloutFilter
+	// accepted by ListRollouts) or nil; kinds without a list filter accept only nil.
+	// Deleted entities are matched against their last stored state.
+	//
+	// With fromRevision = 0 only future changes are delivered. Otherwise, the changes after
+	// fromRevision are replayed first, then live changes follow.
+	//
+	// The channel is closed when ctx is done or when the consumer falls too far behind;
+	// callers then list again and resume watching from the last revision they processed.
+	//
+	// Returns:
+	//   - ErrInvalidArgument if the kind is unknown or the filter type is incompatible.
+	//   - ErrCompacted if changes after fromRevision are no longer retained.
+	//   - ErrUnavailable if the backend is temporarily unavailable.
+	Watch(ctx context.Context, k Kind, filter any, fromRevision uint64) (<-chan Event, error)
+}
@@ -41,3 +41,32 @@ func UnaryRecovery(logger zerolog.Logger) grpc.UnaryServerInterceptor {
 		return handler(ctx, req)
 	}
 }
+
+// StreamRecovery returns a stream server interceptor that catches panics,
+// logs them with a stack trace, and ends the stream with codes.Internal.
+func StreamRecovery(logger zerolog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+
+			ctx := ss.Context()
+			stack := debug.Stack()
+			evt := logger.Error().
+				Str("method", info.FullMethod).
+				Str("panic", fmt.Sprintf("%v", rec)).
+				Bytes("stack", stack)
+
+			if rid, ok := transportctx.RequestID(ctx); ok {
+				evt = evt.Str("request_id", rid)
+			}
+
+			evt.Msg("panic recovered")
+			err = status.Errorf(ctx, codes.Internal, "internal error")
+		}()
+
+		return handler(srv, ss)
+	}
+}
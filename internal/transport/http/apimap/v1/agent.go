@@ -27,6 +27,7 @@ func Agent(a *model.Agent) restv1.Agent {
 		Endpoint:     a.Endpoint(),
 		EndpointType: string(a.EndpointType()),
 		APIVersion:   a.APIVersion().String(),
+		Delivery:     string(a.Delivery()),
 
 		Status:            a.Status().String(),
 		LastSeenAt:        a.LastSeenAt().Format(time.RFC3339),
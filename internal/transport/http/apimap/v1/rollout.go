@@ -7,11 +7,16 @@ import (
 	"github.com/soltiHQ/control-plane/domain/model"
 )
 
-// RolloutSpec maps a domain Spec and its rollouts to the composite DTO.
-func RolloutSpec(ts *model.Spec, states []*model.Rollout) restv1.RolloutSpec {
+// RolloutSpec maps a domain Spec, its current deployment (nil if never deployed) and its
+// rollouts to the composite DTO.
+func RolloutSpec(ts *model.Spec, d *model.Deployment, states []*model.Rollout) restv1.RolloutSpec {
 	dto := restv1.RolloutSpec{
 		Spec: Spec(ts),
 	}
+	if d != nil {
+		dep := Deployment(d)
+		dto.Deployment = &dep
+	}
 	if len(states) > 0 {
 		dto.Entries = make([]restv1.RolloutEntry, 0, len(states))
 		for _, ss := range states {
@@ -21,6 +26,21 @@ func RolloutSpec(ts *model.Spec, states []*model.Rollout) restv1.RolloutSpec {
 	return dto
 }
 
+// Deployment maps a domain Deployment to its REST DTO.
+func Deployment(d *model.Deployment) restv1.Deployment {
+	if d == nil {
+		return restv1.Deployment{}
+	}
+	return restv1.Deployment{
+		SpecID:    d.SpecID(),
+		Version:   d.Version(),
+		State:     d.State().String(),
+		Actor:     d.Actor(),
+		CreatedAt: d.CreatedAt().Format(time.RFC3339),
+		UpdatedAt: d.UpdatedAt().Format(time.RFC3339),
+	}
+}
+
 // RolloutEntry maps a domain Rollout to its REST rollout entry DTO.
 func RolloutEntry(ss *model.Rollout) restv1.RolloutEntry {
 	if ss == nil {
@@ -31,6 +51,7 @@ func RolloutEntry(ss *model.Rollout) restv1.RolloutEntry {
 		DesiredVersion: ss.DesiredVersion(),
 		ActualVersion:  ss.ActualVersion(),
 		Attempts:       ss.Attempts(),
+		Wave:           ss.Wave(),
 		AgentID:        ss.AgentID(),
 	}
 	if !ss.LastPushedAt().IsZero() {
@@ -39,8 +60,26 @@ func RolloutEntry(ss *model.Rollout) restv1.RolloutEntry {
 	if !ss.LastSyncedAt().IsZero() {
 		dto.LastSyncedAt = ss.LastSyncedAt().Format(time.RFC3339)
 	}
+	if !ss.NextAttemptAt().IsZero() {
+		dto.NextAttemptAt = ss.NextAttemptAt().Format(time.RFC3339)
+	}
 	if ss.Error() != "" {
 		dto.Error = ss.Error()
 	}
 	return dto
 }
+
+// DeployPlanEntry maps the planned action for one agent to its REST DTO;
+// current is the agent's existing rollout (nil if one would be created).
+func DeployPlanEntry(agentID, action string, current *model.Rollout, wave int) restv1.DeployPlanEntry {
+	dto := restv1.DeployPlanEntry{
+		AgentID: agentID,
+		Action:  action,
+		Wave:    wave,
+	}
+	if current != nil {
+		dto.Status = current.Status().String()
+		dto.CurrentVersion = current.ActualVersion()
+	}
+	return dto
+}
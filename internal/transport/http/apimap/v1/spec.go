@@ -36,8 +36,51 @@ func Spec(ts *model.Spec) restv1.Spec {
 		RunnerLabels: ts.RunnerLabels(),
 
 		CreateSpec: ts.ToCreateSpec(),
+		Strategy:   RolloutStrategy(ts.Strategy()),
 
 		CreatedAt: ts.CreatedAt().Format(time.RFC3339),
 		UpdatedAt: ts.UpdatedAt().Format(time.RFC3339),
 	}
 }
+
+// RolloutStrategy maps a domain RolloutStrategy to its REST DTO (nil when deploys go to all targets at once).
+func RolloutStrategy(s model.RolloutStrategy) *restv1.RolloutStrategy {
+	if s == (model.RolloutStrategy{}) {
+		return nil
+	}
+	return &restv1.RolloutStrategy{
+		CanaryCount:    s.CanaryCount,
+		CanaryPercent:  s.CanaryPercent,
+		BatchSize:      s.BatchSize,
+		PauseMs:        s.PauseMs,
+		MaxUnavailable: s.MaxUnavailable,
+	}
+}
+
+// SpecRevision maps a domain SpecRevision and its changes against the previous version to its REST DTO.
+func SpecRevision(rev *model.SpecRevision, changes []model.SpecChange) restv1.SpecRevision {
+	if rev == nil {
+		return restv1.SpecRevision{}
+	}
+	dto := restv1.SpecRevision{
+		Version:   rev.Version(),
+		Author:    rev.Author(),
+		CreatedAt: rev.CreatedAt().Format(time.RFC3339),
+	}
+	if ts, err := rev.Spec(); err == nil {
+		dto.Spec = Spec(ts)
+	}
+	if len(changes) > 0 {
+		dto.Changes = SpecChanges(changes)
+	}
+	return dto
+}
+
+// SpecChanges maps domain spec changes to their REST DTOs.
+func SpecChanges(changes []model.SpecChange) []restv1.SpecChange {
+	out := make([]restv1.SpecChange, 0, len(changes))
+	for _, c := range changes {
+		out = append(out, restv1.SpecChange{Field: c.Field, From: c.From, To: c.To})
+	}
+	return out
+}
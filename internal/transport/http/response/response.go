@@ -18,9 +18,10 @@ import (
 )
 
 type errorBody struct {
-	Code      int    `json:"code"`
-	Message   string `json:"message,omitempty"`
-	RequestID string `json:"request_id,omitempty"`
+	Code      int               `json:"code"`
+	Message   string            `json:"message,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
 }
 
 // OK renders a 200 response.
@@ -75,6 +76,28 @@ func BadRequest(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode)
 	})
 }
 
+// Invalid renders a 400 response listing the invalid request fields and what is wrong with each.
+func Invalid(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode, fields map[string]string) {
+	httpctx.Responder(r.Context()).Respond(w, r, http.StatusBadRequest, &responder.View{
+		Data: errorBody{
+			Code:      http.StatusBadRequest,
+			Message:   "invalid fields",
+			RequestID: transportctx.TryRequestID(r.Context()),
+			Fields:    fields,
+		},
+		Component: func(m httpctx.RenderMode) templ.Component {
+			if m == httpctx.RenderPage {
+				return pageSystem.ErrorPage(
+					http.StatusBadRequest,
+					"Invalid request",
+					"Some fields of the request are invalid.",
+				)
+			}
+			return nil
+		}(mode),
+	})
+}
+
 // NotAllowed renders a 405 response.
 func NotAllowed(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode) {
 	httpctx.Responder(r.Context()).Respond(w, r, http.StatusMethodNotAllowed, &responder.View{
@@ -138,6 +161,27 @@ func Unauthorized(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMod
 	})
 }
 
+// Conflict renders a 409 response.
+func Conflict(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode) {
+	httpctx.Responder(r.Context()).Respond(w, r, http.StatusConflict, &responder.View{
+		Data: errorBody{
+			Code:      http.StatusConflict,
+			Message:   "conflict",
+			RequestID: transportctx.TryRequestID(r.Context()),
+		},
+		Component: func(m httpctx.RenderMode) templ.Component {
+			if m == httpctx.RenderPage {
+				return pageSystem.ErrorPage(
+					http.StatusConflict,
+					"Conflict",
+					"The resource was modified by someone else. Reload it and try again.",
+				)
+			}
+			return nil
+		}(mode),
+	})
+}
+
 // Unavailable renders a 503 response.
 func Unavailable(w http.ResponseWriter, r *http.Request, mode httpctx.RenderMode) {
 	httpctx.Responder(r.Context()).Respond(w, r, http.StatusServiceUnavailable, &responder.View{
@@ -36,6 +36,8 @@ const (
 
 	ApiSpecs = "/api/v1/specs"
 	ApiSpec  = "/api/v1/specs/"
+
+	ApiSystemBackup = "/api/v1/system/backup"
 )
 
 var (
@@ -52,8 +54,12 @@ var (
 	ApiAgentLabels    = func(id string) string { return ApiAgent + id + "/labels" }
 	ApiAgentTasks     = func(id string) string { return ApiAgent + id + "/tasks" }
 
-	PageSpecInfoByID = func(id string) string { return PageSpecInfo + id }
-	ApiSpecByID      = func(id string) string { return ApiSpec + id }
-	ApiSpecDeploy    = func(id string) string { return ApiSpec + id + "/deploy" }
-	ApiSpecSync      = func(id string) string { return ApiSpec + id + "/sync" }
+	PageSpecInfoByID  = func(id string) string { return PageSpecInfo + id }
+	ApiSpecByID       = func(id string) string { return ApiSpec + id }
+	ApiSpecDeploy     = func(id string) string { return ApiSpec + id + "/deploy" }
+	ApiSpecDeployPlan = func(id string) string { return ApiSpec + id + "/deploy?dryRun=true" }
+	ApiSpecDeployOp   = func(id, op string) string { return ApiSpec + id + "/deploy/" + op }
+	ApiSpecUndeploy   = func(id string) string { return ApiSpec + id + "/undeploy" }
+	ApiSpecRetry      = func(id string) string { return ApiSpec + id + "/retry" }
+	ApiSpecSync       = func(id string) string { return ApiSpec + id + "/sync" }
 )
@@ -20,6 +20,14 @@ func OpenEvent(name string) string {
 	return "$dispatch('modal:open:" + name + "')"
 }
 
+// OpenTrigger returns the hx-trigger value that fires every time the modal with the
+// given name is opened, so content inside it can be (re)loaded on open.
+//
+//	Example:  hx-trigger={ modal.OpenTrigger("deploy-spec") }
+func OpenTrigger(name string) string {
+	return "modal:open:" + name + " from:window"
+}
+
 // hxMethod returns a templ.Attributes map with the correct hx-* attribute
 // for the given HTTP method.
 //